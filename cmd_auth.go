@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// authCommand defines the "auth" subcommand, which sets up credentials and
+// saves them as named profiles that -credentials selects as profile:NAME.
+func authCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("auth", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(), "JSON configuration file holding the saved profiles")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: drive-downloader auth [flags] setup [setup flags] [credentials.json]")
+		fmt.Fprintln(out, "       drive-downloader auth [flags] list")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if *configPath == "" {
+			log.Fatal("-config is required: no user configuration directory")
+		}
+		args := fs.Args()
+		switch {
+		case len(args) >= 1 && args[0] == "setup":
+			if err := authSetup(*configPath, args[1:]); err != nil {
+				log.Fatal(err)
+			}
+		case len(args) == 1 && args[0] == "list":
+			config, err := loadJobs(*configPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			names := make([]string, 0, len(config.Profiles))
+			for name := range config.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("%s\t%s\n", name, config.Profiles[name])
+			}
+		default:
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+// Kinds of credentials files recognized by credentialsKind.
+const (
+	kindServiceAccount = "service_account"
+	kindAuthorizedUser = "authorized_user"
+	kindOAuthClient    = "oauth_client"
+)
+
+// credentialsKind returns the kind of a JSON credentials file: the "type" of
+// the credentials google.CredentialsFromJSON reads, such as service_account
+// or authorized_user, or kindOAuthClient for the client secrets of an OAuth
+// client, which still have to be authorized by a user.
+func credentialsKind(data []byte) (string, error) {
+	var creds struct {
+		Type      string          `json:"type"`
+		Installed json.RawMessage `json:"installed"`
+		Web       json.RawMessage `json:"web"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", fmt.Errorf("not a JSON credentials file: %w", err)
+	}
+	switch {
+	case creds.Type != "":
+		return creds.Type, nil
+	case creds.Installed != nil:
+		return kindOAuthClient, nil
+	case creds.Web != nil:
+		return "", errors.New(`this is a "Web application" OAuth client; create a "Desktop app" client instead, whose authorization completes on this machine`)
+	}
+	return "", errors.New("unrecognized credentials: expected a service account key or OAuth client secrets")
+}
+
+// authSetup walks the user through setting up credentials: it reads the
+// given credentials file, asking for it if not given, authorizes OAuth
+// clients in the browser, checks the credentials with a test request and
+// saves them as a profile of the configuration at configPath.
+func authSetup(configPath string, args []string) error {
+	fs := flag.NewFlagSet("auth setup", flag.ExitOnError)
+	profile := fs.String("profile", "default", "name of the profile to save")
+	scope := fs.String("scope", "readonly", `OAuth scope to authorize OAuth clients for: "readonly" or "full"`)
+	folder := fs.String("folder", "", "folder ID or link to check the credentials can access")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	scopeURL, err := parseScope(*scope)
+	if err != nil {
+		return fmt.Errorf("invalid -scope: %w", err)
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		fmt.Println("Create credentials in the Google Cloud Console (APIs & Services > Credentials), with the Drive API enabled:")
+		fmt.Println("a service account key to download folders shared with the service account,")
+		fmt.Println(`or an OAuth client ID of type "Desktop app" to download as yourself.`)
+		if path, err = prompt("Path to the downloaded JSON file: "); err != nil {
+			return err
+		}
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials: %w", err)
+	}
+	kind, err := credentialsKind(data)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	source := path
+	switch kind {
+	case kindServiceAccount:
+		fmt.Println("Found a service account key.")
+	case kindOAuthClient:
+		fmt.Println("Found OAuth client secrets, which you now authorize to access your Drive.")
+		if data, err = authorizeUser(ctx, data, scopeURL); err != nil {
+			return err
+		}
+		source = filepath.Join(filepath.Dir(configPath), "credentials-"+*profile+".json")
+		if err := os.MkdirAll(filepath.Dir(source), 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(source, data, 0o600); err != nil {
+			return fmt.Errorf("failed to save credentials: %w", err)
+		}
+		fmt.Printf("Saved your authorization to %s.\n", source)
+	default:
+		fmt.Printf("Found %s credentials.\n", kind)
+	}
+
+	driveClient, err := drive.NewClient(ctx, drive.WithCredentialsJSON(data), drive.WithScopes(scopeURL), drive.WithEndpoint(os.Getenv(endpointEnv)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize Google Drive client: %w", err)
+	}
+	about, err := driveClient.About(ctx)
+	if err != nil {
+		return fmt.Errorf("the credentials do not work: %w", err)
+	}
+	if about.User != nil {
+		fmt.Printf("Authenticated as: %s <%s>\n", about.User.DisplayName, about.User.EmailAddress)
+		if kind == kindServiceAccount {
+			fmt.Printf("Share the folders to download with %s (Viewer is enough).\n", about.User.EmailAddress)
+		}
+	}
+	if *folder != "" {
+		id, err := drive.ExtractFolderID(*folder)
+		if err != nil {
+			return fmt.Errorf("invalid -folder: %w", err)
+		}
+		name, err := driveClient.FolderName(ctx, id)
+		if err != nil {
+			return fmt.Errorf("the credentials cannot access folder %s: %w", id, err)
+		}
+		fmt.Printf("Folder %q is accessible.\n", name)
+	}
+
+	config, err := loadJobs(configPath)
+	if err != nil {
+		return err
+	}
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]string)
+	}
+	config.Profiles[*profile] = source
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o700); err != nil {
+		return err
+	}
+	if err := config.Save(configPath); err != nil {
+		return err
+	}
+	fmt.Printf("Saved profile %q to %s; use it with -credentials profile:%s\n", *profile, configPath, *profile)
+	if configPath != defaultConfigPath() {
+		fmt.Printf("Give downloads -config %s, or set %s=%s, for -credentials to find it there.\n", configPath, configEnv, configPath)
+	}
+	return nil
+}
+
+// prompt prints message and returns the line the user answers.
+func prompt(message string) (string, error) {
+	fmt.Print(message)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if line = strings.TrimSpace(line); line == "" {
+		return "", errors.New("no answer given")
+	}
+	return line, nil
+}
+
+// authorizeUser has the user authorize an OAuth client of type "Desktop app"
+// in the browser, receiving the authorization code on a loopback address,
+// and returns the authorized user credentials as JSON, which
+// google.CredentialsFromJSON reads.
+func authorizeUser(ctx context.Context, clientSecrets []byte, scope string) ([]byte, error) {
+	config, err := google.ConfigFromJSON(clientSecrets, scope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OAuth client secrets: %w", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	config.RedirectURL = "http://" + listener.Addr().String()
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	state := hex.EncodeToString(nonce)
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var res result
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "Unexpected request.", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			res.err = fmt.Errorf("authorization denied: %s", query.Get("error"))
+			fmt.Fprintln(w, "Authorization denied. You can close this window.")
+		default:
+			res.code = query.Get("code")
+			fmt.Fprintln(w, "drive-downloader is authorized. You can close this window.")
+		}
+		select {
+		case results <- res:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Printf("Open this link in a browser and allow access:\n\n  %s\n\nWaiting for the authorization...\n",
+		config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce))
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	token, err := config.Exchange(ctx, res.code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain a token: %w", err)
+	}
+	if token.RefreshToken == "" {
+		return nil, errors.New("no refresh token was issued; revoke the access of the app in your Google account and try again")
+	}
+	return json.MarshalIndent(map[string]string{
+		"type":          kindAuthorizedUser,
+		"client_id":     config.ClientID,
+		"client_secret": config.ClientSecret,
+		"refresh_token": token.RefreshToken,
+	}, "", "  ")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// bundleCommand defines the "bundle" subcommand, which downloads the My
+// Drive, shared and starred items of a user into a directory with an HTML
+// index, like Google Takeout.
+func bundleCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	sections := fs.String("sections", "", `comma-separated sections to download: "my-drive", "shared" or "starred" (all by default)`)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader bundle [-sections LIST] <dest> [download flags]")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		selected, err := drive.ParseBundleSections(*sections)
+		if err != nil {
+			log.Fatalf("invalid -sections: %v", err)
+		}
+		if err := downloadBundle(fs.Arg(0), selected, fs.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// downloadBundle downloads the given sections into dest with the download
+// flags args. Only the flags that apply to every file of a download are
+// meaningful; those naming a folder or an archive are rejected.
+func downloadBundle(dest string, sections []string, args []string) error {
+	settings, err := parseDownloadFlags(args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(settings.folderLinks) > 0:
+		return errors.New("-folder cannot be given to bundle, which downloads every folder of the user")
+	case len(settings.sharedBy) > 0:
+		return errors.New("-shared-by cannot be given to bundle, whose shared section holds every shared item")
+	case settings.archive != "":
+		return errors.New("-archive cannot be combined with bundle")
+	case settings.afterDownload.Action != drive.AfterDownloadNone:
+		return errors.New("-after-download cannot be combined with bundle")
+	case settings.seed != nil:
+		return errors.New("-seed-manifest cannot be combined with bundle, whose sections are downloads of their own")
+	case settings.anonymous || settings.apiKey != "":
+		return errors.New("bundle requires credentials")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger := log.New(os.Stdout, "", 0)
+	driveClient, err := newDownloadClient(ctx, settings, logger)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, cmp.Or(settings.dirMode, os.ModePerm)); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+	if err := driveClient.DownloadBundle(ctx, dest, sections); err != nil {
+		return fmt.Errorf("failed to download bundle: %w", err)
+	}
+	logger.Printf("Downloaded %s into %s; open %s to browse it.", strings.Join(sections, ", "), dest, drive.BundleIndexName)
+	return nil
+}
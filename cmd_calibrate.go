@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// calibrateCommand defines the "calibrate" subcommand, which downloads a
+// sample of the files of a folder with several concurrencies and chunk sizes,
+// prints the throughput and error rate of each, and suggests the -concurrency
+// suiting the network and the account, optionally writing it to a
+// configuration file.
+func calibrateCommand() (*flag.FlagSet, func()) {
+	flags := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(flags)
+	concurrencies := flags.String("concurrency", "1,2,4,8,16", "comma-separated numbers of requests made at the same time to try")
+	chunkSizes := flags.String("chunk-sizes", "0,1M,16M", `comma-separated sizes of the ranges requested to try, 0 requesting whole files as downloads do`)
+	sampleBytes := flags.String("bytes", "32M", "bytes downloaded by every trial")
+	writeConfig := flags.String("write-config", "", "configuration file to write the suggested -concurrency to, as a default of -config")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: drive-downloader calibrate [flags] <folder>")
+		fmt.Fprintln(flags.Output(), "The folder should hold files as large as those usually downloaded; they are downloaded and discarded.")
+		flags.PrintDefaults()
+	}
+	return flags, func() {
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		var opts drive.CalibrateOptions
+		for _, s := range strings.Split(*concurrencies, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n < 1 {
+				log.Fatalf("invalid -concurrency: %q is not a positive number", s)
+			}
+			opts.Concurrencies = append(opts.Concurrencies, n)
+		}
+		for _, s := range strings.Split(*chunkSizes, ",") {
+			n, err := drive.ParseByteSize(s)
+			if err != nil {
+				log.Fatalf("invalid -chunk-sizes: %v", err)
+			}
+			opts.ChunkSizes = append(opts.ChunkSizes, n)
+		}
+		n, err := drive.ParseByteSize(*sampleBytes)
+		if err != nil || n == 0 {
+			log.Fatalf("invalid -bytes: %q is not a positive size", *sampleBytes)
+		}
+		opts.Bytes = n
+		folderID, err := drive.ExtractFolderID(flags.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		driveClient, err := newClient(*credentialsFilePath)
+		if err != nil {
+			log.Fatalf("Failed to initialize Google Drive client: %v", err)
+		}
+		driveClient.Logger = nil
+
+		trials, err := driveClient.Calibrate(context.Background(), folderID, opts)
+		if err != nil {
+			log.Fatalf("Calibration failed: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CONCURRENCY\tCHUNK\tTHROUGHPUT\tREQUESTS\tERRORS")
+		for _, t := range trials {
+			fmt.Fprintf(w, "%d\t%s\t%s/s\t%d\t%.1f%%\n", t.Concurrency, chunkSizeText(t.ChunkSize),
+				drive.FormatBytes(int64(t.Throughput())), t.Requests, 100*t.ErrorRate())
+		}
+		w.Flush()
+
+		best, ok := drive.BestTrial(trials)
+		if !ok {
+			log.Fatal("Every trial failed too often to suggest settings; check the network or try a lower -concurrency")
+		}
+		fmt.Printf("\nSuggested: -concurrency %d (%s/s", best.Concurrency, drive.FormatBytes(int64(best.Throughput())))
+		if best.ChunkSize > 0 {
+			fmt.Printf(" with %s requests; downloads request whole files", chunkSizeText(best.ChunkSize))
+		}
+		fmt.Println(")")
+		if *writeConfig != "" {
+			if err := saveConcurrency(*writeConfig, best.Concurrency); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Wrote -concurrency %d to %s.\n", best.Concurrency, *writeConfig)
+		}
+	}
+}
+
+// chunkSizeText describes a chunk size of the calibrate subcommand.
+func chunkSizeText(chunkSize int64) string {
+	if chunkSize == 0 {
+		return "whole files"
+	}
+	return drive.FormatBytes(chunkSize)
+}
+
+// saveConcurrency sets the default of the -concurrency flag in the
+// configuration file at path, creating it if needed.
+func saveConcurrency(path string, concurrency int) error {
+	config, err := LoadConfig(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		config, err = &Config{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if config.Flags == nil {
+		config.Flags = make(map[string]any)
+	}
+	config.Flags["concurrency"] = concurrency
+	return config.Save(path)
+}
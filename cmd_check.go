@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// checkColumns are the columns of the report of the check subcommand.
+var checkColumns = []string{"link", "id", "name", "list", "download", "why"}
+
+// checkCommand defines the "check" subcommand, which checks whether the
+// credentials can list and download every link of a file, one per line, so
+// that access problems are found before a batch of transfers is scheduled.
+// It exits with status 1 if any link is not accessible.
+func checkCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	format := fs.String("format", "table", `output format: "table" or "csv"`)
+	concurrency := fs.Int("concurrency", 8, "number of links checked at the same time")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader check [flags] <links-file>")
+		fmt.Fprintln(fs.Output(), "The links file holds a folder or file link per line; blank lines and lines starting with # are ignored.")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *format != "table" && *format != "csv" {
+			log.Fatalf("invalid -format: unknown report format %q", *format)
+		}
+		links, err := readLinks(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		driveClient, err := newClient(*credentialsFilePath)
+		if err != nil {
+			log.Fatalf("Failed to initialize Google Drive client: %v", err)
+		}
+		driveClient.Logger = nil
+
+		rows := checkLinks(context.Background(), driveClient, links, *concurrency)
+		if *format == "csv" {
+			err = writeCheckCSV(os.Stdout, rows)
+		} else {
+			err = writeCheckTable(os.Stdout, rows)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		for _, row := range rows {
+			if row[5] != "" {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// readLinks reads the links of a links file.
+func readLinks(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var links []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			links = append(links, line)
+		}
+	}
+	return links, scanner.Err()
+}
+
+// checkLinks checks the links concurrency at a time and returns a row of the
+// report per link, in their order. The last column, why, is empty for the
+// links that can be listed and downloaded.
+func checkLinks(ctx context.Context, driveClient *drive.Client, links []string, concurrency int) [][]string {
+	rows := make([][]string, len(links))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				rows[i] = checkLink(ctx, driveClient, links[i])
+			}
+		}()
+	}
+	for i := range links {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return rows
+}
+
+// checkLink returns the row of the report of a link.
+func checkLink(ctx context.Context, driveClient *drive.Client, link string) []string {
+	id, err := drive.ExtractID(link)
+	if err != nil {
+		return []string{link, "", "", "no", "no", err.Error()}
+	}
+	access := driveClient.CheckAccess(ctx, id)
+	list, download := "no", "no"
+	switch {
+	case !access.IsFolder():
+		list = "-"
+	case access.CanList:
+		list = "yes"
+	}
+	if access.CanDownload && access.Err == nil {
+		download = "yes"
+	}
+	var why string
+	switch {
+	case access.Err != nil:
+		why = fmt.Sprintf("%s: %v", drive.Failure{Err: access.Err}.Cause(), access.Err)
+	case !access.CanDownload:
+		why = "the owner disabled downloads for viewers"
+	}
+	return []string{link, id, access.Name, list, download, why}
+}
+
+// writeCheckTable writes the report as aligned columns.
+func writeCheckTable(w io.Writer, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(checkColumns, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeCheckCSV writes the report as CSV with a header row.
+func writeCheckCSV(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(checkColumns)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
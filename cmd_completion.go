@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// shells lists the shells completion scripts are generated for.
+var shells = []string{"bash", "zsh", "fish", "powershell"}
+
+// Hidden arguments of the completion subcommand that the scripts run to
+// complete the names of the profiles and jobs saved in the configuration.
+const (
+	completeProfiles = "__profiles"
+	completeJobs     = "__jobs"
+)
+
+func init() {
+	// Registered here rather than in commands itself, which the completion
+	// scripts are generated from.
+	commands["completion"] = completionCommand
+}
+
+// completionCommand defines the "completion" subcommand, which prints a
+// completion script for the given shell covering every subcommand and flag,
+// and the profile and job names of the configuration of defaultConfigPath.
+func completionCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: drive-downloader completion %s\n", strings.Join(shells, "|"))
+	}
+	return fs, func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		specs := completionSpecs()
+		switch fs.Arg(0) {
+		case "bash":
+			fmt.Print(bashCompletion(specs))
+		case "zsh":
+			fmt.Print("#compdef drive-downloader\n\nautoload -U +X bashcompinit && bashcompinit\n\n" + bashCompletion(specs))
+		case "fish":
+			fmt.Print(fishCompletion(specs))
+		case "powershell":
+			fmt.Print(powershellCompletion(specs))
+		case completeProfiles, completeJobs:
+			names, err := configNames(defaultConfigPath(), fs.Arg(0))
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, name := range names {
+				fmt.Println(name)
+			}
+		default:
+			log.Fatalf("unknown shell %q (want %s)", fs.Arg(0), strings.Join(shells, ", "))
+		}
+	}
+}
+
+// commandSpec describes a subcommand for completion. The download command,
+// run without a subcommand, has an empty name.
+type commandSpec struct {
+	name  string
+	flags []*flag.Flag
+}
+
+// completionSpecs returns the download command followed by every subcommand
+// in name order.
+func completionSpecs() []commandSpec {
+	fs, _ := downloadFlags()
+	specs := []commandSpec{{flags: flagsOf(fs)}}
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fs, _ := commands[name]()
+		specs = append(specs, commandSpec{name: name, flags: flagsOf(fs)})
+	}
+	return specs
+}
+
+// configNames returns the names of the profiles, for completeProfiles, or of
+// the jobs, for completeJobs, saved in the configuration at path, in order.
+func configNames(path, kind string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	config, err := loadJobs(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if kind == completeProfiles {
+		for name := range config.Profiles {
+			names = append(names, name)
+		}
+	} else {
+		for name := range config.Jobs {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// flagsOf returns the flags defined on fs, in name order.
+func flagsOf(fs *flag.FlagSet) []*flag.Flag {
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	return flags
+}
+
+// isBoolFlag reports whether a flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// flagChoicesPattern matches the list of accepted values in a flag's usage,
+// e.g. `: "png", "svg", "pdf" or "jpeg"`.
+var flagChoicesPattern = regexp.MustCompile(`: ("[^"]+"(?:, "[^"]+")*(?: or "[^"]+")?)`)
+
+// flagChoices returns the values a flag accepts if its usage lists them.
+func flagChoices(f *flag.Flag) []string {
+	match := flagChoicesPattern.FindStringSubmatch(f.Usage)
+	if match == nil {
+		return nil
+	}
+	var choices []string
+	for _, quoted := range regexp.MustCompile(`"([^"]+)"`).FindAllStringSubmatch(match[1], -1) {
+		choices = append(choices, quoted[1])
+	}
+	return choices
+}
+
+// flagNames returns the names of flags prefixed with a dash.
+func flagNames(flags []*flag.Flag) []string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.Name
+	}
+	return names
+}
+
+// bashCompletion returns a bash completion script. Flags taking a value
+// complete the values listed in their usage, or file names; -credentials
+// also completes profile:NAME, "auth setup -profile" the profile names and
+// "job run" and "job delete" the job names.
+func bashCompletion(specs []commandSpec) string {
+	var b strings.Builder
+	b.WriteString("# bash completion for drive-downloader\n")
+	b.WriteString("_drive_downloader() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    local cmd=\"${COMP_WORDS[1]}\" flags\n")
+	b.WriteString("    [[ $COMP_CWORD -eq 1 ]] && cmd=\"\"\n")
+	b.WriteString("    case \"$cmd\" in\n")
+	var subcommands []string
+	for _, spec := range specs[1:] {
+		subcommands = append(subcommands, spec.name)
+		fmt.Fprintf(&b, "    %s) flags=%q ;;\n", spec.name, strings.Join(flagNames(spec.flags), " "))
+	}
+	fmt.Fprintf(&b, "    *) cmd=\"\"; flags=%q ;;\n", strings.Join(flagNames(specs[0].flags), " "))
+	b.WriteString("    esac\n")
+
+	// The word being completed is taken from the line, as bash splits
+	// profile:NAME at the colon when COMP_WORDBREAKS holds one, in which case
+	// only the part after it is replaced.
+	b.WriteString("    local line=\"${COMP_LINE:0:COMP_POINT}\"\n")
+	b.WriteString("    local word=\"${line##* }\" before=\"${line% *}\"\n")
+	b.WriteString("    before=\"${before##* }\"\n")
+	b.WriteString("    if [[ $before == -credentials && $word == profile:* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"$(drive-downloader completion %s 2>/dev/null)\" -- \"${word#profile:}\"))\n", completeProfiles)
+	b.WriteString("        [[ $COMP_WORDBREAKS == *:* ]] || COMPREPLY=(\"${COMPREPLY[@]/#/profile:}\")\n")
+	b.WriteString("        return\n")
+	b.WriteString("    elif [[ $cmd == auth && $prev == -profile ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"$(drive-downloader completion %s 2>/dev/null)\" -- \"$cur\"))\n", completeProfiles)
+	b.WriteString("        return\n")
+	b.WriteString("    elif [[ $cmd == job && ($prev == run || $prev == delete) ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"$(drive-downloader completion %s 2>/dev/null)\" -- \"$cur\"))\n", completeJobs)
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+
+	// Flags with the same name take the same values in every command.
+	choices := make(map[string][]string)
+	var valueFlags []string
+	for _, spec := range specs {
+		for _, f := range spec.flags {
+			if isBoolFlag(f) {
+				continue
+			}
+			if values := flagChoices(f); values != nil {
+				choices["-"+f.Name] = values
+			} else {
+				valueFlags = append(valueFlags, "-"+f.Name)
+			}
+		}
+	}
+	b.WriteString("    case \"$prev\" in\n")
+	fmt.Fprintf(&b, "    -credentials) COMPREPLY=($(compgen -f -- \"$cur\") $(compgen -W \"$(drive-downloader completion %s 2>/dev/null | sed 's/^/profile:/')\" -- \"$cur\")); return ;;\n", completeProfiles)
+	names := make([]string, 0, len(choices))
+	for name := range choices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", name, strings.Join(choices[name], " "))
+	}
+	fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", strings.Join(uniqueSorted(valueFlags), "|"))
+	b.WriteString("    esac\n")
+	fmt.Fprintf(&b, "    if [[ $cmd == completion ]]; then\n        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(shells, " "))
+	fmt.Fprintf(&b, "    elif [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(subcommands, " "))
+	b.WriteString("    else\n        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n    fi\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o default -F _drive_downloader drive-downloader\n")
+	return b.String()
+}
+
+// fishCompletion returns a fish completion script, completing the profile
+// and job names like bashCompletion.
+func fishCompletion(specs []commandSpec) string {
+	var b strings.Builder
+	b.WriteString("# fish completion for drive-downloader\n")
+	var subcommands []string
+	for _, spec := range specs[1:] {
+		subcommands = append(subcommands, spec.name)
+	}
+	fmt.Fprintf(&b, "complete -c drive-downloader -n __fish_use_subcommand -f -a %s\n", fishQuote(strings.Join(subcommands, " ")))
+	fmt.Fprintf(&b, "complete -c drive-downloader -n '__fish_seen_subcommand_from completion' -f -a %s\n", fishQuote(strings.Join(shells, " ")))
+	fmt.Fprintf(&b, "complete -c drive-downloader -n '__fish_prev_arg_in -credentials' -f -a %s\n", fishQuote("(drive-downloader completion "+completeProfiles+" 2>/dev/null | string replace -r '^' profile:)"))
+	fmt.Fprintf(&b, "complete -c drive-downloader -n '__fish_seen_subcommand_from auth; and __fish_prev_arg_in -profile' -f -a %s\n", fishQuote("(drive-downloader completion "+completeProfiles+" 2>/dev/null)"))
+	fmt.Fprintf(&b, "complete -c drive-downloader -n '__fish_seen_subcommand_from job; and __fish_prev_arg_in run delete' -f -a %s\n", fishQuote("(drive-downloader completion "+completeJobs+" 2>/dev/null)"))
+	for _, spec := range specs {
+		condition := "__fish_seen_subcommand_from " + spec.name
+		if spec.name == "" {
+			condition = "not __fish_seen_subcommand_from " + strings.Join(subcommands, " ")
+		}
+		for _, f := range spec.flags {
+			fmt.Fprintf(&b, "complete -c drive-downloader -n %s -o %s -d %s", fishQuote(condition), f.Name, fishQuote(f.Usage))
+			if values := flagChoices(f); values != nil {
+				fmt.Fprintf(&b, " -x -a %s", fishQuote(strings.Join(values, " ")))
+			} else if !isBoolFlag(f) {
+				b.WriteString(" -r -F")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// powershellCompletion returns a PowerShell completion script, completing
+// the profile and job names like bashCompletion.
+func powershellCompletion(specs []commandSpec) string {
+	var b strings.Builder
+	b.WriteString("# PowerShell completion for drive-downloader\n")
+	b.WriteString("Register-ArgumentCompleter -Native -CommandName drive-downloader, drive-downloader.exe -ScriptBlock {\n")
+	b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	b.WriteString("    $commands = @{\n")
+	var subcommands []string
+	for _, spec := range specs {
+		if spec.name != "" {
+			subcommands = append(subcommands, spec.name)
+		}
+		fmt.Fprintf(&b, "        %s = @(%s)\n", psQuote(spec.name), psList(flagNames(spec.flags)))
+	}
+	b.WriteString("    }\n")
+	b.WriteString("    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })\n")
+	b.WriteString("    $cmd = ''\n")
+	b.WriteString("    if ($words.Count -gt 1 -and $commands.ContainsKey($words[1]) -and $words[1] -ne $wordToComplete) { $cmd = $words[1] }\n")
+	b.WriteString("    $candidates = $commands[$cmd]\n")
+	fmt.Fprintf(&b, "    if ($cmd -eq 'completion') { $candidates = @(%s) }\n", psList(shells))
+	fmt.Fprintf(&b, "    elseif ($cmd -eq '' -and $words.Count -le 2) { $candidates += @(%s) }\n", psList(subcommands))
+	b.WriteString("    $prev = if ($wordToComplete -eq '') { $words[-1] } elseif ($words.Count -ge 2) { $words[-2] }\n")
+	fmt.Fprintf(&b, "    if ($prev -eq '-credentials') { $candidates = @(drive-downloader completion %s 2>$null | ForEach-Object { \"profile:$_\" }) }\n", completeProfiles)
+	fmt.Fprintf(&b, "    elseif ($cmd -eq 'auth' -and $prev -eq '-profile') { $candidates = @(drive-downloader completion %s 2>$null) }\n", completeProfiles)
+	fmt.Fprintf(&b, "    elseif ($cmd -eq 'job' -and ($prev -eq 'run' -or $prev -eq 'delete')) { $candidates = @(drive-downloader completion %s 2>$null) }\n", completeJobs)
+	b.WriteString("    $candidates | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	b.WriteString("        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// uniqueSorted returns the distinct strings of s in order.
+func uniqueSorted(s []string) []string {
+	sort.Strings(s)
+	var unique []string
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// fishQuote quotes a string for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// psQuote quotes a string for PowerShell.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// psList formats strings as the elements of a PowerShell array.
+func psList(s []string) string {
+	quoted := make([]string, len(s))
+	for i, v := range s {
+		quoted[i] = psQuote(v)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompletionConfigNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := &Config{
+		Profiles: map[string]string{"work": "env:KEY", "home": "key.json"},
+		Jobs:     map[string]map[string]any{"nightly": {"folder": "ID"}},
+	}
+	if err := config.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	for kind, want := range map[string][]string{
+		completeProfiles: {"home", "work"},
+		completeJobs:     {"nightly"},
+	} {
+		got, err := configNames(path, kind)
+		if err != nil {
+			t.Fatalf("configNames(%s): %v", kind, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("configNames(%s) = %q, want %q", kind, got, want)
+		}
+	}
+	// A missing configuration has no names to complete.
+	if got, err := configNames(filepath.Join(t.TempDir(), "missing.json"), completeProfiles); err != nil || len(got) != 0 {
+		t.Errorf("configNames of a missing file = %q, %v, want none", got, err)
+	}
+}
+
+func TestCompletionScriptsCompleteNames(t *testing.T) {
+	specs := completionSpecs()
+	scripts := map[string]string{
+		"bash":       bashCompletion(specs),
+		"fish":       fishCompletion(specs),
+		"powershell": powershellCompletion(specs),
+	}
+	for shell, script := range scripts {
+		for _, arg := range []string{completeProfiles, completeJobs} {
+			if !strings.Contains(script, "drive-downloader completion "+arg) {
+				t.Errorf("the %s script never runs completion %s", shell, arg)
+			}
+		}
+	}
+}
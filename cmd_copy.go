@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// copyCommand defines the "copy" subcommand, which copies a Drive folder
+// into another Drive folder server-side, e.g. to snapshot a shared folder
+// into one's own Drive before it disappears.
+func copyCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader copy [flags] <srcFolder> <dstFolder>")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		srcID, err := drive.ExtractFolderID(fs.Arg(0))
+		if err != nil {
+			log.Fatalf("Invalid source folder: %v", err)
+		}
+		dstID, err := drive.ExtractFolderID(fs.Arg(1))
+		if err != nil {
+			log.Fatalf("Invalid destination folder: %v", err)
+		}
+
+		driveClient, err := newClient(*credentialsFilePath, drive.WithScopes(drive.FullScope))
+		if err != nil {
+			log.Fatalf("Failed to initialize Google Drive client: %v", err)
+		}
+		copyID, err := driveClient.CopyFolder(context.Background(), srcID, dstID)
+		if err != nil {
+			var copyErr *drive.CopyError
+			if errors.As(err, &copyErr) {
+				for _, failure := range copyErr.Failures {
+					log.Printf("  %s: %v", failure.Path, failure.Err)
+				}
+			}
+			log.Fatalf("Failed to copy folder: %v", err)
+		}
+		fmt.Printf("Copy completed successfully: https://drive.google.com/drive/folders/%s\n", copyID)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// diffCommand defines the "diff" subcommand, which compares two folder trees,
+// each either a Drive folder link or a local directory, and reports files
+// present on only one side or differing in size or checksum. It exits with
+// status 1 if the trees differ.
+func diffCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader diff [flags] <folderA> <folderB>")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		var driveClient *drive.Client
+		trees := make([]drive.Tree, 2)
+		for i, location := range fs.Args() {
+			folderID, err := drive.ExtractFolderID(location)
+			if err != nil {
+				if trees[i], err = drive.LocalTree(location); err != nil {
+					log.Fatalf("Failed to read local folder: %v", err)
+				}
+				continue
+			}
+			if driveClient == nil {
+				if driveClient, err = newClient(*credentialsFilePath); err != nil {
+					log.Fatalf("Failed to initialize Google Drive client: %v", err)
+				}
+				driveClient.Logger = nil
+			}
+			if trees[i], err = driveClient.RemoteTree(context.Background(), folderID); err != nil {
+				log.Fatalf("Failed to list Drive folder: %v", err)
+			}
+		}
+
+		diff := drive.DiffTrees(trees[0], trees[1])
+		for _, path := range diff.OnlyInA {
+			fmt.Printf("Only in A: %s\n", path)
+		}
+		for _, path := range diff.OnlyInB {
+			fmt.Printf("Only in B: %s\n", path)
+		}
+		for _, path := range diff.Differ {
+			a, b := trees[0][path], trees[1][path]
+			fmt.Printf("Differs:   %s (%d bytes, md5 %s vs %d bytes, md5 %s)\n", path, a.Size, a.MD5, b.Size, b.MD5)
+		}
+		fmt.Printf("%d only in A, %d only in B, %d differing\n", len(diff.OnlyInA), len(diff.OnlyInB), len(diff.Differ))
+		if !diff.Empty() {
+			os.Exit(1)
+		}
+	}
+}
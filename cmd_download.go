@@ -0,0 +1,957 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// downloadSettings holds the parsed flags of the default download command.
+type downloadSettings struct {
+	folderLinks     []string
+	sharedBy        []string
+	subject         string
+	credentials     string
+	configPath      string
+	anonymous       bool
+	apiKey          string
+	scope           string
+	spaces          []string
+	dest            string
+	noRootFolder    bool
+	duplicates      drive.DuplicatePolicy
+	maxDepth        int
+	modifiedAfter   time.Time
+	modifiedBefore  time.Time
+	createdAfter    time.Time
+	owner           string
+	notOwner        string
+	properties      map[string]string
+	appProperties   map[string]string
+	labels          []drive.LabelFilter
+	sparse          *drive.Sparse
+	normalization   drive.Normalization
+	drawingFormat   drive.DrawingFormat
+	sheetFormat     drive.SheetFormat
+	sheetValuesOnly bool
+	pdf             drive.PDFOptions
+	sidecars        bool
+	comments        drive.CommentsFormat
+	linkStubs       drive.LinkStubs
+	compression     drive.Compression
+	encryption      *drive.Encryption
+	layout          drive.Layout
+	extractImages   bool
+	autoExtract     bool
+	discardArchives bool
+	routes          []drive.Route
+	caseInsensitive bool
+	fixExtensions   bool
+	sniffExtensions bool
+	maxPathLength   int
+	fileMode        os.FileMode
+	dirMode         os.FileMode
+	ownership       *drive.Ownership
+	fsync           bool
+	preallocate     bool
+	concurrency     int
+	bandwidthLimit  int64
+	classes         []drive.TransferClass
+	exportWorkers   int
+	priorities      []drive.PathPriority
+	exportRate      float64
+	verifyWorkers   int
+	archive         string
+	volumeSize      int64
+	probeSize       int64
+	seed            *drive.Manifest
+	explainAPI      bool
+	estimate        bool
+	yes             bool
+	debug           drive.Debug
+	statusFile      string
+	metricsCSV      string
+	skipSuspended   bool
+	restrictedList  string
+	afterDownload   drive.AfterDownload
+	preCmd          string
+	postCmd         string
+	onFailureCmd    string
+	ackAbuse        bool
+	notifyWebhook   string
+	notifyEmail     string
+	reports         []string
+	smtpServer      string
+	smtpFrom        string
+	smtpUser        string
+	userAgent       string
+	endpoint        string
+	proxy           string
+	dnsServer       string
+	hosts           map[string]string
+	quotaUser       string
+	quotaProject    string
+
+	watch        time.Duration
+	pidFile      string
+	syslog       bool
+	runAsService bool
+}
+
+// parseDownloadFlags parses the command line of the download command. Flags
+// that are not given explicitly take their value from the -config file, if
+// one is given.
+func parseDownloadFlags(args []string) (*downloadSettings, error) {
+	fs, settings := downloadFlags()
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return settings()
+}
+
+// downloadFlags defines the flags of the download command on a new flag set
+// and returns it together with the function converting them to settings once
+// they are parsed.
+func downloadFlags() (*flag.FlagSet, func() (*downloadSettings, error)) {
+	fs := flag.NewFlagSet("drive-downloader", flag.ContinueOnError)
+	var driveFolderLinks folderList
+	fs.Var(&driveFolderLinks, "folder", "Google Drive folder link; repeat it or separate links with commas to download several folders at once")
+	sharedBy := fs.String("shared-by", "", "instead of a folder, download the items shared with you by the users with these comma-separated email addresses, each into a directory of -dest named after them")
+	credentialsFilePath := credentialsFlag(fs)
+	anonymous := fs.Bool("anonymous", false, `download a folder shared with "anyone with the link" without credentials`)
+	apiKey := fs.String("api-key", "", `API key for downloading a folder shared with "anyone with the link" through the Drive API`)
+	subject := fs.String("subject", "", "email address of the user to act as, through the domain-wide delegation of the service account")
+	scope := fs.String("scope", "readonly", `OAuth scope to request: "readonly" or "full"`)
+	spaces := fs.String("spaces", "", `comma-separated Drive spaces to list folders in: "drive", "photos" or "appDataFolder"`)
+	downloadPath := fs.String("dest", ".", "local directory to download into")
+	noRootFolder := fs.Bool("no-root-folder", false, "download into -dest itself rather than into a subdirectory named after the folder when -dest exists, merging several folders")
+	duplicates := fs.String("duplicates", "suffix", `how to rename colliding files: "suffix" or "id"`)
+	maxDepth := fs.Int("max-depth", -1, "maximum number of subfolder levels to download (-1 for unlimited)")
+	modifiedAfter := fs.String("modified-after", "", "only download files modified after this date or RFC 3339 time")
+	modifiedBefore := fs.String("modified-before", "", "only download files modified before this date or RFC 3339 time")
+	createdAfter := fs.String("created-after", "", "only download files created after this date or RFC 3339 time")
+	owner := fs.String("owner", "", "only download files owned by the user with this email address")
+	notOwner := fs.String("not-owner", "", "skip files owned by the user with this email address")
+	properties := fs.String("property", "", `only download files with these comma-separated custom properties, e.g. "classification=public"`)
+	appProperties := fs.String("app-property", "", `only download files with these comma-separated app properties, e.g. "classification=public"`)
+	sparse := fs.String("sparse", "", "only download the paths included by this sparse specification, a file of patterns like a git sparse-checkout (defaults to "+drive.SparseName+" in -dest, if any)")
+	labels := fs.String("label", "", `only download files with these comma-separated Drive labels: label IDs, or "ID.FIELD=VALUE" for a field value`)
+	noRecursive := fs.Bool("no-recursive", false, "only download the top level of the folder")
+	normalization := fs.String("normalize", "none", `Unicode normalization of local names: "none", "nfc" or "nfd"`)
+	drawingFormat := fs.String("drawing-format", "png", `format Google Drawings are exported in: "png", "svg", "pdf" or "jpeg"`)
+	sheetFormat := fs.String("sheet-format", "xlsx", `format Google Sheets are exported in: "xlsx", "ods" or "pdf"`)
+	sheetValuesOnly := fs.Bool("sheets-values-only", false, "export Google Sheets with the computed values of their cells instead of their formulas")
+	pdfPaper := fs.String("pdf-paper", "", `paper size of Sheets exported as PDF, e.g. "a4" or "letter"`)
+	pdfLandscape := fs.Bool("pdf-landscape", false, "lay out Sheets exported as PDF in landscape")
+	pdfGridlines := fs.Bool("pdf-gridlines", true, "print cell gridlines in Sheets exported as PDF")
+	sidecars := fs.Bool("xmp-sidecars", false, "write an XMP sidecar with the Drive metadata next to every photo and video")
+	extractImages := fs.Bool("extract-images", false, "also save the images embedded in Docs and Slides at original resolution in an assets/ folder")
+	autoExtract := fs.Bool("auto-extract", false, "extract downloaded .zip and .tar.gz archives into a directory named after them")
+	discardArchives := fs.Bool("discard-archives", false, "with -auto-extract, delete archives once extracted")
+	comments := fs.String("export-comments", "", `write the comments of every Google document to a sidecar next to it: "json" or "markdown"`)
+	linkStubs := fs.String("write-link-stubs", "none", `write Drive for desktop link stubs (.gdoc, .gsheet, ...) for Google documents: "none", "alongside" or "only"`)
+	caseInsensitive := fs.Bool("case-insensitive", drive.DefaultCaseInsensitive(), "treat names differing only in case as colliding")
+	fixExtensions := fs.Bool("fix-extensions", false, "append the extension of their MIME type to files named without one or with a wrong one")
+	sniffExtensions := fs.Bool("sniff-extensions", false, "with -fix-extensions, detect the type of files Drive only reports as binary data from their first bytes")
+	compress := fs.String("compress", "", `compress every file as it is written: "gzip" or "zstd"`)
+	encrypt := fs.String("encrypt", "", `encrypt every file as it is written, with "age:RECIPIENT" or "gpg:RECIPIENT"`)
+	layout := fs.String("layout", "tree", `how files are stored: "tree", at their paths, or "cas", as deduplicated objects named after their SHA-256 checksum with a tree mapping paths to them`)
+	fileMode := fs.String("file-mode", "", "octal permission bits of downloaded files (e.g. 0644), regardless of the umask")
+	dirMode := fs.String("dir-mode", "", "octal permission bits of created directories (e.g. 0755), regardless of the umask")
+	uid := fs.Int("uid", -1, "user ID to give downloaded files and directories (Unix only, -1 to keep)")
+	gid := fs.Int("gid", -1, "group ID to give downloaded files and directories (Unix only, -1 to keep)")
+	fsync := fs.Bool("fsync", false, "flush every file and its directory to disk once written, for durability on backup targets")
+	preallocate := fs.Bool("preallocate", false, "reserve the disk space of files before downloading them, reducing fragmentation (Linux only)")
+	maxPathLength := fs.Int("max-path-length", 0, "shorten names so that no local path, -dest included, exceeds this many bytes (0 for unlimited)")
+	concurrency := fs.Int("concurrency", 4, "number of files to download at the same time")
+	bwlimit := fs.String("bwlimit", "", "maximum bandwidth used by the downloads, in bytes per second (e.g. 10M)")
+	classes := fs.String("concurrency-by-type", "", `limit the files of some MIME types downloaded at the same time, e.g. "video/*=2,image/*=8"`)
+	priority := fs.String("priority", "", `download files matching some path patterns first or last, e.g. "**/*.docx=high,**/*.mp4=low"`)
+	exportWorkers := fs.Int("export-concurrency", 0, "number of Google documents exported at the same time, apart from other downloads (0 for no separate limit)")
+	exportRate := fs.Float64("export-rate", 0, "maximum number of Google documents exported per second (0 for unlimited)")
+	verifyWorkers := fs.Int("verify-concurrency", runtime.NumCPU(), "number of downloaded files verified against their checksum at the same time")
+	archive := fs.String("archive", "", "write the download into a zip or tar archive at this path instead of -dest")
+	probeSize := fs.String("probe-size", "", "before downloading again a changed file without a checksum, compare its first and last bytes of this size (e.g. 8M) to the local copy")
+	volumeSize := fs.String("volume-size", "", "split the archive into volumes of at most this size (e.g. 4G)")
+	skipSuspended := fs.Bool("skip-suspended", false, "skip files owned by suspended accounts instead of failing")
+	afterDownload := fs.String("after-download", "", `once files are downloaded, "move-to:FOLDER" them, "trash" them or "label:ID" them in Drive (requests the full scope)`)
+	seedManifest := fs.String("seed-manifest", "", "manifest of a download of the same folder elsewhere, whose checksums a first download into -dest trusts for the files already there")
+	restrictedList := fs.String("restricted-list", "", "write the files whose download is disabled by their sharing settings to this CSV file")
+	userAgent := fs.String("user-agent", "", "User-Agent header sent with every request")
+	endpoint := fs.String("endpoint", os.Getenv(endpointEnv), "base URL of the Drive API, e.g. of a mock server or an API gateway (defaults to $"+endpointEnv+")")
+	proxy := fs.String("proxy", "", `send every request through this HTTP or SOCKS5 proxy, e.g. "socks5://127.0.0.1:1080" (defaults to $HTTPS_PROXY)`)
+	dnsServer := fs.String("dns-server", "", `resolve host names through this DNS server, e.g. "10.0.0.2" or "10.0.0.2:5353"`)
+	resolve := fs.String("resolve", "", `connect to these comma-separated host=address pairs instead of resolving the hosts, e.g. "www.googleapis.com=10.1.2.3"`)
+	quotaUser := fs.String("quota-user", "", "quotaUser sent with every request, to apply rate limits per pipeline")
+	quotaProject := fs.String("quota-project", "", "Google Cloud project billed for the API quota")
+	explainAPI := fs.Bool("explain-api", false, "print the number of Drive API requests made, by kind, and their quota cost")
+	estimate := fs.Bool("estimate", false, "list the folder first and print the bytes, API requests and time the download is expected to take, asking for confirmation before it starts")
+	yes := fs.Bool("yes", false, "with -estimate, start the download without asking for confirmation")
+	verbose := fs.Bool("v", false, "log the progress of every file")
+	veryVerbose := fs.Bool("vv", false, "also log folder listings and Drive API requests")
+	veryVeryVerbose := fs.Bool("vvv", false, "also log HTTP headers, with credentials redacted")
+	debugModules := fs.String("debug", "", "comma-separated modules to log debug messages of: drive.api, drive.http, walker, downloader or all")
+	metricsCSV := fs.String("metrics-csv", "", "append throughput, active workers, queue depth and API error counts to this CSV file every 10 seconds")
+	statusFile := fs.String("status-file", "", "keep the progress of the download (files, bytes, ETA, failures) as JSON in this file")
+	preCmd := fs.String("pre-cmd", "", "shell command to run before each download")
+	postCmd := fs.String("post-cmd", "", "shell command to run after each successful download")
+	ackAbuse := fs.Bool("acknowledge-abuse", false, "download files Google flagged as malware or spam, where Drive permits it")
+	onFailureCmd := fs.String("on-failure-cmd", "", "shell command to run after each failed download")
+	var reports []string
+	fs.Func("report", "write a summary of each download to this file, as JUnit XML (.xml) or Markdown (.md); repeat or separate with commas for several", func(s string) error {
+		for _, path := range strings.Split(s, ",") {
+			if _, err := reportFormat(path); err != nil {
+				return err
+			}
+			reports = append(reports, path)
+		}
+		return nil
+	})
+	notifyWebhook := fs.String("notify-webhook", "", "URL to post a JSON summary to after each download")
+	notifyEmail := fs.String("notify-email", "", "comma-separated addresses to mail a summary to after each download")
+	smtpServer := fs.String("smtp-server", "", "SMTP server (host:port) for -notify-email")
+	smtpFrom := fs.String("smtp-from", "", "sender address for -notify-email (defaults to -smtp-user)")
+	smtpUser := fs.String("smtp-user", "", "SMTP user name; the password is read from $SMTP_PASSWORD")
+	configPath := fs.String("config", "", "JSON configuration file providing default flag values (reloaded on SIGHUP)")
+	watch := fs.Duration("watch", 0, "keep running and download changes at this interval (e.g. 15m)")
+	pidFile := fs.String("pidfile", "", "write the process ID to this file while running")
+	useSyslog := fs.Bool("syslog", false, "log to the system journal (syslog) or Windows event log")
+	runAsService := fs.Bool("run-as-service", false, "run under the Windows service control manager")
+	return fs, func() (*downloadSettings, error) {
+		var routes []drive.Route
+		if *configPath != "" {
+			config, err := LoadConfig(*configPath)
+			if err != nil {
+				return nil, err
+			}
+			if err := config.apply(fs); err != nil {
+				return nil, err
+			}
+			for _, s := range config.Routes {
+				route, err := drive.ParseRoute(s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid configuration: %w", err)
+				}
+				routes = append(routes, route)
+			}
+		}
+
+		duplicatePolicy, err := drive.ParseDuplicatePolicy(*duplicates)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -duplicates: %w", err)
+		}
+		normalizationForm, err := drive.ParseNormalization(*normalization)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -normalize: %w", err)
+		}
+		drawingFormatValue, err := drive.ParseDrawingFormat(*drawingFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -drawing-format: %w", err)
+		}
+		sheetFormatValue, err := drive.ParseSheetFormat(*sheetFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -sheet-format: %w", err)
+		}
+		commentsFormat, err := drive.ParseCommentsFormat(*comments)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -export-comments: %w", err)
+		}
+		linkStubsMode, err := drive.ParseLinkStubs(*linkStubs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -write-link-stubs: %w", err)
+		}
+		paperSize, err := drive.ParsePaperSize(*pdfPaper)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -pdf-paper: %w", err)
+		}
+		debug, err := drive.ParseDebug(*debugModules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -debug: %w", err)
+		}
+		switch {
+		case *veryVeryVerbose:
+			debug |= drive.VerbosityDebug(3)
+		case *veryVerbose:
+			debug |= drive.VerbosityDebug(2)
+		case *verbose:
+			debug |= drive.VerbosityDebug(1)
+		}
+		transferClasses, err := drive.ParseTransferClasses(*classes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -concurrency-by-type: %w", err)
+		}
+		priorities, err := drive.ParsePriorities(*priority)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -priority: %w", err)
+		}
+		var times [3]time.Time
+		for i, f := range []struct{ name, value string }{
+			{"modified-after", *modifiedAfter},
+			{"modified-before", *modifiedBefore},
+			{"created-after", *createdAfter},
+		} {
+			if times[i], err = parseTime(f.value); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", f.name, err)
+			}
+		}
+		if *noRecursive {
+			*maxDepth = 0
+		}
+		var seed *drive.Manifest
+		if *seedManifest != "" {
+			if seed, err = drive.LoadManifest(*seedManifest); err != nil {
+				return nil, fmt.Errorf("invalid -seed-manifest: %w", err)
+			}
+		}
+		var bandwidthLimit int64
+		if *bwlimit != "" {
+			if bandwidthLimit, err = drive.ParseByteSize(*bwlimit); err != nil {
+				return nil, fmt.Errorf("invalid -bwlimit: %w", err)
+			}
+		}
+		var probeBytes int64
+		if *probeSize != "" {
+			if probeBytes, err = drive.ParseByteSize(*probeSize); err != nil {
+				return nil, fmt.Errorf("invalid -probe-size: %w", err)
+			}
+		}
+		var volumeBytes int64
+		if *volumeSize != "" {
+			if volumeBytes, err = drive.ParseByteSize(*volumeSize); err != nil {
+				return nil, fmt.Errorf("invalid -volume-size: %w", err)
+			}
+		}
+		scopeURL, err := parseScope(*scope)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -scope: %w", err)
+		}
+		after, err := drive.ParseAfterDownload(*afterDownload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -after-download: %w", err)
+		}
+		if after.Action != drive.AfterDownloadNone && (*anonymous || *apiKey != "") {
+			return nil, errors.New("-after-download requires credentials that can modify the folder")
+		}
+		if len(driveFolderLinks) > 1 && *archive != "" {
+			return nil, errors.New("-archive takes a single -folder")
+		}
+		var sharers []string
+		for _, email := range strings.Split(*sharedBy, ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				sharers = append(sharers, email)
+			}
+		}
+		if len(sharers) > 0 {
+			switch {
+			case len(driveFolderLinks) > 0:
+				return nil, errors.New("-shared-by cannot be combined with -folder")
+			case *archive != "":
+				return nil, errors.New("-shared-by cannot be combined with -archive")
+			case *estimate:
+				return nil, errors.New("-shared-by cannot be combined with -estimate")
+			case after.Action != drive.AfterDownloadNone:
+				return nil, errors.New("-shared-by cannot be combined with -after-download")
+			case *anonymous || *apiKey != "":
+				return nil, errors.New("-shared-by requires credentials")
+			}
+		}
+		propertyValues, err := drive.ParseProperties(*properties)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -property: %w", err)
+		}
+		appPropertyValues, err := drive.ParseProperties(*appProperties)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -app-property: %w", err)
+		}
+		labelFilters, err := drive.ParseLabelFilters(*labels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -label: %w", err)
+		}
+		var sparseSpec *drive.Sparse
+		if *sparse != "" {
+			if sparseSpec, err = drive.LoadSparse(*sparse); err != nil {
+				return nil, fmt.Errorf("invalid -sparse: %w", err)
+			}
+		}
+		hosts, err := drive.ParseHostAddresses(*resolve)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -resolve: %w", err)
+		}
+		spaceNames, err := drive.ParseSpaces(*spaces)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -spaces: %w", err)
+		}
+		fileModeValue, err := parseFileMode(*fileMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -file-mode: %w", err)
+		}
+		dirModeValue, err := parseFileMode(*dirMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -dir-mode: %w", err)
+		}
+		compression, err := drive.ParseCompression(*compress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -compress: %w", err)
+		}
+		if compression != drive.CompressionNone {
+			switch {
+			case *archive != "":
+				return nil, errors.New("-compress cannot be combined with -archive")
+			case *autoExtract:
+				return nil, errors.New("-compress cannot be combined with -auto-extract")
+			}
+		}
+		var encryption *drive.Encryption
+		if *encrypt != "" {
+			if encryption, err = drive.ParseEncryption(*encrypt); err != nil {
+				return nil, fmt.Errorf("invalid -encrypt: %w", err)
+			}
+			switch {
+			case *archive != "":
+				return nil, errors.New("-encrypt cannot be combined with -archive")
+			case *autoExtract:
+				return nil, errors.New("-encrypt cannot be combined with -auto-extract")
+			case *extractImages:
+				return nil, errors.New("-encrypt cannot be combined with -extract-images, which keeps exports in temporary files")
+			}
+		}
+		layoutValue, err := drive.ParseLayout(*layout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -layout: %w", err)
+		}
+		if layoutValue == drive.LayoutCAS {
+			switch {
+			case *archive != "":
+				return nil, errors.New("-layout cas cannot be combined with -archive")
+			case compression != drive.CompressionNone:
+				return nil, errors.New("-layout cas cannot be combined with -compress")
+			case encryption != nil:
+				return nil, errors.New("-layout cas cannot be combined with -encrypt")
+			}
+		}
+		if *estimate {
+			switch {
+			case *archive != "":
+				return nil, errors.New("-estimate cannot be combined with -archive")
+			case *watch > 0:
+				return nil, errors.New("-estimate cannot be combined with -watch")
+			}
+		}
+		if *sniffExtensions && !*fixExtensions {
+			return nil, errors.New("-sniff-extensions requires -fix-extensions")
+		}
+		var ownership *drive.Ownership
+		if *uid >= 0 || *gid >= 0 {
+			if runtime.GOOS == "windows" {
+				return nil, errors.New("-uid and -gid are not supported on Windows")
+			}
+			ownership = &drive.Ownership{UID: *uid, GID: *gid}
+		}
+		if *notifyEmail != "" && *smtpServer == "" {
+			return nil, errors.New("-notify-email requires -smtp-server")
+		}
+
+		return &downloadSettings{
+			folderLinks:     driveFolderLinks,
+			sharedBy:        sharers,
+			subject:         *subject,
+			credentials:     *credentialsFilePath,
+			configPath:      *configPath,
+			anonymous:       *anonymous,
+			apiKey:          *apiKey,
+			scope:           scopeURL,
+			spaces:          spaceNames,
+			dest:            *downloadPath,
+			noRootFolder:    *noRootFolder,
+			duplicates:      duplicatePolicy,
+			maxDepth:        *maxDepth,
+			modifiedAfter:   times[0],
+			modifiedBefore:  times[1],
+			createdAfter:    times[2],
+			owner:           *owner,
+			notOwner:        *notOwner,
+			properties:      propertyValues,
+			appProperties:   appPropertyValues,
+			labels:          labelFilters,
+			sparse:          sparseSpec,
+			normalization:   normalizationForm,
+			drawingFormat:   drawingFormatValue,
+			sheetFormat:     sheetFormatValue,
+			sheetValuesOnly: *sheetValuesOnly,
+			pdf:             drive.PDFOptions{PaperSize: paperSize, Landscape: *pdfLandscape, HideGridlines: !*pdfGridlines},
+			sidecars:        *sidecars,
+			comments:        commentsFormat,
+			linkStubs:       linkStubsMode,
+			compression:     compression,
+			encryption:      encryption,
+			layout:          layoutValue,
+			extractImages:   *extractImages,
+			autoExtract:     *autoExtract,
+			discardArchives: *discardArchives,
+			routes:          routes,
+			caseInsensitive: *caseInsensitive,
+			fixExtensions:   *fixExtensions,
+			sniffExtensions: *sniffExtensions,
+			maxPathLength:   *maxPathLength,
+			fileMode:        fileModeValue,
+			dirMode:         dirModeValue,
+			ownership:       ownership,
+			fsync:           *fsync,
+			preallocate:     *preallocate,
+			concurrency:     *concurrency,
+			bandwidthLimit:  bandwidthLimit,
+			classes:         transferClasses,
+			exportWorkers:   *exportWorkers,
+			priorities:      priorities,
+			exportRate:      *exportRate,
+			verifyWorkers:   *verifyWorkers,
+			archive:         *archive,
+			volumeSize:      volumeBytes,
+			probeSize:       probeBytes,
+			seed:            seed,
+			watch:           *watch,
+			pidFile:         *pidFile,
+			syslog:          *useSyslog || *runAsService,
+			runAsService:    *runAsService,
+			explainAPI:      *explainAPI,
+			estimate:        *estimate,
+			yes:             *yes,
+			debug:           debug,
+			statusFile:      *statusFile,
+			metricsCSV:      *metricsCSV,
+			skipSuspended:   *skipSuspended,
+			restrictedList:  *restrictedList,
+			afterDownload:   after,
+			preCmd:          *preCmd,
+			postCmd:         *postCmd,
+			onFailureCmd:    *onFailureCmd,
+			ackAbuse:        *ackAbuse,
+			notifyWebhook:   *notifyWebhook,
+			notifyEmail:     *notifyEmail,
+			reports:         reports,
+			smtpServer:      *smtpServer,
+			smtpFrom:        *smtpFrom,
+			smtpUser:        *smtpUser,
+			userAgent:       *userAgent,
+			endpoint:        *endpoint,
+			proxy:           *proxy,
+			dnsServer:       *dnsServer,
+			hosts:           hosts,
+			quotaUser:       *quotaUser,
+			quotaProject:    *quotaProject,
+		}, nil
+	}
+}
+
+// runDownload implements the default command, which downloads a folder once
+// or, with -watch, keeps it in sync as a long-running service.
+func runDownload(args []string) error {
+	settings, err := parseDownloadFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger := log.New(os.Stdout, "", 0)
+	if settings.syslog {
+		w, err := systemLogWriter()
+		if err != nil {
+			return fmt.Errorf("failed to open system log: %w", err)
+		}
+		logger.SetOutput(w)
+		log.SetOutput(w)
+	}
+
+	if settings.pidFile != "" {
+		if err := writePidFile(settings.pidFile); err != nil {
+			return err
+		}
+		defer os.Remove(settings.pidFile)
+	}
+
+	if settings.runAsService {
+		return runService(func(ctx context.Context) error {
+			return serve(ctx, args, logger)
+		})
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, args, logger)
+}
+
+// downloadOnce performs a single download with the given settings, recording
+// its client in live while it runs.
+func downloadOnce(ctx context.Context, settings *downloadSettings, logger *log.Logger, live *liveClient) error {
+	var folderIDs []string
+	var folderID string
+	if len(settings.sharedBy) > 0 {
+		folderID = drive.SharedByID(strings.Join(settings.sharedBy, ","))
+	} else {
+		var err error
+		if folderIDs, err = extractFolderIDs(settings.folderLinks); err != nil {
+			return err
+		}
+		// A download of several folders is reported under the ID it is
+		// recorded under.
+		folderID = drive.RootsID(folderIDs)
+	}
+
+	driveClient, err := newDownloadClient(ctx, settings, logger)
+	if err != nil {
+		return err
+	}
+	live.set(driveClient)
+	defer live.set(nil)
+	if settings.explainAPI {
+		defer explainAPI(logger, driveClient.Stats)
+	}
+	if settings.archive == "" && len(folderIDs) == 1 {
+		dest, err := destination(ctx, driveClient, folderID, settings)
+		if err != nil {
+			return err
+		}
+		if dest != settings.dest {
+			logger.Printf("Downloading into %s", dest)
+			resolved := *settings
+			resolved.dest = dest
+			settings = &resolved
+		}
+	}
+
+	if err := runHook(ctx, settings.preCmd, jobEnv(folderID, settings, nil), logger); err != nil {
+		return fmt.Errorf("pre-cmd failed: %w", err)
+	}
+	start := time.Now()
+	err = transfer(ctx, driveClient, folderIDs, settings)
+	summary := newJobSummary(folderID, settings, driveClient.Stats, time.Since(start), err)
+	if notifyErr := notify(context.WithoutCancel(ctx), settings, summary); notifyErr != nil {
+		logger.Println(notifyErr)
+	}
+	if reportErr := writeReports(settings, summary); reportErr != nil {
+		logger.Println(reportErr)
+	}
+	env := jobEnv(folderID, settings, summary)
+	if err != nil {
+		// The failure hook also runs when the download was interrupted.
+		if hookErr := runHook(context.WithoutCancel(ctx), settings.onFailureCmd, env, logger); hookErr != nil {
+			logger.Printf("on-failure-cmd failed: %v", hookErr)
+		}
+		return err
+	}
+
+	logger.Println("Download completed successfully.")
+	if err := runHook(ctx, settings.postCmd, env, logger); err != nil {
+		return fmt.Errorf("post-cmd failed: %w", err)
+	}
+	return nil
+}
+
+// newDownloadClient creates the Drive client of a download and configures it
+// with the download settings.
+func newDownloadClient(ctx context.Context, settings *downloadSettings, logger *log.Logger) (*drive.Client, error) {
+	var credentials drive.Option
+	switch {
+	case settings.anonymous:
+		credentials = drive.WithoutCredentials()
+	case settings.apiKey != "":
+		credentials = drive.WithAPIKey(settings.apiKey)
+	default:
+		var err error
+		if credentials, err = credentialsOption(ctx, settings.credentials, settings.configPath); err != nil {
+			return nil, err
+		}
+	}
+	scopes := []string{settings.scope}
+	if settings.afterDownload.Action != drive.AfterDownloadNone {
+		scopes[0] = drive.FullScope
+	}
+	if slices.Contains(settings.spaces, drive.AppDataFolder) {
+		scopes = append(scopes, drive.AppDataScope)
+	}
+	opts := []drive.Option{
+		credentials, drive.WithScopes(scopes...), drive.WithEndpoint(settings.endpoint),
+		drive.WithProxy(settings.proxy), drive.WithDNSServer(settings.dnsServer), drive.WithHostAddresses(settings.hosts),
+	}
+	if settings.subject != "" {
+		opts = append(opts, drive.WithSubject(settings.subject))
+	}
+	driveClient, err := drive.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Google Drive client: %w", err)
+	}
+	driveClient.Spaces = settings.spaces
+	driveClient.Duplicates = settings.duplicates
+	driveClient.MaxDepth = settings.maxDepth
+	driveClient.ModifiedAfter = settings.modifiedAfter
+	driveClient.ModifiedBefore = settings.modifiedBefore
+	driveClient.CreatedAfter = settings.createdAfter
+	driveClient.Owner = settings.owner
+	driveClient.NotOwner = settings.notOwner
+	driveClient.Properties = settings.properties
+	driveClient.AppProperties = settings.appProperties
+	driveClient.Labels = settings.labels
+	driveClient.Sparse = settings.sparse
+	driveClient.Normalization = settings.normalization
+	driveClient.CaseInsensitive = settings.caseInsensitive
+	driveClient.FixExtensions = settings.fixExtensions
+	driveClient.SniffExtensions = settings.sniffExtensions
+	driveClient.MaxPathLength = settings.maxPathLength
+	driveClient.FileMode = settings.fileMode
+	driveClient.DirMode = settings.dirMode
+	driveClient.Ownership = settings.ownership
+	driveClient.DrawingFormat = settings.drawingFormat
+	driveClient.SheetFormat = settings.sheetFormat
+	driveClient.SheetValuesOnly = settings.sheetValuesOnly
+	driveClient.PDF = settings.pdf
+	driveClient.Sidecars = settings.sidecars
+	driveClient.Comments = settings.comments
+	driveClient.LinkStubs = settings.linkStubs
+	driveClient.Fsync = settings.fsync
+	driveClient.Preallocate = settings.preallocate
+	driveClient.Compression = settings.compression
+	driveClient.Encryption = settings.encryption
+	driveClient.Layout = settings.layout
+	driveClient.ExtractImages = settings.extractImages
+	driveClient.AutoExtract = settings.autoExtract
+	driveClient.DiscardArchives = settings.discardArchives
+	driveClient.Routes = settings.routes
+	driveClient.Concurrency = settings.concurrency
+	driveClient.BandwidthLimit = settings.bandwidthLimit
+	driveClient.Classes = settings.classes
+	driveClient.ExportConcurrency = settings.exportWorkers
+	driveClient.Priorities = settings.priorities
+	driveClient.ExportRate = settings.exportRate
+	driveClient.VerifyConcurrency = settings.verifyWorkers
+	driveClient.VolumeSize = settings.volumeSize
+	driveClient.ProbeSize = settings.probeSize
+	driveClient.Seed = settings.seed
+	driveClient.AcknowledgeAbuse = settings.ackAbuse
+	driveClient.SkipSuspended = settings.skipSuspended
+	driveClient.RestrictedList = settings.restrictedList
+	driveClient.AfterDownload = settings.afterDownload
+	driveClient.Logger = logger
+	driveClient.Debug = settings.debug
+	driveClient.StatusFile = settings.statusFile
+	driveClient.MetricsCSV = settings.metricsCSV
+	driveClient.UserAgent = settings.userAgent
+	driveClient.QuotaUser = settings.quotaUser
+	driveClient.QuotaProject = settings.quotaProject
+	return driveClient, nil
+}
+
+// transfer downloads the folders into the archive or directory given by
+// settings. Several folders are downloaded together, each into a
+// subdirectory named after it or, with -no-root-folder, merged. With
+// -shared-by, the items shared by the given users are downloaded instead.
+func transfer(ctx context.Context, driveClient *drive.Client, folderIDs []string, settings *downloadSettings) error {
+	if settings.archive != "" {
+		if err := driveClient.DownloadArchive(ctx, folderIDs[0], settings.archive); err != nil {
+			return fmt.Errorf("failed to download folder: %w", err)
+		}
+		return nil
+	}
+
+	// Ensure the download path exists.
+	if err := os.MkdirAll(settings.dest, cmp.Or(settings.dirMode, os.ModePerm)); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	if len(settings.sharedBy) > 0 {
+		if err := driveClient.DownloadSharedBy(ctx, settings.sharedBy, settings.dest); err != nil {
+			return fmt.Errorf("failed to download shared items: %w", err)
+		}
+		return nil
+	}
+	if settings.estimate {
+		return transferEstimated(ctx, driveClient, folderIDs, settings)
+	}
+
+	// Download files to the specified directory.
+	if len(folderIDs) > 1 {
+		if err := driveClient.DownloadFolders(ctx, folderIDs, settings.dest, settings.noRootFolder); err != nil {
+			return fmt.Errorf("failed to download folders: %w", err)
+		}
+		return nil
+	}
+	if err := driveClient.DownloadFolder(ctx, folderIDs[0], settings.dest); err != nil {
+		return fmt.Errorf("failed to download folder: %w", err)
+	}
+	return nil
+}
+
+// transferEstimated plans the download of the folders, prints what it is
+// expected to cost and, once the user confirms it unless -yes is given,
+// downloads the files of the plan.
+func transferEstimated(ctx context.Context, driveClient *drive.Client, folderIDs []string, settings *downloadSettings) error {
+	var plan *drive.Plan
+	var err error
+	if len(folderIDs) > 1 {
+		plan, err = driveClient.PlanFolders(ctx, folderIDs, settings.dest, settings.noRootFolder)
+	} else {
+		plan, err = driveClient.PlanFolder(ctx, folderIDs[0], settings.dest)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to plan download: %w", err)
+	}
+	estimate, err := driveClient.EstimatePlan(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("failed to estimate download: %w", err)
+	}
+	fmt.Printf("Estimate of the download into %s:\n", settings.dest)
+	printEstimate(estimate)
+	if estimate.Files+estimate.Exports == 0 {
+		return driveClient.ApplyPlan(ctx, plan)
+	}
+	if !settings.yes {
+		answer, err := prompt("Start the download? [y/N] ")
+		if err != nil || !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return errors.New("download not confirmed (pass -yes to skip the confirmation)")
+		}
+	}
+	if err := driveClient.ApplyPlan(ctx, plan); err != nil {
+		return fmt.Errorf("failed to download folder: %w", err)
+	}
+	return nil
+}
+
+// printEstimate prints the lines of an estimate.
+func printEstimate(estimate *drive.Estimate) {
+	duration := "unknown"
+	if estimate.Duration > 0 {
+		duration = "about " + estimate.Duration.Round(time.Second).String()
+	}
+	fmt.Printf("  files      %d (%s)\n", estimate.Files, drive.FormatBytes(estimate.Bytes))
+	fmt.Printf("  exports    %d\n", estimate.Exports)
+	fmt.Printf("  requests   %d (%d made listing the folder)\n", estimate.APICalls, estimate.ListCalls)
+	if estimate.Throughput > 0 {
+		fmt.Printf("  throughput %s/s per file, %s to start\n", drive.FormatBytes(int64(estimate.Throughput)), estimate.Latency.Round(time.Millisecond))
+	}
+	fmt.Printf("  duration   %s\n", duration)
+}
+
+// extractFolderIDs extracts the IDs of the folders given by -folder.
+func extractFolderIDs(links []string) ([]string, error) {
+	if len(links) == 0 {
+		return nil, errors.New("failed to extract folder ID: -folder is required")
+	}
+	ids := make([]string, len(links))
+	for i, link := range links {
+		id, err := drive.ExtractFolderID(link)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract folder ID from %q: %w", link, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// folderList is the value of -folder, which may be given several times, or
+// as a comma-separated list, to download several folders.
+type folderList []string
+
+func (l *folderList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *folderList) Set(s string) error {
+	for _, link := range strings.Split(s, ",") {
+		if link = strings.TrimSpace(link); link != "" {
+			*l = append(*l, link)
+		}
+	}
+	return nil
+}
+
+// destination returns the directory to download the folder into. Like cp -r,
+// a folder downloaded into an existing directory lands in a subdirectory
+// named after it, unless -no-root-folder is given. An existing directory that
+// already holds a download of the folder, such as one made by an earlier
+// -watch run, is downloaded into directly so that it is updated in place.
+func destination(ctx context.Context, driveClient *drive.Client, folderID string, settings *downloadSettings) (string, error) {
+	if settings.noRootFolder {
+		return settings.dest, nil
+	}
+	if info, err := os.Stat(settings.dest); err != nil || !info.IsDir() {
+		return settings.dest, nil
+	}
+	if manifest, err := drive.LoadManifest(filepath.Join(settings.dest, drive.ManifestName)); err == nil && manifest.FolderID == folderID {
+		return settings.dest, nil
+	}
+	if _, err := os.Stat(filepath.Join(settings.dest, drive.QueueName)); err == nil {
+		return settings.dest, nil
+	}
+	name, err := driveClient.FolderName(ctx, folderID)
+	if err != nil {
+		return "", fmt.Errorf("failed to name the download directory (use -no-root-folder to download into -dest): %w", err)
+	}
+	return filepath.Join(settings.dest, name), nil
+}
+
+// explainAPI prints the Drive API requests counted in stats and an estimate
+// of their cost against the default query quota.
+func explainAPI(logger *log.Logger, stats *drive.APIStats) {
+	if stats == nil {
+		return
+	}
+	logger.Println("Drive API requests:")
+	for _, kind := range stats.Kinds() {
+		logger.Printf("  %-9s %d", kind, stats.Calls()[kind])
+	}
+	total := stats.Total()
+	perMinute := float64(total) / stats.Elapsed().Minutes()
+	logger.Printf("  %-9s %d", "total", total)
+	logger.Printf("Estimated quota cost: %d queries, %.0f per minute (%.1f%% of the default %d queries per minute).",
+		total, perMinute, 100*perMinute/drive.DefaultQueriesPerMinute, drive.DefaultQueriesPerMinute)
+}
+
+// parseScope parses a scope name ("readonly" or "full").
+func parseScope(s string) (string, error) {
+	switch s {
+	case "readonly":
+		return drive.ReadonlyScope, nil
+	case "full":
+		return drive.FullScope, nil
+	}
+	return "", fmt.Errorf("unknown scope %q", s)
+}
+
+// parseTime parses a date ("2024-01-31", midnight local time) or an RFC 3339
+// time. An empty string is the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseFileMode parses octal permission bits such as "0644". An empty string
+// is the zero mode, which keeps the default permissions.
+func parseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0o777 {
+		return 0, fmt.Errorf("%q is not an octal mode between 1 and 0777", s)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// infoCommand defines the "info" subcommand, which prints who the credentials
+// authenticate as and the account's storage quota and limits. It is the first
+// thing to check when a folder does not seem to be visible to the tool.
+func infoCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	return fs, func() {
+		driveClient, err := newClient(*credentialsFilePath)
+		if err != nil {
+			log.Fatalf("Failed to initialize Google Drive client: %v", err)
+		}
+		about, err := driveClient.About(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to get account information: %v", err)
+		}
+
+		if about.User != nil {
+			fmt.Printf("Authenticated as: %s <%s>\n", about.User.DisplayName, about.User.EmailAddress)
+		}
+		if quota := about.StorageQuota; quota != nil {
+			fmt.Printf("Storage used:     %s", drive.FormatBytes(quota.Usage))
+			if quota.Limit > 0 {
+				fmt.Printf(" of %s (%.1f%%)", drive.FormatBytes(quota.Limit), 100*float64(quota.Usage)/float64(quota.Limit))
+			} else {
+				fmt.Print(" (unlimited)")
+			}
+			fmt.Println()
+			fmt.Printf("  in Drive:       %s\n", drive.FormatBytes(quota.UsageInDrive))
+			fmt.Printf("  in trash:       %s\n", drive.FormatBytes(quota.UsageInDriveTrash))
+		}
+		fmt.Printf("Max upload size:  %s\n", drive.FormatBytes(about.MaxUploadSize))
+
+		if len(about.MaxImportSizes) > 0 {
+			fmt.Println("Max import sizes:")
+			types := make([]string, 0, len(about.MaxImportSizes))
+			for mimeType := range about.MaxImportSizes {
+				types = append(types, mimeType)
+			}
+			sort.Strings(types)
+			for _, mimeType := range types {
+				size := about.MaxImportSizes[mimeType]
+				if n, err := strconv.ParseInt(size, 10, 64); err == nil {
+					size = drive.FormatBytes(n)
+				}
+				fmt.Printf("  %-45s %s\n", mimeType, size)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// inventoryItem is an entry of an inventory.
+type inventoryItem struct {
+	Path         string   `json:"path"`
+	ID           string   `json:"id"`
+	Size         int64    `json:"size"`
+	MD5          string   `json:"md5,omitempty"`
+	MimeType     string   `json:"mimeType"`
+	Owners       []string `json:"owners,omitempty"`
+	ModifiedTime string   `json:"modifiedTime"`
+	Shared       bool     `json:"shared"`
+	CanDownload  bool     `json:"canDownload"`
+	CanCopy      bool     `json:"canCopy"`
+}
+
+// inventoryColumns are the columns of CSV inventories.
+var inventoryColumns = []string{"path", "id", "size", "md5", "mimeType", "owners", "modifiedTime", "shared", "canDownload", "canCopy"}
+
+// inventoryCommand defines the "inventory" subcommand, which lists every file
+// and folder below a Drive folder, with the path it is downloaded to and its
+// metadata, as JSON or CSV, for cataloguing a folder without downloading it.
+func inventoryCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	format := fs.String("format", "json", `output format: "json" or "csv"`)
+	output := fs.String("output", "", "file to write the inventory to instead of standard output")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader inventory [flags] <folder>")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *format != "json" && *format != "csv" {
+			log.Fatalf("invalid -format: unknown inventory format %q", *format)
+		}
+		folderID, err := drive.ExtractFolderID(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		driveClient, err := newClient(*credentialsFilePath)
+		if err != nil {
+			log.Fatalf("Failed to initialize Google Drive client: %v", err)
+		}
+		driveClient.Logger = nil
+
+		items, err := inventory(driveClient, folderID)
+		if err != nil {
+			log.Fatalf("Failed to list Drive folder: %v", err)
+		}
+		w := io.Writer(os.Stdout)
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if *format == "csv" {
+			err = writeInventoryCSV(w, items)
+		} else {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(items)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write inventory: %v", err)
+		}
+	}
+}
+
+// inventory lists every file and folder below a folder, sorted by path.
+func inventory(driveClient *drive.Client, folderID string) ([]inventoryItem, error) {
+	var (
+		mu    sync.Mutex
+		items = []inventoryItem{}
+	)
+	err := driveClient.Walk(context.Background(), folderID, func(item drive.DriveItem) error {
+		entry := inventoryItem{
+			Path:         item.Path,
+			ID:           item.ID,
+			Size:         item.Size,
+			MD5:          item.MD5,
+			MimeType:     item.MimeType,
+			ModifiedTime: item.File.ModifiedTime,
+			Shared:       item.File.Shared,
+		}
+		entry.CanDownload, entry.CanCopy = capabilities(item.File)
+		for _, owner := range item.File.Owners {
+			entry.Owners = append(entry.Owners, owner.EmailAddress)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		items = append(items, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return items, nil
+}
+
+// capabilities returns whether the user can download and copy a file. Files
+// listed without capabilities are assumed to allow both.
+func capabilities(file *drivev3.File) (canDownload, canCopy bool) {
+	if file.Capabilities == nil {
+		return true, true
+	}
+	return file.Capabilities.CanDownload, file.Capabilities.CanCopy
+}
+
+// writeInventoryCSV writes an inventory as CSV with a header row. Files with
+// several owners have them separated by semicolons.
+func writeInventoryCSV(w io.Writer, items []inventoryItem) error {
+	cw := csv.NewWriter(w)
+	cw.Write(inventoryColumns)
+	for _, item := range items {
+		cw.Write([]string{
+			item.Path,
+			item.ID,
+			strconv.FormatInt(item.Size, 10),
+			item.MD5,
+			item.MimeType,
+			strings.Join(item.Owners, ";"),
+			item.ModifiedTime,
+			strconv.FormatBool(item.Shared),
+			strconv.FormatBool(item.CanDownload),
+			strconv.FormatBool(item.CanCopy),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
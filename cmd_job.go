@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// jobCommand defines the "job" subcommand, which saves the flags of a
+// download under a name in the configuration file and runs it by name, e.g.
+// from cron.
+func jobCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("job", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(), "JSON configuration file holding the saved jobs")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: drive-downloader job [flags] save <name> [download flags]")
+		fmt.Fprintln(out, "       drive-downloader job [flags] run <name> [download flags]")
+		fmt.Fprintln(out, "       drive-downloader job [flags] list")
+		fmt.Fprintln(out, "       drive-downloader job [flags] delete <name>")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if *configPath == "" {
+			log.Fatal("-config is required: no user configuration directory")
+		}
+		args := fs.Args()
+		switch {
+		case len(args) >= 2 && args[0] == "save":
+			if err := saveJob(*configPath, args[1], args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Saved job %q to %s.\n", args[1], *configPath)
+		case len(args) >= 2 && args[0] == "run":
+			if err := runJob(*configPath, args[1], args[2:]); err != nil {
+				log.Fatal(err)
+			}
+		case len(args) == 1 && args[0] == "list":
+			config, err := loadJobs(*configPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			names := make([]string, 0, len(config.Jobs))
+			for name := range config.Jobs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("%s\t%v\n", name, config.Jobs[name]["folder"])
+			}
+		case len(args) == 2 && args[0] == "delete":
+			config, err := loadJobs(*configPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, ok := config.Jobs[args[1]]; !ok {
+				log.Fatalf("No job named %q in %s", args[1], *configPath)
+			}
+			delete(config.Jobs, args[1])
+			if err := config.Save(*configPath); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+// configEnv is the environment variable naming the configuration file used
+// when -config is not given, and by -credentials profile:NAME.
+const configEnv = "DRIVE_DOWNLOADER_CONFIG"
+
+// defaultConfigPath returns the configuration file used by "job" and "auth"
+// when -config is not given, and by -credentials profile:NAME: the file named
+// by $DRIVE_DOWNLOADER_CONFIG or else the one in the user's configuration
+// directory.
+func defaultConfigPath() string {
+	if path := os.Getenv(configEnv); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "drive-downloader", "config.json")
+}
+
+// loadJobs reads the configuration file holding the saved jobs. A missing
+// file holds no jobs.
+func loadJobs(path string) (*Config, error) {
+	config, err := LoadConfig(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return config, err
+}
+
+// saveJob validates the flags of a download and saves those given
+// explicitly as the job name, replacing any job of that name.
+func saveJob(path, name string, args []string) error {
+	flags, settings := downloadFlags()
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	if _, err := settings(); err != nil {
+		return err
+	}
+	job := make(map[string]any)
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			job[f.Name] = f.Value.String()
+		}
+	})
+	if job["folder"] == nil {
+		return errors.New("a job needs -folder")
+	}
+
+	config, err := loadJobs(path)
+	if err != nil {
+		return err
+	}
+	if config.Jobs == nil {
+		config.Jobs = make(map[string]map[string]any)
+	}
+	config.Jobs[name] = job
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return config.Save(path)
+}
+
+// runJob runs the download saved as the job name. Flags in args override
+// the saved ones, which override the defaults of the configuration file.
+func runJob(path, name string, args []string) error {
+	config, err := loadJobs(path)
+	if err != nil {
+		return err
+	}
+	job, ok := config.Jobs[name]
+	if !ok {
+		return fmt.Errorf("no job named %q in %s", name, path)
+	}
+	jobArgs := []string{"-config=" + path}
+	names := make([]string, 0, len(job))
+	for flagName := range job {
+		names = append(names, flagName)
+	}
+	sort.Strings(names)
+	for _, flagName := range names {
+		jobArgs = append(jobArgs, fmt.Sprintf("-%s=%v", flagName, job[flagName]))
+	}
+	return runDownload(append(jobArgs, args...))
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+const (
+	folderMimeType   = "application/vnd.google-apps.folder"
+	googleMimePrefix = "application/vnd.google-apps."
+)
+
+// ANSI colors distinguishing folders, Google-native files and other files.
+const (
+	colorFolder = "\033[1;34m"
+	colorNative = "\033[32m"
+	colorReset  = "\033[0m"
+)
+
+// lsCommand defines the "ls" subcommand, which lists the content of a Drive
+// folder as a table of sizes, modification times and names, or as an
+// indented tree of its whole content.
+func lsCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	tree := fs.Bool("tree", false, "list subfolders recursively as an indented tree")
+	sortBy := fs.String("sort", "name", `order of the files of each folder: "name", "size" or "mtime"`)
+	noColor := fs.Bool("no-color", false, "do not color folders and Google-native files")
+	long := fs.Bool("l", false, "also list the owner of every file, whether it is shared, and whether it can be downloaded and copied")
+	listFormat := fs.String("list-format", "table", `output format: "table", "lsjson" or "md5sum"`)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader ls [flags] <folder>")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		less, err := fileOrder(*sortBy)
+		if err != nil {
+			log.Fatalf("invalid -sort: %v", err)
+		}
+		folderID, err := drive.ExtractFolderID(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		driveClient, err := newClient(*credentialsFilePath)
+		if err != nil {
+			log.Fatalf("Failed to initialize Google Drive client: %v", err)
+		}
+		driveClient.Logger = nil
+
+		switch *listFormat {
+		case "table":
+		case "lsjson", "md5sum":
+			if err := listRclone(driveClient, folderID, *listFormat); err != nil {
+				log.Fatalf("Failed to list Drive folder: %v", err)
+			}
+			return
+		default:
+			log.Fatalf("invalid -list-format: unknown list format %q", *listFormat)
+		}
+		l := &lister{
+			client: driveClient,
+			less:   less,
+			color:  !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout),
+			tree:   *tree,
+			long:   *long,
+			w:      tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight),
+		}
+		if err := l.list(context.Background(), folderID, 0); err != nil {
+			l.w.Flush()
+			log.Fatalf("Failed to list Drive folder: %v", err)
+		}
+		l.w.Flush()
+		fmt.Printf("%d folder(s), %d file(s), %s\n", l.folders, l.files, drive.FormatBytes(l.bytes))
+	}
+}
+
+// fileOrder returns the order the files of a folder are listed in for a
+// -sort value. Larger and more recently modified files come first.
+func fileOrder(s string) (func(a, b *drivev3.File) bool, error) {
+	switch strings.ToLower(s) {
+	case "name", "":
+		return func(a, b *drivev3.File) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }, nil
+	case "size":
+		return func(a, b *drivev3.File) bool { return a.Size > b.Size }, nil
+	case "mtime":
+		return func(a, b *drivev3.File) bool { return a.ModifiedTime > b.ModifiedTime }, nil
+	}
+	return nil, fmt.Errorf("unknown sort order %q", s)
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// lister prints folder listings as aligned columns, totalling what it lists.
+type lister struct {
+	client *drive.Client
+	less   func(a, b *drivev3.File) bool
+	color  bool
+	tree   bool
+	long   bool // list owners, sharing and capabilities
+	w      *tabwriter.Writer
+
+	folders, files int
+	bytes          int64
+}
+
+// list prints the children of a folder at the given depth, folders first,
+// descending into subfolders if listing a tree.
+func (l *lister) list(ctx context.Context, folderID string, depth int) error {
+	children, err := l.client.ListChildren(ctx, folderID)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		if isFolder(a) != isFolder(b) {
+			return isFolder(a)
+		}
+		return l.less(a, b)
+	})
+	for _, file := range children {
+		l.print(file, depth)
+		if isFolder(file) && l.tree {
+			if err := l.list(ctx, file.Id, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// print writes the row of a file and adds it to the totals.
+func (l *lister) print(file *drivev3.File, depth int) {
+	size, name, color := "-", file.Name, ""
+	switch {
+	case isFolder(file):
+		l.folders++
+		name += "/"
+		color = colorFolder
+	case strings.HasPrefix(file.MimeType, googleMimePrefix):
+		l.files++
+		color = colorNative
+	default:
+		l.files++
+		l.bytes += file.Size
+		size = drive.FormatBytes(file.Size)
+	}
+	if l.color && color != "" {
+		name = color + name + colorReset
+	}
+	modified := "-"
+	if t, err := time.Parse(time.RFC3339, file.ModifiedTime); err == nil {
+		modified = t.Local().Format("2006-01-02 15:04")
+	}
+	if l.long {
+		owner := "-"
+		if len(file.Owners) > 0 {
+			owner = file.Owners[0].EmailAddress
+		}
+		modified += "\t" + owner + "\t" + access(file)
+	}
+	// The name is left out of the aligned cells so that colors and
+	// indentation do not upset the alignment of the other columns.
+	fmt.Fprintf(l.w, "%s\t%s\t  %s%s\n", size, modified, strings.Repeat("  ", depth), name)
+}
+
+// access describes the sharing and capabilities of a file in long listings:
+// "shared" if it is shared with others, and "no-download" or "no-copy" if
+// the user cannot download or copy it, which makes its download fail.
+func access(file *drivev3.File) string {
+	var notes []string
+	if file.Shared {
+		notes = append(notes, "shared")
+	}
+	canDownload, canCopy := capabilities(file)
+	if !canDownload && !isFolder(file) {
+		notes = append(notes, "no-download")
+	}
+	if !canCopy && !isFolder(file) {
+		notes = append(notes, "no-copy")
+	}
+	if len(notes) == 0 {
+		return "-"
+	}
+	return strings.Join(notes, ",")
+}
+
+// isFolder reports whether a file is a Drive folder.
+func isFolder(file *drivev3.File) bool {
+	return file.MimeType == folderMimeType
+}
+
+// rcloneItem is an entry of the output of "rclone lsjson".
+type rcloneItem struct {
+	Path     string
+	Name     string
+	Size     int64
+	MimeType string
+	ModTime  string
+	IsDir    bool
+	ID       string
+	Hashes   map[string]string `json:",omitempty"`
+}
+
+// listRclone lists every file and folder below a folder, recursively and
+// with the local paths they are downloaded to, in the format of
+// "rclone lsjson -R" or "rclone md5sum", so that scripts verifying
+// directories with rclone can verify downloads too.
+func listRclone(driveClient *drive.Client, folderID, format string) error {
+	var (
+		mu    sync.Mutex
+		items []drive.DriveItem
+	)
+	err := driveClient.Walk(context.Background(), folderID, func(item drive.DriveItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+
+	if format == "md5sum" {
+		for _, item := range items {
+			if !item.IsFolder() {
+				// Like rclone, files without a checksum get a blank one.
+				fmt.Printf("%32s  %s\n", item.MD5, item.Path)
+			}
+		}
+		return nil
+	}
+	fmt.Println("[")
+	for i, item := range items {
+		entry := rcloneItem{
+			Path:     item.Path,
+			Name:     item.Name,
+			Size:     item.Size,
+			MimeType: item.MimeType,
+			ModTime:  item.File.ModifiedTime,
+			IsDir:    item.IsFolder(),
+			ID:       item.ID,
+		}
+		if item.IsFolder() {
+			entry.Size, entry.MimeType = -1, "inode/directory"
+		} else if strings.HasPrefix(item.MimeType, googleMimePrefix) {
+			entry.Size = -1
+		}
+		if item.MD5 != "" {
+			entry.Hashes = map[string]string{"md5": item.MD5}
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if i < len(items)-1 {
+			line = append(line, ',')
+		}
+		fmt.Println(string(line))
+	}
+	fmt.Println("]")
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// planActions lists the actions of a plan in the order they are summarized.
+var planActions = []string{drive.ActionMkdir, drive.ActionDownload, drive.ActionExport, drive.ActionMove, drive.ActionSkip, drive.ActionRestricted}
+
+// planFile is the file written by "plan": the plan with the download flags it
+// was made with, which "apply" downloads with again.
+type planFile struct {
+	Args []string    `json:"args"`
+	Plan *drive.Plan `json:"plan"`
+}
+
+// planCommand defines the "plan" subcommand, which writes everything a
+// download would do to a file for review, without downloading anything.
+func planCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader plan <plan file> [download flags]")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if err := writePlan(fs.Arg(0), fs.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// applyCommand defines the "apply" subcommand, which downloads exactly what
+// a plan written by "plan" lists.
+func applyCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: drive-downloader apply <plan file>")
+		fs.PrintDefaults()
+	}
+	return fs, func() {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if err := applyPlan(fs.Arg(0)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// planSettings parses the download flags of a plan. Downloads into archives
+// and -watch runs cannot be planned.
+func planSettings(args []string) (*downloadSettings, error) {
+	settings, err := parseDownloadFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case settings.archive != "":
+		return nil, errors.New("-archive cannot be planned")
+	case settings.watch > 0:
+		return nil, errors.New("-watch cannot be planned")
+	}
+	return settings, nil
+}
+
+// writePlan plans the download given by the download flags args, saves the
+// plan to path and prints a summary of it, with an estimate of its cost.
+func writePlan(path string, args []string) error {
+	settings, err := planSettings(args)
+	if err != nil {
+		return err
+	}
+	if len(settings.sharedBy) > 0 {
+		return errors.New("-shared-by cannot be given to plan")
+	}
+	folderIDs, err := extractFolderIDs(settings.folderLinks)
+	if err != nil {
+		return err
+	}
+	if len(folderIDs) > 1 {
+		return errors.New("plan takes a single -folder")
+	}
+	folderID := folderIDs[0]
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger := log.New(os.Stdout, "", 0)
+	driveClient, err := newDownloadClient(ctx, settings, logger)
+	if err != nil {
+		return err
+	}
+	dest, err := destination(ctx, driveClient, folderID, settings)
+	if err != nil {
+		return err
+	}
+	plan, err := driveClient.PlanFolder(ctx, folderID, dest)
+	if err != nil {
+		return fmt.Errorf("failed to plan download: %w", err)
+	}
+
+	data, err := json.MarshalIndent(planFile{Args: args, Plan: plan}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	fmt.Printf("Plan to download into %s:\n", dest)
+	for _, action := range planActions {
+		n, bytes := plan.Count(action)
+		if n == 0 {
+			continue
+		}
+		switch action {
+		case drive.ActionDownload:
+			fmt.Printf("  %-10s %d (%s)\n", action, n, drive.FormatBytes(bytes))
+		default:
+			fmt.Printf("  %-10s %d\n", action, n)
+		}
+	}
+	if estimate, err := driveClient.EstimatePlan(ctx, plan); err == nil {
+		fmt.Println("Estimate:")
+		printEstimate(estimate)
+	}
+	fmt.Printf("Saved to %s; run \"drive-downloader apply %s\" to carry it out.\n", path, path)
+	return nil
+}
+
+// applyPlan carries out the plan saved at path with the download flags it
+// was made with.
+func applyPlan(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+	var saved planFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if saved.Plan == nil {
+		return fmt.Errorf("%s holds no plan", path)
+	}
+	settings, err := planSettings(saved.Args)
+	if err != nil {
+		return fmt.Errorf("invalid flags in plan: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger := log.New(os.Stdout, "", 0)
+	driveClient, err := newDownloadClient(ctx, settings, logger)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(saved.Plan.Dest, cmp.Or(settings.dirMode, os.ModePerm)); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+	if err := driveClient.ApplyPlan(ctx, saved.Plan); err != nil {
+		return fmt.Errorf("failed to apply plan: %w", err)
+	}
+	logger.Println("Download completed successfully.")
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// repairCommand defines the "repair" subcommand, which re-downloads the files
+// of a previous download whose local copies no longer match its manifest.
+func repairCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	manifestPath := fs.String("manifest", drive.ManifestName, "path to the manifest of the download to repair")
+	return fs, func() {
+		driveClient, err := newClient(*credentialsFilePath)
+		if err != nil {
+			log.Fatalf("Failed to initialize Google Drive client: %v", err)
+		}
+
+		repaired, err := driveClient.Repair(context.Background(), *manifestPath)
+		if err != nil {
+			log.Fatalf("Failed to repair download: %v", err)
+		}
+		fmt.Printf("Repair completed successfully: %d file(s) repaired.\n", repaired)
+	}
+}
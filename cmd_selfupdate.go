@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is the release the binary was built from, set at build time with
+// -ldflags "-X main.version=vX.Y.Z".
+var version = "dev"
+
+// releaseKey is the base64-encoded Ed25519 public key the checksums of
+// releases are signed with, set at build time by the release workflow with
+// -ldflags "-X main.releaseKey=...". Builds without it cannot self-update.
+var releaseKey = ""
+
+// latestReleaseURL is the GitHub API endpoint describing the latest release.
+const latestReleaseURL = "https://api.github.com/repos/rgsuhas/drive-downloader/releases/latest"
+
+// checksumsAsset is the release asset listing the SHA-256 checksum of every
+// binary, in the format of sha256sum.
+const checksumsAsset = "checksums.txt"
+
+// signatureAsset is the release asset holding the Ed25519 signature of the
+// checksums file and the version of the release, made with the private half
+// of releaseKey; see signedPayload.
+const signatureAsset = checksumsAsset + ".sig"
+
+// release is the part of a GitHub release self-update needs.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset returns the download URL of the named asset of the release.
+func (r *release) asset(name string) (string, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, true
+		}
+	}
+	return "", false
+}
+
+// selfUpdateCommand defines the "self-update" subcommand, which replaces the
+// running binary with the one of the latest GitHub release for the current
+// platform, after verifying the signature of its checksum.
+func selfUpdateCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release is available")
+	force := fs.Bool("force", false, "install the latest release even if it is not newer than the running one")
+	return fs, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		latest, err := latestRelease(ctx)
+		if err != nil {
+			log.Fatalf("Failed to check for updates: %v", err)
+		}
+		if version == "dev" {
+			if *check {
+				fmt.Printf("drive-downloader %s is the latest release (running a development build).\n", latest.TagName)
+				return
+			}
+			log.Fatal("This is a development build, which cannot verify releases; install a release from GitHub instead.")
+		}
+		order, err := compareVersions(latest.TagName, version)
+		if err != nil {
+			log.Fatalf("Failed to check for updates: %v", err)
+		}
+		switch {
+		case order == 0 && !*force:
+			fmt.Printf("drive-downloader %s is up to date.\n", version)
+			return
+		case order < 0 && !*force:
+			fmt.Printf("The latest release, %s, is older than drive-downloader %s; use -force to downgrade.\n", latest.TagName, version)
+			return
+		case *check:
+			fmt.Printf("drive-downloader %s is available (running %s).\n", latest.TagName, version)
+			return
+		}
+		if err := installRelease(ctx, latest); err != nil {
+			log.Fatalf("Failed to update: %v", err)
+		}
+		fmt.Printf("Updated drive-downloader from %s to %s.\n", version, latest.TagName)
+	}
+}
+
+// latestRelease retrieves the latest release from GitHub.
+func latestRelease(ctx context.Context) (*release, error) {
+	body, err := fetch(ctx, latestReleaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var r release
+	if err := json.NewDecoder(body).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// compareVersions compares two semantic versions such as "v1.2.3" or
+// "1.3.0-rc.1", returning -1, 0 or +1 as a is older than, the same as or
+// newer than b. A pre-release is older than its release; pre-releases are
+// compared by their identifiers, numeric ones numerically.
+func compareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range 3 {
+		if va.core[i] != vb.core[i] {
+			return cmp.Compare(va.core[i], vb.core[i]), nil
+		}
+	}
+	switch {
+	case va.pre == nil && vb.pre == nil:
+		return 0, nil
+	case va.pre == nil:
+		return 1, nil
+	case vb.pre == nil:
+		return -1, nil
+	}
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		x, errX := strconv.Atoi(va.pre[i])
+		y, errY := strconv.Atoi(vb.pre[i])
+		switch {
+		case errX == nil && errY == nil && x != y:
+			return cmp.Compare(x, y), nil
+		case errX == nil && errY != nil:
+			return -1, nil
+		case errX != nil && errY == nil:
+			return 1, nil
+		case va.pre[i] != vb.pre[i]:
+			return strings.Compare(va.pre[i], vb.pre[i]), nil
+		}
+	}
+	return cmp.Compare(len(va.pre), len(vb.pre)), nil
+}
+
+// semVersion is a parsed semantic version.
+type semVersion struct {
+	core [3]int   // major, minor and patch
+	pre  []string // pre-release identifiers, nil for a release
+}
+
+// parseVersion parses a semantic version, with or without a leading "v",
+// ignoring build metadata.
+func parseVersion(s string) (semVersion, error) {
+	var v semVersion
+	rest, _, _ := strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	rest, pre, hasPre := strings.Cut(rest, "-")
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("%q is not a semantic version", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("%q is not a semantic version", s)
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		v.pre = strings.Split(pre, ".")
+	}
+	return v, nil
+}
+
+// installRelease downloads the binary of a release for the current platform,
+// verifies it against the release checksums, whose signature is checked
+// against releaseKey and the tag of the release, and replaces the running
+// executable with it.
+func installRelease(ctx context.Context, r *release) error {
+	name := fmt.Sprintf("drive-downloader_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	binaryURL, ok := r.asset(name)
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	checksums, err := signedChecksums(ctx, r)
+	if err != nil {
+		return err
+	}
+	want, err := releaseChecksum(checksums, name)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	// The new binary is written next to the old one so that it can be
+	// renamed over it.
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".drive-downloader-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	body, err := fetch(ctx, binaryURL)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+
+	// Windows cannot replace a running executable, but can rename it.
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(old)
+	}
+	return nil
+}
+
+// signedPayload returns what the signature of a release covers: a line
+// naming the version of the release followed by its checksums file. Signing
+// the version too keeps the checksums and binaries of an older release from
+// being republished under a newer tag to get past the downgrade check.
+func signedPayload(version string, checksums []byte) []byte {
+	payload := fmt.Appendf(nil, "drive-downloader %s\n", version)
+	return append(payload, checksums...)
+}
+
+// signedChecksums downloads the checksums file of a release and verifies its
+// detached signature against releaseKey and the tag of the release, so that
+// publishing a binary with a matching checksum, or a signed release under
+// another tag, is not enough to have it installed.
+func signedChecksums(ctx context.Context, r *release) ([]byte, error) {
+	if releaseKey == "" {
+		return nil, errors.New("this build has no release key to verify releases with")
+	}
+	key, err := base64.StdEncoding.DecodeString(releaseKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("this build has an invalid release key")
+	}
+	checksums, err := fetchAsset(ctx, r, checksumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := fetchAsset(ctx, r, signatureAsset)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), signedPayload(r.TagName, checksums), signature) {
+		return nil, fmt.Errorf("the signature of %s is not valid for release %s", checksumsAsset, r.TagName)
+	}
+	return checksums, nil
+}
+
+// fetchAsset downloads the named asset of a release.
+func fetchAsset(ctx context.Context, r *release, name string) ([]byte, error) {
+	url, ok := r.asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s to verify the binary with", r.TagName, name)
+	}
+	body, err := fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// releaseChecksum returns the SHA-256 checksum of the named asset listed in
+// a checksums file.
+func releaseChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s lists no checksum for %s", checksumsAsset, name)
+}
+
+// fetch opens the body of a GET request, failing on non-200 responses.
+func fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "drive-downloader/"+version)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response from %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
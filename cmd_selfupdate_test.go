@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v1.2.3", "v2.0.0", -1},
+		{"v1.2.3-rc.1", "v1.2.3", -1},
+		{"v1.2.3-rc.2", "v1.2.3-rc.10", -1},
+		{"v1.2.3-beta", "v1.2.3-alpha", 1},
+		{"v1.2.3-rc.1", "v1.2.3-rc.1.1", -1},
+		{"v1.2.3+build.5", "v1.2.3", 0},
+	}
+	for _, tt := range tests {
+		got, err := compareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("compareVersions(%q, %q): %v", tt.a, tt.b, err)
+		} else if got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	for _, s := range []string{"dev", "v1.2", "v1.x.3"} {
+		if _, err := compareVersions(s, "v1.0.0"); err == nil {
+			t.Errorf("compareVersions(%q) succeeded", s)
+		}
+	}
+}
+
+func TestSignedChecksumsRefusesReplayedRelease(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(key string) { releaseKey = key }(releaseKey)
+	releaseKey = base64.StdEncoding.EncodeToString(public)
+
+	checksums := []byte("0123abcd  drive-downloader_linux_amd64\n")
+	signature := ed25519.Sign(private, signedPayload("v1.0.0", checksums))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + checksumsAsset:
+			w.Write(checksums)
+		case "/" + signatureAsset:
+			w.Write(signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	releaseWithTag := func(tag string) *release {
+		r := &release{TagName: tag}
+		for _, name := range []string{checksumsAsset, signatureAsset} {
+			r.Assets = append(r.Assets, struct {
+				Name string `json:"name"`
+				URL  string `json:"browser_download_url"`
+			}{name, srv.URL + "/" + name})
+		}
+		return r
+	}
+	ctx := context.Background()
+	got, err := signedChecksums(ctx, releaseWithTag("v1.0.0"))
+	if err != nil {
+		t.Fatalf("signedChecksums of the signed release: %v", err)
+	}
+	if string(got) != string(checksums) {
+		t.Errorf("signedChecksums = %q, want %q", got, checksums)
+	}
+	// The same assets republished under a newer tag must be refused, or
+	// they would get past the downgrade check.
+	if _, err := signedChecksums(ctx, releaseWithTag("v1.1.0")); err == nil {
+		t.Error("signedChecksums accepted the signature of v1.0.0 for v1.1.0")
+	}
+}
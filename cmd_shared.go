@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// coordinateCommand defines the "coordinate" subcommand, which publishes the
+// files of a folder to a shared job directory for "work" processes to
+// download, then waits for them and writes the manifest of the download.
+func coordinateCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("coordinate", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	folderLink := fs.String("folder", "", "Google Drive folder link")
+	jobDir := fs.String("job", "", "shared job directory")
+	dest := fs.String("dest", "", "shared destination directory")
+	quotaUser := fs.String("quota-user", "", "quotaUser the coordinator and the workers of the job send with every request, to apply rate limits per tenant")
+	return fs, func() {
+		if *folderLink == "" || *jobDir == "" || *dest == "" {
+			log.Fatal("-folder, -job and -dest are required")
+		}
+
+		folderID, err := drive.ExtractFolderID(*folderLink)
+		if err != nil {
+			log.Fatal(err)
+		}
+		driveClient, job := openSharedJob(*credentialsFilePath, *jobDir)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if *quotaUser != "" {
+			ctx = drive.WithQuotaUser(ctx, *quotaUser)
+		}
+
+		if err := driveClient.PublishFolder(ctx, job, folderID, *dest); err != nil {
+			log.Fatalf("Failed to publish folder: %v", err)
+		}
+		log.Println("Folder published; waiting for workers.")
+		if err := driveClient.WaitSharedJob(ctx, job, *dest); err != nil {
+			logSharedFailures(err)
+			log.Fatalf("Shared download failed: %v", err)
+		}
+		progress, _ := job.Progress()
+		fmt.Printf("Shared download completed successfully: %d file(s) downloaded.\n", progress.Done)
+	}
+}
+
+// workCommand defines the "work" subcommand, which downloads files published
+// to a shared job directory by "coordinate" until the job is finished.
+func workCommand() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet("work", flag.ExitOnError)
+	credentialsFilePath := credentialsFlag(fs)
+	jobDir := fs.String("job", "", "shared job directory")
+	dest := fs.String("dest", "", "shared destination directory")
+	concurrency := fs.Int("concurrency", 4, "number of files to download at the same time")
+	return fs, func() {
+		if *jobDir == "" || *dest == "" {
+			log.Fatal("-job and -dest are required")
+		}
+
+		driveClient, job := openSharedJob(*credentialsFilePath, *jobDir)
+		driveClient.Concurrency = *concurrency
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if err := driveClient.WorkSharedJob(ctx, job, *dest); err != nil {
+			logSharedFailures(err)
+			log.Fatalf("Shared download failed: %v", err)
+		}
+		fmt.Println("No work left in the shared job.")
+	}
+}
+
+// openSharedJob creates the Drive client and opens the job directory of the
+// shared download subcommands.
+func openSharedJob(credentials, dir string) (*drive.Client, *drive.SharedJob) {
+	driveClient, err := newClient(credentials)
+	if err != nil {
+		log.Fatalf("Failed to initialize Google Drive client: %v", err)
+	}
+	job, err := drive.OpenSharedJob(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return driveClient, job
+}
+
+// logSharedFailures lists the files a shared download failed to download.
+func logSharedFailures(err error) {
+	var downloadErr *drive.DownloadError
+	if errors.As(err, &downloadErr) {
+		for _, failure := range downloadErr.Failures {
+			log.Printf("  %s: %v", failure.Path, failure.Err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Config is the contents of a JSON configuration file.
+type Config struct {
+	// Flags holds default values for command-line flags, keyed by flag name,
+	// e.g. {"dest": "/srv/backup", "max-depth": 2, "watch": "15m"}.
+	Flags map[string]any `json:"flags,omitempty"`
+	// Routes move downloaded files into directories by name, e.g.
+	// ["*.jpg -> Photos/", "*.pdf -> Documents/"]; the first match applies.
+	Routes []string `json:"routes,omitempty"`
+	// Jobs holds named downloads saved with "job save", each as the flags
+	// it was saved with, keyed by flag name like Flags.
+	Jobs map[string]map[string]any `json:"jobs,omitempty"`
+	// Profiles maps the names of the credentials saved with "auth setup"
+	// to the -credentials value they stand for.
+	Profiles map[string]string `json:"profiles,omitempty"`
+}
+
+// LoadConfig reads a configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var config Config
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// Save writes the configuration to path, replacing it atomically.
+func (config *Config) Save(path string) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+	return nil
+}
+
+// apply sets every flag of fs that was not given on the command line to its
+// value from the configuration.
+func (config *Config) apply(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for name, value := range config.Flags {
+		if explicit[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %q in configuration", name)
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("invalid value for %q in configuration: %w", name, err)
+		}
+	}
+	return nil
+}
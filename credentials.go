@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// secretManagerURL is the Secret Manager endpoint returning a secret version.
+const secretManagerURL = "https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/%s:access"
+
+// credentialsOption returns the client option for a -credentials value,
+// which is one of:
+//
+//	path/to/key.json          a service account key file
+//	env:NAME                  the key JSON held in environment variable NAME
+//	keychain:SERVICE/ACCOUNT  the key JSON stored in the OS keychain
+//	sm://PROJECT/SECRET[/VERSION]
+//	                          the key JSON stored in Google Secret Manager
+//	profile:NAME              the credentials saved as NAME by "auth setup"
+//	                          in the configuration configPath, if given, or
+//	                          that of defaultConfigPath
+//
+// An empty value selects Application Default Credentials.
+func credentialsOption(ctx context.Context, source, configPath string) (drive.Option, error) {
+	var key []byte
+	var err error
+	switch {
+	case source == "":
+		return drive.WithCredentialsFile(""), nil
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		key = []byte(value)
+	case strings.HasPrefix(source, "keychain:"):
+		key, err = keychainSecret(ctx, strings.TrimPrefix(source, "keychain:"))
+	case strings.HasPrefix(source, "sm://"):
+		key, err = secretManagerSecret(ctx, strings.TrimPrefix(source, "sm://"))
+	case strings.HasPrefix(source, "profile:"):
+		saved, err := profileSource(strings.TrimPrefix(source, "profile:"), configPath)
+		if err != nil {
+			return nil, err
+		}
+		return credentialsOption(ctx, saved, configPath)
+	default:
+		return drive.WithCredentialsFile(source), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials from %s: %w", source, err)
+	}
+	return drive.WithCredentialsJSON(key), nil
+}
+
+// profileSource returns the -credentials value saved as the profile name,
+// looking it up in the configuration configPath, if given, and then in that
+// of defaultConfigPath. Profiles naming other profiles are refused, so that
+// they cannot loop.
+func profileSource(name, configPath string) (string, error) {
+	var searched []string
+	for _, path := range []string{configPath, defaultConfigPath()} {
+		if path == "" || slices.Contains(searched, path) {
+			continue
+		}
+		searched = append(searched, path)
+		config, err := loadJobs(path)
+		if err != nil {
+			return "", err
+		}
+		if saved, ok := config.Profiles[name]; ok && !strings.HasPrefix(saved, "profile:") {
+			return saved, nil
+		}
+	}
+	return "", fmt.Errorf("no profile named %q in %s; save one with \"auth setup -profile %s\", or give the configuration holding it with -config or %s", name, strings.Join(searched, " or "), name, configEnv)
+}
+
+// keychainSecret reads a secret stored as SERVICE/ACCOUNT in the macOS
+// keychain or, on Linux, the Secret Service (GNOME Keyring, KWallet).
+func keychainSecret(ctx context.Context, name string) ([]byte, error) {
+	service, account, ok := strings.Cut(name, "/")
+	if !ok {
+		return nil, errors.New("expected keychain:SERVICE/ACCOUNT")
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return nil, fmt.Errorf("the keychain is not supported on %s", runtime.GOOS)
+	}
+	cmd.Stderr = os.Stderr
+	secret, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(secret))), nil
+}
+
+// secretManagerSecret reads PROJECT/SECRET[/VERSION] from Google Secret
+// Manager, authenticating with Application Default Credentials.
+func secretManagerSecret(ctx context.Context, name string) ([]byte, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) == 2 {
+		parts = append(parts, "latest")
+	}
+	if len(parts) != 3 {
+		return nil, errors.New("expected sm://PROJECT/SECRET[/VERSION]")
+	}
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(secretManagerURL, parts[0], parts[1], parts[2]), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(version.Payload.Data)
+}
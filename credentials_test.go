@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialsKind(t *testing.T) {
+	tests := []struct {
+		data, want, err string
+	}{
+		{`{"type": "service_account", "client_email": "a@b.iam.gserviceaccount.com"}`, kindServiceAccount, ""},
+		{`{"type": "authorized_user", "refresh_token": "x"}`, kindAuthorizedUser, ""},
+		{`{"installed": {"client_id": "x"}}`, kindOAuthClient, ""},
+		{`{"web": {"client_id": "x"}}`, "", "Desktop app"},
+		{`{"foo": 1}`, "", "unrecognized credentials"},
+		{`not json`, "", "not a JSON credentials file"},
+	}
+	for _, tt := range tests {
+		got, err := credentialsKind([]byte(tt.data))
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("credentialsKind(%s) error = %v, want one mentioning %q", tt.data, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("credentialsKind(%s): %v", tt.data, err)
+		case got != tt.want:
+			t.Errorf("credentialsKind(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCredentialsProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	config := &Config{Profiles: map[string]string{
+		"work": "env:DRIVE_TEST_KEY",
+		"loop": "profile:work",
+	}}
+	if err := config.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configEnv, path)
+	if got := defaultConfigPath(); got != path {
+		t.Fatalf("defaultConfigPath() = %q, want %q from %s", got, path, configEnv)
+	}
+	ctx := context.Background()
+
+	// The profile resolves to the source it was saved with.
+	if _, err := credentialsOption(ctx, "profile:work", ""); err == nil || !strings.Contains(err.Error(), "DRIVE_TEST_KEY is not set") {
+		t.Errorf("profile:work without its key: error = %v, want the missing variable of the profile", err)
+	}
+	t.Setenv("DRIVE_TEST_KEY", `{"type": "service_account"}`)
+	if _, err := credentialsOption(ctx, "profile:work", ""); err != nil {
+		t.Errorf("profile:work: %v", err)
+	}
+	for _, source := range []string{"profile:missing", "profile:loop"} {
+		if _, err := credentialsOption(ctx, source, ""); err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("%s: error = %v, want a missing profile in %s", source, err, path)
+		}
+	}
+
+	// Without a configuration, no profile is found.
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := credentialsOption(ctx, "profile:work", ""); err == nil {
+		t.Error("profile:work found without a configuration")
+	}
+}
+
+func TestCredentialsProfileFromConfigFlag(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "work.json")
+	config := &Config{Profiles: map[string]string{"work": "env:DRIVE_TEST_KEY"}}
+	if err := config.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	defaults := filepath.Join(dir, "defaults.json")
+	config = &Config{Profiles: map[string]string{"home": "env:DRIVE_TEST_KEY"}}
+	if err := config.Save(defaults); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configEnv, defaults)
+	t.Setenv("DRIVE_TEST_KEY", `{"type": "service_account"}`)
+	ctx := context.Background()
+
+	// A download given -config finds the profiles saved there by
+	// "auth -config FILE setup", and still those of the default
+	// configuration.
+	settings, err := parseDownloadFlags([]string{"-config", path, "-credentials", "profile:work", "-folder", "FOLDER"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := credentialsOption(ctx, settings.credentials, settings.configPath); err != nil {
+		t.Errorf("profile:work with -config %s: %v", path, err)
+	}
+	if _, err := credentialsOption(ctx, "profile:home", settings.configPath); err != nil {
+		t.Errorf("profile:home with -config %s: %v", path, err)
+	}
+	if _, err := credentialsOption(ctx, "profile:work", ""); err == nil {
+		t.Error("profile:work found without -config")
+	}
+	_, err = credentialsOption(ctx, "profile:missing", path)
+	if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), defaults) {
+		t.Errorf("profile:missing: error = %v, want one naming %s and %s", err, path, defaults)
+	}
+}
@@ -0,0 +1,152 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// AfterDownloadAction is done remotely to the files of a folder once they
+// were downloaded, so that a pipeline downloading an inbox folder does not
+// process them twice.
+type AfterDownloadAction int
+
+const (
+	// AfterDownloadNone leaves the files in place.
+	AfterDownloadNone AfterDownloadAction = iota
+	// AfterDownloadMove moves the files into the folder named by the target
+	// of the AfterDownload.
+	AfterDownloadMove
+	// AfterDownloadTrash moves the files to the trash.
+	AfterDownloadTrash
+	// AfterDownloadLabel applies the Drive label whose ID is the target of
+	// the AfterDownload to the files.
+	AfterDownloadLabel
+)
+
+// AfterDownload is what is done remotely to every downloaded file; see
+// Client.AfterDownload.
+type AfterDownload struct {
+	Action AfterDownloadAction
+	// Target is the ID of the folder files are moved to, or of the label
+	// applied to them.
+	Target string
+}
+
+// ParseAfterDownload parses an action done to downloaded files: "move-to:ID"
+// (a folder ID or link), "trash" or "label:ID". An empty string selects no
+// action.
+func ParseAfterDownload(s string) (AfterDownload, error) {
+	action, target, _ := strings.Cut(strings.TrimSpace(s), ":")
+	target = strings.TrimSpace(target)
+	switch strings.ToLower(action) {
+	case "":
+		return AfterDownload{}, nil
+	case "trash":
+		if target != "" {
+			return AfterDownload{}, fmt.Errorf("unexpected target %q for trash", target)
+		}
+		return AfterDownload{Action: AfterDownloadTrash}, nil
+	case "move-to":
+		id, err := ExtractFolderID(target)
+		if err != nil {
+			return AfterDownload{}, fmt.Errorf("invalid folder to move to: %w", err)
+		}
+		return AfterDownload{Action: AfterDownloadMove, Target: id}, nil
+	case "label":
+		if target == "" {
+			return AfterDownload{}, errors.New(`missing label ID (want "label:ID")`)
+		}
+		return AfterDownload{Action: AfterDownloadLabel, Target: target}, nil
+	}
+	return AfterDownload{}, fmt.Errorf(`unknown action %q (want "move-to:FOLDER", "trash" or "label:ID")`, action)
+}
+
+// String returns the action as ParseAfterDownload reads it.
+func (a AfterDownload) String() string {
+	switch a.Action {
+	case AfterDownloadMove:
+		return "move-to:" + a.Target
+	case AfterDownloadTrash:
+		return "trash"
+	case AfterDownloadLabel:
+		return "label:" + a.Target
+	}
+	return ""
+}
+
+// checkAfterDownload fails fast if the client's AfterDownload cannot be
+// done, which needs credentials granted the full scope.
+func (c *Client) checkAfterDownload(ctx context.Context) error {
+	if c.AfterDownload.Action == AfterDownloadNone {
+		return nil
+	}
+	if c.anonymous() {
+		return ErrAnonymous
+	}
+	return c.requireScope(ctx, FullScope)
+}
+
+// afterDownload does the client's AfterDownload to the files of m, given the
+// error the download returned, and returns the error of the whole. It is
+// called once the manifest was saved, so that files only leave the folder
+// once their download is recorded. Nothing is done if the download did not
+// complete; files that failed are left in place, and the files the action
+// fails for are reported with them through a *DownloadError.
+func (c *Client) afterDownload(ctx context.Context, m *Manifest, err error) error {
+	var downloadErr *DownloadError
+	if c.AfterDownload.Action == AfterDownloadNone || err != nil && !errors.As(err, &downloadErr) {
+		return err
+	}
+	var failures []Failure
+	skip := make(map[string]bool)
+	if downloadErr != nil {
+		failures = downloadErr.Failures
+		for _, failure := range failures {
+			skip[failure.ID] = true
+		}
+	}
+	for _, entry := range m.Files {
+		if skip[entry.ID] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.afterDownloadFile(ctx, entry.ID); err != nil {
+			c.logf("Failed to %s %s: %v", c.AfterDownload, entry.Path, err)
+			failures = append(failures, Failure{ID: entry.ID, Path: entry.Path, Err: fmt.Errorf("after download: %w", err)})
+		}
+	}
+	if len(failures) > 0 {
+		return &DownloadError{Failures: failures}
+	}
+	return nil
+}
+
+// afterDownloadFile does the client's AfterDownload to a file.
+func (c *Client) afterDownloadFile(ctx context.Context, id string) error {
+	switch c.AfterDownload.Action {
+	case AfterDownloadMove:
+		file, err := c.Service.Files.Get(id).Fields("parents").Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		_, err = c.Service.Files.Update(id, &drivev3.File{}).
+			AddParents(c.AfterDownload.Target).
+			RemoveParents(strings.Join(file.Parents, ",")).
+			Fields("id").Context(ctx).Do()
+		return err
+	case AfterDownloadTrash:
+		_, err := c.Service.Files.Update(id, &drivev3.File{Trashed: true}).Fields("id").Context(ctx).Do()
+		return err
+	case AfterDownloadLabel:
+		req := &drivev3.ModifyLabelsRequest{LabelModifications: []*drivev3.LabelModification{{LabelId: c.AfterDownload.Target}}}
+		_, err := c.Service.Files.ModifyLabels(id, req).Context(ctx).Do()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package drive
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Drive API call kinds counted by APIStats.
+const (
+	CallList     = "list"
+	CallGet      = "get"
+	CallDownload = "download"
+	CallExport   = "export"
+	CallAbout    = "about"
+	CallOther    = "other"
+)
+
+// DefaultQueriesPerMinute is the Drive API's default per-user query quota.
+// Every request counts as one query, whatever its kind.
+const DefaultQueriesPerMinute = 12000
+
+// APIStats counts the Drive API requests made by a client, by kind, the
+// failed ones, the bytes received and the files it transferred.
+type APIStats struct {
+	mu       sync.Mutex
+	start    time.Time
+	calls    map[string]int64
+	errors   int64
+	received int64
+	files    int64
+	bytes    int64
+}
+
+// newAPIStats returns empty statistics starting now.
+func newAPIStats() *APIStats {
+	return &APIStats{start: time.Now(), calls: make(map[string]int64)}
+}
+
+// add counts one request of the given kind.
+func (s *APIStats) add(kind string) {
+	s.mu.Lock()
+	s.calls[kind]++
+	s.mu.Unlock()
+}
+
+// addError counts a request that failed or returned an error status.
+func (s *APIStats) addError() {
+	s.mu.Lock()
+	s.errors++
+	s.mu.Unlock()
+}
+
+// addReceived counts bytes received in response bodies.
+func (s *APIStats) addReceived(n int64) {
+	s.mu.Lock()
+	s.received += n
+	s.mu.Unlock()
+}
+
+// addFile counts a downloaded or exported file of the given size.
+func (s *APIStats) addFile(size int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.files++
+	s.bytes += size
+	s.mu.Unlock()
+}
+
+// Files returns the number of files downloaded or exported so far. Files
+// skipped because they were unchanged or moved locally are not counted.
+func (s *APIStats) Files() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files
+}
+
+// Bytes returns the number of bytes written for the files counted by Files.
+func (s *APIStats) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Errors returns the number of requests that failed or returned an error
+// status so far, including those retried successfully.
+func (s *APIStats) Errors() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errors
+}
+
+// Received returns the number of bytes received in response bodies so far,
+// as they arrive, including those of files still downloading.
+func (s *APIStats) Received() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+// Calls returns the number of requests made so far, by kind.
+func (s *APIStats) Calls() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make(map[string]int64, len(s.calls))
+	for kind, n := range s.calls {
+		calls[kind] = n
+	}
+	return calls
+}
+
+// Total returns the number of requests made so far.
+func (s *APIStats) Total() int64 {
+	var total int64
+	for _, n := range s.Calls() {
+		total += n
+	}
+	return total
+}
+
+// Elapsed returns the time since the statistics started.
+func (s *APIStats) Elapsed() time.Duration {
+	return time.Since(s.start)
+}
+
+// Kinds returns the kinds of requests made so far, in a stable order.
+func (s *APIStats) Kinds() []string {
+	order := map[string]int{CallList: 0, CallGet: 1, CallExport: 2, CallDownload: 3, CallAbout: 4}
+	calls := s.Calls()
+	kinds := make([]string, 0, len(calls))
+	for kind := range calls {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		oi, ok := order[kinds[i]]
+		if !ok {
+			oi = len(order)
+		}
+		oj, ok := order[kinds[j]]
+		if !ok {
+			oj = len(order)
+		}
+		return oi < oj || oi == oj && kinds[i] < kinds[j]
+	})
+	return kinds
+}
+
+// apiCallKind classifies a request to the Drive API, or to the public Drive
+// endpoints used by anonymous clients.
+func apiCallKind(req *http.Request) string {
+	p := req.URL.Path
+	switch {
+	case strings.HasPrefix(p, "/drive/v3/about"):
+		return CallAbout
+	case p == "/drive/v3/files" || p == "/embeddedfolderview":
+		return CallList
+	case strings.HasSuffix(p, "/export") || strings.Contains(p, "/export/"):
+		return CallExport
+	case req.URL.Query().Get("alt") == "media" || p == "/uc":
+		return CallDownload
+	case strings.HasPrefix(p, "/drive/v3/files/"):
+		return CallGet
+	}
+	return CallOther
+}
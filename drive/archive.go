@@ -0,0 +1,217 @@
+package drive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveTrailerSize is reserved in every volume for the end-of-archive
+// records (zip central directory end, tar end blocks).
+const archiveTrailerSize = 1024
+
+// archiveSink stores files in a zip or tar archive. When a volume size is set,
+// the archive is split into numbered volumes, each a complete archive of its
+// own, and files are never split across volumes. It is safe for concurrent
+// use; files are spooled in parallel and written to the archive one at a time.
+type archiveSink struct {
+	base, ext  string // archive path without and with its extension
+	volumeSize int64
+
+	mu sync.Mutex // guards the fields below
+
+	volumes []string          // file names of the volumes written so far
+	index   map[string]string // relative path to volume file name
+
+	file *os.File
+	size *countingWriter
+	zw   *zip.Writer
+	tw   *tar.Writer
+}
+
+// newArchiveSink prepares an archive at path, whose extension (.zip or .tar)
+// selects the format.
+func newArchiveSink(path string, volumeSize int64) (*archiveSink, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".zip" && ext != ".tar" {
+		return nil, fmt.Errorf("unsupported archive format %q: use .zip or .tar", filepath.Ext(path))
+	}
+	return &archiveSink{
+		base:       strings.TrimSuffix(path, filepath.Ext(path)),
+		ext:        ext,
+		volumeSize: volumeSize,
+		index:      make(map[string]string),
+	}, nil
+}
+
+func (a *archiveSink) Mkdir(relPath string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.ensureVolume(0); err != nil {
+		return err
+	}
+	var err error
+	if a.zw != nil {
+		_, err = a.zw.Create(relPath + "/")
+	} else {
+		err = a.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: relPath + "/", Mode: 0o755, ModTime: time.Now()})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write folder to archive: %w", err)
+	}
+	return nil
+}
+
+func (a *archiveSink) Save(relPath string, modTime time.Time, r io.Reader) (int64, string, error) {
+	// Spool the content to a temporary file first: tar headers need the
+	// size up front, and the size decides which volume the file goes to.
+	tmp, err := os.CreateTemp(filepath.Dir(a.base), ".drive-spool-*")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return n, "", fmt.Errorf("failed to save file: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return n, "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ensureVolume(a.entrySize(relPath, n)); err != nil {
+		return n, "", err
+	}
+	if a.zw != nil {
+		var w io.Writer
+		if w, err = a.zw.CreateHeader(&zip.FileHeader{Name: relPath, Method: zip.Deflate, Modified: modTime}); err == nil {
+			_, err = io.Copy(w, tmp)
+		}
+		if err == nil {
+			err = a.zw.Flush()
+		}
+	} else {
+		if err = a.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: relPath, Size: n, Mode: 0o644, ModTime: modTime}); err == nil {
+			_, err = io.Copy(a.tw, tmp)
+		}
+		if err == nil {
+			err = a.tw.Flush()
+		}
+	}
+	if err != nil {
+		return n, "", fmt.Errorf("failed to write file to archive: %w", err)
+	}
+	a.index[relPath] = a.volumes[len(a.volumes)-1]
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// entrySize estimates the space a file of size bytes takes in a volume,
+// including headers and worst-case deflate expansion.
+func (a *archiveSink) entrySize(relPath string, size int64) int64 {
+	if a.ext == ".zip" {
+		return size + size/1000 + 2*int64(len(relPath)) + 256
+	}
+	return 1024 + (size+511)/512*512 + int64(len(relPath))
+}
+
+// ensureVolume makes sure a volume with room for an entry of the given size
+// is open, starting a new volume if the current one would grow too large. An
+// entry larger than the volume size gets a volume of its own.
+func (a *archiveSink) ensureVolume(entrySize int64) error {
+	if a.file != nil {
+		if a.volumeSize <= 0 || a.size.n+entrySize+archiveTrailerSize <= a.volumeSize {
+			return nil
+		}
+		if err := a.closeVolume(); err != nil {
+			return err
+		}
+	}
+
+	name := a.base + a.ext
+	if a.volumeSize > 0 {
+		name = fmt.Sprintf("%s.%03d%s", a.base, len(a.volumes)+1, a.ext)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	a.file = f
+	a.size = &countingWriter{w: f}
+	if a.ext == ".zip" {
+		a.zw = zip.NewWriter(a.size)
+	} else {
+		a.tw = tar.NewWriter(a.size)
+	}
+	a.volumes = append(a.volumes, filepath.Base(name))
+	return nil
+}
+
+// closeVolume finishes the current volume.
+func (a *archiveSink) closeVolume() error {
+	var err error
+	if a.zw != nil {
+		err = a.zw.Close()
+	} else {
+		err = a.tw.Close()
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.file, a.zw, a.tw = nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// Close finishes the last volume and, for split archives, writes the index
+// mapping every file to its volume.
+func (a *archiveSink) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil {
+		if err := a.closeVolume(); err != nil {
+			return err
+		}
+	}
+	if a.volumeSize <= 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(struct {
+		Volumes []string          `json:"volumes"`
+		Files   map[string]string `json:"files"`
+	}{a.volumes, a.index}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(a.base+".index.json", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
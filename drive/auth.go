@@ -0,0 +1,131 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+// cloudPlatformScope is requested for the credentials that impersonate a
+// service account.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// An AuthProvider supplies the credentials of a client; see WithAuth. The
+// providers of this package cover service accounts, OAuth users,
+// Application Default Credentials, API keys and impersonation; library
+// users can implement it to obtain tokens some other way.
+type AuthProvider interface {
+	// TokenSource returns the source of the OAuth tokens sent with every
+	// request, granted the given scopes. A nil TokenSource sends requests
+	// without tokens.
+	TokenSource(ctx context.Context, scopes []string) (oauth2.TokenSource, error)
+}
+
+// ServiceAccount authenticates with a JSON key file, read from File unless
+// JSON holds its contents. Any credentials file google.CredentialsFromJSON
+// accepts works, including authorized users and workload identity
+// federation configurations. Subject, if set, is the user a service account
+// with domain-wide delegation acts as.
+type ServiceAccount struct {
+	File    string
+	JSON    []byte
+	Subject string
+}
+
+// TokenSource implements AuthProvider.
+func (a ServiceAccount) TokenSource(ctx context.Context, scopes []string) (oauth2.TokenSource, error) {
+	json := a.JSON
+	if json == nil {
+		var err error
+		if json, err = os.ReadFile(a.File); err != nil {
+			return nil, fmt.Errorf("failed to read credentials file: %w", err)
+		}
+	}
+	creds, err := google.CredentialsFromJSONWithParams(ctx, json, google.CredentialsParams{Scopes: scopes, Subject: a.Subject})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credentials from JSON: %w", err)
+	}
+	return creds.TokenSource, nil
+}
+
+// OAuthUser authenticates as a user who authorized Config, with Token as
+// obtained from Config's authorization flow. The token is refreshed as
+// needed; the scopes are those of Config.
+type OAuthUser struct {
+	Config *oauth2.Config
+	Token  *oauth2.Token
+}
+
+// TokenSource implements AuthProvider.
+func (a OAuthUser) TokenSource(ctx context.Context, scopes []string) (oauth2.TokenSource, error) {
+	if a.Config == nil || a.Token == nil {
+		return nil, fmt.Errorf("OAuth user credentials need a config and a token")
+	}
+	return a.Config.TokenSource(ctx, a.Token), nil
+}
+
+// ADC authenticates with Application Default Credentials, for instance the
+// service account named by GOOGLE_APPLICATION_CREDENTIALS or that of the
+// Compute Engine instance.
+type ADC struct{}
+
+// TokenSource implements AuthProvider.
+func (ADC) TokenSource(ctx context.Context, scopes []string) (oauth2.TokenSource, error) {
+	creds, err := google.FindDefaultCredentials(ctx, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find default credentials: %w", err)
+	}
+	return creds.TokenSource, nil
+}
+
+// APIKey authenticates with an API key instead of tokens; see WithAPIKey.
+type APIKey string
+
+// TokenSource implements AuthProvider. API keys are sent by the client
+// itself, so no tokens are needed.
+func (APIKey) TokenSource(ctx context.Context, scopes []string) (oauth2.TokenSource, error) {
+	return nil, nil
+}
+
+// Impersonated authenticates as the service account TargetPrincipal,
+// through the credentials of Base (Application Default Credentials if nil),
+// which must be allowed to create tokens for it. Delegates lists the
+// service accounts of a delegation chain, if any, and Subject, if set, is
+// the user a service account with domain-wide delegation acts as.
+type Impersonated struct {
+	Base            AuthProvider
+	TargetPrincipal string
+	Delegates       []string
+	Subject         string
+}
+
+// TokenSource implements AuthProvider.
+func (a Impersonated) TokenSource(ctx context.Context, scopes []string) (oauth2.TokenSource, error) {
+	base := a.Base
+	if base == nil {
+		base = ADC{}
+	}
+	tokens, err := base.TokenSource(ctx, []string{cloudPlatformScope})
+	if err != nil {
+		return nil, err
+	}
+	var opts []option.ClientOption
+	if tokens != nil {
+		opts = append(opts, option.WithTokenSource(tokens))
+	}
+	source, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: a.TargetPrincipal,
+		Scopes:          scopes,
+		Delegates:       a.Delegates,
+		Subject:         a.Subject,
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to impersonate %s: %w", a.TargetPrincipal, err)
+	}
+	return source, nil
+}
@@ -0,0 +1,277 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// Sections of a bundle made by DownloadBundle, which are also the names of
+// their directories.
+const (
+	// BundleMyDrive holds the whole My Drive of the user.
+	BundleMyDrive = "My Drive"
+	// BundleSharedWithMe holds the files and folders shared with the user.
+	BundleSharedWithMe = "Shared with me"
+	// BundleStarred holds the files and folders the user starred.
+	BundleStarred = "Starred"
+)
+
+// BundleSections lists every section of a bundle, in the order they are
+// downloaded.
+var BundleSections = []string{BundleMyDrive, BundleSharedWithMe, BundleStarred}
+
+// BundleIndexName is the name of the HTML index written to the root of a
+// bundle.
+const BundleIndexName = "index.html"
+
+// bundleQueries maps the sections made of the items matching a query to the
+// query and to the ID their manifests record in place of a folder ID.
+var bundleQueries = map[string]struct{ id, query string }{
+	BundleSharedWithMe: {"sharedWithMe", sharedWithMeQuery},
+	BundleStarred:      {"starred", "starred = true and trashed = false"},
+}
+
+// ParseBundleSections parses a comma-separated list of bundle sections:
+// "my-drive", "shared" and "starred". An empty list selects every section.
+func ParseBundleSections(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return BundleSections, nil
+	}
+	var sections []string
+	for _, name := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "my-drive", "mydrive":
+			sections = append(sections, BundleMyDrive)
+		case "shared", "shared-with-me":
+			sections = append(sections, BundleSharedWithMe)
+		case "starred":
+			sections = append(sections, BundleStarred)
+		default:
+			return nil, fmt.Errorf("unknown bundle section %q", name)
+		}
+	}
+	return sections, nil
+}
+
+// DownloadBundle downloads what the user of the client has in Drive into a
+// directory, as a lightweight alternative to Google Takeout: the given
+// sections (every section if none) are each downloaded into a directory of
+// dest named after them, and an index.html listing every file with links to
+// it and to Drive is written to the root. With a service account, WithSubject
+// selects the user whose Drive is bundled.
+//
+// Every section is a download of its own, with its manifest, so that bundling
+// again only transfers what changed. My Drive is downloaded like
+// DownloadFolder; the items shared with the user and the starred ones are
+// downloaded at the top of their section, folders with all their content.
+// MaxPathLength only applies to My Drive. A section that fails does not stop
+// the others; the errors are returned together once the index is written.
+func (c *Client) DownloadBundle(ctx context.Context, dest string, sections []string) error {
+	if len(sections) == 0 {
+		sections = BundleSections
+	}
+	root := c.dirSink(dest)
+	var errs []error
+	for _, section := range sections {
+		if err := root.Mkdir(section); err != nil {
+			return err
+		}
+		c.logf("Downloading %s", section)
+		dir := filepath.Join(dest, section)
+		var err error
+		if q, ok := bundleQueries[section]; ok {
+			var plan *Plan
+			if plan, err = c.planQuery(ctx, q.id, q.query, dir); err == nil {
+				err = c.ApplyPlan(ctx, plan)
+			}
+		} else {
+			err = c.DownloadFolder(ctx, "root", dir)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			c.logf("Failed to download %s: %v", section, err)
+			errs = append(errs, fmt.Errorf("%s: %w", section, err))
+		}
+	}
+	if err := writeBundleIndex(dest, sections); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// planQuery plans the download into downloadPath of the items matching query
+// as if they were the content of a folder with the given ID: files at the top
+// of downloadPath, and folders with all their content.
+func (c *Client) planQuery(ctx context.Context, id, query, downloadPath string) (*Plan, error) {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return nil, err
+	}
+	names := c.newFolderNames()
+	var top []namedFile
+	_, err := c.listPages(ctx, query, fileFields, nil, func(page []*drivev3.File) error {
+		for _, file := range page {
+			if name, ok := names.add(ctx, file); ok {
+				top = append(top, namedFile{file: file, name: name})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.planTop(ctx, id, append(top, names.flush()...), downloadPath)
+}
+
+// planTop plans the download into downloadPath of the named items as if they
+// were the content of a folder with the given ID: files at the top of
+// downloadPath, and folders with all their content.
+func (c *Client) planTop(ctx context.Context, id string, top []namedFile, downloadPath string) (*Plan, error) {
+	previous, _, err := c.previousDownload(id, downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{FolderID: id, Dest: downloadPath, Created: time.Now().UTC()}
+	var mu sync.Mutex
+	add := func(item DriveItem) error {
+		action := c.planItem(ctx, item, previous, downloadPath)
+		mu.Lock()
+		defer mu.Unlock()
+		plan.Actions = append(plan.Actions, action)
+		return nil
+	}
+	for _, named := range top {
+		item := newDriveItem(named.file, named.name, "", []string{named.file.Id})
+		add(item)
+		if !item.IsFolder() {
+			continue
+		}
+		err := c.walk(ctx, named.file.Id, func(child DriveItem) error {
+			child.Path = path.Join(named.name, child.Path)
+			return add(child)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(plan.Actions, func(i, j int) bool { return plan.Actions[i].Path < plan.Actions[j].Path })
+	return plan, nil
+}
+
+// bundleIndex is the data of the index of a bundle.
+type bundleIndex struct {
+	Created  string
+	Sections []bundleSection
+}
+
+// bundleSection is a section of the index of a bundle.
+type bundleSection struct {
+	Name  string
+	Files []bundleFile
+	Bytes string
+}
+
+// bundleFile is a file listed in the index of a bundle.
+type bundleFile struct {
+	Path     string
+	Link     string // relative to the root of the bundle
+	DriveURL string
+	Size     string
+	Modified string
+}
+
+// bundleIndexTemplate renders the index of a bundle.
+var bundleIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Drive export</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.2em 0.6em; border-bottom: 1px solid #ddd; }
+td.size { text-align: right; white-space: nowrap; }
+</style>
+</head>
+<body>
+<h1>Drive export</h1>
+<p>Created {{.Created}}.</p>
+{{range .Sections}}<h2>{{.Name}}</h2>
+<p>{{len .Files}} file(s), {{.Bytes}}.</p>
+{{if .Files}}<table>
+<tr><th>File</th><th>Size</th><th>Modified</th><th></th></tr>
+{{range .Files}}<tr><td><a href="{{.Link}}">{{.Path}}</a></td><td class="size">{{.Size}}</td><td>{{.Modified}}</td><td><a href="{{.DriveURL}}">Drive</a></td></tr>
+{{end}}</table>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// writeBundleIndex writes the index of the sections of the bundle at dest,
+// listing the files their manifests record.
+func writeBundleIndex(dest string, sections []string) error {
+	index := bundleIndex{Created: time.Now().Format("2006-01-02 15:04")}
+	for _, name := range sections {
+		section := bundleSection{Name: name}
+		var bytes int64
+		if m, err := LoadManifest(filepath.Join(dest, name, ManifestName)); err == nil {
+			sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+			for _, entry := range m.Files {
+				local := entry.Path
+				switch {
+				case entry.StoredPath != "":
+					local = entry.StoredPath
+				case entry.Object != "":
+					local = path.Join(ObjectsDir, entry.Object)
+				}
+				file := bundleFile{
+					Path:     entry.Path,
+					Link:     pathURL(path.Join(name, local)),
+					DriveURL: "https://drive.google.com/open?id=" + entry.ID,
+					Size:     FormatBytes(entry.Size),
+				}
+				if t, err := time.Parse(time.RFC3339, entry.ModifiedTime); err == nil {
+					file.Modified = t.Local().Format("2006-01-02 15:04")
+				}
+				section.Files = append(section.Files, file)
+				bytes += entry.Size
+			}
+		}
+		section.Bytes = FormatBytes(bytes)
+		index.Sections = append(index.Sections, section)
+	}
+
+	f, err := os.Create(filepath.Join(dest, BundleIndexName))
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	err = bundleIndexTemplate.Execute(f, index)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// pathURL escapes a slash-separated relative path for use as a link.
+func pathURL(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = (&url.URL{Path: s}).EscapedPath()
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,237 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults of CalibrateOptions.
+var (
+	defaultCalibrateConcurrencies = []int{1, 2, 4, 8, 16}
+	defaultCalibrateChunkSizes    = []int64{0, 1 << 20, 16 << 20}
+)
+
+const (
+	defaultCalibrateBytes = 32 << 20
+	// calibrateSampleFiles is the number of files Calibrate samples at most.
+	calibrateSampleFiles = 64
+	// calibrateMaxErrorRate is the share of failed requests above which a
+	// trial is not suggested, however fast.
+	calibrateMaxErrorRate = 0.01
+)
+
+// errSampled stops the walk of Calibrate once enough files were found.
+var errSampled = errors.New("enough files sampled")
+
+// CalibrateOptions sets the trials of Calibrate.
+type CalibrateOptions struct {
+	// Concurrencies are the numbers of requests made at the same time to
+	// try, 1, 2, 4, 8 and 16 by default.
+	Concurrencies []int
+	// ChunkSizes are the sizes of the ranges of the files requested to
+	// try, 0 requesting whole files as downloads do; by default whole files,
+	// 1 MiB and 16 MiB.
+	ChunkSizes []int64
+	// Bytes is the number of bytes downloaded by every trial, 32 MiB by
+	// default.
+	Bytes int64
+}
+
+// CalibrationTrial is the outcome of downloading with one concurrency and
+// chunk size.
+type CalibrationTrial struct {
+	Concurrency int
+	ChunkSize   int64 // 0 for whole files
+	Bytes       int64 // bytes received
+	Requests    int
+	Errors      int // failed requests
+	Duration    time.Duration
+}
+
+// Throughput returns the bytes per second received by the trial.
+func (t CalibrationTrial) Throughput() float64 {
+	return float64(t.Bytes) / max(t.Duration.Seconds(), 1e-3)
+}
+
+// ErrorRate returns the share of the requests of the trial that failed.
+func (t CalibrationTrial) ErrorRate() float64 {
+	if t.Requests == 0 {
+		return 0
+	}
+	return float64(t.Errors) / float64(t.Requests)
+}
+
+// Calibrate measures how fast the files of a folder download with every
+// combination of the concurrencies and chunk sizes of opts, to find the
+// settings suiting the network and the account: it downloads, and discards,
+// opts.Bytes of the largest of the first files found below the folder for
+// every trial, and returns the trials in order. Requests that fail are
+// counted rather than retried. See BestTrial.
+func (c *Client) Calibrate(ctx context.Context, folderID string, opts CalibrateOptions) ([]CalibrationTrial, error) {
+	if c.anonymous() {
+		return nil, fmt.Errorf("calibration is %w", ErrAnonymous)
+	}
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return nil, err
+	}
+	if len(opts.Concurrencies) == 0 {
+		opts.Concurrencies = defaultCalibrateConcurrencies
+	}
+	if len(opts.ChunkSizes) == 0 {
+		opts.ChunkSizes = defaultCalibrateChunkSizes
+	}
+	if opts.Bytes <= 0 {
+		opts.Bytes = defaultCalibrateBytes
+	}
+
+	var mu sync.Mutex
+	var files []DriveItem
+	err := c.walk(ctx, folderID, func(item DriveItem) error {
+		if item.File.MimeType == folderMimeType || isGoogleDoc(item.File) || item.Size <= 0 ||
+			item.File.Capabilities != nil && !item.File.Capabilities.CanDownload {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		files = append(files, item)
+		if len(files) == calibrateSampleFiles {
+			return errSampled
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSampled) {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("the folder holds no file to download")
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+
+	var trials []CalibrationTrial
+	for _, chunkSize := range opts.ChunkSizes {
+		for _, concurrency := range opts.Concurrencies {
+			c.debugf(DebugDownloader, "Calibrating with %d requests at a time of %s", concurrency, chunkText(chunkSize))
+			trial, err := c.calibrationTrial(ctx, files, max(concurrency, 1), max(chunkSize, 0), opts.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			trials = append(trials, trial)
+		}
+	}
+	return trials, nil
+}
+
+// calibrationRange is a range of a file requested by a calibration trial, or
+// its first size bytes read from a request for the whole file.
+type calibrationRange struct {
+	id           string
+	offset, size int64
+	whole        bool
+}
+
+// calibrationTrial downloads budget bytes of files, concurrency requests of
+// chunkSize bytes at a time.
+func (c *Client) calibrationTrial(ctx context.Context, files []DriveItem, concurrency int, chunkSize, budget int64) (CalibrationTrial, error) {
+	var ranges []calibrationRange
+	for queued := int64(0); queued < budget; {
+		for _, file := range files {
+			size := min(file.Size, budget-queued)
+			if chunkSize == 0 {
+				ranges = append(ranges, calibrationRange{id: file.ID, size: size, whole: true})
+			}
+			for offset := int64(0); chunkSize > 0 && offset < size; offset += chunkSize {
+				ranges = append(ranges, calibrationRange{id: file.ID, offset: offset, size: min(chunkSize, size-offset)})
+			}
+			if queued += size; queued >= budget {
+				break
+			}
+		}
+	}
+
+	trial := CalibrationTrial{Concurrency: concurrency, ChunkSize: chunkSize}
+	var mu sync.Mutex
+	next := make(chan calibrationRange)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range next {
+				n, err := c.downloadRange(ctx, r)
+				mu.Lock()
+				trial.Requests++
+				trial.Bytes += n
+				if err != nil {
+					trial.Errors++
+					c.debugf(DebugDownloader, "Calibration request for %s failed: %v", r.id, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, r := range ranges {
+		select {
+		case next <- r:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+	trial.Duration = time.Since(start)
+	return trial, ctx.Err()
+}
+
+// downloadRange downloads a range of a file, discarding it, and returns the
+// number of bytes received.
+func (c *Client) downloadRange(ctx context.Context, r calibrationRange) (int64, error) {
+	call := c.Service.Files.Get(r.id).Context(ctx)
+	if !r.whole {
+		call.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", r.offset, r.offset+r.size-1))
+	}
+	resp, err := call.Download()
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(io.Discard, io.LimitReader(resp.Body, r.size))
+}
+
+// BestTrial returns the trial to suggest among trials: among those whose
+// error rate is at most 1%, the one with the lowest concurrency, and then the
+// largest chunk size, whose throughput is within 10% of the highest, so that
+// Drive is not loaded more than it pays. It reports false if every trial
+// failed too often.
+func BestTrial(trials []CalibrationTrial) (CalibrationTrial, bool) {
+	var fastest float64
+	for _, t := range trials {
+		if t.ErrorRate() <= calibrateMaxErrorRate {
+			fastest = max(fastest, t.Throughput())
+		}
+	}
+	var best CalibrationTrial
+	found := false
+	for _, t := range trials {
+		if t.ErrorRate() > calibrateMaxErrorRate || t.Throughput() < 0.9*fastest {
+			continue
+		}
+		if !found || t.Concurrency < best.Concurrency ||
+			t.Concurrency == best.Concurrency && (t.ChunkSize == 0 || best.ChunkSize != 0 && t.ChunkSize > best.ChunkSize) {
+			best, found = t, true
+		}
+	}
+	return best, found
+}
+
+// chunkText describes a chunk size of CalibrateOptions.
+func chunkText(chunkSize int64) string {
+	if chunkSize <= 0 {
+		return "whole files"
+	}
+	return FormatBytes(chunkSize)
+}
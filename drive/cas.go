@@ -0,0 +1,283 @@
+package drive
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Layout selects how DownloadFolder stores the files of a download.
+type Layout int
+
+const (
+	// LayoutTree stores every file at its path, mirroring the folder.
+	LayoutTree Layout = iota
+	// LayoutCAS stores the content of every file once, as an object named
+	// after its SHA-256 checksum in the ObjectsDir directory, and maps the
+	// paths of the folder to their objects in an ObjectTree written to
+	// TreeName. Identical files are only stored once, and every download
+	// also keeps its tree in TreesDir as a snapshot: as objects are never
+	// deleted, the folder can be restored as it was at any earlier download.
+	LayoutCAS
+)
+
+// Paths of a download with LayoutCAS, relative to the download directory.
+const (
+	ObjectsDir = "objects"
+	TreeName   = ".drive-tree.json"
+	TreesDir   = "trees"
+)
+
+// ParseLayout parses a layout name ("tree" or "cas"); an empty name selects
+// LayoutTree.
+func ParseLayout(s string) (Layout, error) {
+	switch strings.ToLower(s) {
+	case "", "tree":
+		return LayoutTree, nil
+	case "cas":
+		return LayoutCAS, nil
+	}
+	return 0, fmt.Errorf("unknown layout %q", s)
+}
+
+// String returns the name of the layout.
+func (l Layout) String() string {
+	if l == LayoutCAS {
+		return "cas"
+	}
+	return "tree"
+}
+
+// ObjectTree maps the paths of a download with LayoutCAS to their objects.
+type ObjectTree struct {
+	FolderID string    `json:"folderId"`
+	Created  time.Time `json:"created"`
+	// Files maps the slash-separated path of every file to the hex-encoded
+	// SHA-256 checksum naming its object.
+	Files map[string]string `json:"files"`
+}
+
+// LoadObjectTree reads an object tree from path.
+func LoadObjectTree(path string) (*ObjectTree, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree: %w", err)
+	}
+	var t ObjectTree
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse tree: %w", err)
+	}
+	return &t, nil
+}
+
+// Save writes the tree to path, replacing any previous tree atomically.
+func (t *ObjectTree) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tree: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write tree: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write tree: %w", err)
+	}
+	return nil
+}
+
+// Below reports whether the tree holds files below the folder at dir, such as
+// the files of an Apps Script project.
+func (t *ObjectTree) Below(dir string) bool {
+	for p := range t.Files {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// casSink stores files as the objects of LayoutCAS below root and notes the
+// objects of the paths saved, for finish to write the tree of the download.
+// It is safe for concurrent use.
+type casSink struct {
+	root  string
+	perm  filePermissions
+	fsync bool
+
+	mu       sync.Mutex        // guards the fields below
+	previous map[string]string // files of the tree of the previous download
+	files    map[string]string // objects of the paths saved or moved
+}
+
+// newCASSink returns the sink storing files as objects below root, starting
+// from the tree of the previous download into root, if any.
+func (c *Client) newCASSink(root string) *casSink {
+	s := &casSink{
+		root:     root,
+		perm:     filePermissions{file: c.FileMode, dir: c.DirMode, owner: c.Ownership},
+		fsync:    c.Fsync,
+		previous: make(map[string]string),
+		files:    make(map[string]string),
+	}
+	if tree, err := LoadObjectTree(filepath.Join(root, TreeName)); err == nil {
+		s.previous = tree.Files
+	}
+	return s
+}
+
+// sink returns the sink storing the files of a download into root with the
+// client's Layout.
+func (c *Client) sink(root string) (sink, error) {
+	if c.Layout != LayoutCAS {
+		return c.dirSink(root), nil
+	}
+	if c.Compression != CompressionNone || c.Encryption != nil {
+		return nil, fmt.Errorf("the %s layout stores files as they are, without compression or encryption", LayoutCAS)
+	}
+	return c.newCASSink(root), nil
+}
+
+// Mkdir does nothing: folders only exist as the paths of the tree.
+func (s *casSink) Mkdir(relPath string) error {
+	return nil
+}
+
+// Save stores the content of r as an object, unless an identical object is
+// already stored, and maps relPath to it.
+func (s *casSink) Save(relPath string, modTime time.Time, r io.Reader) (int64, string, error) {
+	dir := filepath.Join(s.root, ObjectsDir)
+	if err := s.perm.mkdirAll(dir); err != nil {
+		return 0, "", fmt.Errorf("failed to create folder: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".spool-*")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	f, err := s.perm.create(tmp.Name())
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create file: %w", err)
+	}
+	sum, hash := sha256.New(), md5.New()
+	n, err := io.Copy(io.MultiWriter(f, sum, hash), r)
+	if err == nil && s.fsync {
+		err = syncFile(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, "", fmt.Errorf("failed to save file: %w", err)
+	}
+	object := hex.EncodeToString(sum.Sum(nil))
+	if _, err := os.Stat(s.objectPath(object)); err != nil {
+		if err := os.Rename(tmp.Name(), s.objectPath(object)); err != nil {
+			return n, "", fmt.Errorf("failed to save file: %w", err)
+		}
+	}
+	s.mu.Lock()
+	s.files[relPath] = object
+	s.mu.Unlock()
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// objectPath returns the path of an object.
+func (s *casSink) objectPath(object string) string {
+	return filepath.Join(s.root, ObjectsDir, object)
+}
+
+// localPath returns the local path standing for the file recorded as prev by
+// the previous download: its object or, for the folders of several files,
+// such as Apps Script projects, the objects directory if the previous tree
+// holds their files, and an empty path if nothing stands for it.
+func (s *casSink) localPath(prev ManifestEntry) string {
+	if prev.Object != "" {
+		return s.objectPath(prev.Object)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if (&ObjectTree{Files: s.previous}).Below(prev.Path) {
+		return filepath.Join(s.root, ObjectsDir)
+	}
+	return ""
+}
+
+// record notes in entry the object of its file.
+func (s *casSink) record(entry *ManifestEntry) {
+	s.mu.Lock()
+	entry.Object = s.files[entry.Path]
+	s.mu.Unlock()
+}
+
+// move maps the paths of the file at oldPath of the previous download, and of
+// the files saved with it, to newPath.
+func (s *casSink) move(oldPath, newPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, object := range s.previous {
+		if covers(oldPath, p) {
+			s.files[newPath+strings.TrimPrefix(p, oldPath)] = object
+		}
+	}
+}
+
+// finish writes the tree of the files of m, and its snapshot, which keeps
+// the files of the previous download that were not downloaded again.
+func (s *casSink) finish(m *Manifest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tree := &ObjectTree{FolderID: m.FolderID, Created: time.Now().UTC(), Files: make(map[string]string)}
+	paths := make(map[string]bool, len(m.Files))
+	for _, entry := range m.Files {
+		paths[entry.Path] = true
+		if entry.Object != "" {
+			// Entries resumed from an interrupted download were saved by
+			// another sink.
+			tree.Files[entry.Path] = entry.Object
+		}
+	}
+	for _, files := range []map[string]string{s.previous, s.files} {
+		for p, object := range files {
+			// Files deleted from Drive are left out.
+			if covered(paths, p) {
+				tree.Files[p] = object
+			}
+		}
+	}
+	if err := tree.Save(filepath.Join(s.root, TreeName)); err != nil {
+		return err
+	}
+	if err := s.perm.mkdirAll(filepath.Join(s.root, TreesDir)); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	return tree.Save(filepath.Join(s.root, TreesDir, tree.Created.Format("20060102T150405.000Z")+".json"))
+}
+
+// covers reports whether p is the path of the file at base or of a file saved
+// with it: a sidecar, whose name extends it, or a file of its folder.
+func covers(base, p string) bool {
+	return p == base || strings.HasPrefix(p, base) && (p[len(base)] == '.' || p[len(base)] == '/')
+}
+
+// covered reports whether p is covered by one of paths.
+func covered(paths map[string]bool, p string) bool {
+	if paths[p] {
+		return true
+	}
+	for i := 1; i < len(p); i++ {
+		if (p[i] == '.' || p[i] == '/') && paths[p[:i]] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package drive
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// A TransferClass limits how many files of some MIME types are downloaded at
+// the same time, so that large media does not occupy every worker while the
+// long tail of small documents waits behind it.
+type TransferClass struct {
+	// MimeType is a path.Match pattern matched against the MIME type of
+	// files, e.g. "video/*".
+	MimeType string
+	// Concurrency is the number of files of the class downloaded at the
+	// same time.
+	Concurrency int
+}
+
+// ParseTransferClasses parses a comma-separated list of classes written as
+// "MIMETYPE=N", e.g. "video/*=2,image/*=8".
+func ParseTransferClasses(s string) ([]TransferClass, error) {
+	var classes []TransferClass
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		pattern, limit, ok := strings.Cut(field, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if !ok || err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid class %q (want \"MIMETYPE=N\" with N at least 1)", field)
+		}
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in class %q: %w", field, err)
+		}
+		classes = append(classes, TransferClass{MimeType: pattern, Concurrency: n})
+	}
+	return classes, nil
+}
+
+// transferClass returns the index of the first of the client's Classes a
+// file belongs to, or -1 if it belongs to none.
+func (c *Client) transferClass(file *drivev3.File) int {
+	for i, class := range c.Classes {
+		if ok, _ := path.Match(class.MimeType, file.MimeType); ok {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,390 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	drivev3 "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// AppDataFolder is the ID alias of the application data folder, the root of
+// the "appDataFolder" space; listing it requires AppDataScope.
+const AppDataFolder = "appDataFolder"
+
+// driveIDPattern matches a Drive file or folder ID.
+var driveIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// ExtractFolderID extracts the Google Drive folder ID from a folder link, in
+// any of the shapes the web interface, the share dialog and the mobile apps
+// produce: with or without a scheme, an account path such as u/0, a mobile
+// path, query parameters such as usp=sharing or resourcekey, or the ID in an
+// id parameter or the fragment of legacy links. AppDataFolder is accepted as
+// is.
+func ExtractFolderID(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == AppDataFolder {
+		return link, nil
+	}
+	if id := folderIDFromURL(link); id != "" {
+		return id, nil
+	}
+	re := regexp.MustCompile(`folders/([a-zA-Z0-9-_]+)`)
+	match := re.FindStringSubmatch(link)
+	if len(match) < 2 {
+		return "", fmt.Errorf("invalid Google Drive folder link")
+	}
+	return match[1], nil
+}
+
+// ExtractID extracts the ID of a file or folder from its link: a folder link
+// as ExtractFolderID reads them, or the link of a file or document, such as
+// https://drive.google.com/file/d/ID/view or
+// https://docs.google.com/spreadsheets/d/ID/edit.
+func ExtractID(link string) (string, error) {
+	if id, err := ExtractFolderID(link); err == nil {
+		return id, nil
+	}
+	link = strings.TrimSpace(link)
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	if u, err := url.Parse(link); err == nil {
+		segments := strings.Split(u.Path, "/")
+		for i := 0; i+1 < len(segments); i++ {
+			if segments[i] == "d" && driveIDPattern.MatchString(segments[i+1]) {
+				return segments[i+1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("invalid Google Drive link")
+}
+
+// folderIDFromURL returns the folder ID of a Drive folder URL, or "" if link
+// is not one.
+func folderIDFromURL(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	// /drive/folders/ID, /drive/u/0/folders/ID, /drive/mobile/folders/ID
+	// and the #folders/ID fragment of legacy links, possibly followed by
+	// further segments.
+	for _, p := range []string{u.Path, u.Fragment} {
+		segments := strings.Split(p, "/")
+		for i := 0; i+1 < len(segments); i++ {
+			if segments[i] == "folders" && driveIDPattern.MatchString(segments[i+1]) {
+				return segments[i+1]
+			}
+		}
+	}
+	// open?id=ID, folderview?id=ID and embeddedfolderview?id=ID.
+	if id := u.Query().Get("id"); driveIDPattern.MatchString(id) {
+		return id
+	}
+	return ""
+}
+
+// Client holds the Google Drive service and related configurations.
+type Client struct {
+	Service *drivev3.Service
+
+	// Duplicates controls how colliding local file names are disambiguated.
+	Duplicates DuplicatePolicy
+	// MaxDepth limits how many levels of subfolders are downloaded; 0 keeps
+	// to the top level and a negative value means unlimited.
+	MaxDepth int
+	// ModifiedAfter, ModifiedBefore and CreatedAfter, if set, restrict
+	// downloads to the files modified or created within those bounds. The
+	// filters are applied by Drive when listing folders.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	CreatedAfter   time.Time
+	// Spaces, if set, are the Drive spaces folders are listed in: "drive",
+	// "photos" (the legacy Google Photos space) and AppDataFolder. Drive
+	// lists the "drive" space alone by default.
+	Spaces []string
+	// Owner and NotOwner, if set, restrict downloads to the files owned, or
+	// not owned, by the user with this email address. Files in shared drives
+	// have no owner and are excluded by Owner.
+	Owner    string
+	NotOwner string
+	// Properties and AppProperties, if set, restrict downloads to the files
+	// having every one of these custom properties, or of the app properties
+	// private to the app that set them, with the given value. Labels, if
+	// set, restrict them to the files having every one of these Drive
+	// labels, or label field values, such as a classification. Like the
+	// other filters, they are applied by Drive when listing folders, and
+	// folders are walked whatever their metadata.
+	Properties    map[string]string
+	AppProperties map[string]string
+	Labels        []LabelFilter
+	// Normalization is the Unicode normalization applied to local names.
+	Normalization Normalization
+	// CaseInsensitive makes names that differ only in case or Unicode
+	// normalization collide, as they do on macOS and Windows filesystems.
+	CaseInsensitive bool
+	// MaxPathLength, if positive, limits the length in bytes of the local
+	// paths DownloadFolder writes, download directory included. Names that
+	// would exceed it are shortened, folders first, and recorded in the
+	// manifest so that later downloads keep them.
+	MaxPathLength int
+	// DrawingFormat is the format Google Drawings are exported in.
+	DrawingFormat DrawingFormat
+	// SheetFormat is the format Google Sheets are exported in.
+	SheetFormat SheetFormat
+	// SheetValuesOnly exports spreadsheets in XLSX and ODS with the values
+	// last computed by their formulas in place of the formulas, for archives
+	// whose figures must not change when opened. By default formulas are
+	// kept.
+	SheetValuesOnly bool
+	// ExportResolver, if set, chooses the format of each Google-native
+	// document, for instance from its name or folder, overriding
+	// DrawingFormat, SheetFormat and the default formats.
+	ExportResolver ExportResolver
+	// PDF sets the page layout of spreadsheets exported as PDF.
+	PDF PDFOptions
+	// Sidecars writes an XMP sidecar next to every downloaded photo and
+	// video, recording its Drive description, times and original path.
+	Sidecars bool
+	// ExtractImages also saves the images embedded in every Google Doc and
+	// Slides deck, at their original resolution, below an AssetsDir
+	// directory next to the exported document.
+	ExtractImages bool
+	// AutoExtract extracts the zip archives and gzipped tarballs downloaded
+	// to a directory into a directory next to them named after the archive
+	// without its extension. Tarballs are extracted as they download.
+	AutoExtract bool
+	// DiscardArchives deletes archives once AutoExtract has extracted them
+	// and their checksum was verified.
+	DiscardArchives bool
+	// Comments, if set, writes the comment threads of every exported Google
+	// document to a sidecar next to it in this format.
+	Comments CommentsFormat
+	// FileMode, if set, is the permission bits given to downloaded files,
+	// regardless of the umask; otherwise files are created with 0666 less
+	// the umask.
+	FileMode os.FileMode
+	// DirMode, if set, is the permission bits given to the directories a
+	// download creates, regardless of the umask; otherwise they are created
+	// with 0777 less the umask.
+	DirMode os.FileMode
+	// Ownership, if set, changes the owner and group of the files and
+	// directories a download creates. It is only supported on Unix.
+	Ownership *Ownership
+	// Fsync flushes every file a download saves, and its directory, to
+	// stable storage before it is recorded as downloaded.
+	Fsync bool
+	// Preallocate reserves the disk space of files of known size before
+	// downloading them, on Linux, reducing the fragmentation of large files.
+	Preallocate bool
+	// Compression compresses every file DownloadFolder saves as it is
+	// written, before any encryption.
+	Compression Compression
+	// Encryption, if set, encrypts every file DownloadFolder saves as it is
+	// written, so that no plaintext reaches the disk.
+	Encryption *Encryption
+	// FixExtensions appends the extension of their MIME type to the local
+	// names of files named without one, with an unknown one, or with that of
+	// another type. The extensions appended are recorded in the manifest.
+	FixExtensions bool
+	// SniffExtensions detects the type of the files whose MIME type is not
+	// specific enough for FixExtensions, such as application/octet-stream,
+	// from the first bytes of their content, read while the folder is
+	// walked.
+	SniffExtensions bool
+	// Layout selects how DownloadFolder stores files: at their paths or, with
+	// LayoutCAS, as deduplicated objects, which excludes Compression and
+	// Encryption.
+	Layout Layout
+	// LinkStubs writes link stubs to Google-native documents next to their
+	// exports, or instead of exporting them, as Drive for desktop does.
+	LinkStubs LinkStubs
+	// ProbeSize, if positive, avoids downloading again files without a
+	// checksum that were modified since the previous download but kept their
+	// size, when their first and last ProbeSize bytes still match the local
+	// copy. Only files larger than twice ProbeSize are probed.
+	ProbeSize int64
+	// Seed, if set, is the manifest of a download of the same folder into
+	// another directory, such as the disk the files were copied from. A
+	// download into a directory without a manifest of its own starts from
+	// it, as if it were its previous download: the files it records that are
+	// found with their recorded size are kept with their recorded checksums,
+	// rather than downloaded and hashed again.
+	Seed *Manifest
+	// Filter, if set, is called for every file and folder found below the
+	// downloaded folder; those it rejects are skipped, folders with their
+	// content. It may be called from several goroutines at once.
+	Filter func(item DriveItem) bool
+	// Sparse, if set, limits downloads to the paths it includes; without it,
+	// DownloadFolder reads the SparseName file of the download directory,
+	// if any.
+	Sparse *Sparse
+	// Routes move downloaded files into directories by name, the first
+	// matching route applying; see Route.
+	Routes []Route
+	// Concurrency is the number of files downloaded at the same time; see
+	// also SetConcurrency.
+	Concurrency int
+	// BandwidthLimit, if positive, is the maximum number of bytes per
+	// second received for the content of files, shared by every download of
+	// the client; see also SetBandwidthLimit.
+	BandwidthLimit int64
+	// Classes further limit the number of files of some MIME types
+	// downloaded at the same time; the first matching class applies. Files
+	// of other types are only limited by Concurrency.
+	Classes []TransferClass
+	// ExportConcurrency, if positive, limits the number of Google-native
+	// files exported at the same time, apart from the downloads of other
+	// files, which keep the remaining workers. Exports that Drive throttles
+	// are retried after a backoff shared by every export only.
+	ExportConcurrency int
+	// Priorities download the files matching some patterns before or after
+	// the others; the first matching pattern applies. They do not apply to
+	// archives, whose files are written one folder at a time.
+	Priorities []PathPriority
+	// ExportRate, if positive, is the maximum number of exports started per
+	// second.
+	ExportRate float64
+	// VerifyConcurrency is the number of downloaded files whose checksums
+	// are computed and verified at the same time, separately from the
+	// downloads so that hashing overlaps with network transfers.
+	VerifyConcurrency int
+	// VolumeSize, if positive, splits archives written by DownloadArchive
+	// into volumes of at most this many bytes.
+	VolumeSize int64
+	// SkipSuspended skips files whose owner's account is suspended instead
+	// of failing the download; they are still listed at the end.
+	SkipSuspended bool
+	// AcknowledgeAbuse downloads files that Google flagged as malware or
+	// spam, where Drive permits it, instead of reporting them as failures.
+	AcknowledgeAbuse bool
+	// RestrictedList, if set, is where the files whose download is disabled
+	// by their sharing settings are listed as CSV. Such files are skipped
+	// and reported rather than failing the download.
+	RestrictedList string
+	// AfterDownload, if set, is done remotely to every file once the
+	// download completed and its manifest was saved, such as moving the
+	// files out of an inbox folder. It needs the full scope.
+	AfterDownload AfterDownload
+	// Logger receives progress messages.
+	Logger *log.Logger
+	// Debug selects the modules whose debug messages are logged to Logger.
+	Debug Debug
+	// StatusFile, if set, is where the progress of downloads is written as a
+	// JSON Status every few seconds, for external monitoring.
+	StatusFile string
+	// MetricsCSV, if set, is where the performance of downloads is appended
+	// as CSV every ten seconds: bytes received and throughput, files done,
+	// workers downloading, files queued, and requests and errors, for
+	// graphing long transfers to find their bottlenecks.
+	MetricsCSV string
+	// Stats counts the requests made to Drive.
+	Stats *APIStats
+	// UserAgent, if set, replaces the User-Agent header of every request.
+	UserAgent string
+	// QuotaUser, if set, is sent as the quotaUser of every request so that
+	// per-user rate limits apply to it rather than to the service account.
+	QuotaUser string
+	// QuotaProject, if set, is the Google Cloud project billed for the quota
+	// used by every request.
+	QuotaProject string
+
+	http     *http.Client // sends the requests of Service and of anonymous clients
+	apiKey   string       // sent with every request, see WithAPIKey
+	scopes   *scopeCheck
+	exports  *exportLimiter
+	throttle *throttle
+}
+
+// NewClient creates a Google Drive client. Without options it authenticates
+// with Application Default Credentials (for instance the service account
+// named by GOOGLE_APPLICATION_CREDENTIALS); see the Option functions for
+// other credentials. The returned client downloads with the defaults
+// documented on its fields, which may be changed before use.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &Client{
+		MaxDepth:          -1,
+		Concurrency:       4,
+		VerifyConcurrency: runtime.NumCPU(),
+		CaseInsensitive:   DefaultCaseInsensitive(),
+		Logger:            log.New(os.Stdout, "", 0),
+		Stats:             newAPIStats(),
+		scopes:            &scopeCheck{},
+		exports:           &exportLimiter{},
+		throttle:          &throttle{},
+	}
+	network, err := o.networkTransport()
+	if err != nil {
+		return nil, err
+	}
+	if network != nil {
+		// Credentials are fetched through the same network settings.
+		client := &http.Client{Transport: network}
+		if o.httpClient != nil {
+			client.Timeout = o.httpClient.Timeout
+		}
+		o.httpClient = client
+	}
+	transport := http.DefaultTransport
+	if o.httpClient != nil && o.httpClient.Transport != nil {
+		transport = o.httpClient.Transport
+	}
+	if key, ok := o.auth.(APIKey); ok {
+		c.apiKey = string(key)
+	}
+	if !o.anonymous {
+		if o.httpClient != nil {
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, o.httpClient)
+		}
+		tokens, err := o.tokenSource(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if tokens != nil {
+			c.scopes.tokens = tokens
+			transport = &oauth2.Transport{Source: tokens, Base: transport}
+		}
+	}
+	c.http = &http.Client{Transport: &clientTransport{base: transport, client: c}}
+	if o.httpClient != nil {
+		c.http.Timeout = o.httpClient.Timeout
+	}
+	if o.anonymous {
+		return c, nil
+	}
+
+	serviceOpts := []option.ClientOption{option.WithHTTPClient(c.http)}
+	if o.endpoint != "" {
+		serviceOpts = append(serviceOpts, option.WithEndpoint(o.endpoint))
+	}
+	c.Service, err = drivev3.NewService(ctx, serviceOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Drive service: %w", err)
+	}
+	return c, nil
+}
+
+// logf writes a progress message to the client's logger.
+func (c *Client) logf(format string, args ...any) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, args...)
+	}
+}
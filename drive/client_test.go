@@ -0,0 +1,159 @@
+package drive_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+	"github.com/rgsuhas/drive-downloader/drive/drivetest"
+)
+
+func TestExtractFolderID(t *testing.T) {
+	const id = "1AbC-dEf_23"
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"web", "https://drive.google.com/drive/folders/" + id, id},
+		{"share dialog", "https://drive.google.com/drive/folders/" + id + "?usp=sharing", id},
+		{"share link", "https://drive.google.com/drive/folders/" + id + "?usp=drive_link", id},
+		{"resource key", "https://drive.google.com/drive/folders/" + id + "?resourcekey=0-xyz&usp=sharing", id},
+		{"account", "https://drive.google.com/drive/u/0/folders/" + id, id},
+		{"second account", "https://drive.google.com/drive/u/1/folders/" + id + "?usp=share_link", id},
+		{"mobile app", "https://drive.google.com/drive/mobile/folders/" + id + "?usp=sharing", id},
+		{"mobile basic", "https://drive.google.com/drive/mobile/folders/" + id + "/mobilebasic", id},
+		{"trailing slash", "https://drive.google.com/drive/folders/" + id + "/", id},
+		{"no scheme", "drive.google.com/drive/folders/" + id, id},
+		{"surrounding space", "  https://drive.google.com/drive/folders/" + id + "\n", id},
+		{"open", "https://drive.google.com/open?id=" + id, id},
+		{"open with account", "https://drive.google.com/u/0/open?id=" + id + "&usp=sharing", id},
+		{"folder view", "https://drive.google.com/folderview?id=" + id + "&usp=sharing", id},
+		{"embedded folder view", "https://drive.google.com/embeddedfolderview?id=" + id + "#list", id},
+		{"legacy fragment", "https://drive.google.com/drive/#folders/" + id, id},
+		{"legacy fragment with account", "https://drive.google.com/drive/u/0/#folders/" + id, id},
+		{"app data folder", drive.AppDataFolder, drive.AppDataFolder},
+		{"file link", "https://drive.google.com/file/d/" + id + "/view", ""},
+		{"empty", "", ""},
+		{"not a link", "hello world", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := drive.ExtractFolderID(tt.link)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("ExtractFolderID(%q) = %q, want an error", tt.link, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ExtractFolderID(%q) = %q, %v, want %q", tt.link, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractID(t *testing.T) {
+	const id = "1AbC-dEf_23"
+	for link, want := range map[string]string{
+		"https://drive.google.com/drive/folders/" + id + "?usp=sharing": id,
+		"https://drive.google.com/file/d/" + id + "/view?usp=sharing":   id,
+		"https://docs.google.com/spreadsheets/d/" + id + "/edit#gid=0":  id,
+		"docs.google.com/document/d/" + id:                              id,
+		"https://drive.google.com/open?id=" + id:                        id,
+		"hello world":                                                   "",
+	} {
+		got, err := drive.ExtractID(link)
+		if want == "" && err == nil || want != "" && (err != nil || got != want) {
+			t.Errorf("ExtractID(%q) = %q, %v, want %q", link, got, err, want)
+		}
+	}
+}
+
+func TestWithEndpoint(t *testing.T) {
+	srv, root, _ := newTree(t)
+	// Without the redirecting client of srv, requests only reach it through
+	// the endpoint.
+	client, err := drive.NewClient(context.Background(),
+		drive.WithAPIKey("drivetest"), drive.WithHTTPClient(srv.Client()), drive.WithEndpoint(srv.URL+"/drive/v3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Logger = nil
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	drivetest.CompareDir(t, dir, "testdata/download")
+}
+
+func TestCheckAccess(t *testing.T) {
+	srv, root, _ := newTree(t)
+	restricted := srv.Add(drivetest.File{Name: "secret.pdf", Parents: []string{root}, NotDownloadable: true})
+	locked := srv.AddFolder(root, "Locked")
+	srv.Fail(locked, http.StatusForbidden)
+	client := newClient(t, srv)
+	ctx := context.Background()
+
+	if got := client.CheckAccess(ctx, root); got.Err != nil || !got.IsFolder() || !got.CanList || !got.CanDownload || got.Name != "Backup" {
+		t.Errorf("CheckAccess(root) = %+v, want a folder that can be listed and downloaded", got)
+	}
+	if got := client.CheckAccess(ctx, restricted); got.Err != nil || got.IsFolder() || got.CanList || got.CanDownload {
+		t.Errorf("CheckAccess(restricted) = %+v, want a file that cannot be downloaded", got)
+	}
+	got := client.CheckAccess(ctx, locked)
+	if cause := (drive.Failure{Err: got.Err}).Cause(); got.Err == nil || cause != drive.CausePermission {
+		t.Errorf("CheckAccess(locked) = %+v (cause %v), want a permission error", got, cause)
+	}
+	if got := client.CheckAccess(ctx, "missing"); got.Err == nil {
+		t.Errorf("CheckAccess(missing) = %+v, want an error", got)
+	}
+}
+
+func TestHostAddresses(t *testing.T) {
+	srv, root, _ := newTree(t)
+	ctx := context.Background()
+	// drive.test does not resolve: requests only reach the server through
+	// its address.
+	client, err := drive.NewClient(ctx,
+		drive.WithAPIKey("drivetest"),
+		drive.WithEndpoint("http://drive.test/drive/v3/"),
+		drive.WithHostAddresses(map[string]string{"drive.test": srv.Listener.Addr().String()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := client.ListChildren(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 7 {
+		t.Errorf("ListChildren listed %d files, want 7", len(files))
+	}
+
+	if _, err := drive.NewClient(ctx, drive.WithAPIKey("drivetest"), drive.WithProxy("ftp://proxy.test")); err == nil {
+		t.Error("NewClient accepted an FTP proxy")
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	srv, root, _ := newTree(t)
+	client := newClient(t, srv)
+	opts := drive.CalibrateOptions{Concurrencies: []int{1, 2}, ChunkSizes: []int64{0, 4}, Bytes: 64}
+	trials, err := client.Calibrate(context.Background(), root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trials) != 4 {
+		t.Fatalf("Calibrate ran %d trials, want 4", len(trials))
+	}
+	for _, trial := range trials {
+		if trial.Bytes != opts.Bytes || trial.Errors != 0 {
+			t.Errorf("trial %+v received %d bytes with %d errors, want %d bytes", trial, trial.Bytes, trial.Errors, opts.Bytes)
+		}
+	}
+	if _, ok := drive.BestTrial(trials); !ok {
+		t.Error("BestTrial found no trial to suggest")
+	}
+}
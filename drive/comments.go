@@ -0,0 +1,136 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// CommentsFormat is the format of the comment sidecars written next to
+// exported Google documents.
+type CommentsFormat int
+
+const (
+	// CommentsNone writes no comment sidecars.
+	CommentsNone CommentsFormat = iota
+	// CommentsJSON writes the comment threads as returned by Drive, as JSON.
+	CommentsJSON
+	// CommentsMarkdown writes the comment threads as a Markdown document.
+	CommentsMarkdown
+)
+
+// commentsExtensions maps comment formats to the extension appended to the
+// name of a document to name its comment sidecar.
+var commentsExtensions = map[CommentsFormat]string{
+	CommentsJSON:     ".comments.json",
+	CommentsMarkdown: ".comments.md",
+}
+
+// ParseCommentsFormat parses a comment sidecar format name ("json" or
+// "markdown"); an empty name selects CommentsNone.
+func ParseCommentsFormat(s string) (CommentsFormat, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return CommentsNone, nil
+	case "json":
+		return CommentsJSON, nil
+	case "markdown", "md":
+		return CommentsMarkdown, nil
+	}
+	return 0, fmt.Errorf("unknown comments format %q", s)
+}
+
+// commentFields lists the comment metadata written to comment sidecars.
+const commentFields = "nextPageToken, comments(id, author(displayName, emailAddress), content, quotedFileContent(value), createdTime, modifiedTime, resolved, replies(id, author(displayName, emailAddress), content, createdTime, action))"
+
+// listComments retrieves every comment thread of a file, replies included.
+func (c *Client) listComments(ctx context.Context, fileID string) ([]*drivev3.Comment, error) {
+	var comments []*drivev3.Comment
+	err := c.Service.Comments.List(fileID).Fields(commentFields).PageSize(100).Pages(ctx, func(page *drivev3.CommentList) error {
+		comments = append(comments, page.Comments...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	return comments, nil
+}
+
+// writeComments saves the comment threads of a Google document exported to
+// relPath in a sidecar next to it, in the client's CommentsFormat. Exports
+// drop comments, which legal and audit users need to keep alongside the
+// document. Comments made on suggested edits are included, but the Drive
+// API does not expose the suggested edits themselves. Documents without
+// comments get no sidecar, and neither do documents downloaded anonymously,
+// since listing comments requires credentials.
+func (c *Client) writeComments(ctx context.Context, d *download, file *drivev3.File, relPath string, modTime time.Time) error {
+	if c.anonymous() {
+		return nil
+	}
+	comments, err := c.listComments(ctx, file.Id)
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	switch c.Comments {
+	case CommentsJSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(comments); err != nil {
+			return fmt.Errorf("failed to encode comments: %w", err)
+		}
+	case CommentsMarkdown:
+		writeCommentsMarkdown(&buf, file, comments)
+	}
+	if _, _, err := d.sink.Save(relPath+commentsExtensions[c.Comments], modTime, &buf); err != nil {
+		return fmt.Errorf("failed to write comments: %w", err)
+	}
+	return nil
+}
+
+// writeCommentsMarkdown writes comment threads as Markdown: a section per
+// thread quoting the commented text, followed by its replies.
+func writeCommentsMarkdown(buf *bytes.Buffer, file *drivev3.File, comments []*drivev3.Comment) {
+	fmt.Fprintf(buf, "# Comments on %s\n", file.Name)
+	for _, comment := range comments {
+		state := ""
+		if comment.Resolved {
+			state = " (resolved)"
+		}
+		fmt.Fprintf(buf, "\n## %s, %s%s\n\n", commentAuthor(comment.Author), comment.CreatedTime, state)
+		if comment.QuotedFileContent != nil && comment.QuotedFileContent.Value != "" {
+			fmt.Fprintf(buf, "> %s\n\n", strings.ReplaceAll(comment.QuotedFileContent.Value, "\n", "\n> "))
+		}
+		fmt.Fprintf(buf, "%s\n", comment.Content)
+		for _, reply := range comment.Replies {
+			fmt.Fprintf(buf, "\n- **%s**, %s", commentAuthor(reply.Author), reply.CreatedTime)
+			if reply.Action != "" {
+				fmt.Fprintf(buf, " (%s)", reply.Action)
+			}
+			if reply.Content != "" {
+				fmt.Fprintf(buf, ": %s", strings.ReplaceAll(reply.Content, "\n", "\n  "))
+			}
+			buf.WriteString("\n")
+		}
+	}
+}
+
+// commentAuthor names the author of a comment or reply.
+func commentAuthor(user *drivev3.User) string {
+	switch {
+	case user == nil:
+		return "Unknown"
+	case user.EmailAddress != "":
+		return fmt.Sprintf("%s <%s>", user.DisplayName, user.EmailAddress)
+	}
+	return user.DisplayName
+}
@@ -0,0 +1,108 @@
+package drive
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Compression selects how downloaded files are compressed as they are
+// written. Compressed files are named with the extension of the compression
+// appended, and their checksums are those of the uncompressed content.
+type Compression int
+
+const (
+	// CompressionNone stores files as they are.
+	CompressionNone Compression = iota
+	// CompressionGzip compresses files with gzip, in a .gz file.
+	CompressionGzip
+	// CompressionZstd compresses files with the zstd tool, in a .zst file.
+	CompressionZstd
+)
+
+// ParseCompression parses a compression name ("none", "gzip" or "zstd"); an
+// empty name selects CompressionNone.
+func ParseCompression(s string) (Compression, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	}
+	return 0, fmt.Errorf("unknown compression %q", s)
+}
+
+// String returns the name of the compression as recorded in manifests.
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return ""
+}
+
+// Extension returns the extension appended to the names of compressed files.
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// writer returns a writer compressing into dst, which must be closed to
+// flush the compressed stream.
+func (c Compression) writer(dst io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(dst), nil
+	case CompressionZstd:
+		return startWriter([]string{"zstd", "--quiet", "--stdout"}, dst)
+	}
+	return nil, fmt.Errorf("unknown compression %d", c)
+}
+
+// decompressReader returns a reader of the content compressed in src with the
+// compression named name, as recorded in manifests. It must be closed.
+func decompressReader(name string, src io.Reader) (io.ReadCloser, error) {
+	switch name {
+	case "gzip":
+		return gzip.NewReader(src)
+	case "zstd":
+		return startReader([]string{"zstd", "--quiet", "--decompress", "--stdout"}, src)
+	}
+	return nil, fmt.Errorf("unknown compression %q", name)
+}
+
+// hashCompressed is like hashFile for the uncompressed content of the file at
+// path, compressed with the compression named name.
+func hashCompressed(path, name string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	r, err := decompressReader(name, f)
+	if err != nil {
+		return 0, "", err
+	}
+	hash := md5.New()
+	n, err := io.Copy(hash, r)
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,97 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// CopyError reports the files that could not be copied by CopyFolder.
+type CopyError struct {
+	Failures []Failure
+}
+
+func (e *CopyError) Error() string {
+	return fmt.Sprintf("%d file(s) could not be copied", len(e.Failures))
+}
+
+// CopyFolder recursively copies a Google Drive folder into another folder
+// on Drive, without downloading anything: folders are recreated and files
+// copied server-side with Files.Copy, keeping their names. It returns the
+// ID of the copy. Copying requires the full scope.
+//
+// Files that fail are reported through a *CopyError once every other file
+// has been copied.
+func (c *Client) CopyFolder(ctx context.Context, srcFolderID, dstFolderID string) (string, error) {
+	if c.anonymous() {
+		return "", ErrAnonymous
+	}
+	if err := c.requireScope(ctx, FullScope); err != nil {
+		return "", err
+	}
+	src, err := c.Service.Files.Get(srcFolderID).Fields("name").Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve folder: %w", err)
+	}
+	rootID, err := c.createFolder(ctx, src.Name, dstFolderID)
+	if err != nil {
+		return "", err
+	}
+	c.logf("Copying %s into folder %s", src.Name, rootID)
+
+	var (
+		mu       sync.Mutex
+		folders  = map[string]string{srcFolderID: rootID} // IDs of the copies of the source folders
+		failures []Failure
+	)
+	err = c.walk(ctx, srcFolderID, func(item DriveItem) error {
+		mu.Lock()
+		parentID := folders[item.Parents[len(item.Parents)-1]]
+		mu.Unlock()
+
+		if item.IsFolder() {
+			id, err := c.createFolder(ctx, item.File.Name, parentID)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			folders[item.ID] = id
+			mu.Unlock()
+			return nil
+		}
+
+		c.logf("Copying file: %s", item.Path)
+		copied := &drivev3.File{Name: item.File.Name, Parents: []string{parentID}}
+		if _, err := c.Service.Files.Copy(item.ID, copied).Fields("id").Context(ctx).Do(); err != nil {
+			c.logf("Failed to copy %s: %v", item.Path, err)
+			mu.Lock()
+			failures = append(failures, Failure{ID: item.ID, Path: item.Path, Err: err})
+			mu.Unlock()
+		}
+		return nil
+	})
+	var walkFailures *WalkError
+	if errors.As(err, &walkFailures) {
+		failures = append(failures, walkFailures.Folders...)
+	} else if err != nil {
+		return rootID, err
+	}
+	if len(failures) > 0 {
+		return rootID, &CopyError{Failures: failures}
+	}
+	return rootID, nil
+}
+
+// createFolder creates a folder named name in the folder parentID and
+// returns its ID.
+func (c *Client) createFolder(ctx context.Context, name, parentID string) (string, error) {
+	folder := &drivev3.File{Name: name, MimeType: folderMimeType, Parents: []string{parentID}}
+	created, err := c.Service.Files.Create(folder).Fields("id").Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to create folder %s: %w", name, err)
+	}
+	return created.Id, nil
+}
@@ -0,0 +1,157 @@
+package drive
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Debug selects the modules whose debug messages a client logs.
+type Debug uint
+
+const (
+	// DebugAPI logs every request to Drive with its status and duration.
+	DebugAPI Debug = 1 << iota
+	// DebugHTTP also logs the headers of every request and response, with
+	// credentials redacted.
+	DebugHTTP
+	// DebugWalker logs folder listings.
+	DebugWalker
+	// DebugDownloader logs the progress of every file.
+	DebugDownloader
+)
+
+// debugModules maps module names to their Debug flags, in the order they are
+// listed in error messages.
+var debugModules = []struct {
+	name  string
+	debug Debug
+}{
+	{"drive.api", DebugAPI},
+	{"drive.http", DebugHTTP},
+	{"walker", DebugWalker},
+	{"downloader", DebugDownloader},
+}
+
+// ParseDebug parses a comma-separated list of debug modules ("drive.api",
+// "drive.http", "walker", "downloader" or "all").
+func ParseDebug(s string) (Debug, error) {
+	var debug Debug
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			debug |= DebugAPI | DebugHTTP | DebugWalker | DebugDownloader
+			continue
+		}
+		found := false
+		for _, module := range debugModules {
+			if module.name == name {
+				debug |= module.debug
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown debug module %q", name)
+		}
+	}
+	return debug, nil
+}
+
+// VerbosityDebug returns the modules enabled by a verbosity level: 1 logs
+// the progress of every file, 2 also logs folder listings and API requests,
+// and 3 also logs HTTP headers.
+func VerbosityDebug(level int) Debug {
+	var debug Debug
+	if level >= 1 {
+		debug |= DebugDownloader
+	}
+	if level >= 2 {
+		debug |= DebugWalker | DebugAPI
+	}
+	if level >= 3 {
+		debug |= DebugHTTP
+	}
+	return debug
+}
+
+// debugf logs a debug message of a module if the client's Debug enables it.
+func (c *Client) debugf(module Debug, format string, args ...any) {
+	if c.Debug&module == 0 {
+		return
+	}
+	name := ""
+	for _, m := range debugModules {
+		if m.debug == module {
+			name = m.name
+		}
+	}
+	c.logf("["+name+"] "+format, args...)
+}
+
+// redactedParams and redactedHeaders hold credentials that are never logged.
+var (
+	redactedParams  = []string{"key", "access_token"}
+	redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Goog-Api-Key"}
+)
+
+// redactURL returns u with its credentials replaced.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, param := range redactedParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.String()
+	}
+	clone := *u
+	clone.RawQuery = query.Encode()
+	return clone.String()
+}
+
+// debugHeaders logs HTTP headers under DebugHTTP, one per line and in name
+// order, with credentials replaced.
+func (c *Client) debugHeaders(prefix string, header http.Header) {
+	if c.Debug&DebugHTTP == 0 {
+		return
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		for _, secret := range redactedHeaders {
+			if strings.EqualFold(name, secret) {
+				value = "REDACTED"
+			}
+		}
+		c.debugf(DebugHTTP, "%s %s: %s", prefix, name, value)
+	}
+}
+
+// debugRoundTrip sends a request through base, logging it and its response
+// under DebugAPI and DebugHTTP.
+func (c *Client) debugRoundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	c.debugHeaders(">", req.Header)
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		c.debugf(DebugAPI, "%s %s: %v (%s)", req.Method, redactURL(req.URL), err, elapsed)
+		return nil, err
+	}
+	c.debugf(DebugAPI, "%s %s: %s (%s)", req.Method, redactURL(req.URL), resp.Status, elapsed)
+	c.debugHeaders("<", resp.Header)
+	return resp, nil
+}
@@ -0,0 +1,229 @@
+package drive
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TreeFile describes a file of a folder tree for comparison.
+type TreeFile struct {
+	Size int64  // size in bytes, or -1 if unknown (Google-native files)
+	MD5  string // MD5 checksum, empty if unknown
+}
+
+// Tree maps slash-separated relative paths to the files of a folder tree.
+type Tree map[string]TreeFile
+
+// RemoteTree lists every file below a Drive folder, using the local names
+// DownloadFolder would give them so that it can be compared to a download.
+func (c *Client) RemoteTree(ctx context.Context, folderID string) (Tree, error) {
+	tree := make(Tree)
+	var mu sync.Mutex
+	err := c.walk(ctx, folderID, func(item DriveItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case item.IsFolder():
+		case isGoogleDoc(item.File):
+			tree[item.Path] = TreeFile{Size: -1}
+		default:
+			tree[item.Path] = TreeFile{Size: item.Size, MD5: item.MD5}
+		}
+		return nil
+	})
+	return tree, err
+}
+
+// LocalTree lists every file below a local directory, hashing their content.
+// The files a download writes besides those of the folder are skipped: its
+// manifest, queue journal, sparse specification and ignore file, and the
+// XMP sidecars, comment sidecars, link stubs and extracted images of the
+// files its manifest records. A download with LayoutCAS is listed through
+// its object tree.
+func LocalTree(root string) (Tree, error) {
+	skip, skipDirs := downloadExtras(root)
+	if objects, err := LoadObjectTree(filepath.Join(root, TreeName)); err == nil {
+		return objectTree(root, objects, skip, skipDirs)
+	}
+	tree := make(Tree)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if entry.IsDir() {
+			if skipDirs[relPath] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skip[relPath] {
+			return nil
+		}
+		size, sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		tree[relPath] = TreeFile{Size: size, MD5: sum}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return tree, nil
+}
+
+// downloadExtras returns the slash-separated paths of the files, and of the
+// directories, that a download into root wrote besides the files of the
+// folder, according to its manifest if it has one.
+func downloadExtras(root string) (files, dirs map[string]bool) {
+	files = map[string]bool{ManifestName: true, QueueName: true, SparseName: true, IgnoreName: true}
+	dirs = make(map[string]bool)
+	m, err := LoadManifest(filepath.Join(root, ManifestName))
+	if err != nil {
+		return files, dirs
+	}
+	for _, entry := range m.Files {
+		files[entry.Path+SidecarExtension] = true
+		for _, ext := range commentsExtensions {
+			files[entry.Path+ext] = true
+		}
+		if !strings.HasPrefix(entry.MimeType, googleAppsPrefix) {
+			continue
+		}
+		base := strings.TrimSuffix(entry.Path, path.Ext(entry.Path))
+		files[base+"."+linkStubTag(entry.MimeType)] = true
+		if _, ok := imageSources[entry.MimeType]; ok {
+			dirs[path.Join(path.Dir(entry.Path), AssetsDir, path.Base(base))] = true
+		}
+	}
+	// A file of the folder is never skipped, e.g. the link stub saved
+	// instead of a document with LinkStubsOnly.
+	for _, entry := range m.Files {
+		delete(files, entry.Path)
+	}
+	return files, dirs
+}
+
+// objectTree lists the files of a download with LayoutCAS but those of skip
+// and below skipDirs, hashing their objects.
+func objectTree(root string, objects *ObjectTree, skip, skipDirs map[string]bool) (Tree, error) {
+	tree := make(Tree, len(objects.Files))
+	hashed := make(map[string]TreeFile)
+	for relPath, object := range objects.Files {
+		if skip[relPath] || below(relPath, skipDirs) {
+			continue
+		}
+		file, ok := hashed[object]
+		if !ok {
+			size, sum, err := hashFile(filepath.Join(root, ObjectsDir, object))
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+			}
+			file = TreeFile{Size: size, MD5: sum}
+			hashed[object] = file
+		}
+		tree[relPath] = file
+	}
+	return tree, nil
+}
+
+// below reports whether the slash-separated relPath is below one of dirs.
+func below(relPath string, dirs map[string]bool) bool {
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFile returns the size and hex-encoded MD5 checksum of a local file.
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashFileSHA256 returns the size and hex-encoded MD5 and SHA-256 checksums
+// of a local file, read once.
+func hashFileSHA256(path string) (int64, string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer f.Close()
+
+	md5Hash, shaHash := md5.New(), sha256.New()
+	n, err := io.Copy(io.MultiWriter(md5Hash, shaHash), f)
+	if err != nil {
+		return n, "", "", err
+	}
+	return n, hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(shaHash.Sum(nil)), nil
+}
+
+// TreeDiff lists the differences between two folder trees.
+type TreeDiff struct {
+	OnlyInA []string
+	OnlyInB []string
+	Differ  []string // present in both but with a different size or checksum
+}
+
+// Empty reports whether the trees are identical.
+func (d *TreeDiff) Empty() bool {
+	return len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.Differ) == 0
+}
+
+// DiffTrees compares two folder trees. Files whose content is unknown on
+// either side (Google-native files) are only compared by presence.
+func DiffTrees(a, b Tree) *TreeDiff {
+	diff := &TreeDiff{}
+	for path, fa := range a {
+		fb, ok := b[path]
+		switch {
+		case !ok:
+			diff.OnlyInA = append(diff.OnlyInA, path)
+		case fa.MD5 != "" && fb.MD5 != "":
+			if fa.MD5 != fb.MD5 {
+				diff.Differ = append(diff.Differ, path)
+			}
+		case fa.Size >= 0 && fb.Size >= 0:
+			if fa.Size != fb.Size {
+				diff.Differ = append(diff.Differ, path)
+			}
+		}
+	}
+	for path := range b {
+		if _, ok := a[path]; !ok {
+			diff.OnlyInB = append(diff.OnlyInB, path)
+		}
+	}
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(diff.OnlyInB)
+	sort.Strings(diff.Differ)
+	return diff
+}
@@ -0,0 +1,22 @@
+// Package drive downloads Google Drive folders to local directories or
+// archives. It is the library behind the drive-downloader command.
+//
+// A Client is created with NewClient and configured through its exported
+// fields before use:
+//
+//	client, err := drive.NewClient(ctx, drive.WithCredentialsFile("service-account.json"))
+//	if err != nil {
+//		return err
+//	}
+//	client.Concurrency = 8
+//	err = client.DownloadFolder(ctx, folderID, "backup")
+//
+// # Compatibility
+//
+// The package follows semantic versioning. Within a major version, exported
+// identifiers are not removed or changed incompatibly; new fields, options
+// and methods may be added. The log messages written to Client.Logger are
+// meant for people and may change in any release, but the manifest and queue
+// files written into download directories stay readable by later releases
+// of the same major version.
+package drive
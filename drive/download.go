@@ -0,0 +1,714 @@
+package drive
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// fileFields lists the file metadata needed to download and verify a file,
+// to describe it in sidecars, to report files that cannot be downloaded, and
+// for ExportResolvers to decide how to export it.
+const fileFields = "id, name, mimeType, size, md5Checksum, sha256Checksum, headRevisionId, modifiedTime, createdTime, description, parents, capabilities(canDownload, canCopy), shared, owners(emailAddress), resourceKey"
+
+// download tracks the state of a single DownloadFolder call.
+type download struct {
+	root     string
+	sink     sink
+	queue    *jobQueue
+	previous *Manifest            // manifest of the previous download into root, if any
+	verify   chan<- verifyJob     // verification workers, if the sink supports them
+	shared   *SharedJob           // shared job the files are downloaded for, if any
+	short    *shortNames          // shortens local paths that are too long, if set
+	rules    *dirRules            // limits the paths walked, if set
+	plan     *Plan                // plan whose files are downloaded instead of walking, if any
+	planned  map[string]string    // actions of the files of plan by ID
+	events   chan<- ProgressEvent // receives the progress of the download, if set
+
+	mu       sync.Mutex
+	manifest *Manifest
+}
+
+// record adds a completed file to the manifest and marks it done in the queue.
+func (d *download) record(entry ManifestEntry) {
+	d.mu.Lock()
+	d.manifest.Put(entry)
+	d.mu.Unlock()
+	if d.queue != nil {
+		d.queue.Done(entry)
+	}
+	if d.shared != nil {
+		d.shared.complete(entry)
+	}
+	d.emit(ProgressEvent{Kind: EventFinished, ID: entry.ID, Path: entry.Path, Bytes: entry.Size})
+}
+
+// Failure describes a file that could not be downloaded.
+type Failure struct {
+	ID   string
+	Path string
+	Err  error
+}
+
+// DownloadError is returned when some files of a download failed. The other
+// files were downloaded.
+type DownloadError struct {
+	Failures []Failure
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("%d file(s) could not be downloaded", len(e.Failures))
+}
+
+// ErrOwnerSuspended is wrapped by the errors of files that could not be
+// downloaded because the account owning them is suspended.
+var ErrOwnerSuspended = errors.New("owner's account is suspended")
+
+// ErrAbusiveFile is wrapped by the errors of files that Google flagged as
+// malware or spam, which are only downloaded if AcknowledgeAbuse is set.
+var ErrAbusiveFile = errors.New("file is flagged as malware or spam")
+
+// ErrNotDownloadable is wrapped by the errors of files that Drive refuses to
+// download and that cannot be exported either.
+var ErrNotDownloadable = errors.New("file cannot be downloaded")
+
+// apiErrorReason reports whether err is a Drive API error with the given
+// reason.
+func apiErrorReason(err error, reason string) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerSuspended reports whether a Drive API error was caused by the file's
+// owner being suspended. Drive reports this as a 403 whose reason or message
+// mentions the suspension, depending on the kind of file.
+func ownerSuspended(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if strings.Contains(strings.ToLower(item.Reason), "suspended") || strings.Contains(strings.ToLower(item.Message), "suspended") {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(apiErr.Message), "suspended")
+}
+
+// getFile retrieves the metadata needed to download a file.
+func (c *Client) getFile(ctx context.Context, fileID string) (*drivev3.File, error) {
+	if c.anonymous() {
+		return nil, ErrAnonymous
+	}
+	file, err := c.Service.Files.Get(fileID).Fields(fileFields).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve file: %w", err)
+	}
+	return file, nil
+}
+
+// DownloadFolder recursively downloads a Google Drive folder to the specified
+// path, descending at most MaxDepth levels of subfolders and downloading
+// Concurrency files at a time. Every downloaded file is recorded in a
+// manifest written to the root of downloadPath; files that are unchanged
+// since the download that wrote the previous manifest are not downloaded
+// again, so repeated runs only transfer what changed. While the download
+// runs, its work queue is journaled next to the manifest so that an
+// interrupted download resumes where it stopped.
+//
+// Files that fail are reported through a *DownloadError once every other
+// file has been downloaded.
+func (c *Client) DownloadFolder(ctx context.Context, folderID, downloadPath string) error {
+	return c.downloadInto(ctx, folderID, downloadPath, nil, nil)
+}
+
+// downloadInto downloads a folder into downloadPath for DownloadFolder, or
+// the files of plan for ApplyPlan, sending its progress to events if set.
+func (c *Client) downloadInto(ctx context.Context, folderID, downloadPath string, plan *Plan, events chan<- ProgressEvent) error {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return err
+	}
+	if err := c.checkAfterDownload(ctx); err != nil {
+		return err
+	}
+	queue, err := openQueue(filepath.Join(downloadPath, QueueName), folderID)
+	if err != nil {
+		return err
+	}
+	sink, err := c.sink(downloadPath)
+	if err != nil {
+		queue.Close(false)
+		return err
+	}
+	d := &download{root: downloadPath, sink: sink, queue: queue, plan: plan, events: events, manifest: &Manifest{FolderID: folderID}}
+	if plan != nil {
+		d.planned = make(map[string]string, len(plan.Actions))
+		for _, a := range plan.Actions {
+			if a.File != nil {
+				d.planned[a.File.Id] = a.Action
+			}
+		}
+	}
+	if d.previous, d.short, err = c.previousDownload(folderID, downloadPath); err != nil {
+		queue.Close(false)
+		return err
+	}
+	if d.rules, err = c.loadDirRules(downloadPath); err != nil {
+		queue.Close(false)
+		return err
+	}
+
+	err = c.downloadTree(ctx, d, folderID)
+	d.manifest.ShortNames = d.short.recorded()
+	if closeErr := queue.Close(err == nil); err == nil {
+		err = closeErr
+	}
+	if cas, ok := sink.(*casSink); ok {
+		if treeErr := cas.finish(d.manifest); err == nil {
+			err = treeErr
+		}
+	}
+	if saveErr := d.manifest.Save(filepath.Join(downloadPath, ManifestName)); err == nil {
+		err = saveErr
+	}
+	return c.afterDownload(ctx, d.manifest, err)
+}
+
+// previousDownload loads the manifest of the previous download of folderID
+// into downloadPath, or else the client's Seed, if any, and returns it with
+// the shortener of the local names of the download, if it needs one.
+func (c *Client) previousDownload(folderID, downloadPath string) (*Manifest, *shortNames, error) {
+	var previous *Manifest
+	if m, err := LoadManifest(filepath.Join(downloadPath, ManifestName)); err == nil && m.FolderID == folderID {
+		previous = m
+	} else if c.Seed != nil {
+		if c.Seed.FolderID != folderID {
+			return nil, nil, fmt.Errorf("the seed manifest records folder %s, not %s", c.Seed.FolderID, folderID)
+		}
+		c.logf("Starting from the seed manifest: files found with their recorded size are not downloaded again")
+		previous = c.Seed
+	}
+	if previous != nil {
+		// Indexed now, as the workers look it up concurrently.
+		previous.buildIndex()
+	}
+	if c.MaxPathLength <= 0 && previous == nil {
+		return previous, nil, nil
+	}
+	root, err := filepath.Abs(downloadPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var recorded map[string]string
+	if previous != nil {
+		recorded = previous.ShortNames
+	}
+	return previous, c.newShortNames(len(root), recorded), nil
+}
+
+// DownloadArchive recursively downloads a Google Drive folder into a zip or
+// tar archive at archivePath, the format being chosen by its extension. If
+// VolumeSize is set, the archive is split into numbered volumes that each
+// stay below that size, and an index mapping every path to its volume is
+// written next to them. Entries are written in a streaming-friendly order:
+// the folders first, as the walk finds them, then the files one folder at a
+// time, so that the files of a folder are contiguous and follow the entry of
+// their folder. Files are only downloaded once the walk is over.
+func (c *Client) DownloadArchive(ctx context.Context, folderID, archivePath string) error {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return err
+	}
+	if err := c.checkAfterDownload(ctx); err != nil {
+		return err
+	}
+	archive, err := newArchiveSink(archivePath, c.VolumeSize)
+	if err != nil {
+		return err
+	}
+	queue, _ := openQueue("", folderID)
+	queue.SetGrouped()
+	d := &download{sink: archive, queue: queue, manifest: &Manifest{FolderID: folderID}}
+	d.rules, _ = c.loadDirRules("")
+	err = c.downloadTree(ctx, d, folderID)
+	queue.Close(err == nil)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	return c.afterDownload(ctx, d.manifest, err)
+}
+
+// downloadTree walks a folder, creating its subfolders in d's sink and adding
+// its files to d's queue, while Concurrency workers download the queued files:
+// files start downloading as soon as they are found, while deeper folders are
+// still being listed. Files completed by an interrupted earlier run, according
+// to d's queue, are not downloaded again.
+func (c *Client) downloadTree(ctx context.Context, d *download, folderID string) (err error) {
+	var (
+		mu         sync.Mutex
+		failures   []Failure
+		suspended  []Failure
+		restricted []restrictedFile
+		clashes    []DriveItem
+	)
+	status := c.newStatus(folderID)
+	defer func() {
+		if statusErr := status.close(err); statusErr != nil {
+			c.logf("Failed to write status: %v", statusErr)
+		}
+	}()
+	metrics, metricsErr := c.newMetrics(d.queue)
+	if metricsErr != nil {
+		return metricsErr
+	}
+	defer func() {
+		if metricsErr := metrics.close(); metricsErr != nil {
+			c.logf("Failed to write metrics: %v", metricsErr)
+		}
+	}()
+	fail := func(file *drivev3.File, relPath string, err error) {
+		failure := Failure{ID: file.Id, Path: relPath, Err: err}
+		isSuspended := ownerSuspended(err)
+		mu.Lock()
+		defer mu.Unlock()
+		if isSuspended {
+			failure.Err = fmt.Errorf("%w: %v", ErrOwnerSuspended, err)
+			suspended = append(suspended, failure)
+		}
+		if isSuspended && c.SkipSuspended {
+			c.logf("Skipping %s: %v", relPath, failure.Err)
+		} else {
+			c.logf("Failed to download %s: %v", relPath, failure.Err)
+			failures = append(failures, failure)
+			status.fail(relPath, failure.Err)
+		}
+		d.emit(ProgressEvent{Kind: EventFailed, ID: file.Id, Path: relPath, Err: failure.Err})
+	}
+
+	// Downloaded files are handed to separate verification workers so that
+	// hashing them does not hold up the next download.
+	verifyJobs := make(chan verifyJob, max(c.Concurrency, 1))
+	var verifiers sync.WaitGroup
+	if root, ok := d.sink.(dirSink); ok && !root.transforms() {
+		// Compressed and encrypted files are hashed as they are written
+		// instead.
+		d.verify = verifyJobs
+		for i := 0; i < max(c.VerifyConcurrency, 1); i++ {
+			verifiers.Add(1)
+			go func() {
+				defer verifiers.Done()
+				for job := range verifyJobs {
+					if err := c.verifyFile(d, job); err != nil {
+						fail(job.file, job.entry.Path, err)
+					}
+				}
+			}()
+		}
+	}
+
+	if len(c.Classes) > 0 || c.ExportConcurrency > 0 {
+		limits := make([]int, len(c.Classes))
+		for i, class := range c.Classes {
+			limits[i] = class.Concurrency
+		}
+		classify := c.transferClass
+		if c.ExportConcurrency > 0 {
+			limits = append(limits, c.ExportConcurrency)
+			classify = c.exportClass
+		}
+		d.queue.SetClasses(classify, limits)
+	}
+	if len(c.Priorities) > 0 {
+		d.queue.SetPrioritized()
+	}
+	workers := c.startWorkers(func(retire func() bool) bool {
+		for ctx.Err() == nil {
+			if retire() {
+				return true
+			}
+			item, ok := d.queue.Pop()
+			if !ok {
+				return false
+			}
+			c.debugf(DebugDownloader, "Starting %s", item.Path)
+			status.start(item.Path)
+			d.emit(ProgressEvent{Kind: EventStarted, ID: item.File.Id, Path: item.Path})
+			metrics.started()
+			err := c.fetchFile(ctx, d, item.File, item.Path)
+			metrics.finished()
+			d.queue.Release(item)
+			status.finish(item.File, item.Path, err)
+			if err != nil && ctx.Err() == nil {
+				fail(item.File, item.Path, err)
+			}
+		}
+		return false
+	})
+
+	// Wake a walk waiting for room in the queue if the download is cancelled.
+	stop := context.AfterFunc(ctx, d.queue.Cancel)
+	defer stop()
+
+	// enqueue creates a folder or queues a file to download to relPath.
+	enqueue := func(item DriveItem, relPath string) error {
+		if item.CaseClash != "" {
+			mu.Lock()
+			clashes = append(clashes, item)
+			mu.Unlock()
+		}
+		if item.IsFolder() {
+			return d.sink.Mkdir(item.Path)
+		}
+		if downloadRestricted(item.File) {
+			// Downloading it would only fail; it is reported at the end.
+			c.logf("Skipping %s: download disabled by its sharing settings", item.Path)
+			mu.Lock()
+			restricted = append(restricted, restrictedFile{path: item.Path, file: item.File})
+			mu.Unlock()
+			return nil
+		}
+		queued, resumed := d.queue.Add(queueItem{Path: relPath, File: item.File, Priority: c.priority(item.Path)})
+		if queued {
+			status.found(item.File)
+			d.emit(ProgressEvent{Kind: EventDiscovered, ID: item.File.Id, Path: relPath, Bytes: item.File.Size})
+		}
+		if resumed != nil {
+			// Completed by an earlier run, and still found by this one.
+			status.resume(*resumed)
+			d.mu.Lock()
+			d.manifest.Put(*resumed)
+			d.mu.Unlock()
+		}
+		return nil
+	}
+	var walkErr error
+	if d.plan != nil {
+		walkErr = d.plan.each(enqueue)
+	} else {
+		walkErr = c.walkShortened(ctx, folderID, d.short, d.rules, func(item DriveItem) error {
+			return enqueue(item, c.route(item.Path))
+		})
+	}
+	var walkFailures *WalkError
+	if errors.As(walkErr, &walkFailures) {
+		// The folders are reported with the failed files, and listed
+		// again by the next run.
+		for _, failure := range walkFailures.Folders {
+			mu.Lock()
+			failures = append(failures, failure)
+			mu.Unlock()
+			status.fail(failure.Path, failure.Err)
+		}
+		walkErr = nil
+	}
+	if walkErr != nil {
+		// Let the workers finish the files in flight, then stop.
+		d.queue.Cancel()
+	} else {
+		d.queue.MarkWalked()
+		status.walked()
+	}
+	c.waitWorkers(workers)
+	close(verifyJobs)
+	verifiers.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+	if len(suspended) > 0 && c.SkipSuspended {
+		c.logf("Skipped files owned by suspended accounts (%d):", len(suspended))
+		for _, failure := range suspended {
+			c.logf("  %s", failure.Path)
+		}
+	}
+	c.summarizeFailures(failures)
+	c.reportCaseClashes(clashes)
+	if err := c.reportRestricted(restricted); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return &DownloadError{Failures: failures}
+	}
+	return nil
+}
+
+// fetchFile downloads or exports a file to relPath below the download root,
+// verifies it against the checksum reported by Drive, directly or through
+// d's verification workers, and records it in the manifest. Files that the
+// previous download holds are kept or moved instead, as decided by
+// fileAction or, for the files of a plan, as the plan records.
+func (c *Client) fetchFile(ctx context.Context, d *download, file *drivev3.File, relPath string) error {
+	filePath := filepath.Join(d.root, filepath.FromSlash(relPath))
+	entry := ManifestEntry{
+		ID:           file.Id,
+		Path:         relPath,
+		MimeType:     file.MimeType,
+		ModifiedTime: file.ModifiedTime,
+		Revision:     file.HeadRevisionId,
+	}
+	if c.FixExtensions && !isGoogleDoc(file) {
+		entry.Extension = appendedExtension(file, relPath)
+	}
+	prev, found := d.previous.Lookup(file.Id)
+	if cas, ok := d.sink.(*casSink); ok && found {
+		filePath = cas.localPath(prev)
+	}
+	action, planned := d.planned[file.Id]
+	if !planned {
+		action, prev = c.fileAction(ctx, prev, found, &entry, file, filePath)
+	}
+	switch {
+	case action == ActionSkip && !found, action == ActionMove && !found:
+		return fmt.Errorf("the plan keeps the local copy of %s, which the previous download does not record", relPath)
+	case action == ActionSkip:
+		c.debugf(DebugDownloader, "Unchanged since the last download: %s", relPath)
+		if planned {
+			// The plan found that only the metadata of the file changed.
+			prev.ModifiedTime = entry.ModifiedTime
+			prev.Revision = cmp.Or(entry.Revision, prev.Revision)
+		}
+		d.record(prev)
+		return nil
+	case action == ActionMove && c.moveLocal(d, prev, entry, file):
+		return nil
+	case action == ActionMove && planned:
+		return fmt.Errorf("failed to move %s to %s as planned: its local copy changed", prev.Path, relPath)
+	case !planned && found && c.probeUnchanged(ctx, d, prev, entry, file, filePath):
+		return nil
+	}
+
+	if c.LinkStubs == LinkStubsOnly && isGoogleDoc(file) {
+		return c.fetchLinkStub(d, file, entry)
+	}
+	if file.MimeType == scriptMimeType {
+		return c.fetchScript(ctx, d, file, entry)
+	}
+
+	var body io.ReadCloser
+	var err error
+	if isGoogleDoc(file) {
+		c.logf("Exporting file: %s", file.Name)
+		if entry.Revision == "" {
+			entry.Revision = c.docRevision(ctx, file)
+		}
+		entry.ExportMimeType = c.exportFormatFor(file).MimeType
+		body, err = c.exportFile(ctx, file, c.exportFormatFor(file))
+		if file.MimeType == sheetMimeType && apiErrorReason(err, "exportSizeLimitExceeded") && !c.anonymous() {
+			return c.fetchSheetTabs(ctx, d, file, entry)
+		}
+	} else {
+		c.logf("Downloading file: %s", file.Name)
+		body, err = c.downloadFile(ctx, file.Id)
+		if apiErrorReason(err, "fileNotDownloadable") {
+			// Google-native files listed with another type can still be
+			// exported once their actual type is known.
+			native, getErr := c.getFile(ctx, file.Id)
+			if getErr != nil || !isGoogleDoc(native) {
+				return fmt.Errorf("%w: %v", ErrNotDownloadable, err)
+			}
+			c.logf("Exporting file, which Drive reports as a Google document: %s", file.Name)
+			file = native
+			entry.MimeType = file.MimeType
+			entry.ExportMimeType = c.exportFormatFor(file).MimeType
+			body, err = c.exportFile(ctx, file, c.exportFormatFor(file))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	modTime, _ := time.Parse(time.RFC3339, file.ModifiedTime)
+	// The bandwidth limit may be set while the file downloads.
+	src := io.Reader(&limitedReader{ctx: ctx, c: c, r: body})
+	if d.events != nil {
+		src = &progressReader{r: src, d: d, id: file.Id, path: relPath}
+	}
+	var sha hash.Hash
+	if file.Sha256Checksum != "" && !isGoogleDoc(file) {
+		sha = sha256.New()
+		src = io.TeeReader(src, sha)
+	}
+	extract := c.newExtractor(d, relPath)
+	if extract != nil {
+		src = extract.reader(src)
+	}
+	discard := extract != nil && c.DiscardArchives
+	if root, ok := d.sink.(dirSink); ok && d.verify != nil && !discard {
+		// The checksum is computed and verified by a verification worker.
+		var size int64
+		if !isGoogleDoc(file) {
+			size = file.Size
+		}
+		entry.Size, err = root.saveUnhashed(relPath, size, src)
+	} else {
+		entry.Size, entry.MD5, err = d.sink.Save(relPath, modTime, src)
+	}
+	if extract != nil {
+		if extractErr := extract.finish(err); err == nil {
+			err = extractErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if sha != nil {
+		entry.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	}
+	switch sink := d.sink.(type) {
+	case dirSink:
+		sink.record(&entry)
+	case *casSink:
+		sink.record(&entry)
+	}
+	if c.Sidecars && isMedia(file) {
+		if err := c.writeSidecar(d, file, relPath, modTime); err != nil {
+			return err
+		}
+	}
+	if c.ExtractImages && isGoogleDoc(file) {
+		if err := c.extractImages(ctx, d, file, relPath, modTime); err != nil {
+			return err
+		}
+	}
+	if c.Comments != CommentsNone && isGoogleDoc(file) {
+		if err := c.writeComments(ctx, d, file, relPath, modTime); err != nil {
+			return err
+		}
+	}
+	if c.LinkStubs == LinkStubsAlongside && isGoogleDoc(file) {
+		if _, _, err := c.writeLinkStub(d, file, linkStubPath(relPath, c.exportFormatFor(file)), modTime); err != nil {
+			return err
+		}
+	}
+	c.Stats.addFile(entry.Size)
+	if discard {
+		// The archive is only deleted once its checksum was verified.
+		entry.Discarded = true
+		if err := c.checkFile(d, entry, file); err != nil {
+			return err
+		}
+		extract.discard()
+		return nil
+	}
+	if d.verify != nil && entry.MD5 == "" {
+		d.verify <- verifyJob{entry: entry, file: file}
+		return nil
+	}
+	return c.checkFile(d, entry, file)
+}
+
+// downloadFile opens the content of a file by its ID for download. Files
+// flagged as abusive are downloaded again acknowledging the risk if the
+// client's AcknowledgeAbuse is set, which Drive only permits to some users,
+// such as the owner of the file. If the API fails with a transient error,
+// the file is downloaded from its webContentLink instead, which some large
+// files download more reliably through.
+func (c *Client) downloadFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if c.anonymous() {
+		return c.downloadPublicFile(ctx, fileID)
+	}
+	resp, err := c.Service.Files.Get(fileID).Context(ctx).Download()
+	if apiErrorReason(err, "cannotDownloadAbusiveFile") {
+		if !c.AcknowledgeAbuse {
+			return nil, fmt.Errorf("%w: %v", ErrAbusiveFile, err)
+		}
+		c.debugf(DebugDownloader, "Acknowledging abuse to download %s", fileID)
+		if resp, err = c.Service.Files.Get(fileID).AcknowledgeAbuse(true).Context(ctx).Download(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAbusiveFile, err)
+		}
+	}
+	if err != nil && ctx.Err() == nil && transientError(err) {
+		c.logf("Failed to download %s through the API, trying its webContentLink: %v", fileID, err)
+		body, linkErr := c.downloadContentLink(ctx, fileID)
+		if linkErr == nil {
+			return body, nil
+		}
+		c.debugf(DebugDownloader, "Download of %s through its webContentLink failed: %v", fileID, linkErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// downloadContentLink opens the content of a file through its
+// webContentLink, the link the Drive web interface downloads files with,
+// authenticated like the API requests.
+func (c *Client) downloadContentLink(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	file, err := c.Service.Files.Get(fileID).Fields("webContentLink").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if file.WebContentLink == "" {
+		return nil, errors.New("file has no webContentLink")
+	}
+	return c.openPublic(ctx, file.WebContentLink)
+}
+
+// exportFile opens a Google-native file, exported in the given format, for
+// download, paced by the client's export limiter: exports that Drive throttles
+// are retried once every export has backed off. Spreadsheets lose their
+// formulas if the client's SheetValuesOnly is set.
+func (c *Client) exportFile(ctx context.Context, file *drivev3.File, format exportFormat) (io.ReadCloser, error) {
+	var interval time.Duration
+	if c.ExportRate > 0 {
+		interval = time.Duration(float64(time.Second) / c.ExportRate)
+	}
+	for attempt := 1; ; attempt++ {
+		if err := c.exports.wait(ctx, interval); err != nil {
+			return nil, err
+		}
+		body, err := c.openExport(ctx, file, format)
+		if err == nil {
+			c.exports.succeeded()
+			if c.valuesOnly(file, format) {
+				return stripFormulas(body, format)
+			}
+			return body, nil
+		}
+		if attempt == exportAttempts || ctx.Err() != nil || !throttledError(err) {
+			return nil, err
+		}
+		delay := c.exports.throttled()
+		c.logf("Export of %s throttled, retrying in %s: %v", file.Name, delay, err)
+	}
+}
+
+// openExport requests the export of a Google-native file in the given format.
+func (c *Client) openExport(ctx context.Context, file *drivev3.File, format exportFormat) (io.ReadCloser, error) {
+	if file.MimeType == sheetMimeType && format.MimeType == "application/pdf" && !c.PDF.isZero() {
+		return c.exportSheetPDF(ctx, file)
+	}
+	if c.anonymous() {
+		return c.exportPublicFile(ctx, file, format)
+	}
+	resp, err := c.Service.Files.Export(file.Id, format.MimeType).Context(ctx).Download()
+	if err != nil {
+		return nil, fmt.Errorf("failed to export file: %w", err)
+	}
+	return resp.Body, nil
+}
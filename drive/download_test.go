@@ -0,0 +1,2007 @@
+package drive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+	"github.com/rgsuhas/drive-downloader/drive/drivetest"
+)
+
+const (
+	docMimeType   = "application/vnd.google-apps.document"
+	sheetMimeType = "application/vnd.google-apps.spreadsheet"
+	pdfMimeType   = "application/pdf"
+	xlsxMimeType  = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	odsMimeType   = "application/vnd.oasis.opendocument.spreadsheet"
+)
+
+// newTree starts a server holding a small folder tree and returns it with
+// the ID of the folder and of its subfolder.
+func newTree(t *testing.T) (srv *drivetest.Server, root, sub string) {
+	t.Helper()
+	srv = drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root = srv.AddFolder("", "Backup")
+	srv.AddFile(root, "notes.txt", []byte("hello\n"))
+	srv.AddFile(root, "same.txt", []byte("first\n"))
+	srv.AddFile(root, "same.txt", []byte("second\n"))
+	srv.AddDocument(root, "Report", docMimeType, map[string][]byte{pdfMimeType: []byte("%PDF report\n")})
+	// The export of the document must not take the name of a real file.
+	srv.AddFile(root, "Report.pdf", []byte("%PDF uploaded\n"))
+	srv.AddDocument(root, "Budget", sheetMimeType, map[string][]byte{
+		xlsxMimeType: []byte("xlsx budget\n"),
+		odsMimeType:  []byte("ods budget\n"),
+	})
+	sub = srv.AddFolder(root, "Photos")
+	srv.AddFile(sub, "cat.jpg", []byte("meow\n"))
+	srv.AddFolder(sub, "Empty")
+	return srv, root, sub
+}
+
+// newClient creates a client of srv.
+func newClient(t *testing.T, srv *drivetest.Server) *drive.Client {
+	t.Helper()
+	client, err := srv.NewClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestDownloadFolder(t *testing.T) {
+	srv, root, _ := newTree(t)
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	drivetest.CompareDir(t, dir, "testdata/download")
+
+	// Downloading again transfers nothing new.
+	files := client.Stats.Files()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if downloaded := client.Stats.Files() - files; downloaded != 0 {
+		t.Errorf("second download fetched %d files, want 0", downloaded)
+	}
+	drivetest.CompareDir(t, dir, "testdata/download")
+}
+
+func TestDownloadFolderEvents(t *testing.T) {
+	srv, root, _ := newTree(t)
+	broken := srv.AddFile(root, "broken.txt", []byte("broken\n"))
+	srv.Fail(broken, http.StatusNotFound)
+	client := newClient(t, srv)
+	events, err := client.DownloadFolderEvents(context.Background(), root, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string][]drive.ProgressEventKind)
+	var last drive.ProgressEvent
+	for event := range events {
+		if event.Kind != drive.EventProgressed {
+			kinds[event.Path] = append(kinds[event.Path], event.Kind)
+		}
+		last = event
+	}
+
+	var downloadErr *drive.DownloadError
+	if last.Kind != drive.EventDone || !errors.As(last.Err, &downloadErr) {
+		t.Fatalf("last event = %v %v, want done with a download error", last.Kind, last.Err)
+	}
+	want := map[string][]drive.ProgressEventKind{
+		"notes.txt":      {drive.EventDiscovered, drive.EventStarted, drive.EventFinished},
+		"Photos/cat.jpg": {drive.EventDiscovered, drive.EventStarted, drive.EventFinished},
+		"broken.txt":     {drive.EventDiscovered, drive.EventStarted, drive.EventFailed},
+	}
+	for path, want := range want {
+		if got := kinds[path]; !slices.Equal(got, want) {
+			t.Errorf("events of %s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestDownloadFolderLiveLimits(t *testing.T) {
+	srv, root, _ := newTree(t)
+	for i := range 20 {
+		srv.AddFile(root, fmt.Sprintf("file%02d.txt", i), []byte(strings.Repeat("x", 100)))
+	}
+	client := newClient(t, srv)
+	client.Concurrency = 1
+	client.BandwidthLimit = 1 << 20
+	dir := t.TempDir()
+	events, err := client.DownloadFolderEvents(context.Background(), root, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := 0
+	var last drive.ProgressEvent
+	for event := range events {
+		if event.Kind == drive.EventFinished {
+			// Limits change while the download runs.
+			switch finished++; finished {
+			case 1:
+				client.SetConcurrency(8)
+				client.SetBandwidthLimit(0)
+			case 10:
+				client.SetConcurrency(2)
+			}
+		}
+		last = event
+	}
+	if last.Err != nil {
+		t.Fatal(last.Err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if name := fmt.Sprintf("file%02d.txt", i); len(got[name]) != 100 {
+			t.Errorf("%s holds %d bytes, want 100", name, len(got[name]))
+		}
+	}
+}
+
+// credentialsChecker fails the test if a request carries credentials.
+type credentialsChecker struct {
+	t    *testing.T
+	base http.RoundTripper
+}
+
+func (c credentialsChecker) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" || req.URL.Query().Has("key") {
+		c.t.Errorf("request to %s carries credentials", req.URL)
+	}
+	return c.base.RoundTrip(req)
+}
+
+// newAnonymousClient creates a client of srv without credentials.
+func newAnonymousClient(t *testing.T, srv *drivetest.Server) *drive.Client {
+	t.Helper()
+	client, err := drive.NewClient(context.Background(), drive.WithoutCredentials(),
+		drive.WithHTTPClient(&http.Client{Transport: credentialsChecker{t: t, base: srv.HTTPClient().Transport}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Logger = nil
+	return client
+}
+
+func TestDownloadFolderWithoutCredentials(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Public")
+	srv.AddFile(root, "notes & todo.txt", []byte("hello\n"))
+	sub := srv.AddFolder(root, "Photos")
+	srv.AddFile(sub, "cat.jpg", []byte("meow\n"))
+	srv.AddDocument(sub, "Report", docMimeType, map[string][]byte{pdfMimeType: []byte("%PDF report\n")})
+	srv.AddDocument(root, "Budget", sheetMimeType, map[string][]byte{xlsxMimeType: []byte("xlsx budget\n")})
+	trashed := srv.AddFile(root, "old.txt", []byte("old\n"))
+	file, _ := srv.File(trashed)
+	file.Trashed = true
+	srv.Add(file)
+	client := newAnonymousClient(t, srv)
+
+	name, err := client.FolderName(context.Background(), root)
+	if err != nil || name != "Public" {
+		t.Errorf("FolderName = %q, %v, want %q", name, err, "Public")
+	}
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"notes & todo.txt":  "hello\n",
+		"Budget.xlsx":       "xlsx budget\n",
+		"Photos/cat.jpg":    "meow\n",
+		"Photos/Report.pdf": "%PDF report\n",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("downloaded %v, want %v", got, want)
+	}
+}
+
+func TestDownloadFolderConfirmsScanWarning(t *testing.T) {
+	warnings := map[string]drivetest.ScanWarning{
+		"form":   drivetest.ScanWarningForm,
+		"link":   drivetest.ScanWarningLink,
+		"cookie": drivetest.ScanWarningCookie,
+	}
+	for name, warning := range warnings {
+		t.Run(name, func(t *testing.T) {
+			srv := drivetest.NewServer()
+			t.Cleanup(srv.Close)
+			root := srv.AddFolder("", "Public")
+			srv.Add(drivetest.File{Name: "large.bin", Parents: []string{root}, Content: []byte("large content\n"), ScanWarning: warning})
+			dir := t.TempDir()
+			if err := newAnonymousClient(t, srv).DownloadFolder(context.Background(), root, dir); err != nil {
+				t.Fatal(err)
+			}
+			got, err := drivetest.ReadTree(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{"large.bin": "large content\n"}; !maps.Equal(got, want) {
+				t.Errorf("downloaded %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDownloadFolderExportFormats(t *testing.T) {
+	srv, root, _ := newTree(t)
+	client := newClient(t, srv)
+	client.SheetFormat = drive.SheetODS
+	client.MaxDepth = 0
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree["Budget.ods"]; got != "ods budget\n" {
+		t.Errorf("Budget.ods = %q, want the ODS export", got)
+	}
+	if _, ok := tree["Photos/cat.jpg"]; ok {
+		t.Error("Photos/cat.jpg downloaded beyond MaxDepth")
+	}
+}
+
+func TestDownloadFolderRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(srv *drivetest.Server, root, sub string) string
+	}{
+		{"folder listing", func(srv *drivetest.Server, root, sub string) string {
+			srv.Fail(sub, http.StatusServiceUnavailable)
+			return sub
+		}},
+		{"rate limited listing", func(srv *drivetest.Server, root, sub string) string {
+			srv.Fail(root, http.StatusTooManyRequests)
+			return root
+		}},
+		{"file download", func(srv *drivetest.Server, root, sub string) string {
+			// The download falls back to the webContentLink of the file.
+			id := srv.AddFile(sub, "dog.jpg", []byte("woof\n"))
+			srv.Fail(id, http.StatusInternalServerError)
+			return id
+		}},
+		{"throttled export", func(srv *drivetest.Server, root, sub string) string {
+			id := srv.AddDocument(sub, "Caption", docMimeType, map[string][]byte{pdfMimeType: []byte("%PDF caption\n")})
+			srv.Fail(id, http.StatusTooManyRequests)
+			return id
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, root, sub := newTree(t)
+			test.fail(srv, root, sub)
+			client := newClient(t, srv)
+			dir := t.TempDir()
+			if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+				t.Fatal(err)
+			}
+			tree, err := drivetest.ReadTree(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tree["Photos/cat.jpg"]; got != "meow\n" {
+				t.Errorf("Photos/cat.jpg = %q, want %q", got, "meow\n")
+			}
+		})
+	}
+}
+
+// listingBlocker holds the listing of one folder until release is closed,
+// closing started once it is requested.
+type listingBlocker struct {
+	base    http.RoundTripper
+	id      string
+	once    *sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (t listingBlocker) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Query().Get("q"), "'"+t.id+"' in parents") {
+		t.once.Do(func() { close(t.started) })
+		<-t.release
+	}
+	return t.base.RoundTrip(req)
+}
+
+func TestDownloadFolderDownloadsDuringWalk(t *testing.T) {
+	srv, root, sub := newTree(t)
+	blocker := listingBlocker{base: srv.HTTPClient().Transport, id: sub, once: new(sync.Once), started: make(chan struct{}), release: make(chan struct{})}
+	client, err := srv.NewClient(context.Background(), drive.WithHTTPClient(&http.Client{Transport: blocker}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	done := make(chan error, 1)
+	go func() { done <- client.DownloadFolder(context.Background(), root, dir) }()
+
+	// The files of the root folder are downloaded while Photos is still
+	// being listed.
+	<-blocker.started
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "notes.txt"))
+		if err == nil && string(data) == "hello\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			close(blocker.release)
+			t.Fatal("notes.txt was not downloaded while a folder was being listed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(blocker.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	drivetest.CompareDir(t, dir, "testdata/download")
+}
+
+func TestDownloadFolderConcurrentWalk(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Share")
+	want := make(map[string]string)
+	for i := range 8 {
+		folder := srv.AddFolder(root, fmt.Sprintf("folder%d", i))
+		nested := srv.AddFolder(folder, "nested")
+		for j := range 5 {
+			name := fmt.Sprintf("file%d.txt", j)
+			srv.AddFile(folder, name, []byte(name+"\n"))
+			srv.AddFile(nested, name, []byte("nested "+name+"\n"))
+			want[path.Join(fmt.Sprintf("folder%d", i), name)] = name + "\n"
+			want[path.Join(fmt.Sprintf("folder%d", i), "nested", name)] = "nested " + name + "\n"
+		}
+	}
+	var mu sync.Mutex
+	var fetched []string
+	client, err := srv.NewClient(context.Background(), drive.WithHTTPClient(&http.Client{Transport: recordingTransport{base: srv.HTTPClient().Transport, mu: &mu, ids: &fetched}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Concurrency = 8
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("downloaded %d files, want %d: %v", len(got), len(want), got)
+	}
+	slices.Sort(fetched)
+	if n := len(fetched); n != len(want) || len(slices.Compact(fetched)) != n {
+		t.Errorf("downloaded content %d times, want each of the %d files once", n, len(want))
+	}
+}
+
+func TestDownloadFolderResumesListing(t *testing.T) {
+	// The root folder spans three pages of two files.
+	requests := func(fail bool) int {
+		srv, root, _ := newTree(t)
+		srv.SetPageSize(2)
+		if fail {
+			srv.FailPage(root, 1, http.StatusServiceUnavailable)
+		}
+		client := newClient(t, srv)
+		dir := t.TempDir()
+		if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+			t.Fatal(err)
+		}
+		drivetest.CompareDir(t, dir, "testdata/download")
+		return srv.Requests()
+	}
+	clean := requests(false)
+	// The failed page is requested again, but not the one before it.
+	if got := requests(true); got != clean+1 {
+		t.Errorf("download with a failed page took %d requests, want %d", got, clean+1)
+	}
+}
+
+func TestDownloadFolderFailures(t *testing.T) {
+	srv, root, sub := newTree(t)
+	id := srv.AddFile(sub, "private.jpg", []byte("secret\n"))
+	srv.Fail(id, http.StatusForbidden)
+	client := newClient(t, srv)
+	err := client.DownloadFolder(context.Background(), root, t.TempDir())
+	var downloadErr *drive.DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("DownloadFolder returned %v, want a DownloadError", err)
+	}
+	if len(downloadErr.Failures) != 1 {
+		t.Fatalf("got %d failures, want 1: %v", len(downloadErr.Failures), downloadErr.Failures)
+	}
+	failure := downloadErr.Failures[0]
+	if failure.Path != "Photos/private.jpg" || failure.Cause() != drive.CausePermission {
+		t.Errorf("failure = %s (%s), want Photos/private.jpg (%s)", failure.Path, failure.Cause(), drive.CausePermission)
+	}
+}
+
+func TestDownloadFolderSkipsUnlistableFolder(t *testing.T) {
+	srv, root, sub := newTree(t)
+	deep := srv.AddFolder(sub, "Deep")
+	srv.AddFile(deep, "dog.jpg", []byte("woof\n"))
+	srv.Fail(sub, http.StatusNotFound)
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	err := client.DownloadFolder(context.Background(), root, dir)
+	var downloadErr *drive.DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("DownloadFolder returned %v, want a DownloadError", err)
+	}
+	if len(downloadErr.Failures) != 1 || downloadErr.Failures[0].Path != "Photos" || !errors.Is(downloadErr.Failures[0].Err, drive.ErrFolderListing) {
+		t.Fatalf("failures = %v, want Photos failing with %v", downloadErr.Failures, drive.ErrFolderListing)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["notes.txt"] != "hello\n" || got["Photos/cat.jpg"] != "" || got["Photos/Deep/dog.jpg"] != "" {
+		t.Errorf("downloaded %v, want the files of the root folder only", got)
+	}
+
+	// The next run lists the folder again.
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = drivetest.ReadTree(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got["Photos/cat.jpg"] != "meow\n" || got["Photos/Deep/dog.jpg"] != "woof\n" {
+		t.Errorf("Photos/cat.jpg = %q, Photos/Deep/dog.jpg = %q after the second run", got["Photos/cat.jpg"], got["Photos/Deep/dog.jpg"])
+	}
+}
+
+func TestWalkReportsUnlistableFolders(t *testing.T) {
+	srv, root, sub := newTree(t)
+	srv.Fail(sub, http.StatusNotFound)
+	var mu sync.Mutex
+	var paths []string
+	err := newClient(t, srv).Walk(context.Background(), root, func(item drive.DriveItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, item.Path)
+		return nil
+	})
+	var walkErr *drive.WalkError
+	if !errors.As(err, &walkErr) || len(walkErr.Folders) != 1 || walkErr.Folders[0].ID != sub {
+		t.Fatalf("Walk = %v, want a WalkError for Photos", err)
+	}
+	if !slices.Contains(paths, "Photos") || slices.Contains(paths, "Photos/cat.jpg") {
+		t.Errorf("walked %v, want Photos without its content", paths)
+	}
+
+	// Failing to list the root folder stops the walk.
+	srv.Fail(root, http.StatusNotFound)
+	err = newClient(t, srv).Walk(context.Background(), root, func(drive.DriveItem) error { return nil })
+	if err == nil || errors.As(err, &walkErr) {
+		t.Errorf("Walk of an unlistable root = %v, want a plain error", err)
+	}
+}
+
+func TestDownloadFolderBreaksCycles(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Share")
+	photos := srv.AddFolder(root, "Photos")
+	srv.AddFile(photos, "cat.jpg", []byte("meow\n"))
+	inner := srv.AddFolder(photos, "Inner")
+	shared := srv.AddFolder(root, "Shared")
+	srv.AddFile(shared, "doc.txt", []byte("doc\n"))
+	// Photos is also found below itself, and Shared below a second parent.
+	file, _ := srv.File(photos)
+	file.Parents = append(file.Parents, inner)
+	srv.Add(file)
+	file, _ = srv.File(shared)
+	file.Parents = append(file.Parents, photos)
+	srv.Add(file)
+
+	client := newClient(t, srv)
+	var logs strings.Builder
+	client.Logger = log.New(&logs, "", 0)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, warning := range []string{"contains itself", "already found at another path"} {
+		if !strings.Contains(logs.String(), warning) {
+			t.Errorf("no warning that a folder %s:\n%s", warning, logs.String())
+		}
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["Photos/cat.jpg"] != "meow\n" || (got["Shared/doc.txt"] != "doc\n" && got["Photos/Shared/doc.txt"] != "doc\n") {
+		t.Errorf("downloaded %v, want Photos/cat.jpg and doc.txt once", got)
+	}
+}
+
+func TestDownloadFolderAfterDownload(t *testing.T) {
+	tests := []struct {
+		name   string
+		action func(processed string) drive.AfterDownload
+		done   func(f drivetest.File, processed string) bool
+	}{
+		{"move", func(processed string) drive.AfterDownload {
+			return drive.AfterDownload{Action: drive.AfterDownloadMove, Target: processed}
+		}, func(f drivetest.File, processed string) bool {
+			return slices.Equal(f.Parents, []string{processed})
+		}},
+		{"trash", func(string) drive.AfterDownload {
+			return drive.AfterDownload{Action: drive.AfterDownloadTrash}
+		}, func(f drivetest.File, _ string) bool {
+			return f.Trashed
+		}},
+		{"label", func(string) drive.AfterDownload {
+			return drive.AfterDownload{Action: drive.AfterDownloadLabel, Target: "processed-label"}
+		}, func(f drivetest.File, _ string) bool {
+			return slices.Equal(f.Labels, []string{"processed-label"})
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := drivetest.NewServer()
+			t.Cleanup(srv.Close)
+			inbox := srv.AddFolder("", "Inbox")
+			processed := srv.AddFolder("", "Processed")
+			done := srv.AddFile(inbox, "invoice.pdf", []byte("%PDF invoice\n"))
+			failed := srv.AddFile(inbox, "broken.pdf", []byte("%PDF broken\n"))
+			srv.Fail(failed, http.StatusForbidden)
+			client := newClient(t, srv)
+			client.AfterDownload = test.action(processed)
+
+			err := client.DownloadFolder(context.Background(), inbox, t.TempDir())
+			var downloadErr *drive.DownloadError
+			if !errors.As(err, &downloadErr) || len(downloadErr.Failures) != 1 {
+				t.Fatalf("DownloadFolder returned %v, want the failure of broken.pdf", err)
+			}
+			if f, _ := srv.File(done); !test.done(f, processed) {
+				t.Errorf("invoice.pdf = %+v after download, want the %s done", f, test.name)
+			}
+			if f, _ := srv.File(failed); test.done(f, processed) {
+				t.Errorf("the %s was done to broken.pdf, which failed", test.name)
+			}
+		})
+	}
+}
+
+func TestDownloadFolderSeed(t *testing.T) {
+	srv, root, _ := newTree(t)
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	seed, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of the files without the manifest is not downloaded again.
+	copied := t.TempDir()
+	if err := os.CopyFS(copied, os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(copied, drive.ManifestName)); err != nil {
+		t.Fatal(err)
+	}
+	client = newClient(t, srv)
+	client.Seed = seed
+	if err := client.DownloadFolder(context.Background(), root, copied); err != nil {
+		t.Fatal(err)
+	}
+	if downloaded := client.Stats.Files(); downloaded != 0 {
+		t.Errorf("seeded download fetched %d files, want 0", downloaded)
+	}
+	drivetest.CompareDir(t, copied, "testdata/download")
+
+	client.Seed.FolderID = "other"
+	if err := client.DownloadFolder(context.Background(), root, t.TempDir()); err == nil {
+		t.Error("download seeded with another folder succeeded")
+	}
+}
+
+func TestDownloadFolderSameRevision(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	doc := drivetest.File{
+		Name:     "Plan",
+		MimeType: docMimeType,
+		Parents:  []string{root},
+		Exports:  map[string][]byte{pdfMimeType: []byte("%PDF v1\n")},
+		Revision: "r1",
+	}
+	doc.ID = srv.Add(doc)
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	download := func() map[string]string {
+		t.Helper()
+		if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+			t.Fatal(err)
+		}
+		tree, err := drivetest.ReadTree(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+	download()
+
+	// Renaming the document modifies it without making a revision: it is
+	// moved rather than exported again.
+	doc.Name = "Plan 2024"
+	doc.ModifiedTime = drivetest.Epoch.Add(time.Hour)
+	doc.Exports = map[string][]byte{pdfMimeType: []byte("%PDF v2\n")}
+	srv.Add(doc)
+	tree := download()
+	if got := tree["Plan 2024.pdf"]; got != "%PDF v1\n" {
+		t.Errorf("Plan 2024.pdf = %q after a rename, want the first export", got)
+	}
+	if _, ok := tree["Plan.pdf"]; ok {
+		t.Error("Plan.pdf was kept after the rename")
+	}
+
+	doc.ModifiedTime = drivetest.Epoch.Add(2 * time.Hour)
+	doc.Revision = "r2"
+	srv.Add(doc)
+	if got := download()["Plan 2024.pdf"]; got != "%PDF v2\n" {
+		t.Errorf("Plan 2024.pdf = %q after a new revision, want it exported again", got)
+	}
+}
+
+func TestDownloadFolderPriorities(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Share")
+	srv.AddFile(root, "clip.mp4", []byte("video\n"))
+	srv.AddFile(root, "notes.txt", []byte("notes\n"))
+	contracts := srv.AddFolder(root, "Contracts")
+	srv.AddFile(contracts, "movie.MP4", []byte("video\n"))
+	srv.AddFile(contracts, "lease.docx", []byte("lease\n"))
+	client := newClient(t, srv)
+	client.Concurrency = 1
+	client.Priorities = []drive.PathPriority{
+		{Pattern: "**/*.docx", Priority: drive.PriorityHigh},
+		{Pattern: "*.mp4", Priority: drive.PriorityLow},
+	}
+	var logs strings.Builder
+	client.Logger = log.New(&logs, "", 0)
+	if err := client.DownloadFolder(context.Background(), root, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "Downloading file: "); ok {
+			order = append(order, name)
+		}
+	}
+	// The walk lists the root first, so notes.txt may start before
+	// lease.docx is found; the videos wait for the end of the walk.
+	if len(order) != 4 || slices.Index(order, "lease.docx") > 1 || !slices.Contains(order[2:], "clip.mp4") || !slices.Contains(order[2:], "movie.MP4") {
+		t.Errorf("downloaded in the order %q, want lease.docx first and the videos last", order)
+	}
+}
+
+func TestDownloadFolderUnusableNames(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	blank := srv.AddFile(root, "  ", []byte("blank\n"))
+	dots := srv.AddFolder(root, "..")
+	srv.AddFile(dots, "inside.txt", []byte("inside\n"))
+	untitled := srv.AddDocument(root, "", docMimeType, map[string][]byte{pdfMimeType: []byte("%PDF untitled\n")})
+	srv.AddFile(root, "a/b", []byte("slash\n"))
+	srv.AddFile(root, `c\d`, []byte("backslash\n"))
+	srv.AddFile(root, "../escape", []byte("escape\n"))
+	up := srv.AddFolder(root, "../../up")
+	srv.AddFile(up, "../escape", []byte("deeper\n"))
+	client := newClient(t, srv)
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "dest", "Backup")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		blank:                "blank\n",
+		dots + "/inside.txt": "inside\n",
+		untitled + ".pdf":    "%PDF untitled\n",
+		"a_b":                "slash\n",
+		"c_d":                "backslash\n",
+		".._escape":          "escape\n",
+		".._.._up/.._escape": "deeper\n",
+	}
+	for name, content := range want {
+		if got, ok := tree[name]; !ok || got != content {
+			t.Errorf("%s = %q, want %q (tree: %v)", name, got, content, tree)
+		}
+	}
+	// Nothing is written outside the destination.
+	outside, err := drivetest.ReadTree(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range outside {
+		if !strings.HasPrefix(name, "dest/Backup/") {
+			t.Errorf("%s was written outside the destination", name)
+		}
+	}
+}
+
+func TestDownloadFolders(t *testing.T) {
+	srv, root, _ := newTree(t)
+	other := srv.AddFolder("", "Backup")
+	srv.AddFile(other, "notes.txt", []byte("other notes\n"))
+	photos := srv.AddFolder(other, "Photos")
+	srv.AddFile(photos, "dog.jpg", []byte("woof\n"))
+	roots := []string{root, other}
+
+	for _, tt := range []struct {
+		merge bool
+		want  map[string]string
+	}{
+		{false, map[string]string{
+			"Backup/notes.txt":          "hello\n",
+			"Backup/Photos/cat.jpg":     "meow\n",
+			"Backup (2)/notes.txt":      "other notes\n",
+			"Backup (2)/Photos/dog.jpg": "woof\n",
+		}},
+		{true, map[string]string{
+			"notes.txt":      "hello\n",
+			"notes (2).txt":  "other notes\n",
+			"Photos/cat.jpg": "meow\n",
+			"Photos/dog.jpg": "woof\n",
+		}},
+	} {
+		client := newClient(t, srv)
+		dir := t.TempDir()
+		if err := client.DownloadFolders(context.Background(), roots, dir, tt.merge); err != nil {
+			t.Fatal(err)
+		}
+		tree, err := drivetest.ReadTree(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range tt.want {
+			if got, ok := tree[name]; !ok || got != content {
+				t.Errorf("merge %v: %s = %q, want %q (tree: %v)", tt.merge, name, got, content, tree)
+			}
+		}
+
+		// Downloading again transfers nothing new.
+		files := client.Stats.Files()
+		if err := client.DownloadFolders(context.Background(), roots, dir, tt.merge); err != nil {
+			t.Fatal(err)
+		}
+		if downloaded := client.Stats.Files() - files; downloaded != 0 {
+			t.Errorf("merge %v: second download fetched %d files, want 0", tt.merge, downloaded)
+		}
+	}
+}
+
+func TestDownloadFolderSheetTooLarge(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	var big [][]string
+	var want strings.Builder
+	for i := 1; i <= 5002; i++ {
+		// An empty row ends the first block of rows read.
+		if i == 5000 {
+			big = append(big, nil)
+			want.WriteString("\n")
+			continue
+		}
+		big = append(big, []string{strconv.Itoa(i), "row, " + strconv.Itoa(i)})
+		fmt.Fprintf(&want, "%d,\"row, %d\"\n", i, i)
+	}
+	srv.Add(drivetest.File{
+		Name:           "Ledger",
+		MimeType:       sheetMimeType,
+		Parents:        []string{root},
+		ExportTooLarge: true,
+		Tabs: []drivetest.Tab{
+			{Title: "Summary", Rows: [][]string{{"total", "5001"}}},
+			{Title: "It's big", Rows: big, ExportTooLarge: true},
+		},
+	})
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"Ledger.xlsx/Summary.csv":  "total,5001\n",
+		"Ledger.xlsx/It's big.csv": want.String(),
+	} {
+		if got := tree[name]; got != content {
+			t.Errorf("%s = %.40q, want %.40q (%d bytes, want %d)", name, got, content, len(got), len(content))
+		}
+	}
+
+	// The folder is kept as long as the spreadsheet is unchanged.
+	files := client.Stats.Files()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if downloaded := client.Stats.Files() - files; downloaded != 0 {
+		t.Errorf("second download fetched %d files, want 0", downloaded)
+	}
+}
+
+func TestDownloadFolderMetadataFilters(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	sub := srv.AddFolder(root, "Sub")
+	srv.Add(drivetest.File{Name: "public.txt", Parents: []string{sub}, Content: []byte("public\n"),
+		Properties: map[string]string{"classification": "public"}, Labels: []string{"lbl1"},
+		LabelFields: map[string]string{"lbl1.level": "low"}})
+	srv.Add(drivetest.File{Name: "secret.txt", Parents: []string{root}, Content: []byte("secret\n"),
+		Properties: map[string]string{"classification": "secret"}, Labels: []string{"lbl1"},
+		LabelFields: map[string]string{"lbl1.level": "high"}})
+	srv.Add(drivetest.File{Name: "app.txt", Parents: []string{root}, Content: []byte("app\n"),
+		AppProperties: map[string]string{"classification": "public"}})
+
+	labels, err := drive.ParseLabelFilters("lbl1.level=low")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name   string
+		filter func(*drive.Client)
+		want   []string
+	}{
+		{"property", func(c *drive.Client) { c.Properties = map[string]string{"classification": "public"} }, []string{"Sub/public.txt"}},
+		{"app property", func(c *drive.Client) { c.AppProperties = map[string]string{"classification": "public"} }, []string{"app.txt"}},
+		{"label", func(c *drive.Client) { c.Labels = []drive.LabelFilter{{ID: "lbl1"}} }, []string{"Sub/public.txt", "secret.txt"}},
+		{"label field", func(c *drive.Client) { c.Labels = labels }, []string{"Sub/public.txt"}},
+	} {
+		client := newClient(t, srv)
+		tt.filter(client)
+		dir := t.TempDir()
+		if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+			t.Fatal(err)
+		}
+		tree, err := drivetest.ReadTree(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for name := range tree {
+			got = append(got, name)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: downloaded %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadFolderFixExtensions(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	srv.Add(drivetest.File{Name: "scan", MimeType: "image/jpeg", Parents: []string{root}, Content: []byte("jpeg\n")})
+	srv.Add(drivetest.File{Name: "photo.png", MimeType: "image/jpeg", Parents: []string{root}, Content: []byte("jpeg\n")})
+	srv.Add(drivetest.File{Name: "photo.JPEG", MimeType: "image/jpeg", Parents: []string{root}, Content: []byte("jpeg\n")})
+	srv.Add(drivetest.File{Name: "server.log", MimeType: "text/plain", Parents: []string{root}, Content: []byte("log\n")})
+	srv.Add(drivetest.File{Name: "README", MimeType: "text/plain", Parents: []string{root}, Content: []byte("read me\n")})
+	srv.AddFile(root, "blob", []byte("%PDF-1.7\n"))
+	srv.AddFile(root, "data", []byte{0, 1, 2})
+	client := newClient(t, srv)
+	client.FixExtensions = true
+	client.SniffExtensions = true
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(got, drive.ManifestName)
+	want := []string{"README.txt", "blob.pdf", "data", "photo.JPEG", "photo.png.jpg", "scan.jpg", "server.log"}
+	if names := slices.Sorted(maps.Keys(got)); !slices.Equal(names, want) {
+		t.Errorf("downloaded %v, want %v", names, want)
+	}
+
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appended := map[string]string{"README.txt": ".txt", "blob.pdf": ".pdf", "photo.png.jpg": ".jpg", "scan.jpg": ".jpg"}
+	for _, entry := range m.Files {
+		if entry.Extension != appended[entry.Path] {
+			t.Errorf("%s is recorded with extension %q, want %q", entry.Path, entry.Extension, appended[entry.Path])
+		}
+	}
+
+	// Downloading again keeps the names.
+	files := client.Stats.Files()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if n := client.Stats.Files() - files; n != 0 {
+		t.Errorf("second download fetched %d files, want 0", n)
+	}
+}
+
+func TestDownloadFolderCompressed(t *testing.T) {
+	srv, root, _ := newTree(t)
+	client := newClient(t, srv)
+	client.Compression = drive.CompressionGzip
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "Photos", "cat.jpg.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(r); err != nil || string(data) != "meow\n" {
+		t.Errorf("cat.jpg.gz holds %q, %v, want %q", data, err, "meow\n")
+	}
+
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range m.Files {
+		if entry.Compression != "gzip" || entry.StoredPath != entry.Path+".gz" {
+			t.Errorf("%s is stored at %q with compression %q, want %q with gzip", entry.Path, entry.StoredPath, entry.Compression, entry.Path+".gz")
+		}
+		if err := entry.Verify(dir); err != nil {
+			t.Errorf("%s: %v", entry.Path, err)
+		}
+	}
+}
+
+func TestDownloadFolderCAS(t *testing.T) {
+	srv, root, _ := newTree(t)
+	srv.AddFile(root, "cat copy.jpg", []byte("meow\n"))
+	client := newClient(t, srv)
+	client.Layout = drive.LayoutCAS
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := drive.LoadObjectTree(filepath.Join(dir, drive.TreeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Files["cat copy.jpg"] == "" || tree.Files["cat copy.jpg"] != tree.Files["Photos/cat.jpg"] {
+		t.Errorf("cat copy.jpg is stored as object %q, Photos/cat.jpg as %q, want the same object", tree.Files["cat copy.jpg"], tree.Files["Photos/cat.jpg"])
+	}
+	data, err := os.ReadFile(filepath.Join(dir, drive.ObjectsDir, tree.Files["notes.txt"]))
+	if err != nil || string(data) != "hello\n" {
+		t.Errorf("object of notes.txt holds %q, %v, want %q", data, err, "hello\n")
+	}
+	objects, err := os.ReadDir(filepath.Join(dir, drive.ObjectsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != len(tree.Files)-1 {
+		t.Errorf("%d objects stored for %d files, want %d", len(objects), len(tree.Files), len(tree.Files)-1)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err == nil {
+		t.Error("notes.txt was stored at its path")
+	}
+
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range m.Files {
+		if entry.Object != tree.Files[entry.Path] {
+			t.Errorf("%s is recorded with object %q, want %q", entry.Path, entry.Object, tree.Files[entry.Path])
+		}
+		if err := entry.Verify(dir); err != nil {
+			t.Errorf("%s: %v", entry.Path, err)
+		}
+	}
+
+	// Downloading again transfers nothing new and keeps a snapshot per run.
+	files := client.Stats.Files()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if n := client.Stats.Files() - files; n != 0 {
+		t.Errorf("second download fetched %d files, want 0", n)
+	}
+	again, err := drive.LoadObjectTree(filepath.Join(dir, drive.TreeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(again.Files, tree.Files) {
+		t.Errorf("second download has tree %v, want %v", again.Files, tree.Files)
+	}
+	if snapshots, err := os.ReadDir(filepath.Join(dir, drive.TreesDir)); err != nil || len(snapshots) != 2 {
+		t.Errorf("found %d snapshots, %v, want 2", len(snapshots), err)
+	}
+}
+
+func TestLocalTreeMatchesFreshDownload(t *testing.T) {
+	for _, layout := range []drive.Layout{drive.LayoutTree, drive.LayoutCAS} {
+		srv, root, _ := newTree(t)
+		srv.Add(drivetest.File{Parents: []string{root}, Name: "notes.xmp", Content: []byte("not a sidecar\n")})
+		client := newClient(t, srv)
+		client.Layout = layout
+		client.Sidecars = true
+		client.LinkStubs = drive.LinkStubsAlongside
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, drive.IgnoreName), []byte("*.tmp\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+			t.Fatal(err)
+		}
+		if layout == drive.LayoutTree {
+			if _, err := os.Stat(filepath.Join(dir, "Photos", "cat.jpg"+drive.SidecarExtension)); err != nil {
+				t.Fatalf("no sidecar written: %v", err)
+			}
+		}
+
+		remote, err := client.RemoteTree(context.Background(), root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		local, err := drive.LocalTree(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := drive.DiffTrees(remote, local); !diff.Empty() {
+			t.Errorf("layout %d: the fresh download differs from the folder: only remote %v, only local %v, differ %v", layout, diff.OnlyInA, diff.OnlyInB, diff.Differ)
+		}
+	}
+}
+
+func TestDownloadBundle(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.Add(drivetest.File{ID: "root", Name: "My Drive", MimeType: drivetest.FolderMimeType})
+	srv.AddFile("root", "todo.txt", []byte("mine\n"))
+	srv.Add(drivetest.File{Name: "starred.txt", Parents: []string{"root"}, Content: []byte("star\n"), Starred: true})
+	shared := srv.Add(drivetest.File{Name: "Team", MimeType: drivetest.FolderMimeType, SharedWithMe: true})
+	srv.AddFile(shared, "plan.txt", []byte("plan\n"))
+	srv.Add(drivetest.File{Name: "memo.txt", Content: []byte("memo\n"), SharedWithMe: true})
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadBundle(context.Background(), dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"My Drive/todo.txt":            "mine\n",
+		"My Drive/starred.txt":         "star\n",
+		"Shared with me/Team/plan.txt": "plan\n",
+		"Shared with me/memo.txt":      "memo\n",
+		"Starred/starred.txt":          "star\n",
+	} {
+		if got[p] != want {
+			t.Errorf("%s holds %q, want %q", p, got[p], want)
+		}
+	}
+	for _, link := range []string{`href="My%20Drive/todo.txt"`, `href="Shared%20with%20me/Team/plan.txt"`, `href="Starred/starred.txt"`} {
+		if !strings.Contains(got[drive.BundleIndexName], link) {
+			t.Errorf("index has no link %s", link)
+		}
+	}
+}
+
+func TestDownloadArchiveOrder(t *testing.T) {
+	srv, root, sub := newTree(t)
+	for i := range 20 {
+		srv.AddFile(root, fmt.Sprintf("file%d.txt", i), []byte("text\n"))
+		srv.AddFile(sub, fmt.Sprintf("photo%d.jpg", i), []byte("photo\n"))
+	}
+	client := newClient(t, srv)
+	client.Concurrency = 8
+	archivePath := filepath.Join(t.TempDir(), "backup.tar")
+	if err := client.DownloadArchive(context.Background(), root, archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	folders := map[string]bool{".": true} // folders written so far
+	finished := make(map[string]bool)     // folders whose files were all written
+	current := ""
+	r := tar.NewReader(f)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimSuffix(header.Name, "/")
+		dir := path.Dir(name)
+		if !folders[dir] {
+			t.Errorf("%s written before its folder", header.Name)
+		}
+		if header.Typeflag == tar.TypeDir {
+			folders[name] = true
+			continue
+		}
+		if dir != current {
+			if finished[dir] {
+				t.Errorf("files of %s are not contiguous: %s", dir, header.Name)
+			}
+			finished[current] = true
+			current = dir
+		}
+	}
+}
+
+func TestEstimatePlan(t *testing.T) {
+	srv, root, _ := newTree(t)
+	client := newClient(t, srv)
+	plan, err := client.PlanFolder(context.Background(), root, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimate, err := client.EstimatePlan(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.Files != 5 || estimate.Exports != 2 || estimate.Bytes != 38 {
+		t.Errorf("estimate = %d files, %d exports, %d bytes, want 5, 2, 38", estimate.Files, estimate.Exports, estimate.Bytes)
+	}
+	if estimate.APICalls != 9 {
+		t.Errorf("estimate.APICalls = %d, want 9", estimate.APICalls)
+	}
+	if estimate.Throughput <= 0 || estimate.Duration <= 0 {
+		t.Errorf("estimate = %v bytes/s for %v, want a measured throughput", estimate.Throughput, estimate.Duration)
+	}
+}
+
+func TestDownloadFolderSheetValuesOnly(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"[Content_Types].xml":        `<Types><Override PartName="/xl/calcChain.xml" ContentType="calcChain"/></Types>`,
+		"xl/calcChain.xml":           `<calcChain><c r="A2" i="1"/></calcChain>`,
+		"xl/worksheets/sheet1.xml":   `<sheetData><row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2"><f>A1*2</f><v>2</v></c></row></sheetData>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId9" Target="calcChain.xml"/></Relationships>`,
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	srv.AddDocument(root, "Ledger", sheetMimeType, map[string][]byte{xlsxMimeType: buf.Bytes()})
+	client := newClient(t, srv)
+	client.SheetValuesOnly = true
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := zip.OpenReader(filepath.Join(dir, "Ledger.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exported.Close()
+	got := make(map[string]string)
+	for _, f := range exported.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		got[f.Name] = string(data)
+	}
+	if _, ok := got["xl/calcChain.xml"]; ok {
+		t.Error("the calculation chain was kept")
+	}
+	if want := `<c r="A2"><v>2</v></c>`; !strings.Contains(got["xl/worksheets/sheet1.xml"], want) {
+		t.Errorf("sheet1.xml = %s, want the cell %s", got["xl/worksheets/sheet1.xml"], want)
+	}
+	for _, name := range []string{"[Content_Types].xml", "xl/_rels/workbook.xml.rels"} {
+		if strings.Contains(got[name], "calcChain") {
+			t.Errorf("%s = %s, still referencing the calculation chain", name, got[name])
+		}
+	}
+}
+
+func TestDownloadFolderSHA256(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	hashed := srv.Add(drivetest.File{Name: "hashed.bin", Parents: []string{root}, Content: []byte("sha256\n"), SHA256: true})
+	plain := srv.AddFile(root, "plain.bin", []byte("md5\n"))
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{hashed: drive.ChecksumSHA256, plain: drive.ChecksumMD5} {
+		entry, ok := m.Lookup(id)
+		if !ok {
+			t.Fatalf("%s is not in the manifest", id)
+		}
+		if entry.Checksum != want || (entry.SHA256 != "") != (want == drive.ChecksumSHA256) {
+			t.Errorf("%s is recorded with checksum %q and sha256 %q, want %q", entry.Path, entry.Checksum, entry.SHA256, want)
+		}
+		if err := entry.Verify(dir); err != nil {
+			t.Errorf("Verify(%s) = %v", entry.Path, err)
+		}
+	}
+
+	// A file whose content does not match the SHA-256 checksum fails, even
+	// though its MD5 checksum matches.
+	srv.Add(drivetest.File{Name: "corrupt.bin", Parents: []string{root}, Content: []byte("corrupt\n"), WrongSHA256: true})
+	if err := client.DownloadFolder(context.Background(), root, dir); err == nil {
+		t.Error("DownloadFolder accepted a file with a wrong SHA-256 checksum")
+	}
+}
+
+func TestDownloadFolderSparse(t *testing.T) {
+	srv, root, sub := newTree(t)
+	archive := srv.AddFolder(sub, "Archive")
+	srv.AddFile(archive, "old.jpg", []byte("old\n"))
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	spec := "# Shared with the whole team\nnotes.txt\nPhotos/\n!Photos/Archive\n"
+	if err := os.WriteFile(filepath.Join(dir, drive.SparseName), []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Photos/cat.jpg", "notes.txt"}
+	if names := slices.Sorted(maps.Keys(got)); !slices.Equal(names, want) {
+		t.Errorf("downloaded %v, want %v", names, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Photos", "Archive")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the excluded folder Photos/Archive was created: %v", err)
+	}
+
+	// A specification set on the client replaces the file.
+	client.Sparse, err = drive.ParseSparse(strings.NewReader("**/*.jpg\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = drivetest.ReadTree(dir); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"Photos/Archive/old.jpg", "Photos/cat.jpg"}
+	if names := slices.Sorted(maps.Keys(got)); !slices.Equal(names, want) {
+		t.Errorf("downloaded %v, want %v", names, want)
+	}
+}
+
+func TestDownloadFolderDriveignore(t *testing.T) {
+	srv, root, _ := newTree(t)
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	ignore := "# Kept locally\n*.txt\n!notes.txt\nPhotos/\n"
+	if err := os.WriteFile(filepath.Join(dir, drive.IgnoreName), []byte(ignore), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(got, drive.IgnoreName)
+	want := []string{"Budget.xlsx", "Report (gdoc).pdf", "Report.pdf", "notes.txt"}
+	if names := slices.Sorted(maps.Keys(got)); !slices.Equal(names, want) {
+		t.Errorf("downloaded %v, want %v", names, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Photos")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the ignored folder Photos was created: %v", err)
+	}
+}
+
+func TestDownloadFolderCaseClashes(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Share")
+	srv.AddFile(root, "Report.PDF", []byte("upper\n"))
+	srv.AddFile(root, "report.pdf", []byte("lower\n"))
+	srv.AddFile(root, "notes.txt", []byte("notes\n"))
+	srv.AddFile(root, "notes.txt", []byte("copy\n"))
+	client := newClient(t, srv)
+	client.CaseInsensitive = true
+	var logs strings.Builder
+	client.Logger = log.New(&logs, "", 0)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Report.PDF", "notes (2).txt", "notes.txt", "report (2).pdf"}
+	if names := slices.Sorted(maps.Keys(got)); !slices.Equal(names, want) {
+		t.Errorf("downloaded %v, want %v", names, want)
+	}
+
+	// Only the names differing in case are reported.
+	_, report, ok := strings.Cut(logs.String(), "Names differing only in case from another in the same folder (1):\n")
+	if !ok || !strings.HasPrefix(report, `  report (2).pdf ("report.pdf" on Drive, next to "Report.PDF")`) {
+		t.Errorf("logs do not report the collision:\n%s", logs.String())
+	}
+}
+
+func TestDownloadSharedBy(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.Add(drivetest.File{Name: "essay.txt", Content: []byte("essay\n"), SharedWithMe: true, SharingUser: "alice@example.com"})
+	project := srv.Add(drivetest.File{Name: "Project", MimeType: drivetest.FolderMimeType, SharedWithMe: true, SharingUser: "Alice@example.com"})
+	srv.AddFile(project, "code.go", []byte("package main\n"))
+	srv.Add(drivetest.File{Name: "essay.txt", Content: []byte("bob\n"), SharedWithMe: true, SharingUser: "bob@example.com"})
+	srv.Add(drivetest.File{Name: "spam.txt", Content: []byte("spam\n"), SharedWithMe: true, SharingUser: "carol@example.com"})
+	srv.Add(drivetest.File{Name: "anonymous.txt", Content: []byte("who\n"), SharedWithMe: true})
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadSharedBy(context.Background(), []string{"alice@example.com", "BOB@example.com"}, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"alice@example.com/essay.txt":       "essay\n",
+		"alice@example.com/Project/code.go": "package main\n",
+		"bob@example.com/essay.txt":         "bob\n",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("downloaded %v, want %v", got, want)
+	}
+	m, err := drive.LoadManifest(filepath.Join(dir, "bob@example.com", drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.FolderID != drive.SharedByID("bob@example.com") {
+		t.Errorf("manifest records folder %q, want %q", m.FolderID, drive.SharedByID("bob@example.com"))
+	}
+}
+
+func TestDownloadFolderJournalWalksAgain(t *testing.T) {
+	srv, root, _ := newTree(t)
+	broken := srv.AddFile(root, "broken.txt", []byte("broken\n"))
+	srv.Fail(broken, http.StatusNotFound)
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err == nil {
+		t.Fatal("DownloadFolder succeeded despite a failing file")
+	}
+	if _, err := os.Stat(filepath.Join(dir, drive.QueueName)); err != nil {
+		t.Fatalf("the journal of the failed download was not kept: %v", err)
+	}
+
+	// The next run lists the folder again, finding the file added since,
+	// while the file that failed is retried.
+	srv.AddFile(root, "added.txt", []byte("added\n"))
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["added.txt"] != "added\n" || got["broken.txt"] != "broken\n" {
+		t.Errorf("added.txt = %q, broken.txt = %q after the second run", got["added.txt"], got["broken.txt"])
+	}
+}
+
+func TestDownloadFolderJournalForgetsDeletedFile(t *testing.T) {
+	srv, root, _ := newTree(t)
+	broken := srv.AddFile(root, "broken.txt", []byte("broken\n"))
+	srv.Fail(broken, http.StatusNotFound)
+	gone := srv.AddFile(root, "gone.txt", []byte("gone\n"))
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err == nil {
+		t.Fatal("DownloadFolder succeeded despite a failing file")
+	}
+
+	// gone.txt, completed by the interrupted run, is deleted before the
+	// next one, which must not record it again from the journal.
+	file, _ := srv.File(gone)
+	file.Trashed = true
+	srv.Add(file)
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := m.Lookup(gone); ok {
+		t.Errorf("the manifest records the deleted file as %s", entry.Path)
+	}
+	if _, ok := m.Lookup(broken); !ok {
+		t.Error("the manifest lacks the file retried by the second run")
+	}
+}
+
+func TestDownloadFolderCancelledMidDownload(t *testing.T) {
+	srv, root, _ := newTree(t)
+	slowID := srv.AddFile(root, "slow.bin", []byte("slow\n"))
+	slow := blockingTransport{base: srv.HTTPClient().Transport, id: slowID, once: new(sync.Once), started: make(chan struct{}), release: make(chan struct{})}
+	client, err := srv.NewClient(context.Background(), drive.WithHTTPClient(&http.Client{Transport: slow}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.DownloadFolder(ctx, root, dir) }()
+	<-slow.started
+	cancel()
+	close(slow.release)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("DownloadFolder = %v after being cancelled, want %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(filepath.Join(dir, drive.QueueName)); err != nil {
+		t.Fatalf("the journal of the cancelled download was not kept: %v", err)
+	}
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := m.Lookup(slowID); ok {
+		t.Errorf("the file in flight when cancelled is recorded as %s", entry.Path)
+	}
+
+	// The next run completes the download.
+	if err := newClient(t, srv).DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["slow.bin"] != "slow\n" || got["notes.txt"] != "hello\n" {
+		t.Errorf("slow.bin = %q, notes.txt = %q after the second run", got["slow.bin"], got["notes.txt"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, drive.QueueName)); err == nil {
+		t.Error("the journal was kept after the download completed")
+	}
+}
+
+func TestDownloadFolderFailedVerify(t *testing.T) {
+	srv, root, _ := newTree(t)
+	corrupt := srv.Add(drivetest.File{Name: "corrupt.bin", Parents: []string{root}, Content: []byte("corrupt\n"), WrongMD5: true})
+	client := newClient(t, srv)
+	client.VerifyConcurrency = 2
+	dir := t.TempDir()
+	err := client.DownloadFolder(context.Background(), root, dir)
+	var downloadErr *drive.DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("DownloadFolder = %v, want a DownloadError", err)
+	}
+	if len(downloadErr.Failures) != 1 || downloadErr.Failures[0].ID != corrupt || !strings.Contains(downloadErr.Failures[0].Err.Error(), "checksum mismatch") {
+		t.Errorf("failures = %v, want a checksum mismatch of corrupt.bin", downloadErr.Failures)
+	}
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := m.Lookup(corrupt); ok {
+		t.Errorf("the file that failed verification is recorded as %s", entry.Path)
+	}
+	for _, entry := range m.Files {
+		if err := entry.Verify(dir); err != nil {
+			t.Errorf("Verify(%s) = %v", entry.Path, err)
+		}
+	}
+
+	// The file is downloaded again by the next run.
+	file, _ := srv.File(corrupt)
+	file.WrongMD5 = false
+	srv.Add(file)
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = drive.LoadManifest(filepath.Join(dir, drive.ManifestName)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Lookup(corrupt); !ok {
+		t.Error("the manifest lacks the file downloaded again")
+	}
+}
+
+// recordingTransport records the IDs of the files whose content is
+// downloaded.
+type recordingTransport struct {
+	base http.RoundTripper
+	mu   *sync.Mutex
+	ids  *[]string
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("alt") == "media" {
+		t.mu.Lock()
+		*t.ids = append(*t.ids, path.Base(req.URL.Path))
+		t.mu.Unlock()
+	}
+	return t.base.RoundTrip(req)
+}
+
+func TestDownloadFolderResumesTornJournal(t *testing.T) {
+	srv, root, _ := newTree(t)
+	notes := srv.AddFile(root, "more notes.txt", []byte("more\n"))
+	broken := srv.AddFile(root, "broken.txt", []byte("broken\n"))
+	srv.Fail(broken, http.StatusNotFound)
+	dir := t.TempDir()
+	if err := newClient(t, srv).DownloadFolder(context.Background(), root, dir); err == nil {
+		t.Fatal("DownloadFolder succeeded despite a failing file")
+	}
+
+	// A crash tears the record being written.
+	journal, err := os.OpenFile(filepath.Join(dir, drive.QueueName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.WriteString(`{"op":"done","entry":{"id":"` + broken)
+	journal.Close()
+
+	var mu sync.Mutex
+	var fetched []string
+	client, err := srv.NewClient(context.Background(), drive.WithHTTPClient(&http.Client{Transport: recordingTransport{base: srv.HTTPClient().Transport, mu: &mu, ids: &fetched}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(fetched, broken) || slices.Contains(fetched, notes) {
+		t.Errorf("the second run downloaded %v, want %s but not %s, completed by the first run", fetched, broken, notes)
+	}
+	m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{notes, broken} {
+		if _, ok := m.Lookup(id); !ok {
+			t.Errorf("the manifest lacks %s", id)
+		}
+	}
+}
+
+func TestDownloadFolderMovesRenamedFile(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Share")
+	sub := srv.AddFolder(root, "Archive")
+	id := srv.AddFile(root, "notes.txt", []byte("hello\n"))
+	client := newClient(t, srv)
+	var logs strings.Builder
+	client.Logger = log.New(&logs, "", 0)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving and renaming a file updates its modification time on Drive.
+	file, _ := srv.File(id)
+	file.Name, file.Parents = "renamed.txt", []string{sub}
+	file.ModifiedTime = drivetest.Epoch.Add(time.Hour)
+	srv.Add(file)
+	logs.Reset()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "Moving file: notes.txt -> Archive/renamed.txt") {
+		t.Errorf("the renamed file was not moved:\n%s", logs.String())
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Archive/renamed.txt": "hello\n"}; !maps.Equal(got, want) {
+		t.Errorf("downloaded %v after the move, want %v", got, want)
+	}
+}
+
+func TestDownloadFolderMovesRenamedCompressedFile(t *testing.T) {
+	for _, planned := range []bool{false, true} {
+		srv := drivetest.NewServer()
+		t.Cleanup(srv.Close)
+		root := srv.AddFolder("", "Share")
+		sub := srv.AddFolder(root, "Archive")
+		id := srv.AddFile(root, "notes.txt", []byte("hello\n"))
+		var mu sync.Mutex
+		var fetched []string
+		client, err := srv.NewClient(context.Background(), drive.WithHTTPClient(&http.Client{Transport: recordingTransport{base: srv.HTTPClient().Transport, mu: &mu, ids: &fetched}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Compression = drive.CompressionGzip
+		dir := t.TempDir()
+		if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+			t.Fatal(err)
+		}
+
+		file, _ := srv.File(id)
+		file.Name, file.Parents = "renamed.txt", []string{sub}
+		file.ModifiedTime = drivetest.Epoch.Add(time.Hour)
+		srv.Add(file)
+		fetched = nil
+		if planned {
+			plan, err := client.PlanFolder(context.Background(), root, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.ApplyPlan(context.Background(), plan); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+			t.Fatal(err)
+		}
+		if len(fetched) > 0 {
+			t.Errorf("planned=%v: the moved file was downloaded again", planned)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "notes.txt.gz")); err == nil {
+			t.Errorf("planned=%v: the old compressed copy was left behind", planned)
+		}
+		m, err := drive.LoadManifest(filepath.Join(dir, drive.ManifestName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, ok := m.Lookup(id)
+		if !ok || entry.Path != "Archive/renamed.txt" || entry.StoredPath != "Archive/renamed.txt.gz" || entry.Compression != "gzip" {
+			t.Fatalf("planned=%v: the manifest records %+v, want the compressed copy at Archive/renamed.txt.gz", planned, entry)
+		}
+		if err := entry.Verify(dir); err != nil {
+			t.Errorf("planned=%v: Verify(%s) = %v", planned, entry.Path, err)
+		}
+	}
+}
+
+func TestApplyPlanCarriesOutActions(t *testing.T) {
+	srv := drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Share")
+	sub := srv.AddFolder(root, "Archive")
+	notes := srv.AddFile(root, "notes.txt", []byte("notes\n"))
+	srv.AddFile(root, "todo.txt", []byte("todo\n"))
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	if err := client.DownloadFolder(context.Background(), root, dir); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := srv.File(notes)
+	file.Parents = []string{sub}
+	file.ModifiedTime = drivetest.Epoch.Add(time.Hour)
+	srv.Add(file)
+
+	plan, err := client.PlanFolder(context.Background(), root, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make(map[string]string)
+	for _, a := range plan.Actions {
+		actions[a.Path] = a.Action
+	}
+	want := map[string]string{"Archive": drive.ActionMkdir, "Archive/notes.txt": drive.ActionMove, "todo.txt": drive.ActionSkip}
+	if !maps.Equal(actions, want) {
+		t.Fatalf("planned %v, want %v", actions, want)
+	}
+
+	// The plan is carried out as reviewed: the file it keeps is not
+	// downloaded again, although its local copy was removed meanwhile.
+	if err := os.Remove(filepath.Join(dir, "todo.txt")); err != nil {
+		t.Fatal(err)
+	}
+	requests := srv.Requests()
+	if err := client.ApplyPlan(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests() - requests; n != 0 {
+		t.Errorf("applying a plan without downloads made %d requests", n)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Archive/notes.txt": "notes\n"}; !maps.Equal(got, want) {
+		t.Errorf("applied the plan into %v, want %v", got, want)
+	}
+}
+
+func TestApplyPlanDownloadsReviewedFiles(t *testing.T) {
+	srv, root, _ := newTree(t)
+	changed := srv.AddFile(root, "changed.txt", []byte("reviewed\n"))
+	client := newClient(t, srv)
+	dir := t.TempDir()
+	plan, err := client.PlanFolder(context.Background(), root, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len("hello\nfirst\nsecond\n%PDF uploaded\nmeow\nreviewed\n"))
+	if n, bytes := plan.Count(drive.ActionDownload); n != 6 || bytes != size {
+		t.Errorf("plan downloads %d files of %d bytes, want 6 files of %d bytes", n, bytes, size)
+	}
+	if n, bytes := plan.Count(drive.ActionExport); n != 2 || bytes != 0 {
+		t.Errorf("plan exports %d files of %d bytes, want 2 files of unknown size", n, bytes)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err == nil {
+		t.Error("planning downloaded files")
+	}
+
+	// A file added since the plan is not downloaded, and a file changed
+	// since fails its verification against the reviewed checksum.
+	srv.AddFile(root, "added.txt", []byte("added\n"))
+	file, _ := srv.File(changed)
+	file.Content = []byte("changed\n")
+	srv.Add(file)
+	err = client.ApplyPlan(context.Background(), plan)
+	var downloadErr *drive.DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("ApplyPlan returned %v, want a DownloadError", err)
+	}
+	if len(downloadErr.Failures) != 1 || downloadErr.Failures[0].ID != changed {
+		t.Errorf("failures = %v, want changed.txt", downloadErr.Failures)
+	}
+	got, err := drivetest.ReadTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["added.txt"]; ok {
+		t.Error("ApplyPlan downloaded a file added since the plan")
+	}
+	if got["notes.txt"] != "hello\n" || got["Photos/cat.jpg"] != "meow\n" {
+		t.Errorf("notes.txt = %q, Photos/cat.jpg = %q after applying the plan", got["notes.txt"], got["Photos/cat.jpg"])
+	}
+}
+
+// newSharedJob starts a server holding a folder of n files, publishes them
+// to a shared job in a temporary directory and returns the server, the job
+// directory and the download directory.
+func newSharedJob(t *testing.T, n int) (srv *drivetest.Server, jobDir, dest string) {
+	t.Helper()
+	srv = drivetest.NewServer()
+	t.Cleanup(srv.Close)
+	root := srv.AddFolder("", "Backup")
+	for i := range n {
+		srv.AddFile(root, fmt.Sprintf("file%02d.txt", i), []byte(fmt.Sprintf("content %d\n", i)))
+	}
+	jobDir, dest = t.TempDir(), t.TempDir()
+	job, err := drive.OpenSharedJob(jobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newClient(t, srv).PublishFolder(context.Background(), job, root, dest); err != nil {
+		t.Fatal(err)
+	}
+	return srv, jobDir, dest
+}
+
+// workSharedJob runs WorkSharedJob with client on its own handle of the job
+// directory, as a separate process would, and sends its result on the
+// returned channel.
+func workSharedJob(t *testing.T, client *drive.Client, jobDir, dest string) <-chan error {
+	t.Helper()
+	job, err := drive.OpenSharedJob(jobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- client.WorkSharedJob(context.Background(), job, dest) }()
+	return done
+}
+
+func TestSharedJobWorkers(t *testing.T) {
+	defer drive.SetSharedTimings(10*time.Millisecond, time.Minute, 10*time.Millisecond)()
+	srv, jobDir, dest := newSharedJob(t, 40)
+	// Both workers race to claim every item; each must be downloaded once.
+	first, second := newClient(t, srv), newClient(t, srv)
+	first.Concurrency, second.Concurrency = 4, 4
+	firstDone, secondDone := workSharedJob(t, first, jobDir, dest), workSharedJob(t, second, jobDir, dest)
+	for _, done := range []<-chan error{firstDone, secondDone} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := first.Stats.Files() + second.Stats.Files(); got != 40 {
+		t.Errorf("workers downloaded %d files, want each of the 40 once", got)
+	}
+
+	job, err := drive.OpenSharedJob(jobDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newClient(t, srv).WaitSharedJob(context.Background(), job, dest); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := drive.LoadManifest(filepath.Join(dest, drive.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 40 {
+		t.Errorf("manifest lists %d files, want 40", len(manifest.Files))
+	}
+	for i := range 40 {
+		data, err := os.ReadFile(filepath.Join(dest, fmt.Sprintf("file%02d.txt", i)))
+		if want := fmt.Sprintf("content %d\n", i); err != nil || string(data) != want {
+			t.Errorf("file%02d.txt = %q, %v, want %q", i, data, err, want)
+		}
+	}
+}
+
+func TestSharedJobReclaimsStaleClaim(t *testing.T) {
+	defer drive.SetSharedTimings(10*time.Millisecond, 300*time.Millisecond, 10*time.Millisecond)()
+	srv, jobDir, dest := newSharedJob(t, 2)
+
+	// A worker that crashed after claiming an item leaves a claim that
+	// never beats. Its old modification time, as a worker with a clock
+	// behind would leave, must not get it reclaimed early.
+	pending, err := os.ReadDir(filepath.Join(jobDir, "pending"))
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("pending items = %v, %v, want 2", pending, err)
+	}
+	claimed := filepath.Join(jobDir, "claimed", pending[0].Name())
+	if err := os.Rename(filepath.Join(jobDir, "pending", pending[0].Name()), claimed); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(claimed, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newClient(t, srv)
+	start := time.Now()
+	if err := <-workSharedJob(t, client, jobDir, dest); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("the stale claim was reclaimed after %v, before the claim timeout", elapsed)
+	}
+	if got := client.Stats.Files(); got != 2 {
+		t.Errorf("worker downloaded %d files, want 2 with the reclaimed one", got)
+	}
+	if left, _ := os.ReadDir(filepath.Join(jobDir, "claimed")); len(left) != 0 {
+		t.Errorf("claims left behind: %v", left)
+	}
+}
+
+// blockingTransport holds the download of the content of one file until
+// release is closed, closing started once it is requested.
+type blockingTransport struct {
+	base    http.RoundTripper
+	id      string
+	once    *sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (t blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "/"+t.id) && req.URL.Query().Get("alt") == "media" {
+		t.once.Do(func() { close(t.started) })
+		<-t.release
+	}
+	return t.base.RoundTrip(req)
+}
+
+func TestSharedJobKeepsLiveClaim(t *testing.T) {
+	defer drive.SetSharedTimings(10*time.Millisecond, 100*time.Millisecond, 10*time.Millisecond)()
+	srv, jobDir, dest := newSharedJob(t, 1)
+	pending, err := os.ReadDir(filepath.Join(jobDir, "pending"))
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending items = %v, %v, want 1", pending, err)
+	}
+	id := strings.TrimSuffix(pending[0].Name(), ".json")
+
+	// The first worker claims the file and keeps downloading it for many
+	// claim timeouts, beating all along.
+	slow := blockingTransport{base: srv.HTTPClient().Transport, id: id, once: new(sync.Once), started: make(chan struct{}), release: make(chan struct{})}
+	first, err := srv.NewClient(context.Background(), drive.WithHTTPClient(&http.Client{Transport: slow}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstDone := workSharedJob(t, first, jobDir, dest)
+	<-slow.started
+	// Even with the modification time of the claim far behind, as the clock
+	// of the first worker's machine could leave it, the second worker must
+	// leave the claim alone while it beats.
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(jobDir, "claimed", pending[0].Name()), old, old)
+	second := newClient(t, srv)
+	secondDone := workSharedJob(t, second, jobDir, dest)
+	time.Sleep(time.Second)
+	close(slow.release)
+
+	for _, done := range []<-chan error{firstDone, secondDone} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.Stats.Files() != 1 || second.Stats.Files() != 0 {
+		t.Errorf("workers downloaded %d and %d files, want only the first to download the file", first.Stats.Files(), second.Stats.Files())
+	}
+}
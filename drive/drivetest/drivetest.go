@@ -0,0 +1,885 @@
+// Package drivetest provides a fake Google Drive API server and a golden
+// directory harness for testing code built on package drive without
+// reaching the real Drive.
+//
+// A Server holds a tree of folders, files and Google-native documents, and
+// answers the requests a drive.Client sends to list, download and export
+// them, to move, trash and label them, and to read spreadsheets too large
+// to export through the Sheets API. It also serves the public pages and
+// URLs that clients without credentials list, download and export from.
+// Failures can be injected to exercise retries:
+//
+//	srv := drivetest.NewServer()
+//	defer srv.Close()
+//	root := srv.AddFolder("", "Backup")
+//	srv.AddFile(root, "notes.txt", []byte("hello"))
+//	srv.Fail(root, http.StatusServiceUnavailable)
+//	client, err := srv.NewClient(ctx)
+//	...
+//	err = client.DownloadFolder(ctx, root, dir)
+//	drivetest.CompareDir(t, dir, "testdata/backup")
+package drivetest
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+	drivev3 "google.golang.org/api/drive/v3"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// FolderMimeType is the MIME type of Drive folders.
+const FolderMimeType = "application/vnd.google-apps.folder"
+
+// Epoch is the modification and creation time of files added without one.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// File is a file, folder or Google-native document held by a Server.
+type File struct {
+	ID       string
+	Name     string
+	MimeType string
+	Parents  []string
+	// Content is the content of a regular file.
+	Content []byte
+	// Exports holds the content of a Google-native document by export MIME
+	// type; exporting it to other types fails.
+	Exports      map[string][]byte
+	ModifiedTime time.Time
+	CreatedTime  time.Time
+	// Owner is the email address of the owner of the file, if any.
+	Owner string
+	// NotDownloadable makes downloading the file fail as Drive does for
+	// files whose owner disabled downloads.
+	NotDownloadable bool
+	// NotCopyable clears the canCopy capability of the file.
+	NotCopyable bool
+	// SHA256 reports the sha256Checksum of a regular file, which Drive only
+	// does for some files, and WrongSHA256 reports a wrong one.
+	SHA256      bool
+	WrongSHA256 bool
+	// WrongMD5 reports a wrong md5Checksum for a regular file.
+	WrongMD5 bool
+	// Shared marks the file as shared with other users.
+	Shared bool
+	// SharedWithMe and Starred make the file match the sharedWithMe and
+	// starred queries, which list such files wherever they are.
+	SharedWithMe bool
+	Starred      bool
+	// SharingUser is the email address of the user who shared the file
+	// with the user of the client, if any.
+	SharingUser string
+	// Trashed hides the file from the listings of files that are not
+	// trashed.
+	Trashed bool
+	// Labels holds the IDs of the Drive labels applied to the file, and
+	// LabelFields the values of their fields by "LABEL.FIELD" ID.
+	Labels      []string
+	LabelFields map[string]string
+	// Properties and AppProperties are the custom properties of the file.
+	Properties    map[string]string
+	AppProperties map[string]string
+	// Revision, if set, is the ID of the head revision of the file: the
+	// headRevisionId of a regular file, or the only revision listed for a
+	// Google-native document, made at RevisionTime.
+	Revision     string
+	RevisionTime time.Time
+	// ExportTooLarge makes exporting the document fail as Drive does for
+	// documents over its export size limit.
+	ExportTooLarge bool
+	// Tabs are the tabs of a spreadsheet, which the Sheets API lists and
+	// reads and the export URL of the spreadsheet exports as CSV.
+	Tabs []Tab
+	// ScanWarning makes the public download URL of a regular file serve
+	// the virus scan warning page Drive serves for files too large to be
+	// scanned, in the given variant, until the download is confirmed.
+	ScanWarning ScanWarning
+}
+
+// ScanWarning is a variant of the virus scan warning page of public
+// downloads.
+type ScanWarning int
+
+const (
+	// ScanWarningNone serves the content of the file.
+	ScanWarningNone ScanWarning = iota
+	// ScanWarningForm serves the current page, whose download-form submits
+	// a confirmation token and a UUID to another URL.
+	ScanWarningForm
+	// ScanWarningLink serves the older page linking to the download URL
+	// with a confirm parameter.
+	ScanWarningLink
+	// ScanWarningCookie serves the older page setting the confirmation
+	// token in a download_warning cookie.
+	ScanWarningCookie
+)
+
+// Tab is a tab of a spreadsheet.
+type Tab struct {
+	Title string
+	Rows  [][]string
+	// ExportTooLarge makes exporting the tab as CSV fail, so that it can
+	// only be read through the Sheets API.
+	ExportTooLarge bool
+}
+
+// Server is a fake Drive API server. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string]*File
+	order    []string // IDs of the files in the order they were added
+	failures map[string][]int
+	pageSize int // maximum number of files of a page, if positive
+	requests int
+	nextID   int
+}
+
+// NewServer starts a Server holding no files. It should be closed when done.
+func NewServer() *Server {
+	s := &Server{files: make(map[string]*File), failures: make(map[string][]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Add adds a file and returns its ID, assigning one if f has none. Files
+// without a MIME type are given one from their extension, and files
+// without times are given Epoch.
+func (s *Server) Add(f File) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.ID == "" {
+		s.nextID++
+		f.ID = "id" + strconv.Itoa(s.nextID)
+	}
+	if f.MimeType == "" {
+		f.MimeType = "application/octet-stream"
+		if t := mime.TypeByExtension(path.Ext(f.Name)); t != "" {
+			f.MimeType, _, _ = strings.Cut(t, ";")
+		}
+	}
+	if f.ModifiedTime.IsZero() {
+		f.ModifiedTime = Epoch
+	}
+	if f.CreatedTime.IsZero() {
+		f.CreatedTime = f.ModifiedTime
+	}
+	if _, ok := s.files[f.ID]; !ok {
+		s.order = append(s.order, f.ID)
+	}
+	s.files[f.ID] = &f
+	return f.ID
+}
+
+// AddFolder adds a folder named name to the folder parent, or at the top
+// level if parent is empty, and returns its ID.
+func (s *Server) AddFolder(parent, name string) string {
+	return s.Add(File{Name: name, MimeType: FolderMimeType, Parents: parents(parent)})
+}
+
+// AddFile adds a regular file to the folder parent and returns its ID.
+func (s *Server) AddFile(parent, name string, content []byte) string {
+	return s.Add(File{Name: name, Parents: parents(parent), Content: content})
+}
+
+// AddDocument adds a Google-native document of the given MIME type, such as
+// "application/vnd.google-apps.document", to the folder parent, with its
+// content in each export format, and returns its ID.
+func (s *Server) AddDocument(parent, name, mimeType string, exports map[string][]byte) string {
+	return s.Add(File{Name: name, MimeType: mimeType, Parents: parents(parent), Exports: exports})
+}
+
+// parents returns the parents of a file added to parent.
+func parents(parent string) []string {
+	if parent == "" {
+		return nil
+	}
+	return []string{parent}
+}
+
+// Fail makes the next requests concerning the file or folder id fail with
+// the given HTTP status codes, one request per code: getting, downloading or
+// exporting it, or listing the content of a folder.
+func (s *Server) Fail(id string, codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[id] = append(s.failures[id], codes...)
+}
+
+// FailPage makes the next requests for the page of the listing of the folder
+// id numbered page, starting from 0, fail with the given HTTP status codes,
+// one request per code, while the pages before it are listed.
+func (s *Server) FailPage(id string, page int, codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := pageKey(id, page)
+	s.failures[key] = append(s.failures[key], codes...)
+}
+
+// SetPageSize caps the number of files of a page of a listing to n, so that
+// listings of small folders span several pages; 0 removes the cap.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = n
+}
+
+// pageKey returns the key of the failures of a page of the listing of a
+// folder in Server.failures.
+func pageKey(id string, page int) string {
+	return id + "#" + strconv.Itoa(page)
+}
+
+// File returns a copy of the file id as it currently is, after the changes
+// clients made to it.
+func (s *Server) File(id string) (File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[id]
+	if !ok {
+		return File{}, false
+	}
+	return *f, true
+}
+
+// Requests returns the number of requests the server received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// HTTPClient returns an HTTP client sending every request to the server,
+// whatever its host, so that clients using it reach the server instead of
+// Google.
+func (s *Server) HTTPClient() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: redirectTransport{target: target, base: s.Client().Transport}}
+}
+
+// NewClient creates a drive.Client sending its requests to the server,
+// authenticated with an API key, with any further options. Its Logger is
+// left unset.
+func (s *Server) NewClient(ctx context.Context, opts ...drive.Option) (*drive.Client, error) {
+	opts = append([]drive.Option{drive.WithAPIKey("drivetest"), drive.WithHTTPClient(s.HTTPClient())}, opts...)
+	client, err := drive.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	client.Logger = nil
+	return client, nil
+}
+
+// redirectTransport sends every request to the host of target.
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	req.Host = ""
+	return t.base.RoundTrip(req)
+}
+
+// apiPrefix is the path prefix of Drive API requests.
+const apiPrefix = "/drive/v3/files"
+
+// downloadPrefix is the path prefix of the webContentLink of files.
+const downloadPrefix = "/download/"
+
+// Paths of the public endpoints that clients without credentials use: the
+// embedded folder view listing a folder, the download URL of files, and the
+// URL the form of the virus scan warning page is submitted to.
+const (
+	folderViewPath     = "/embeddedfolderview"
+	publicDownloadPath = "/uc"
+	confirmPath        = "/download"
+)
+
+// publicExportPattern matches the public export URLs of Google-native
+// documents, naming the format as a format parameter or a last path element.
+var publicExportPattern = regexp.MustCompile(`^/(document|spreadsheets|presentation|drawings)/d/([^/]+)/export(?:/(\w+))?$`)
+
+// Path prefixes of the export URLs of spreadsheets and of Sheets API
+// requests.
+const (
+	sheetExportPrefix = "/spreadsheets/d/"
+	sheetsPrefix      = "/v4/spreadsheets/"
+)
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	rest := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	switch {
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, apiPrefix):
+		s.serveUpdate(w, r, strings.Trim(rest, "/"))
+	case r.Method == http.MethodPost && strings.HasSuffix(rest, "/modifyLabels"):
+		s.serveModifyLabels(w, r, strings.Trim(strings.TrimSuffix(rest, "/modifyLabels"), "/"))
+	case r.Method != http.MethodGet:
+		writeError(w, http.StatusMethodNotAllowed, "badRequest", "the fake server only updates files and modifies their labels")
+	case strings.HasPrefix(r.URL.Path, downloadPrefix):
+		s.serveContent(w, strings.TrimPrefix(r.URL.Path, downloadPrefix))
+	case r.URL.Path == folderViewPath:
+		s.serveFolderView(w, r.URL.Query().Get("id"))
+	case r.URL.Path == publicDownloadPath || r.URL.Path == confirmPath:
+		s.servePublicDownload(w, r)
+	case strings.HasPrefix(r.URL.Path, sheetExportPrefix) && strings.HasSuffix(r.URL.Path, "/export") && r.URL.Query().Has("gid"):
+		s.serveTabExport(w, r, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, sheetExportPrefix), "/export"))
+	case publicExportPattern.MatchString(r.URL.Path):
+		s.servePublicExport(w, r)
+	case strings.HasPrefix(r.URL.Path, sheetsPrefix):
+		s.serveSheets(w, strings.TrimPrefix(r.URL.Path, sheetsPrefix))
+	case !strings.HasPrefix(r.URL.Path, apiPrefix):
+		writeError(w, http.StatusNotFound, "notFound", "unknown path "+r.URL.Path)
+	case rest == "" || rest == "/":
+		s.serveList(w, r)
+	case strings.HasSuffix(rest, "/revisions"):
+		s.serveRevisions(w, strings.Trim(strings.TrimSuffix(rest, "/revisions"), "/"))
+	case strings.HasSuffix(rest, "/export"):
+		s.serveExport(w, strings.Trim(strings.TrimSuffix(rest, "/export"), "/"), r.URL.Query().Get("mimeType"))
+	case r.URL.Query().Get("alt") == "media":
+		s.serveContent(w, strings.Trim(rest, "/"))
+	default:
+		s.serveMetadata(w, strings.Trim(rest, "/"))
+	}
+}
+
+// fail writes the next failure injected for id, if any, and reports whether
+// it did.
+func (s *Server) fail(w http.ResponseWriter, id string) bool {
+	codes := s.failures[id]
+	if len(codes) == 0 {
+		return false
+	}
+	s.failures[id] = codes[1:]
+	reason := "backendError"
+	switch codes[0] {
+	case http.StatusTooManyRequests:
+		reason = "rateLimitExceeded"
+	case http.StatusForbidden:
+		reason = "forbidden"
+	case http.StatusNotFound:
+		reason = "notFound"
+	}
+	writeError(w, codes[0], reason, "injected failure")
+	return true
+}
+
+// lookup returns the file id, writing a not found error if there is none.
+func (s *Server) lookup(w http.ResponseWriter, id string) (*File, bool) {
+	if s.fail(w, id) {
+		return nil, false
+	}
+	f, ok := s.files[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "File not found: "+id)
+	}
+	return f, ok
+}
+
+func (s *Server) serveMetadata(w http.ResponseWriter, id string) {
+	if f, ok := s.lookup(w, id); ok {
+		writeJSON(w, s.metadata(f))
+	}
+}
+
+func (s *Server) serveContent(w http.ResponseWriter, id string) {
+	f, ok := s.lookup(w, id)
+	switch {
+	case !ok:
+	case f.MimeType == FolderMimeType || strings.HasPrefix(f.MimeType, "application/vnd.google-apps."):
+		writeError(w, http.StatusForbidden, "fileNotDownloadable", "Only files with binary content can be downloaded")
+	case f.NotDownloadable:
+		writeError(w, http.StatusForbidden, "cannotDownloadFile", "The user does not have sufficient permissions to download this file")
+	default:
+		w.Header().Set("Content-Type", f.MimeType)
+		w.Write(f.Content)
+	}
+}
+
+func (s *Server) serveExport(w http.ResponseWriter, id, mimeType string) {
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	if f.ExportTooLarge {
+		writeError(w, http.StatusForbidden, "exportSizeLimitExceeded", "This file is too large to be exported.")
+		return
+	}
+	content, ok := f.Exports[mimeType]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "badRequest", fmt.Sprintf("The requested conversion to %s is not supported", mimeType))
+		return
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Write(content)
+}
+
+// publicLinks maps the MIME types of the items of the embedded folder view
+// that are not regular files to the prefix of their link.
+var publicLinks = map[string]string{
+	FolderMimeType:                             "https://drive.google.com/drive/folders/",
+	"application/vnd.google-apps.document":     "https://docs.google.com/document/d/",
+	"application/vnd.google-apps.spreadsheet":  "https://docs.google.com/spreadsheets/d/",
+	"application/vnd.google-apps.presentation": "https://docs.google.com/presentation/d/",
+	"application/vnd.google-apps.drawing":      "https://docs.google.com/drawings/d/",
+}
+
+// serveFolderView writes the embedded folder view of a folder: a page titled
+// with its name listing its items that are not trashed, in the order they
+// were added, with their link, icon and name.
+func (s *Server) serveFolderView(w http.ResponseWriter, id string) {
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%s</title></head><body><div class=\"flip-entries\">\n", html.EscapeString(f.Name))
+	for _, childID := range s.order {
+		child := s.files[childID]
+		if child.Trashed || !slices.Contains(child.Parents, id) {
+			continue
+		}
+		link := "https://drive.google.com/file/d/" + child.ID + "/view?usp=drive_web"
+		if prefix, ok := publicLinks[child.MimeType]; ok {
+			link = prefix + child.ID
+		}
+		icon := "https://drive-thirdparty.googleusercontent.com/16/type/" + child.MimeType
+		fmt.Fprintf(w, `<div class="flip-entry" id="entry-%s" tabindex="0" role="link"><div class="flip-entry-info"><a href="%s" target="_blank"><div class="flip-entry-visual"><div class="flip-entry-list-icon"><img src="%s" alt=""></div></div><div class="flip-entry-title">%s</div></a></div></div>`+"\n",
+			child.ID, html.EscapeString(link), html.EscapeString(icon), html.EscapeString(child.Name))
+	}
+	fmt.Fprint(w, "</div></body></html>\n")
+}
+
+// scanToken is the confirmation token of the virus scan warning page of a
+// file.
+func scanToken(id string) string {
+	return "token-" + id
+}
+
+// servePublicDownload answers the public download URL of a file, and the URL
+// the form of its virus scan warning page is submitted to. Files with a
+// ScanWarning are only served once the download is confirmed as their
+// variant of the page says.
+func (s *Server) servePublicDownload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id := query.Get("id")
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	confirmed := false
+	switch f.ScanWarning {
+	case ScanWarningNone:
+		confirmed = r.URL.Path == publicDownloadPath
+	case ScanWarningForm:
+		confirmed = r.URL.Path == confirmPath && query.Get("confirm") == "t" && query.Get("uuid") == scanToken(id)
+	case ScanWarningLink, ScanWarningCookie:
+		confirmed = r.URL.Path == publicDownloadPath && query.Get("confirm") == scanToken(id)
+	}
+	if confirmed {
+		s.serveContent(w, id)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if f.ScanWarning == ScanWarningCookie {
+		http.SetCookie(w, &http.Cookie{Name: "download_warning_13058876669334088843_" + id, Value: scanToken(id), Path: "/uc"})
+	}
+	fmt.Fprint(w, "<!DOCTYPE html><html><head><title>Google Drive - Virus scan warning</title></head><body>")
+	fmt.Fprintf(w, "<p>%s is too large for Google to scan for viruses. Would you still like to download this file?</p>", html.EscapeString(f.Name))
+	switch f.ScanWarning {
+	case ScanWarningForm:
+		fmt.Fprintf(w, `<form id="download-form" action="https://drive.usercontent.google.com%s" method="get">`+
+			`<input type="submit" id="uc-download-link" class="goog-inline-block jfk-button jfk-button-action" value="Download anyway">`+
+			`<input type="hidden" name="id" value="%s"><input type="hidden" name="export" value="download">`+
+			`<input type="hidden" name="confirm" value="t"><input type="hidden" name="uuid" value="%s"></form>`,
+			confirmPath, html.EscapeString(id), html.EscapeString(scanToken(id)))
+	case ScanWarningLink:
+		fmt.Fprintf(w, `<a id="uc-download-link" class="goog-inline-block jfk-button jfk-button-action" href="%s?export=download&amp;confirm=%s&amp;id=%s">Download anyway</a>`,
+			publicDownloadPath, url.QueryEscape(scanToken(id)), url.QueryEscape(id))
+	}
+	fmt.Fprint(w, "</body></html>\n")
+}
+
+// servePublicExport answers the public export URL of a Google-native
+// document, in the format named by its extension.
+func (s *Server) servePublicExport(w http.ResponseWriter, r *http.Request) {
+	match := publicExportPattern.FindStringSubmatch(r.URL.Path)
+	format := match[3]
+	if format == "" {
+		format = r.URL.Query().Get("format")
+	}
+	mimeType, ok := exportTypes[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "badRequest", "unknown export format "+format)
+		return
+	}
+	s.serveExport(w, match[2], mimeType)
+}
+
+// exportTypes maps the formats of public export URLs to export MIME types.
+var exportTypes = map[string]string{
+	"pdf":  "application/pdf",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	"csv":  "text/csv",
+	"png":  "image/png",
+	"svg":  "image/svg+xml",
+	"jpg":  "image/jpeg",
+}
+
+// serveTabExport exports the tab of a spreadsheet selected by the gid
+// parameter as CSV, the only format the fake server exports tabs to.
+func (s *Server) serveTabExport(w http.ResponseWriter, r *http.Request, id string) {
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	gid, err := strconv.Atoi(r.URL.Query().Get("gid"))
+	switch {
+	case r.URL.Query().Get("format") != "csv":
+		writeError(w, http.StatusBadRequest, "badRequest", "the fake server only exports tabs as CSV")
+	case err != nil || gid < 0 || gid >= len(f.Tabs):
+		writeError(w, http.StatusNotFound, "notFound", "no such tab")
+	case f.Tabs[gid].ExportTooLarge:
+		writeError(w, http.StatusForbidden, "exportSizeLimitExceeded", "This tab is too large to be exported.")
+	default:
+		w.Header().Set("Content-Type", "text/csv")
+		csv.NewWriter(w).WriteAll(f.Tabs[gid].Rows)
+	}
+}
+
+// serveSheets answers the Sheets API requests getting the tabs of a
+// spreadsheet, whose IDs are their indexes, and reading the values of a
+// range of rows of a tab, written as 'TITLE'!FIRST:LAST.
+func (s *Server) serveSheets(w http.ResponseWriter, rest string) {
+	id, valueRange, isValues := strings.Cut(rest, "/values/")
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	if !isValues {
+		spreadsheet := &sheets.Spreadsheet{SpreadsheetId: f.ID}
+		for i, tab := range f.Tabs {
+			spreadsheet.Sheets = append(spreadsheet.Sheets, &sheets.Sheet{Properties: &sheets.SheetProperties{
+				SheetId:        int64(i),
+				Title:          tab.Title,
+				GridProperties: &sheets.GridProperties{RowCount: int64(len(tab.Rows))},
+			}})
+		}
+		writeJSON(w, spreadsheet)
+		return
+	}
+	match := sheetRange.FindStringSubmatch(valueRange)
+	if match == nil {
+		writeError(w, http.StatusBadRequest, "badRequest", "unsupported range "+valueRange)
+		return
+	}
+	title := strings.ReplaceAll(match[1], "''", "'")
+	first, _ := strconv.Atoi(match[2])
+	last, _ := strconv.Atoi(match[3])
+	i := slices.IndexFunc(f.Tabs, func(tab Tab) bool { return tab.Title == title })
+	if i < 0 || first < 1 || last < first {
+		writeError(w, http.StatusBadRequest, "badRequest", "unable to parse range: "+valueRange)
+		return
+	}
+	rows := f.Tabs[i].Rows[min(first-1, len(f.Tabs[i].Rows)):min(last, len(f.Tabs[i].Rows))]
+	// Like the Sheets API, leave out the empty rows at the end.
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	values := &sheets.ValueRange{Range: valueRange, MajorDimension: "ROWS"}
+	for _, row := range rows {
+		record := make([]any, len(row))
+		for j, value := range row {
+			record[j] = value
+		}
+		values.Values = append(values.Values, record)
+	}
+	writeJSON(w, values)
+}
+
+// sheetRange matches the ranges of rows read by the Sheets API.
+var sheetRange = regexp.MustCompile(`^'((?:[^']|'')*)'!(\d+):(\d+)$`)
+
+// serveRevisions lists the head revision of a file, if it has one.
+func (s *Server) serveRevisions(w http.ResponseWriter, id string) {
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	list := &drivev3.RevisionList{}
+	if f.Revision != "" {
+		list.Revisions = []*drivev3.Revision{{Id: f.Revision, ModifiedTime: f.RevisionTime.UTC().Format(time.RFC3339)}}
+	}
+	writeJSON(w, list)
+}
+
+// serveUpdate moves a file between the parents given by the addParents and
+// removeParents parameters and trashes it if the request body says so.
+func (s *Server) serveUpdate(w http.ResponseWriter, r *http.Request, id string) {
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	var update drivev3.File
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return
+	}
+	query := r.URL.Query()
+	if remove := query.Get("removeParents"); remove != "" {
+		var kept []string
+		for _, p := range f.Parents {
+			if !slices.Contains(strings.Split(remove, ","), p) {
+				kept = append(kept, p)
+			}
+		}
+		f.Parents = kept
+	}
+	if add := query.Get("addParents"); add != "" {
+		f.Parents = append(f.Parents, strings.Split(add, ",")...)
+	}
+	if update.Trashed {
+		f.Trashed = true
+	}
+	writeJSON(w, s.metadata(f))
+}
+
+// serveModifyLabels applies the labels of the modifications in the request
+// body to a file; their fields are ignored.
+func (s *Server) serveModifyLabels(w http.ResponseWriter, r *http.Request, id string) {
+	f, ok := s.lookup(w, id)
+	if !ok {
+		return
+	}
+	var req drivev3.ModifyLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return
+	}
+	resp := &drivev3.ModifyLabelsResponse{}
+	for _, mod := range req.LabelModifications {
+		if mod.RemoveLabel {
+			f.Labels = slices.DeleteFunc(f.Labels, func(l string) bool { return l == mod.LabelId })
+			continue
+		}
+		if !slices.Contains(f.Labels, mod.LabelId) {
+			f.Labels = append(f.Labels, mod.LabelId)
+		}
+		resp.ModifiedLabels = append(resp.ModifiedLabels, &drivev3.Label{Id: mod.LabelId})
+	}
+	writeJSON(w, resp)
+}
+
+// parentPattern matches the parent a query lists the content of.
+var parentPattern = regexp.MustCompile(`'((?:[^'\\]|\\.)*)' in parents`)
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	pageSize, _ := strconv.Atoi(query.Get("pageSize"))
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	if s.pageSize > 0 {
+		pageSize = min(pageSize, s.pageSize)
+	}
+	start, _ := strconv.Atoi(query.Get("pageToken"))
+	var found []*drivev3.File
+	switch match := parentPattern.FindStringSubmatch(q); {
+	case match != nil:
+		parent := unescape(match[1])
+		if s.fail(w, parent) || s.fail(w, pageKey(parent, start/pageSize)) {
+			return
+		}
+		for _, id := range s.order {
+			f := s.files[id]
+			if hasParent(f, parent) && (f.MimeType == FolderMimeType || matches(f, q)) {
+				found = append(found, s.metadata(f))
+			}
+		}
+	case strings.Contains(q, "sharedWithMe = true"), strings.Contains(q, "starred = true"):
+		starred := strings.Contains(q, "starred = true")
+		for _, id := range s.order {
+			f := s.files[id]
+			if (starred && f.Starred || !starred && f.SharedWithMe) && matches(f, q) {
+				found = append(found, s.metadata(f))
+			}
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "invalidQuery", "the fake server only lists the content of folders and the sharedWithMe and starred files")
+		return
+	}
+
+	start = min(max(start, 0), len(found))
+	end := min(start+pageSize, len(found))
+	list := &drivev3.FileList{Files: found[start:end]}
+	if end < len(found) {
+		list.NextPageToken = strconv.Itoa(end)
+	}
+	writeJSON(w, list)
+}
+
+// hasParent reports whether parent is a parent of f.
+func hasParent(f *File, parent string) bool {
+	for _, p := range f.Parents {
+		if p == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// Patterns of the query terms filtering files.
+var (
+	timePattern     = regexp.MustCompile(`(modifiedTime|createdTime) ([<>]) '([^']+)'`)
+	ownerPattern    = regexp.MustCompile(`(not )?'((?:[^'\\]|\\.)*)' in owners`)
+	mimeTypePattern = regexp.MustCompile(`mimeType (!?=) '([^']+)'`)
+	propertyPattern = regexp.MustCompile(`(properties|appProperties) has \{ key='((?:[^'\\]|\\.)*)' and value='((?:[^'\\]|\\.)*)' \}`)
+	labelPattern    = regexp.MustCompile(`'labels/([^']+)' in labels`)
+	fieldPattern    = regexp.MustCompile(`labels/([\w-]+\.[\w-]+) = '((?:[^'\\]|\\.)*)'`)
+)
+
+// matches reports whether a file other than a folder passes the terms of a
+// query that package drive filters listings with. The terms are all taken to
+// be combined with "and".
+func matches(f *File, q string) bool {
+	if f.Trashed && strings.Contains(q, "trashed = false") {
+		return false
+	}
+	for _, m := range timePattern.FindAllStringSubmatch(q, -1) {
+		bound, err := time.Parse(time.RFC3339, m[3])
+		if err != nil {
+			continue
+		}
+		t := f.ModifiedTime
+		if m[1] == "createdTime" {
+			t = f.CreatedTime
+		}
+		if m[2] == ">" && !t.After(bound) || m[2] == "<" && !t.Before(bound) {
+			return false
+		}
+	}
+	for _, m := range ownerPattern.FindAllStringSubmatch(q, -1) {
+		if (f.Owner == unescape(m[2])) == (m[1] != "") {
+			return false
+		}
+	}
+	for _, m := range propertyPattern.FindAllStringSubmatch(q, -1) {
+		properties := f.Properties
+		if m[1] == "appProperties" {
+			properties = f.AppProperties
+		}
+		if value, ok := properties[unescape(m[2])]; !ok || value != unescape(m[3]) {
+			return false
+		}
+	}
+	for _, m := range labelPattern.FindAllStringSubmatch(q, -1) {
+		if !slices.Contains(f.Labels, m[1]) {
+			return false
+		}
+	}
+	for _, m := range fieldPattern.FindAllStringSubmatch(q, -1) {
+		if value, ok := f.LabelFields[m[1]]; !ok || value != unescape(m[2]) {
+			return false
+		}
+	}
+	for _, m := range mimeTypePattern.FindAllStringSubmatch(q, -1) {
+		if m[2] == FolderMimeType {
+			// Folders are always listed.
+			continue
+		}
+		if (f.MimeType == m[2]) != (m[1] == "=") {
+			return false
+		}
+	}
+	return true
+}
+
+// unescape undoes the escaping of a quoted query value.
+func unescape(s string) string {
+	return strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(s)
+}
+
+// metadata returns the Drive API representation of f.
+func (s *Server) metadata(f *File) *drivev3.File {
+	file := &drivev3.File{
+		Id:           f.ID,
+		Name:         f.Name,
+		MimeType:     f.MimeType,
+		Parents:      f.Parents,
+		ModifiedTime: f.ModifiedTime.UTC().Format(time.RFC3339),
+		CreatedTime:  f.CreatedTime.UTC().Format(time.RFC3339),
+		Capabilities: &drivev3.FileCapabilities{CanDownload: !f.NotDownloadable, CanCopy: !f.NotCopyable},
+		Shared:       f.Shared,
+	}
+	if f.Owner != "" {
+		file.Owners = []*drivev3.User{{EmailAddress: f.Owner}}
+	}
+	if f.SharingUser != "" {
+		file.SharingUser = &drivev3.User{EmailAddress: f.SharingUser}
+	}
+	if f.MimeType != FolderMimeType && !strings.HasPrefix(f.MimeType, "application/vnd.google-apps.") {
+		sum := md5.Sum(f.Content)
+		if f.WrongMD5 {
+			sum = md5.Sum(append(f.Content, '!'))
+		}
+		file.Size = int64(len(f.Content))
+		file.Md5Checksum = hex.EncodeToString(sum[:])
+		if f.SHA256 || f.WrongSHA256 {
+			sum := sha256.Sum256(f.Content)
+			if f.WrongSHA256 {
+				sum = sha256.Sum256(append(f.Content, '!'))
+			}
+			file.Sha256Checksum = hex.EncodeToString(sum[:])
+		}
+		file.WebContentLink = s.URL + downloadPrefix + f.ID
+		file.HeadRevisionId = f.Revision
+	}
+	return file
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response in the format of the Drive API.
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"errors":  []map[string]string{{"domain": "global", "reason": reason, "message": message}},
+		},
+	})
+}
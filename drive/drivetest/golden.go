@@ -0,0 +1,116 @@
+package drivetest
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// UpdateEnv is the environment variable that, when set to a non-empty value,
+// makes CompareDir replace golden directories with the trees it is given
+// instead of comparing them, to record new expectations:
+//
+//	DRIVETEST_UPDATE=1 go test ./...
+const UpdateEnv = "DRIVETEST_UPDATE"
+
+// ReadTree returns the content of every regular file below dir by
+// slash-separated path relative to it. The manifest, queue and other files
+// a download keeps in its directory, whose names start with ".drive-", are
+// left out.
+func ReadTree(dir string) (map[string]string, error) {
+	tree := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".drive-") || !entry.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		tree[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return tree, err
+}
+
+// CompareDir compares the files below dir with those below the golden
+// directory, as read by ReadTree, and reports every missing, unexpected or
+// differing file as an error of t. Empty directories are not compared, as
+// version control does not keep them. If the UpdateEnv environment variable
+// is set, the golden directory is replaced with a copy of dir instead.
+func CompareDir(t testing.TB, dir, golden string) {
+	t.Helper()
+	got, err := ReadTree(dir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+	if os.Getenv(UpdateEnv) != "" {
+		if err := writeTree(golden, got); err != nil {
+			t.Fatalf("failed to update %s: %v", golden, err)
+		}
+		return
+	}
+	want, err := ReadTree(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden directory %s: %v", golden, err)
+	}
+
+	paths := make([]string, 0, len(got)+len(want))
+	for p := range got {
+		paths = append(paths, p)
+	}
+	for p := range want {
+		if _, ok := got[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		g, inGot := got[p]
+		w, inWant := want[p]
+		switch {
+		case !inGot:
+			t.Errorf("%s: missing", p)
+		case !inWant:
+			t.Errorf("%s: unexpected file", p)
+		case g != w:
+			t.Errorf("%s: content is %q, want %q", p, abbreviate(g), abbreviate(w))
+		}
+	}
+}
+
+// writeTree replaces the directory dir with the files of tree.
+func writeTree(dir string, tree map[string]string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for p, content := range tree {
+		filePath := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abbreviate shortens long file contents in error messages.
+func abbreviate(s string) string {
+	const limit = 64
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "..."
+}
@@ -0,0 +1,15 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// syncFile flushes the content of f to stable storage, and then its parent
+// directory, so that the file survives a crash or power loss once saved.
+func syncFile(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(f.Name()))
+}
@@ -0,0 +1,7 @@
+package drive
+
+// syncDir does nothing on Windows, where directories cannot be opened to be
+// flushed and NTFS journals their entries.
+func syncDir(dir string) error {
+	return nil
+}
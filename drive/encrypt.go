@@ -0,0 +1,123 @@
+package drive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Encryption encrypts every downloaded file as it is written, by piping its
+// content through an external program such as age or gpg, so that no
+// plaintext ever reaches the disk. Encrypted files are named with Extension
+// appended, and their checksums are those of the plaintext.
+type Encryption struct {
+	// Command is the program and arguments run for every file, reading the
+	// plaintext on its standard input and writing the ciphertext to its
+	// standard output.
+	Command []string
+	// Extension is appended to the names of encrypted files, e.g. ".age".
+	Extension string
+}
+
+// ParseEncryption parses an encryption setting of the form "age:RECIPIENT",
+// encrypting with the age tool to an age or SSH public key, or
+// "gpg:RECIPIENT", encrypting with GnuPG to a key in the user's keyring.
+func ParseEncryption(s string) (*Encryption, error) {
+	tool, recipient, ok := strings.Cut(s, ":")
+	if !ok || recipient == "" {
+		return nil, fmt.Errorf("encryption %q is not of the form TOOL:RECIPIENT", s)
+	}
+	switch strings.ToLower(tool) {
+	case "age":
+		return &Encryption{Command: []string{"age", "--encrypt", "--recipient", recipient}, Extension: ".age"}, nil
+	case "gpg":
+		return &Encryption{Command: []string{"gpg", "--batch", "--quiet", "--encrypt", "--recipient", recipient}, Extension: ".gpg"}, nil
+	}
+	return nil, fmt.Errorf("unknown encryption tool %q: use age or gpg", tool)
+}
+
+// writer starts the encryption program writing the ciphertext to dst. The
+// returned writer must be closed to wait for it.
+func (e *Encryption) writer(dst io.Writer) (*commandWriter, error) {
+	if len(e.Command) == 0 {
+		return nil, errors.New("no encryption command")
+	}
+	return startWriter(e.Command, dst)
+}
+
+// commandWriter pipes what is written to it through an external program
+// writing its output to an underlying writer.
+type commandWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+// startWriter starts the program and arguments args writing its output to
+// dst. The returned writer must be closed to wait for it.
+func startWriter(args []string, dst io.Writer) (*commandWriter, error) {
+	w := &commandWriter{cmd: exec.Command(args[0], args[1:]...)}
+	w.cmd.Stdout = dst
+	w.cmd.Stderr = &w.stderr
+	var err error
+	if w.stdin, err = w.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := w.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+	return w, nil
+}
+
+func (w *commandWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+// Close ends the input and waits for the program to complete.
+func (w *commandWriter) Close() error {
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", w.cmd.Args[0], err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// commandReader reads the output of an external program reading its input
+// from an underlying reader.
+type commandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+}
+
+// startReader starts the program and arguments args reading its input from
+// src. The returned reader must be closed to wait for it.
+func startReader(args []string, src io.Reader) (*commandReader, error) {
+	r := &commandReader{cmd: exec.Command(args[0], args[1:]...)}
+	r.cmd.Stdin = src
+	r.cmd.Stderr = &r.stderr
+	var err error
+	if r.stdout, err = r.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := r.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+	return r, nil
+}
+
+func (r *commandReader) Read(p []byte) (int, error) {
+	return r.stdout.Read(p)
+}
+
+// Close waits for the program to complete.
+func (r *commandReader) Close() error {
+	io.Copy(io.Discard, r.stdout)
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", r.cmd.Args[0], err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
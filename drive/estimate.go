@@ -0,0 +1,127 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Sampling of the throughput of a download by EstimatePlan: the first
+// estimateSampleSize bytes of up to estimateSamples of the largest files are
+// downloaded.
+const (
+	estimateSamples    = 3
+	estimateSampleSize = 4 << 20
+)
+
+// Estimate is what carrying out a Plan is expected to cost, as returned by
+// EstimatePlan.
+type Estimate struct {
+	// Files is the number of files to download, Exports the number of
+	// Google documents to export, and Bytes the bytes the files to download
+	// hold; the size of exports is unknown until they are made.
+	Files   int
+	Exports int
+	Bytes   int64
+	// APICalls is the number of Drive API requests expected for the
+	// transfers, ListCalls the number of requests the walk that made the
+	// plan took.
+	APICalls  int
+	ListCalls int64
+	// Throughput is the measured bytes per second of a single download and
+	// Latency the time it took for a download to start, both 0 if nothing
+	// could be sampled.
+	Throughput float64
+	Latency    time.Duration
+	// Duration is the projected duration of the transfers with the
+	// client's concurrency and bandwidth limit, 0 if unknown.
+	Duration time.Duration
+}
+
+// EstimatePlan estimates what carrying out plan costs: the files and bytes to
+// transfer, the API requests expected, and how long the transfers take,
+// projected from the throughput of the first few megabytes of the largest
+// files, which are downloaded and discarded. The throughput of exports is not
+// sampled, only their latency counted.
+func (c *Client) EstimatePlan(ctx context.Context, plan *Plan) (*Estimate, error) {
+	e := &Estimate{ListCalls: c.Stats.Calls()[CallList]}
+	var downloads []PlanAction
+	for _, action := range plan.Actions {
+		switch action.Action {
+		case ActionDownload:
+			e.Files++
+			e.Bytes += max(action.Bytes, 0)
+			e.APICalls++
+			downloads = append(downloads, action)
+		case ActionExport:
+			e.Exports++
+			// The latest revision is looked up before the export.
+			e.APICalls += 2
+		}
+	}
+	if err := c.sampleThroughput(ctx, e, downloads); err != nil {
+		return nil, err
+	}
+	if e.Throughput <= 0 {
+		return e, nil
+	}
+	transfers := e.Files + e.Exports
+	streams := float64(min(c.concurrency(), max(transfers, 1)))
+	rate := e.Throughput * streams
+	c.throttle.mu.Lock()
+	limit := c.throttle.bandwidthLimit(c)
+	c.throttle.mu.Unlock()
+	if limit > 0 && float64(limit) < rate {
+		rate = float64(limit)
+	}
+	seconds := float64(e.Bytes)/rate + e.Latency.Seconds()*float64(transfers)/streams
+	e.Duration = time.Duration(seconds * float64(time.Second))
+	return e, nil
+}
+
+// sampleThroughput measures the throughput and latency of downloads in e,
+// with the largest of downloads.
+func (c *Client) sampleThroughput(ctx context.Context, e *Estimate, downloads []PlanAction) error {
+	if c.anonymous() {
+		return nil
+	}
+	sort.Slice(downloads, func(i, j int) bool { return downloads[i].Bytes > downloads[j].Bytes })
+	var received int64
+	var latency, elapsed time.Duration
+	samples := 0
+	for _, action := range downloads[:min(len(downloads), estimateSamples)] {
+		if action.Bytes <= 0 {
+			break
+		}
+		call := c.Service.Files.Get(action.File.Id).Context(ctx)
+		call.Header().Set("Range", fmt.Sprintf("bytes=0-%d", min(action.Bytes, estimateSampleSize)-1))
+		start := time.Now()
+		resp, err := call.Download()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.debugf(DebugDownloader, "Failed to sample %s: %v", action.Path, err)
+			continue
+		}
+		started := time.Now()
+		n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, estimateSampleSize))
+		resp.Body.Close()
+		if err != nil {
+			c.debugf(DebugDownloader, "Failed to sample %s: %v", action.Path, err)
+			continue
+		}
+		samples++
+		received += n
+		latency += started.Sub(start)
+		elapsed += time.Since(started)
+	}
+	if samples == 0 {
+		return nil
+	}
+	e.Latency = latency / time.Duration(samples)
+	e.Throughput = float64(received) / max(elapsed.Seconds(), 1e-3)
+	return nil
+}
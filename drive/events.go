@@ -0,0 +1,132 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Buffering of progress events: the channel returned by DownloadFolderEvents
+// holds eventBuffer events, and the bytes received for a file are reported at
+// most every progressInterval.
+const (
+	eventBuffer      = 64
+	progressInterval = 250 * time.Millisecond
+)
+
+// ProgressEventKind is the kind of a ProgressEvent.
+type ProgressEventKind int
+
+const (
+	// EventDiscovered reports a file found by the walk and queued for
+	// download.
+	EventDiscovered ProgressEventKind = iota
+	// EventStarted reports that a file started downloading.
+	EventStarted
+	// EventProgressed reports the bytes received so far for a file.
+	EventProgressed
+	// EventFinished reports a file downloaded and verified, or kept
+	// unchanged since the previous download.
+	EventFinished
+	// EventFailed reports a file that could not be downloaded.
+	EventFailed
+	// EventDone is the last event, reporting the end of the download.
+	EventDone
+)
+
+// String returns the name of the kind, such as "discovered".
+func (k ProgressEventKind) String() string {
+	switch k {
+	case EventDiscovered:
+		return "discovered"
+	case EventStarted:
+		return "started"
+	case EventProgressed:
+		return "progressed"
+	case EventFinished:
+		return "finished"
+	case EventFailed:
+		return "failed"
+	case EventDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// ProgressEvent is a step of a download started by DownloadFolderEvents.
+type ProgressEvent struct {
+	Kind ProgressEventKind
+	// ID and Path identify the file, Path being slash-separated and
+	// relative to the download directory. Both are empty for EventDone.
+	ID   string
+	Path string
+	// Bytes is the size Drive reports for a discovered file (0 for Google
+	// documents, whose exports have no known size), the bytes received so
+	// far for EventProgressed, and the size of the local copy for
+	// EventFinished.
+	Bytes int64
+	// Err is the error of EventFailed and of EventDone, which is nil if the
+	// download succeeded.
+	Err error
+}
+
+// DownloadFolderEvents starts DownloadFolder in the background and returns
+// the events of its progress, so that front-ends can display it without
+// parsing the log. The last event is EventDone, with the error DownloadFolder
+// returned, after which the channel is closed. The caller must receive every
+// event, since the download waits for them to be received; only
+// EventProgressed events are dropped while the channel is full. An error is
+// returned without starting the download if the client's credentials lack
+// the scopes it needs.
+func (c *Client) DownloadFolderEvents(ctx context.Context, folderID, downloadPath string) (<-chan ProgressEvent, error) {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return nil, err
+	}
+	if err := c.checkAfterDownload(ctx); err != nil {
+		return nil, err
+	}
+	events := make(chan ProgressEvent, eventBuffer)
+	go func() {
+		defer close(events)
+		err := c.downloadInto(ctx, folderID, downloadPath, nil, events)
+		events <- ProgressEvent{Kind: EventDone, Err: err}
+	}()
+	return events, nil
+}
+
+// emit sends an event to the events of d, if it has any.
+func (d *download) emit(event ProgressEvent) {
+	if d.events == nil {
+		return
+	}
+	if event.Kind == EventProgressed {
+		// A later event supersedes it.
+		select {
+		case d.events <- event:
+		default:
+		}
+		return
+	}
+	d.events <- event
+}
+
+// progressReader reports the bytes read from the content of a file as
+// EventProgressed events.
+type progressReader struct {
+	r    io.Reader
+	d    *download
+	id   string
+	path string
+	n    int64
+	last time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if now := time.Now(); n > 0 && now.Sub(p.last) >= progressInterval || err == io.EOF {
+		p.last = now
+		p.d.emit(ProgressEvent{Kind: EventProgressed, ID: p.id, Path: p.path, Bytes: p.n})
+	}
+	return n, err
+}
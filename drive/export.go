@@ -0,0 +1,250 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+const (
+	folderMimeType   = "application/vnd.google-apps.folder"
+	shortcutMimeType = "application/vnd.google-apps.shortcut"
+	googleAppsPrefix = "application/vnd.google-apps."
+	drawingMimeType  = "application/vnd.google-apps.drawing"
+	sheetMimeType    = "application/vnd.google-apps.spreadsheet"
+)
+
+// exportFormat describes how a Google-native file is exported to a local file.
+type exportFormat struct {
+	MimeType  string // export MIME type passed to Files.Export
+	Extension string // extension appended to the document name
+	Tag       string // short type name used to disambiguate colliding names
+}
+
+// exportFormats maps Google-native MIME types to their export formats.
+var exportFormats = map[string]exportFormat{
+	"application/vnd.google-apps.document":     {"application/pdf", ".pdf", "gdoc"},
+	sheetMimeType:                              {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx", "gsheet"},
+	"application/vnd.google-apps.presentation": {"application/pdf", ".pdf", "gslides"},
+	drawingMimeType:                            {"image/png", ".png", "gdraw"},
+	// Apps Script projects are exported as a folder of source files.
+	scriptMimeType: {"application/vnd.google-apps.script+json", "", "gscript"},
+}
+
+// isGoogleDoc reports whether a file is a Google-native document that has to
+// be exported rather than downloaded.
+func isGoogleDoc(file *drivev3.File) bool {
+	return strings.HasPrefix(file.MimeType, googleAppsPrefix) &&
+		file.MimeType != folderMimeType && file.MimeType != shortcutMimeType
+}
+
+// DrawingFormat selects the format Google Drawings are exported in.
+type DrawingFormat int
+
+const (
+	// DrawingPNG exports drawings as PNG images.
+	DrawingPNG DrawingFormat = iota
+	// DrawingSVG exports drawings as SVG, which keeps them scalable.
+	DrawingSVG
+	// DrawingPDF exports drawings as PDF.
+	DrawingPDF
+	// DrawingJPEG exports drawings as JPEG images.
+	DrawingJPEG
+)
+
+// drawingFormats maps drawing formats to their export formats.
+var drawingFormats = map[DrawingFormat]exportFormat{
+	DrawingPNG:  {"image/png", ".png", "gdraw"},
+	DrawingSVG:  {"image/svg+xml", ".svg", "gdraw"},
+	DrawingPDF:  {"application/pdf", ".pdf", "gdraw"},
+	DrawingJPEG: {"image/jpeg", ".jpg", "gdraw"},
+}
+
+// ParseDrawingFormat parses a drawing format name ("png", "svg", "pdf" or
+// "jpeg").
+func ParseDrawingFormat(s string) (DrawingFormat, error) {
+	switch strings.ToLower(s) {
+	case "png", "":
+		return DrawingPNG, nil
+	case "svg":
+		return DrawingSVG, nil
+	case "pdf":
+		return DrawingPDF, nil
+	case "jpeg", "jpg":
+		return DrawingJPEG, nil
+	}
+	return 0, fmt.Errorf("unknown drawing format %q", s)
+}
+
+// SheetFormat selects the format Google Sheets are exported in.
+type SheetFormat int
+
+const (
+	// SheetXLSX exports spreadsheets as Excel workbooks.
+	SheetXLSX SheetFormat = iota
+	// SheetODS exports spreadsheets as OpenDocument spreadsheets.
+	SheetODS
+	// SheetPDF exports spreadsheets as PDF, laid out according to the
+	// client's PDF options.
+	SheetPDF
+)
+
+// sheetFormats maps spreadsheet formats to their export formats.
+var sheetFormats = map[SheetFormat]exportFormat{
+	SheetXLSX: {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx", "gsheet"},
+	SheetODS:  {"application/vnd.oasis.opendocument.spreadsheet", ".ods", "gsheet"},
+	SheetPDF:  {"application/pdf", ".pdf", "gsheet"},
+}
+
+// ParseSheetFormat parses a spreadsheet format name ("xlsx", "ods" or "pdf").
+func ParseSheetFormat(s string) (SheetFormat, error) {
+	switch strings.ToLower(s) {
+	case "xlsx", "":
+		return SheetXLSX, nil
+	case "ods":
+		return SheetODS, nil
+	case "pdf":
+		return SheetPDF, nil
+	}
+	return 0, fmt.Errorf("unknown sheet format %q", s)
+}
+
+// PDFOptions controls the page layout of spreadsheets exported as PDF. The
+// Drive API exports documents and presentations with the page setup saved in
+// them, so these options only apply to spreadsheets; the locale and time zone
+// used to format their values are likewise those of the spreadsheet.
+type PDFOptions struct {
+	// PaperSize is the paper size, e.g. PaperA4; empty keeps the default.
+	PaperSize PaperSize
+	// Landscape lays pages out in landscape rather than portrait.
+	Landscape bool
+	// HideGridlines leaves the cell gridlines out.
+	HideGridlines bool
+}
+
+// isZero reports whether o keeps every default.
+func (o PDFOptions) isZero() bool {
+	return o == PDFOptions{}
+}
+
+// query returns the export URL parameters applying o.
+func (o PDFOptions) query() url.Values {
+	params := url.Values{}
+	if o.PaperSize != "" {
+		params.Set("size", string(o.PaperSize))
+	}
+	if o.Landscape {
+		params.Set("portrait", "false")
+	}
+	if o.HideGridlines {
+		params.Set("gridlines", "false")
+	}
+	return params
+}
+
+// PaperSize is a paper size accepted by spreadsheet PDF exports.
+type PaperSize string
+
+// Paper sizes for PDF exports.
+const (
+	PaperLetter    PaperSize = "letter"
+	PaperLegal     PaperSize = "legal"
+	PaperTabloid   PaperSize = "tabloid"
+	PaperStatement PaperSize = "statement"
+	PaperExecutive PaperSize = "executive"
+	PaperFolio     PaperSize = "folio"
+	PaperA3        PaperSize = "A3"
+	PaperA4        PaperSize = "A4"
+	PaperA5        PaperSize = "A5"
+	PaperB4        PaperSize = "B4"
+	PaperB5        PaperSize = "B5"
+)
+
+// ParsePaperSize parses a paper size name such as "a4" or "letter".
+func ParsePaperSize(s string) (PaperSize, error) {
+	if s == "" {
+		return "", nil
+	}
+	for _, size := range []PaperSize{PaperLetter, PaperLegal, PaperTabloid, PaperStatement, PaperExecutive, PaperFolio, PaperA3, PaperA4, PaperA5, PaperB4, PaperB5} {
+		if strings.EqualFold(s, string(size)) {
+			return size, nil
+		}
+	}
+	return "", fmt.Errorf("unknown paper size %q", s)
+}
+
+// sheetExportURL is the export URL of a spreadsheet, formatted with its ID.
+// Unlike Files.Export, it accepts the page layout of PDF exports.
+const sheetExportURL = "https://docs.google.com/spreadsheets/d/%s/export"
+
+// An ExportResolver decides, file by file, what Google-native documents are
+// exported to; see Client.ExportResolver.
+type ExportResolver interface {
+	// ResolveExport returns the MIME type to export file to and the
+	// extension appended to its local name, or ok false to export it in the
+	// client's default format. Besides its name and type, file holds the ID
+	// of its folder in Parents. It must return the same answer whenever it
+	// is asked about the same file, as it is consulted both to name the file
+	// and to export it.
+	ResolveExport(file *drivev3.File) (mimeType, extension string, ok bool)
+}
+
+// ExportResolverFunc adapts a function to an ExportResolver.
+type ExportResolverFunc func(file *drivev3.File) (mimeType, extension string, ok bool)
+
+// ResolveExport implements ExportResolver.
+func (f ExportResolverFunc) ResolveExport(file *drivev3.File) (string, string, bool) {
+	return f(file)
+}
+
+// exportFormatFor returns the export format for a Google-native file: the
+// one chosen by the client's ExportResolver, if any, or else its default
+// format, falling back to PDF for types without an explicit mapping.
+// Drawings and spreadsheets are exported in the client's DrawingFormat and
+// SheetFormat by default. Apps Script projects are always exported as a
+// folder of source files.
+func (c *Client) exportFormatFor(file *drivev3.File) exportFormat {
+	format := c.defaultExportFormat(file)
+	if c.ExportResolver != nil && file.MimeType != scriptMimeType {
+		if mimeType, extension, ok := c.ExportResolver.ResolveExport(file); ok {
+			format.MimeType, format.Extension = mimeType, extension
+		}
+	}
+	return format
+}
+
+// defaultExportFormat returns the export format for a Google-native file
+// when no ExportResolver decides otherwise.
+func (c *Client) defaultExportFormat(file *drivev3.File) exportFormat {
+	if file.MimeType == drawingMimeType {
+		if format, ok := drawingFormats[c.DrawingFormat]; ok {
+			return format
+		}
+	}
+	if file.MimeType == sheetMimeType {
+		if format, ok := sheetFormats[c.SheetFormat]; ok {
+			return format
+		}
+	}
+	if format, ok := exportFormats[file.MimeType]; ok {
+		return format
+	}
+	return exportFormat{"application/pdf", ".pdf", "g" + strings.TrimPrefix(file.MimeType, googleAppsPrefix)}
+}
+
+// exportSheetPDF exports a spreadsheet as PDF through its export URL, which
+// applies the client's PDF options. The request goes through the client's
+// transport, so it is authenticated like those of the Drive API.
+func (c *Client) exportSheetPDF(ctx context.Context, file *drivev3.File) (io.ReadCloser, error) {
+	params := c.PDF.query()
+	params.Set("format", "pdf")
+	body, err := c.openPublic(ctx, fmt.Sprintf(sheetExportURL, url.PathEscape(file.Id))+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to export file: %w", err)
+	}
+	return body, nil
+}
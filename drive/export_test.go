@@ -0,0 +1,11 @@
+package drive
+
+import "time"
+
+// SetSharedTimings shortens the heartbeat, claim timeout and polling period
+// of shared jobs for a test, returning a function restoring them.
+func SetSharedTimings(heartbeat, timeout, poll time.Duration) (restore func()) {
+	saved := [3]time.Duration{claimHeartbeat, claimTimeout, sharedPollPeriod}
+	claimHeartbeat, claimTimeout, sharedPollPeriod = heartbeat, timeout, poll
+	return func() { claimHeartbeat, claimTimeout, sharedPollPeriod = saved[0], saved[1], saved[2] }
+}
@@ -0,0 +1,98 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Backoff of exports that Drive throttles: the delay doubles with every
+// throttled export, from exportBackoffMin up to exportBackoffMax, and is reset
+// by the next export that succeeds. A throttled export is tried exportAttempts
+// times in all.
+const (
+	exportBackoffMin = time.Second
+	exportBackoffMax = time.Minute
+	exportAttempts   = 6
+)
+
+// exportLimiter paces the exports of a client, which Drive throttles much
+// earlier than the downloads of binary files. It is separate from the limits
+// of downloads, so that backing off exports does not slow them down: every
+// export waits for the backoff of the last throttled one and, with an
+// ExportRate, for its turn.
+type exportLimiter struct {
+	mu    sync.Mutex
+	next  time.Time     // earliest start of the next export
+	delay time.Duration // backoff after the last throttled export, 0 if none
+}
+
+// wait waits until an export may start, at most interval after the previous
+// one.
+func (l *exportLimiter) wait(ctx context.Context, interval time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(interval)
+	l.mu.Unlock()
+	if d := start.Sub(now); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// throttled backs off every export after one was throttled, and returns how
+// long they wait.
+func (l *exportLimiter) throttled() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.delay = min(max(2*l.delay, exportBackoffMin), exportBackoffMax)
+	if until := time.Now().Add(l.delay); until.After(l.next) {
+		l.next = until
+	}
+	return l.delay
+}
+
+// succeeded resets the backoff once an export went through.
+func (l *exportLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.delay = 0
+}
+
+// throttledError reports whether a request failed because Drive rate limited
+// it.
+func throttledError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+			return true
+		}
+	}
+	return apiErr.Code == http.StatusTooManyRequests
+}
+
+// exportClass returns the transfer class of a file when exports are limited
+// by ExportConcurrency: the Google-native files that are exported form a
+// class of their own, after the client's Classes.
+func (c *Client) exportClass(file *drivev3.File) int {
+	if isGoogleDoc(file) {
+		return len(c.Classes)
+	}
+	return c.transferClass(file)
+}
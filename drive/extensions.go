@@ -0,0 +1,160 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// sniffLength is the number of bytes of a file read to detect its type.
+const sniffLength = 512
+
+// typeExtensions lists the extensions of common MIME types, the one appended
+// by FixExtensions first. It is fixed rather than read from the system so
+// that local names do not depend on the machine.
+var typeExtensions = map[string][]string{
+	"application/pdf":               {".pdf"},
+	"application/rtf":               {".rtf"},
+	"application/epub+zip":          {".epub"},
+	"application/json":              {".json"},
+	"application/xml":               {".xml"},
+	"application/zip":               {".zip"},
+	"application/x-zip-compressed":  {".zip"},
+	"application/gzip":              {".gz", ".tgz"},
+	"application/x-gzip":            {".gz", ".tgz"},
+	"application/x-tar":             {".tar"},
+	"application/x-7z-compressed":   {".7z"},
+	"application/vnd.rar":           {".rar"},
+	"application/x-rar-compressed":  {".rar"},
+	"application/postscript":        {".ps", ".eps", ".ai"},
+	"application/msword":            {".doc"},
+	"application/vnd.ms-excel":      {".xls"},
+	"application/vnd.ms-powerpoint": {".ppt"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {".docx"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {".xlsx"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {".pptx"},
+	"application/vnd.oasis.opendocument.text":                                   {".odt"},
+	"application/vnd.oasis.opendocument.spreadsheet":                            {".ods"},
+	"application/vnd.oasis.opendocument.presentation":                           {".odp"},
+	"text/plain":       {".txt"},
+	"text/csv":         {".csv"},
+	"text/html":        {".html", ".htm"},
+	"text/markdown":    {".md"},
+	"text/xml":         {".xml"},
+	"image/jpeg":       {".jpg", ".jpeg", ".jpe", ".jfif"},
+	"image/png":        {".png"},
+	"image/gif":        {".gif"},
+	"image/webp":       {".webp"},
+	"image/bmp":        {".bmp"},
+	"image/tiff":       {".tif", ".tiff"},
+	"image/heic":       {".heic"},
+	"image/heif":       {".heif"},
+	"image/svg+xml":    {".svg"},
+	"video/mp4":        {".mp4", ".m4v"},
+	"video/quicktime":  {".mov"},
+	"video/webm":       {".webm"},
+	"video/avi":        {".avi"},
+	"video/x-msvideo":  {".avi"},
+	"video/x-matroska": {".mkv"},
+	"audio/mpeg":       {".mp3"},
+	"audio/mp4":        {".m4a"},
+	"audio/wav":        {".wav"},
+	"audio/wave":       {".wav"},
+	"audio/x-wav":      {".wav"},
+	"audio/ogg":        {".ogg", ".oga"},
+	"audio/flac":       {".flac"},
+}
+
+// containerTypes are the MIME types that files of many other types are
+// reported with, such as logs, which are plain text, or DOCX files, which are
+// zip archives: only files of such a type named without any extension get
+// one.
+var containerTypes = map[string]bool{
+	"text/plain":                   true,
+	"application/xml":              true,
+	"text/xml":                     true,
+	"application/zip":              true,
+	"application/x-zip-compressed": true,
+}
+
+// knownExtension reports whether ext is the extension of one of the types of
+// typeExtensions.
+func knownExtension(ext string) bool {
+	for _, exts := range typeExtensions {
+		if slices.Contains(exts, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixExtension returns the name of a file with the extension of its type
+// appended if the client's FixExtensions is set and the name has no
+// extension, an unknown one, or that of another type, except for
+// containerTypes. The type is the MIME
+// type Drive reports or, if that is not one of typeExtensions and the
+// client's SniffExtensions is set, the type detected from the first bytes of
+// its content.
+func (c *Client) fixExtension(ctx context.Context, file *drivev3.File, name string) string {
+	if !c.FixExtensions || strings.HasPrefix(file.MimeType, googleAppsPrefix) {
+		return name
+	}
+	ext := strings.ToLower(path.Ext(name))
+	mimeType := file.MimeType
+	exts, ok := typeExtensions[mimeType]
+	if !ok && c.SniffExtensions && !knownExtension(ext) && file.Size > 0 {
+		mimeType = c.sniffType(ctx, file)
+		exts, ok = typeExtensions[mimeType]
+	}
+	if !ok || slices.Contains(exts, ext) || ext != "" && containerTypes[mimeType] {
+		return name
+	}
+	c.debugf(DebugWalker, "Appending %s to %s, of type %s", exts[0], name, mimeType)
+	return name + exts[0]
+}
+
+// sniffType returns the MIME type detected from the first bytes of the
+// content of a file, or an empty string if they cannot be read.
+func (c *Client) sniffType(ctx context.Context, file *drivev3.File) string {
+	var body io.ReadCloser
+	if c.anonymous() {
+		var err error
+		if body, err = c.downloadPublicFile(ctx, file.Id); err != nil {
+			c.debugf(DebugWalker, "Failed to sniff the type of %s: %v", file.Name, err)
+			return ""
+		}
+	} else {
+		call := c.Service.Files.Get(file.Id).Context(ctx)
+		call.Header().Set("Range", fmt.Sprintf("bytes=0-%d", sniffLength-1))
+		resp, err := call.Download()
+		if err != nil {
+			c.debugf(DebugWalker, "Failed to sniff the type of %s: %v", file.Name, err)
+			return ""
+		}
+		body = resp.Body
+	}
+	defer body.Close()
+	head, err := io.ReadAll(io.LimitReader(body, sniffLength))
+	if err != nil {
+		return ""
+	}
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return mimeType
+}
+
+// appendedExtension returns the extension FixExtensions appended to the name
+// of file to save it at relPath, if any.
+func appendedExtension(file *drivev3.File, relPath string) string {
+	ext := path.Ext(relPath)
+	if ext == "" || strings.HasSuffix(strings.ToLower(file.Name), strings.ToLower(ext)) {
+		return ""
+	}
+	return ext
+}
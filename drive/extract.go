@@ -0,0 +1,187 @@
+package drive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// archiveExtensions lists the extensions of the archives AutoExtract
+// extracts, longest first.
+var archiveExtensions = []string{".tar.gz", ".tgz", ".zip"}
+
+// archiveExtension returns the extension of relPath if it names an archive
+// AutoExtract extracts, or "".
+func archiveExtension(relPath string) string {
+	lower := strings.ToLower(relPath)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) && len(lower) > len(ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// extractDir returns the directory the archive at relPath is extracted to:
+// its path without the archive extension.
+func extractDir(relPath string) string {
+	return relPath[:len(relPath)-len(archiveExtension(relPath))]
+}
+
+// archiveEntryPath returns the path below the extraction directory of an
+// archive entry, and false for entries naming the directory itself. Names
+// climbing out of the directory with ".." are kept inside it.
+func archiveEntryPath(name string) (string, bool) {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+	return name, name != ""
+}
+
+// extractor extracts an archive being downloaded into the directory next to
+// it named by extractDir. Gzipped tarballs are extracted as they download;
+// zip archives, whose index is at their end, once downloaded.
+type extractor struct {
+	c       *Client
+	d       *download
+	relPath string
+	dir     string
+
+	pw   *io.PipeWriter // feeds the tarball being extracted, if any
+	done chan error     // result of the extraction of the tarball
+}
+
+// newExtractor returns the extractor of the file at relPath, or nil if it is
+// not to be extracted. Only archives downloaded to a directory without
+// compression or encryption are.
+func (c *Client) newExtractor(d *download, relPath string) *extractor {
+	if !c.AutoExtract || archiveExtension(relPath) == "" {
+		return nil
+	}
+	if root, ok := d.sink.(dirSink); !ok || root.transforms() {
+		return nil
+	}
+	return &extractor{c: c, d: d, relPath: relPath, dir: extractDir(relPath)}
+}
+
+// reader returns the reader to save the archive from instead of body; a
+// tarball is extracted from what is read from it.
+func (x *extractor) reader(body io.Reader) io.Reader {
+	if archiveExtension(x.relPath) == ".zip" {
+		return body
+	}
+	pr, pw := io.Pipe()
+	x.pw, x.done = pw, make(chan error, 1)
+	go func() {
+		err := x.extractTar(pr)
+		// Whatever the extraction left unread must still be consumed for
+		// the download to complete.
+		io.Copy(io.Discard, pr)
+		x.done <- err
+	}()
+	return io.TeeReader(body, pw)
+}
+
+// finish completes the extraction once the archive was saved, or abandons
+// it if saving failed with saveErr.
+func (x *extractor) finish(saveErr error) error {
+	if x.pw != nil {
+		x.pw.CloseWithError(saveErr)
+		if err := <-x.done; err != nil && saveErr == nil {
+			return fmt.Errorf("failed to extract %s: %w", x.relPath, err)
+		}
+		if saveErr == nil {
+			x.c.logf("Extracted %s to %s", x.relPath, x.dir)
+		}
+		return nil
+	}
+	if saveErr != nil {
+		return nil
+	}
+	if err := x.extractZip(); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", x.relPath, err)
+	}
+	x.c.logf("Extracted %s to %s", x.relPath, x.dir)
+	return nil
+}
+
+// extractTar extracts a gzipped tarball read from r. Links and special
+// files are skipped.
+func (x *extractor) extractTar(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := archiveEntryPath(header.Name)
+		if !ok {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := x.d.sink.Mkdir(path.Join(x.dir, name)); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if _, _, err := x.d.sink.Save(path.Join(x.dir, name), header.ModTime, archive); err != nil {
+				return err
+			}
+		default:
+			x.c.debugf(DebugDownloader, "Not extracting %s from %s: not a regular file", header.Name, x.relPath)
+		}
+	}
+}
+
+// extractZip extracts the downloaded zip archive.
+func (x *extractor) extractZip() error {
+	archive, err := zip.OpenReader(filepath.Join(x.d.root, filepath.FromSlash(x.relPath)))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	for _, entry := range archive.File {
+		name, ok := archiveEntryPath(entry.Name)
+		if !ok {
+			continue
+		}
+		if entry.FileInfo().IsDir() {
+			if err := x.d.sink.Mkdir(path.Join(x.dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			x.c.debugf(DebugDownloader, "Not extracting %s from %s: not a regular file", entry.Name, x.relPath)
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		_, _, err = x.d.sink.Save(path.Join(x.dir, name), entry.Modified, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard deletes the extracted archive.
+func (x *extractor) discard() {
+	if err := os.Remove(filepath.Join(x.d.root, filepath.FromSlash(x.relPath))); err != nil {
+		x.c.logf("Failed to delete extracted archive %s: %v", x.relPath, err)
+	}
+}
@@ -0,0 +1,146 @@
+package drive
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"syscall"
+
+	"google.golang.org/api/googleapi"
+)
+
+// FailureCause is the broad cause of a failure, which decides how it can be
+// remedied.
+type FailureCause int
+
+const (
+	// CauseOther covers failures of any other cause, such as dropped
+	// connections or checksum mismatches.
+	CauseOther FailureCause = iota
+	// CausePermission is a file or folder the credentials cannot access.
+	CausePermission
+	// CauseQuota is a request refused because a rate limit or quota of the
+	// Drive API was exceeded.
+	CauseQuota
+	// CauseExportTooLarge is a Google document too large for Drive to
+	// export.
+	CauseExportTooLarge
+	// CauseAbusive is a file Google flagged as malware or spam.
+	CauseAbusive
+	// CauseNotDownloadable is a file Drive refuses to download.
+	CauseNotDownloadable
+	// CauseSuspended is a file whose owner's account is suspended.
+	CauseSuspended
+	// CauseDisk is a file that could not be written locally, for instance
+	// because the disk is full.
+	CauseDisk
+)
+
+// failureCauses describes every cause, in the order failures are summarized.
+var failureCauses = []struct {
+	cause  FailureCause
+	title  string
+	remedy string
+}{
+	{CausePermission, "Permission denied",
+		"Share the folder or these files with the account the tool uses (see the info subcommand), or use the credentials of a user who can open them."},
+	{CauseQuota, "Drive API quota exceeded",
+		"Run the download again later; only the failed files are downloaded again. Lowering -concurrency, or giving each pipeline its own -quota-user, keeps within the rate limits. Files downloaded too often in 24 hours stay unavailable until then."},
+	{CauseExportTooLarge, "Documents too large to export",
+		"Drive exports documents of up to 10 MB only; spreadsheets are saved as CSV files, one per tab, instead, which only fails if the Sheets API cannot read them either. Export the others from the Drive web interface, or choose a more compact format with -drawing-format."},
+	{CauseAbusive, "Files flagged by Google as malware or spam",
+		"Review them in Drive; if you trust them, run again with -acknowledge-abuse, which Drive only permits to some users, such as their owner."},
+	{CauseNotDownloadable, "Files Drive does not allow to be downloaded",
+		"Open them in Drive to see why; their owner may be able to download them or to convert them to a downloadable file."},
+	{CauseSuspended, "Files owned by suspended accounts",
+		"Ask a Workspace administrator to restore the accounts or to transfer their files, or pass -skip-suspended to skip them without failing."},
+	{CauseDisk, "Local write errors",
+		"Free up space on the destination disk or fix the permissions of the destination directory, then run the download again."},
+	{CauseOther, "Other failures",
+		"Run the download again to retry them; -v and -vv log the details of every request."},
+}
+
+// String returns the title of the cause.
+func (cause FailureCause) String() string {
+	for _, c := range failureCauses {
+		if c.cause == cause {
+			return c.title
+		}
+	}
+	return "Unknown cause"
+}
+
+// Remedy returns the steps suggested to solve failures of the cause.
+func (cause FailureCause) Remedy() string {
+	for _, c := range failureCauses {
+		if c.cause == cause {
+			return c.remedy
+		}
+	}
+	return ""
+}
+
+// Cause classifies the failure by its error.
+func (f Failure) Cause() FailureCause {
+	err := f.Err
+	switch {
+	case errors.Is(err, ErrOwnerSuspended) || ownerSuspended(err):
+		return CauseSuspended
+	case errors.Is(err, ErrAbusiveFile):
+		return CauseAbusive
+	case errors.Is(err, ErrNotDownloadable):
+		return CauseNotDownloadable
+	case apiErrorReason(err, "exportSizeLimitExceeded"):
+		return CauseExportTooLarge
+	case errors.Is(err, syscall.ENOSPC):
+		return CauseDisk
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return CauseDisk
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return CauseOther
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "dailyLimitExceeded", "quotaExceeded", "downloadQuotaExceeded", "sharingRateLimitExceeded":
+			return CauseQuota
+		case "insufficientPermissions", "insufficientFilePermissions", "appNotAuthorizedToFile", "forbidden", "notFound", "authError":
+			return CausePermission
+		}
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests:
+		return CauseQuota
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return CausePermission
+	}
+	return CauseOther
+}
+
+// summarizeFailures logs the failures of a download grouped by cause, each
+// group followed by the steps suggested to remedy it.
+func (c *Client) summarizeFailures(failures []Failure) {
+	if len(failures) == 0 {
+		return
+	}
+	groups := make(map[FailureCause][]Failure)
+	for _, failure := range failures {
+		cause := failure.Cause()
+		groups[cause] = append(groups[cause], failure)
+	}
+	c.logf("%d file(s) failed:", len(failures))
+	for _, cause := range failureCauses {
+		group := groups[cause.cause]
+		if len(group) == 0 {
+			continue
+		}
+		c.logf("%s (%d):", cause.title, len(group))
+		for _, failure := range group {
+			c.logf("  %s", failure.Path)
+		}
+		c.logf("  What to do: %s", cause.remedy)
+	}
+}
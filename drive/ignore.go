@@ -0,0 +1,30 @@
+package drive
+
+import (
+	"fmt"
+	"os"
+)
+
+// IgnoreName is the name of the ignore file that downloads read from the root
+// of the download directory. It lists the paths below the downloaded folder
+// that are never downloaded, one pattern per line, in the syntax of a
+// gitignore file and of a sparse specification (see Sparse): "*.tmp" ignores
+// files so named in any folder, "Archive/" or "Projects/Old" a folder and
+// everything in it, and a pattern starting with "!" downloads paths an
+// earlier pattern ignored, except in an ignored folder, which is not listed.
+// Unlike Filter, the file keeps its exclusions with the destination.
+const IgnoreName = ".driveignore"
+
+// loadIgnore reads the patterns of an ignore file.
+func loadIgnore(path string) ([]pathPattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreName, err)
+	}
+	defer f.Close()
+	patterns, err := parsePathPatterns(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", IgnoreName, err)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,93 @@
+package drive
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// AssetsDir is the directory, next to exported documents, that the images
+// embedded in them are extracted to when ExtractImages is set.
+const AssetsDir = "assets"
+
+// imageSources maps the MIME types of documents whose embedded images can be
+// extracted to the Office format they are exported in for that, and the
+// directory of that format's archive holding the images.
+var imageSources = map[string]struct {
+	format   exportFormat
+	mediaDir string
+}{
+	"application/vnd.google-apps.document": {
+		exportFormat{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx", "gdoc"},
+		"word/media/",
+	},
+	"application/vnd.google-apps.presentation": {
+		exportFormat{"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx", "gslides"},
+		"ppt/media/",
+	},
+}
+
+// extractImages saves the images embedded in a Google Doc or Slides deck
+// exported to relPath, at their original resolution, in AssetsDir/NAME next
+// to it, NAME being the document's local name without extension. Exports
+// such as PDF flatten and recompress images; the Office export keeps them
+// as they were inserted, so the document is exported a second time in that
+// format and its media unzipped.
+func (c *Client) extractImages(ctx context.Context, d *download, file *drivev3.File, relPath string, modTime time.Time) error {
+	source, ok := imageSources[file.MimeType]
+	if !ok {
+		return nil
+	}
+	body, err := c.exportFile(ctx, file, source.format)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Zip archives are read from the end, so the export is spooled to disk.
+	tmp, err := os.CreateTemp("", "drive-downloader-*"+source.format.Extension)
+	if err != nil {
+		return fmt.Errorf("failed to extract images: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return fmt.Errorf("failed to export file: %w", err)
+	}
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract images: %w", err)
+	}
+
+	base := path.Base(relPath)
+	dir := path.Join(path.Dir(relPath), AssetsDir, strings.TrimSuffix(base, path.Ext(base)))
+	extracted := 0
+	for _, entry := range archive.File {
+		name := path.Base(entry.Name)
+		if !strings.HasPrefix(entry.Name, source.mediaDir) || entry.FileInfo().IsDir() || name == "." || name == ".." {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("failed to extract images: %w", err)
+		}
+		_, _, err = d.sink.Save(path.Join(dir, name), modTime, r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to extract images: %w", err)
+		}
+		extracted++
+	}
+	if extracted > 0 {
+		c.debugf(DebugDownloader, "Extracted %d image(s) from %s", extracted, relPath)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// aboutFields lists the About fields reported by the info subcommand.
+const aboutFields = "user(displayName, emailAddress), storageQuota, maxUploadSize, maxImportSizes"
+
+// About returns the identity the client is authenticated as together with
+// its storage quota and transfer limits.
+func (c *Client) About(ctx context.Context) (*drivev3.About, error) {
+	if c.anonymous() {
+		return nil, ErrAnonymous
+	}
+	about, err := c.Service.About.Get().Fields(aboutFields).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve account information: %w", err)
+	}
+	return about, nil
+}
+
+// FolderName returns the local name of a Drive folder: its name on Drive,
+// normalized like the names of downloaded files, with path separators
+// replaced so that it is a single path element, or its ID if the name is not
+// usable, such as a blank name.
+func (c *Client) FolderName(ctx context.Context, folderID string) (string, error) {
+	var name string
+	if c.anonymous() {
+		var err error
+		if name, err = c.publicFolderName(ctx, folderID); err != nil {
+			return "", err
+		}
+	} else {
+		folder, err := c.Service.Files.Get(folderID).Fields("name").Context(ctx).Do()
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve folder: %w", err)
+		}
+		name = folder.Name
+	}
+	name = strings.NewReplacer("/", "_", `\`, "_").Replace(c.normalizeName(name))
+	if usable, ok := usableName(name, folderID); !ok {
+		c.logf("Naming folder %q after its ID %s: the name is not usable as a local file name", name, folderID)
+		name = usable
+	}
+	return name, nil
+}
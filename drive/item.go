@@ -0,0 +1,48 @@
+package drive
+
+import (
+	"path"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// DriveItem is a file or folder found below the root of a walk, with its
+// place in the tree.
+type DriveItem struct {
+	ID       string
+	Name     string // local name, disambiguated and normalized
+	Path     string // slash-separated local path relative to the root
+	Depth    int    // number of folders between the root and the item
+	Parents  []string
+	Size     int64
+	MD5      string
+	MimeType string
+	// CaseClash is the name of the item in the same folder that the name
+	// of this one differed from only in case or Unicode normalization, if
+	// it was renamed because of it; see Client.CaseInsensitive.
+	CaseClash string
+
+	// File is the Drive metadata of the item.
+	File *drivev3.File
+}
+
+// newDriveItem describes a file named name in the folder at dirPath, whose
+// chain of folder IDs from the root is parents.
+func newDriveItem(file *drivev3.File, name, dirPath string, parents []string) DriveItem {
+	return DriveItem{
+		ID:       file.Id,
+		Name:     name,
+		Path:     path.Join(dirPath, name),
+		Depth:    len(parents) - 1,
+		Parents:  parents,
+		Size:     file.Size,
+		MD5:      file.Md5Checksum,
+		MimeType: file.MimeType,
+		File:     file,
+	}
+}
+
+// IsFolder reports whether the item is a folder.
+func (item DriveItem) IsFolder() bool {
+	return item.MimeType == folderMimeType
+}
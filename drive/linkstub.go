@@ -0,0 +1,106 @@
+package drive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// LinkStubs selects whether Google-native documents are saved as link stubs:
+// the small JSON files, such as Notes.gdoc, that Google Drive for desktop
+// writes in place of native documents and opens them in the browser.
+type LinkStubs int
+
+const (
+	// LinkStubsNone writes no link stubs.
+	LinkStubsNone LinkStubs = iota
+	// LinkStubsAlongside writes a link stub next to every exported document.
+	LinkStubsAlongside
+	// LinkStubsOnly writes a link stub instead of exporting documents.
+	LinkStubsOnly
+)
+
+// linkStubWarning is the warning Drive for desktop puts at the top of its
+// link stubs.
+const linkStubWarning = "WARNING! DO NOT EDIT THIS FILE! ANY CHANGES MADE WILL BE LOST!"
+
+// ParseLinkStubs parses a link stub mode name ("none", "alongside" or
+// "only"); an empty name selects LinkStubsNone.
+func ParseLinkStubs(s string) (LinkStubs, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return LinkStubsNone, nil
+	case "alongside":
+		return LinkStubsAlongside, nil
+	case "only":
+		return LinkStubsOnly, nil
+	}
+	return 0, fmt.Errorf("unknown link stub mode %q", s)
+}
+
+// linkStubExtension returns the extension of the link stub of a document
+// exported in format, such as ".gdoc" or ".gsheet".
+func linkStubExtension(format exportFormat) string {
+	return "." + format.Tag
+}
+
+// linkStubTag returns the extension, without its dot, of the link stubs of
+// Google-native documents of mimeType, whatever format they are exported in.
+func linkStubTag(mimeType string) string {
+	if format, ok := exportFormats[mimeType]; ok {
+		return format.Tag
+	}
+	return "g" + strings.TrimPrefix(mimeType, googleAppsPrefix)
+}
+
+// linkStubPath returns the path of the link stub written next to a document
+// exported to relPath in format: its path with the export extension
+// replaced, e.g. Notes.gdoc next to Notes.pdf.
+func linkStubPath(relPath string, format exportFormat) string {
+	return strings.TrimSuffix(relPath, format.Extension) + linkStubExtension(format)
+}
+
+// writeLinkStub saves the link stub of a Google-native document at relPath.
+// Drive for desktop reads doc_id and resource_key from it; url and email are
+// those of the older Backup and Sync stubs, which other tools still read.
+func (c *Client) writeLinkStub(d *download, file *drivev3.File, relPath string, modTime time.Time) (int64, string, error) {
+	stub := map[string]string{
+		"":             linkStubWarning,
+		"url":          "https://drive.google.com/open?id=" + file.Id,
+		"doc_id":       file.Id,
+		"resource_key": file.ResourceKey,
+		"email":        "",
+	}
+	if len(file.Owners) > 0 {
+		stub["email"] = file.Owners[0].EmailAddress
+	}
+	data, err := json.Marshal(stub)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to encode link stub: %w", err)
+	}
+	size, sum, err := d.sink.Save(relPath, modTime, bytes.NewReader(data))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to write link stub: %w", err)
+	}
+	return size, sum, nil
+}
+
+// fetchLinkStub saves a link stub in place of a Google-native document when
+// LinkStubs is LinkStubsOnly, and records it in the manifest.
+func (c *Client) fetchLinkStub(d *download, file *drivev3.File, entry ManifestEntry) error {
+	c.logf("Writing link stub: %s", entry.Path)
+	modTime, _ := time.Parse(time.RFC3339, file.ModifiedTime)
+	var err error
+	if entry.Size, entry.MD5, err = c.writeLinkStub(d, file, entry.Path, modTime); err != nil {
+		return err
+	}
+	if root, ok := d.sink.(dirSink); ok {
+		root.record(&entry)
+	}
+	c.Stats.addFile(entry.Size)
+	return c.checkFile(d, entry, file)
+}
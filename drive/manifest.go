@@ -0,0 +1,188 @@
+package drive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ManifestName is the name of the manifest written to the root of every
+// download directory.
+const ManifestName = ".drive-manifest.json"
+
+// ManifestEntry records a file written by a download.
+type ManifestEntry struct {
+	ID             string `json:"id"`
+	Path           string `json:"path"` // slash-separated, relative to the download directory
+	MimeType       string `json:"mimeType"`
+	ExportMimeType string `json:"exportMimeType,omitempty"`
+	ModifiedTime   string `json:"modifiedTime,omitempty"`
+	Size           int64  `json:"size"` // local size in bytes
+	MD5            string `json:"md5"`  // local MD5 checksum
+	// SHA256 is the local SHA-256 checksum, recorded for the files that
+	// Drive reports a sha256Checksum for.
+	SHA256 string `json:"sha256,omitempty"`
+	// Checksum names the checksum reported by Drive that the file was
+	// verified against, ChecksumSHA256 or ChecksumMD5, and is empty if Drive
+	// reported none, as for Google documents.
+	Checksum string `json:"checksum,omitempty"`
+	// Discarded is set for archives that were deleted once extracted; see
+	// Client.DiscardArchives.
+	Discarded bool `json:"discarded,omitempty"`
+	// StoredPath is the slash-separated path of the local copy of files
+	// downloaded with Client.Compression or Client.Encryption, named with
+	// their extensions; Size and MD5 are then those of the original content.
+	StoredPath string `json:"storedPath,omitempty"`
+	// Compression names the compression of the local copy, "gzip" or
+	// "zstd", if it is compressed.
+	Compression string `json:"compression,omitempty"`
+	// Encrypted is set if the local copy is encrypted.
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Extension is the extension Client.FixExtensions appended to the name
+	// of the file on Drive to name its local copy.
+	Extension string `json:"extension,omitempty"`
+	// Object is the SHA-256 checksum naming the object of files downloaded
+	// with LayoutCAS.
+	Object string `json:"object,omitempty"`
+	// Revision identifies the head revision of the file when it was
+	// downloaded: its headRevisionId, or for Google documents the ID and
+	// modification time of their latest revision. A file modified since
+	// with the same revision only changed metadata, such as its name.
+	Revision string `json:"revision,omitempty"`
+}
+
+// Manifest lists every file written by a download so that the local copy can
+// later be verified and repaired.
+type Manifest struct {
+	FolderID string          `json:"folderId"`
+	Files    []ManifestEntry `json:"files"`
+	// ShortNames maps the IDs of the files and folders whose local names
+	// were shortened to fit MaxPathLength to their shortened names.
+	ShortNames map[string]string `json:"shortNames,omitempty"`
+
+	index map[string]int // position of each file ID in Files
+}
+
+// LoadManifest reads a manifest from path.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to path, replacing any previous manifest atomically.
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Put adds an entry to the manifest, replacing any entry for the same file.
+func (m *Manifest) Put(entry ManifestEntry) {
+	m.buildIndex()
+	if i, ok := m.index[entry.ID]; ok {
+		m.Files[i] = entry
+		return
+	}
+	m.index[entry.ID] = len(m.Files)
+	m.Files = append(m.Files, entry)
+}
+
+// Lookup returns the entry recorded for a file ID. It is safe to call on a
+// nil manifest.
+func (m *Manifest) Lookup(id string) (ManifestEntry, bool) {
+	if m == nil {
+		return ManifestEntry{}, false
+	}
+	m.buildIndex()
+	i, ok := m.index[id]
+	if !ok {
+		return ManifestEntry{}, false
+	}
+	return m.Files[i], true
+}
+
+// buildIndex indexes the entries by file ID on first use.
+func (m *Manifest) buildIndex() {
+	if m.index != nil {
+		return
+	}
+	m.index = make(map[string]int, len(m.Files))
+	for i, f := range m.Files {
+		m.index[f.ID] = i
+	}
+}
+
+// Verify checks that the local copy of entry below root still has the size
+// and MD5 checksum recorded in the manifest, and its SHA-256 checksum if one
+// was recorded. Apps Script projects and spreadsheets saved as CSV files,
+// which are folders, are only checked for existence, and so are the
+// directories that discarded archives were extracted to and encrypted files,
+// which cannot be hashed without decrypting them. Compressed files are
+// decompressed to be checked, and files downloaded with LayoutCAS are
+// checked through their objects.
+func (entry ManifestEntry) Verify(root string) error {
+	if entry.Encrypted {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(entry.StoredPath)))
+		return err
+	}
+	if entry.MimeType == scriptMimeType || entry.ExportMimeType == csvTabsMimeType {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(entry.Path)))
+		if errors.Is(err, fs.ErrNotExist) {
+			// With LayoutCAS, their files are only listed in the tree.
+			if tree, treeErr := LoadObjectTree(filepath.Join(root, TreeName)); treeErr == nil && tree.Below(entry.Path) {
+				return nil
+			}
+		}
+		return err
+	}
+	if entry.Discarded {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(extractDir(entry.Path))))
+		return err
+	}
+	var n int64
+	var sum, sha string
+	var err error
+	if entry.Object != "" {
+		n, sum, sha, err = hashFileSHA256(filepath.Join(root, ObjectsDir, entry.Object))
+	} else if entry.Compression != "" {
+		// The SHA-256 checksum is not checked.
+		n, sum, err = hashCompressed(filepath.Join(root, filepath.FromSlash(entry.StoredPath)), entry.Compression)
+		sha = entry.SHA256
+	} else if entry.SHA256 != "" {
+		n, sum, sha, err = hashFileSHA256(filepath.Join(root, filepath.FromSlash(entry.Path)))
+	} else {
+		n, sum, err = hashFile(filepath.Join(root, filepath.FromSlash(entry.Path)))
+	}
+	if err != nil {
+		return err
+	}
+	if n != entry.Size {
+		return fmt.Errorf("size is %d bytes, expected %d", n, entry.Size)
+	}
+	if entry.SHA256 != "" && sha != entry.SHA256 {
+		return fmt.Errorf("sha256 is %s, expected %s", sha, entry.SHA256)
+	}
+	if sum != entry.MD5 {
+		return fmt.Errorf("md5 is %s, expected %s", sum, entry.MD5)
+	}
+	return nil
+}
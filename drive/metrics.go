@@ -0,0 +1,128 @@
+package drive
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// metricsInterval is how often a row is added to the metrics CSV.
+const metricsInterval = 10 * time.Second
+
+// metricsColumns are the columns of the metrics CSV.
+var metricsColumns = []string{"time", "elapsedSeconds", "bytesReceived", "bytesPerSecond", "filesDone", "activeWorkers", "queueDepth", "apiRequests", "apiErrors"}
+
+// metricsWriter appends the performance of a download to a CSV file every
+// metricsInterval. A nil *metricsWriter records nothing.
+type metricsWriter struct {
+	c      *Client
+	queue  *jobQueue
+	active atomic.Int64 // files being downloaded
+
+	file    *os.File
+	csv     *csv.Writer
+	start   time.Time
+	last    time.Time
+	lastRcv int64
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newMetrics starts recording the metrics of a download whose files are
+// queued in queue to the client's MetricsCSV, or returns nil if it has none.
+// Rows are appended, so that repeated downloads add to the same series.
+func (c *Client) newMetrics(queue *jobQueue) (*metricsWriter, error) {
+	if c.MetricsCSV == "" || c.Stats == nil {
+		return nil, nil
+	}
+	f, err := os.OpenFile(c.MetricsCSV, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metrics file: %w", err)
+	}
+	m := &metricsWriter{
+		c:       c,
+		queue:   queue,
+		file:    f,
+		csv:     csv.NewWriter(f),
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	m.last, m.lastRcv = m.start, c.Stats.Received()
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		m.csv.Write(metricsColumns)
+	}
+	go func() {
+		defer close(m.stopped)
+		ticker := time.NewTicker(metricsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				if err := m.record(); err != nil {
+					c.logf("Failed to write metrics: %v", err)
+				}
+			}
+		}
+	}()
+	return m, nil
+}
+
+// started records that a worker started downloading a file.
+func (m *metricsWriter) started() {
+	if m != nil {
+		m.active.Add(1)
+	}
+}
+
+// finished records that a worker finished downloading a file.
+func (m *metricsWriter) finished() {
+	if m != nil {
+		m.active.Add(-1)
+	}
+}
+
+// record appends a row with the metrics of the interval ending now.
+func (m *metricsWriter) record() error {
+	now := time.Now()
+	stats := m.c.Stats
+	received := stats.Received()
+	rate := 0.0
+	if elapsed := now.Sub(m.last).Seconds(); elapsed > 0 {
+		rate = float64(received-m.lastRcv) / elapsed
+	}
+	m.last, m.lastRcv = now, received
+	m.csv.Write([]string{
+		now.UTC().Format(time.RFC3339),
+		strconv.FormatFloat(now.Sub(m.start).Seconds(), 'f', 1, 64),
+		strconv.FormatInt(received, 10),
+		strconv.FormatFloat(rate, 'f', 0, 64),
+		strconv.FormatInt(stats.Files(), 10),
+		strconv.FormatInt(m.active.Load(), 10),
+		strconv.Itoa(m.queue.Len()),
+		strconv.FormatInt(stats.Total(), 10),
+		strconv.FormatInt(stats.Errors(), 10),
+	})
+	m.csv.Flush()
+	return m.csv.Error()
+}
+
+// close records a last row and closes the metrics file.
+func (m *metricsWriter) close() error {
+	if m == nil {
+		return nil
+	}
+	close(m.stop)
+	<-m.stopped
+	err := m.record()
+	if closeErr := m.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// DuplicatePolicy controls how colliding local file names are disambiguated.
+type DuplicatePolicy int
+
+const (
+	// DuplicateSuffix appends a readable suffix such as " (gdoc)" or " (2)".
+	DuplicateSuffix DuplicatePolicy = iota
+	// DuplicateFileID appends the Drive file ID.
+	DuplicateFileID
+)
+
+// ParseDuplicatePolicy parses a policy name ("suffix" or "id").
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch s {
+	case "suffix":
+		return DuplicateSuffix, nil
+	case "id":
+		return DuplicateFileID, nil
+	}
+	return 0, fmt.Errorf("unknown duplicate policy %q", s)
+}
+
+// Normalization selects the Unicode normalization form applied to local names.
+type Normalization int
+
+const (
+	// NormalizeNone keeps names exactly as reported by Drive.
+	NormalizeNone Normalization = iota
+	// NormalizeNFC converts names to precomposed form (Linux, Windows).
+	NormalizeNFC
+	// NormalizeNFD converts names to decomposed form (macOS HFS+).
+	NormalizeNFD
+)
+
+// ParseNormalization parses a normalization name ("none", "nfc" or "nfd").
+func ParseNormalization(s string) (Normalization, error) {
+	switch strings.ToLower(s) {
+	case "none", "":
+		return NormalizeNone, nil
+	case "nfc":
+		return NormalizeNFC, nil
+	case "nfd":
+		return NormalizeNFD, nil
+	}
+	return 0, fmt.Errorf("unknown normalization %q", s)
+}
+
+// DefaultCaseInsensitive reports whether the default filesystem of the
+// current platform treats names that differ only in case (or Unicode
+// normalization) as the same file.
+func DefaultCaseInsensitive() bool {
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// normalizeName applies the client's Unicode normalization to a name.
+func (c *Client) normalizeName(name string) string {
+	switch c.Normalization {
+	case NormalizeNFC:
+		return norm.NFC.String(name)
+	case NormalizeNFD:
+		return norm.NFD.String(name)
+	}
+	return name
+}
+
+// nameKey returns the key under which the destination filesystem considers
+// two names equal.
+func (c *Client) nameKey(name string) string {
+	if c.CaseInsensitive {
+		return cases.Fold().String(norm.NFC.String(name))
+	}
+	return name
+}
+
+// folderNames assigns a unique local file name to every file of a folder as
+// its listing is streamed in. Regular files claim their names first so that
+// an exported Google document never overwrites a real file with the same name
+// (e.g. a Doc called "Report" next to "Report.pdf"): documents are only named
+// by flush, once the whole folder has been listed. Colliding names are
+// disambiguated according to the client's duplicate policy. Names are
+// compared the way the destination filesystem compares them, so "Report.PDF"
+// and "report.pdf" collide when CaseInsensitive is set; such collisions, which
+// would go unnoticed on Drive, are recorded for the final report.
+//
+// Only the names in use and the documents awaiting a name are held in memory,
+// not the folder's listing.
+type folderNames struct {
+	c       *Client
+	used    map[string]string // names in use by their key
+	docs    []*drivev3.File
+	clashes map[string]string // names clashed with by the ID of the renamed file
+}
+
+// namedFile is a file together with its local name.
+type namedFile struct {
+	file *drivev3.File
+	name string
+}
+
+// newFolderNames starts naming the files of a folder.
+func (c *Client) newFolderNames() *folderNames {
+	return &folderNames{c: c, used: make(map[string]string)}
+}
+
+// add names a regular file, or defers a Google document until flush, in
+// which case it returns false.
+func (n *folderNames) add(ctx context.Context, file *drivev3.File) (string, bool) {
+	if isGoogleDoc(file) {
+		n.docs = append(n.docs, file)
+		return "", false
+	}
+	return n.claim(file, n.c.fixExtension(ctx, file, n.c.fileName(file)), ""), true
+}
+
+// flush names the Google documents deferred by add.
+func (n *folderNames) flush() []namedFile {
+	named := make([]namedFile, 0, len(n.docs))
+	for _, file := range n.docs {
+		format := n.c.exportFormatFor(file)
+		ext := format.Extension
+		if n.c.LinkStubs == LinkStubsOnly {
+			ext = linkStubExtension(format)
+		}
+		named = append(named, namedFile{file: file, name: n.claim(file, n.c.fileName(file)+ext, format.Tag)})
+	}
+	n.docs = nil
+	return named
+}
+
+// fileName returns the name a file is saved under, before its extension and
+// any disambiguation: its name on Drive or, if that name is not usable
+// locally, its ID, the substitution being logged.
+func (c *Client) fileName(file *drivev3.File) string {
+	name, ok := usableName(file.Name, file.Id)
+	if !ok {
+		c.logf("Naming %q after its ID %s: the name is not usable as a local file name", file.Name, file.Id)
+	}
+	return name
+}
+
+// usableName returns name, and true, if it is usable as a local file name,
+// or else id. Path separators are replaced with underscores, so that a name
+// such as "../x" cannot reach outside its folder. Names that are empty, only
+// whitespace or only dots are not usable: "." and ".." name a folder and its
+// parent, and Windows strips trailing dots and spaces, leaving an empty name.
+func usableName(name, id string) (string, bool) {
+	name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+	if strings.TrimFunc(name, func(r rune) bool { return r == '.' || unicode.IsSpace(r) }) == "" {
+		return id, false
+	}
+	return name, true
+}
+
+// claim reserves name for file, disambiguating it if it is already used.
+func (n *folderNames) claim(file *drivev3.File, name, tag string) string {
+	c := n.c
+	name = c.normalizeName(name)
+	if other, ok := n.used[c.nameKey(name)]; ok {
+		renamed := c.disambiguate(file, name, tag, n.used)
+		c.logf("Renaming %q to %q to avoid a name collision", name, renamed)
+		if other != name {
+			// The names differ only in case or normalization.
+			if n.clashes == nil {
+				n.clashes = make(map[string]string)
+			}
+			n.clashes[file.Id] = other
+		}
+		name = renamed
+	}
+	n.used[c.nameKey(name)] = name
+	return name
+}
+
+// clash returns the name in use that the name of the file with the given ID
+// differed from only in case or Unicode normalization, if it was renamed
+// because of it.
+func (n *folderNames) clash(id string) string {
+	return n.clashes[id]
+}
+
+// reportCaseClashes lists the items renamed because their names differed
+// from others in the same folder only in case or Unicode normalization, which
+// Drive tells apart but the destination does not.
+func (c *Client) reportCaseClashes(items []DriveItem) {
+	if len(items) == 0 {
+		return
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	c.logf("Names differing only in case from another in the same folder (%d):", len(items))
+	for _, item := range items {
+		c.logf("  %s (%q on Drive, next to %q)", item.Path, item.File.Name, item.CaseClash)
+	}
+}
+
+// disambiguate returns a variant of name that is not yet used.
+func (c *Client) disambiguate(file *drivev3.File, name, tag string, used map[string]string) string {
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name, ext = name[:i], name[i:]
+	}
+
+	var candidate string
+	if c.Duplicates == DuplicateFileID {
+		candidate = fmt.Sprintf("%s (%s)%s", name, file.Id, ext)
+	} else if tag != "" {
+		candidate = fmt.Sprintf("%s (%s)%s", name, tag, ext)
+	}
+	for n := 2; candidate == "" || used[c.nameKey(candidate)] != ""; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", name, n, ext)
+	}
+	return candidate
+}
@@ -0,0 +1,119 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WithProxy sends every request through the proxy at proxyURL, an HTTP,
+// HTTPS or SOCKS5 proxy such as "socks5://127.0.0.1:1080", instead of the
+// proxy named by the HTTPS_PROXY and HTTP_PROXY environment variables. With a
+// SOCKS5 proxy, host names are resolved by the proxy. An empty URL keeps the
+// proxy of the environment.
+func WithProxy(proxyURL string) Option {
+	return func(o *options) {
+		o.proxy = proxyURL
+	}
+}
+
+// WithDNSServer resolves host names through the DNS server at addr, such as
+// "10.0.0.2" or "10.0.0.2:5353", instead of the system's resolver. An empty
+// address keeps the system's resolver.
+func WithDNSServer(addr string) Option {
+	return func(o *options) {
+		o.dnsServer = addr
+	}
+}
+
+// WithHostAddresses connects to the address hosts maps a host name to, with
+// or without a port, whenever a request is sent to that host, like an
+// /etc/hosts entry: for instance {"www.googleapis.com": "10.1.2.3"} reaches
+// the Drive API through a private egress. Requests keep the name of the host,
+// so TLS certificates are still checked against it.
+func WithHostAddresses(hosts map[string]string) Option {
+	return func(o *options) {
+		o.hosts = hosts
+	}
+}
+
+// ParseHostAddresses parses comma-separated host=address pairs, such as
+// "www.googleapis.com=10.1.2.3,oauth2.googleapis.com=10.1.2.4:8443", for
+// WithHostAddresses.
+func ParseHostAddresses(s string) (map[string]string, error) {
+	hosts := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		host, addr, ok := strings.Cut(pair, "=")
+		host, addr = strings.TrimSpace(host), strings.TrimSpace(addr)
+		if !ok || host == "" || addr == "" {
+			return nil, fmt.Errorf("%q is not a host=address pair", pair)
+		}
+		hosts[strings.ToLower(host)] = addr
+	}
+	return hosts, nil
+}
+
+// networkTransport returns the transport applying the proxy, DNS server and
+// host addresses of the options, based on the transport of their HTTP
+// client, or nil if none is set.
+func (o *options) networkTransport() (http.RoundTripper, error) {
+	if o.proxy == "" && o.dnsServer == "" && len(o.hosts) == 0 {
+		return nil, nil
+	}
+	base := http.DefaultTransport
+	if o.httpClient != nil && o.httpClient.Transport != nil {
+		base = o.httpClient.Transport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("a proxy, DNS server or host addresses require the transport of the HTTP client to be an *http.Transport")
+	}
+	t = t.Clone()
+	if o.proxy != "" {
+		u, err := url.Parse(o.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", u.Scheme)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if o.dnsServer != "" {
+		server := o.dnsServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	hosts := o.hosts
+	t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			if addr, ok := hosts[strings.ToLower(host)]; ok {
+				if _, _, err := net.SplitHostPort(addr); err != nil {
+					addr = net.JoinHostPort(addr, port)
+				}
+				address = addr
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+	return t, nil
+}
@@ -0,0 +1,135 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// An Option configures a Client created by NewClient.
+type Option func(*options)
+
+// options collects the settings of NewClient.
+type options struct {
+	auth       AuthProvider
+	anonymous  bool
+	scopes     []string
+	subject    string
+	endpoint   string
+	httpClient *http.Client
+	proxy      string            // see WithProxy
+	dnsServer  string            // see WithDNSServer
+	hosts      map[string]string // see WithHostAddresses
+}
+
+// WithAuth authenticates with the credentials supplied by provider.
+func WithAuth(provider AuthProvider) Option {
+	return func(o *options) {
+		o.auth = provider
+	}
+}
+
+// WithCredentialsFile authenticates with the service account credentials
+// stored in a JSON key file. An empty path selects Application Default
+// Credentials.
+func WithCredentialsFile(path string) Option {
+	if path == "" {
+		return WithAuth(ADC{})
+	}
+	return WithAuth(ServiceAccount{File: path})
+}
+
+// WithCredentialsJSON authenticates with service account credentials given
+// as the contents of a JSON key file.
+func WithCredentialsJSON(json []byte) Option {
+	return WithAuth(ServiceAccount{JSON: json})
+}
+
+// WithoutCredentials creates a client that uses no credentials at all. It can
+// only download folders and files shared with "anyone with the link", through
+// the public endpoints used by the Drive web interface; sizes, checksums and
+// modification times are not available, and operations that need the Drive
+// API fail with ErrAnonymous.
+func WithoutCredentials() Option {
+	return func(o *options) {
+		o.anonymous = true
+	}
+}
+
+// WithAPIKey authenticates with an API key instead of credentials. Like
+// WithoutCredentials, it only gives access to files shared with "anyone with
+// the link", but through the Drive API, so sizes, checksums and modification
+// times are available and incremental downloads work.
+func WithAPIKey(key string) Option {
+	return WithAuth(APIKey(key))
+}
+
+// WithScopes requests the given OAuth scopes for the client's credentials
+// instead of ReadonlyScope alone. Operations check that the scopes they need
+// were granted before doing any work.
+func WithScopes(scopes ...string) Option {
+	return func(o *options) {
+		o.scopes = scopes
+	}
+}
+
+// WithSubject acts as the user with the email address subject, through the
+// domain-wide delegation of the service account of the client's credentials,
+// which must be ServiceAccount or Impersonated credentials.
+func WithSubject(subject string) Option {
+	return func(o *options) {
+		o.subject = subject
+	}
+}
+
+// WithHTTPClient sends requests through the transport of client, with its
+// timeout, instead of http.DefaultTransport. Credentials are added to the
+// requests on top of the transport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithEndpoint sends the Drive API requests to endpoint, the base URL of the
+// Drive API of a mock server or of an API gateway, such as
+// "https://gateway.example.com/drive/v3/", instead of Google's. An empty
+// endpoint selects Google's. The public links anonymous clients download
+// through are not affected.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		if endpoint != "" && !strings.HasSuffix(endpoint, "/") {
+			endpoint += "/"
+		}
+		o.endpoint = endpoint
+	}
+}
+
+// tokenSource returns the source of the tokens of the credentials selected by
+// the options, Application Default Credentials by default.
+func (o *options) tokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	scopes := o.scopes
+	if len(scopes) == 0 {
+		scopes = []string{ReadonlyScope}
+	}
+	auth := o.auth
+	if auth == nil {
+		auth = ADC{}
+	}
+	if o.subject != "" {
+		switch a := auth.(type) {
+		case ServiceAccount:
+			a.Subject = o.subject
+			auth = a
+		case Impersonated:
+			a.Subject = o.subject
+			auth = a
+		default:
+			return nil, fmt.Errorf("acting as %s requires service account credentials", o.subject)
+		}
+	}
+	return auth.TokenSource(ctx, scopes)
+}
@@ -0,0 +1,140 @@
+package drive
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"maps"
+	"path"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// folderReserve is the room, in bytes, kept below a shortened folder for the
+// names of its content.
+const folderReserve = 32
+
+// minShortStem is the number of bytes of the original name kept at least in
+// a shortened name.
+const minShortStem = 8
+
+// shortNames shortens the local names of the files and folders whose path
+// would exceed a length budget. Names are shortened deterministically, by
+// truncating them and appending a hash of the file ID, and every shortened
+// name is remembered by file ID so that later downloads keep using it even
+// if the tree around it changes.
+type shortNames struct {
+	budget int // maximum length of a path relative to the root, 0 if unlimited
+
+	mu    sync.Mutex
+	names map[string]string // shortened name of each file ID
+}
+
+// newShortNames returns the shortener of a download whose root is rootLen
+// bytes long, reusing the names recorded by a previous download. It returns
+// nil if names need neither shortening nor reusing.
+func (c *Client) newShortNames(rootLen int, recorded map[string]string) *shortNames {
+	if c.MaxPathLength <= 0 && len(recorded) == 0 {
+		return nil
+	}
+	s := &shortNames{names: maps.Clone(recorded)}
+	if s.names == nil {
+		s.names = make(map[string]string)
+	}
+	if c.MaxPathLength > 0 {
+		// Paths are joined to the root with a separator.
+		s.budget = max(c.MaxPathLength-rootLen-1, 1)
+	}
+	return s
+}
+
+// fit returns the local name of a file in the folder at dirPath, shortened
+// if its path would exceed the budget. Folders are shortened to leave
+// folderReserve bytes for their content, which is what makes the paths of
+// deeply nested files fit.
+func (s *shortNames) fit(file *drivev3.File, name, dirPath string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if short, ok := s.names[file.Id]; ok {
+		if shortenedFrom(short, name) {
+			return short, true
+		}
+		// The file was renamed since; its new name is fitted afresh.
+		delete(s.names, file.Id)
+	}
+	if s.budget == 0 {
+		return name, false
+	}
+	reserve := 0
+	if file.MimeType == folderMimeType {
+		reserve = folderReserve
+	}
+	room := s.budget - reserve
+	if dirPath != "" {
+		room -= len(dirPath) + 1
+	}
+	if len(name) <= room {
+		return name, false
+	}
+	short := shortenName(name, file.Id, room, file.MimeType == folderMimeType)
+	s.names[file.Id] = short
+	return short, true
+}
+
+// recorded returns the shortened names, to be saved in the manifest.
+func (s *shortNames) recorded() map[string]string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.names) == 0 {
+		return nil
+	}
+	return maps.Clone(s.names)
+}
+
+// shortenName shortens name to at most room bytes, keeping the extension of
+// files, by truncating it and appending "~" and a hash of the file ID, so
+// that shortened names stay distinct. Names keep at least minShortStem bytes
+// of the original, even if they then exceed room.
+func shortenName(name, id string, room int, isFolder bool) string {
+	ext := ""
+	if !isFolder {
+		ext = path.Ext(name)
+		if len(ext) > folderReserve {
+			ext = ""
+		}
+	}
+	sum := sha1.Sum([]byte(id))
+	suffix := "~" + hex.EncodeToString(sum[:3])
+	stem := name[:len(name)-len(ext)]
+	keep := max(room-len(suffix)-len(ext), minShortStem)
+	if keep < len(stem) {
+		// Cut at a character boundary.
+		for keep > 0 && !utf8.RuneStart(stem[keep]) {
+			keep--
+		}
+		// Windows drops trailing spaces and dots.
+		stem = strings.TrimRight(stem[:keep], " .")
+	}
+	return stem + suffix + ext
+}
+
+// shortenedFrom reports whether short is a shortened form of name, that is
+// whether it keeps the beginning and the extension of name.
+func shortenedFrom(short, name string) bool {
+	i := strings.LastIndex(short, "~")
+	if i < 0 {
+		return false
+	}
+	ext := short[i+1:]
+	if j := strings.Index(ext, "."); j >= 0 {
+		ext = ext[j:]
+	} else {
+		ext = ""
+	}
+	return strings.HasPrefix(name, short[:i]) && strings.HasSuffix(name, ext)
+}
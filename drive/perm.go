@@ -0,0 +1,80 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Ownership is the owner and group given to downloaded files and
+// directories. An ID of -1 leaves it unchanged, as with os.Chown.
+type Ownership struct {
+	UID int
+	GID int
+}
+
+// filePermissions are the permissions a dirSink gives to what it creates.
+type filePermissions struct {
+	file  os.FileMode // permission bits of files, if set
+	dir   os.FileMode // permission bits of directories, if set
+	owner *Ownership  // owner of files and directories, if set
+}
+
+// create creates or truncates the file at filePath with the permissions.
+func (p filePermissions) create(filePath string) (*os.File, error) {
+	mode := p.file
+	if mode == 0 {
+		mode = 0o666
+	}
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	// The mode passed to OpenFile is reduced by the umask and ignored for
+	// existing files.
+	if p.file != 0 {
+		err = f.Chmod(p.file)
+	}
+	if err == nil && p.owner != nil {
+		err = f.Chown(p.owner.UID, p.owner.GID)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// mkdirAll creates dir and any missing parents, giving those it creates the
+// permissions. Existing directories are left as they are.
+func (p filePermissions) mkdirAll(dir string) error {
+	if p.dir == 0 && p.owner == nil {
+		return os.MkdirAll(dir, os.ModePerm)
+	}
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	mode := p.dir
+	if mode == 0 {
+		mode = os.ModePerm
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if p.dir != 0 {
+			if err := os.Chmod(d, p.dir); err != nil {
+				return err
+			}
+		}
+		if p.owner != nil {
+			if err := os.Chown(d, p.owner.UID, p.owner.GID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// Actions of a Plan.
+const (
+	// ActionMkdir creates a folder.
+	ActionMkdir = "mkdir"
+	// ActionDownload downloads a file.
+	ActionDownload = "download"
+	// ActionExport exports a Google-native document.
+	ActionExport = "export"
+	// ActionMove renames the local copy of a file moved or renamed on Drive
+	// since the previous download.
+	ActionMove = "move"
+	// ActionSkip keeps the local copy of a file unchanged since the
+	// previous download.
+	ActionSkip = "skip"
+	// ActionRestricted reports a file whose download is disabled by its
+	// sharing settings.
+	ActionRestricted = "restricted"
+)
+
+// PlanAction is a step of a Plan.
+type PlanAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`           // slash-separated local path
+	From   string `json:"from,omitempty"` // previous local path of moved files
+	// Bytes is the number of bytes expected to be transferred, or -1 for
+	// exports, whose size Drive does not report.
+	Bytes int64         `json:"bytes"`
+	File  *drivev3.File `json:"file"`
+}
+
+// Plan is the list of everything a download of a folder into a directory
+// would do, made by PlanFolder for review before ApplyPlan carries it out.
+type Plan struct {
+	FolderID string       `json:"folderId"`
+	Dest     string       `json:"dest"`
+	Created  time.Time    `json:"created"`
+	Actions  []PlanAction `json:"actions"`
+}
+
+// Count returns the number of actions of the given kind and the bytes they
+// are expected to transfer, exports excluded.
+func (p *Plan) Count(action string) (int, int64) {
+	var n int
+	var bytes int64
+	for _, a := range p.Actions {
+		if a.Action == action {
+			n++
+			bytes += max(a.Bytes, 0)
+		}
+	}
+	return n, bytes
+}
+
+// PlanFolder lists what DownloadFolder would do to download a folder into
+// downloadPath, without downloading anything: the folders to create, the
+// files to download or export, and those the previous download already
+// holds, using the client's settings. The plan records the metadata of every
+// file, so that ApplyPlan downloads exactly the files that were reviewed.
+func (c *Client) PlanFolder(ctx context.Context, folderID, downloadPath string) (*Plan, error) {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return nil, err
+	}
+	previous, short, err := c.previousDownload(folderID, downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := c.loadDirRules(downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{FolderID: folderID, Dest: downloadPath, Created: time.Now().UTC()}
+	var mu sync.Mutex
+	err = c.walkShortened(ctx, folderID, short, rules, func(item DriveItem) error {
+		action := c.planItem(ctx, item, previous, downloadPath)
+		mu.Lock()
+		defer mu.Unlock()
+		plan.Actions = append(plan.Actions, action)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(plan.Actions, func(i, j int) bool { return plan.Actions[i].Path < plan.Actions[j].Path })
+	return plan, nil
+}
+
+// planItem returns the action of a folder or file found by the walk of a
+// download into downloadPath.
+func (c *Client) planItem(ctx context.Context, item DriveItem, previous *Manifest, downloadPath string) PlanAction {
+	action := PlanAction{Action: ActionDownload, Path: item.Path, Bytes: item.Size, File: item.File}
+	switch {
+	case item.IsFolder():
+		action.Action, action.Bytes = ActionMkdir, 0
+	case downloadRestricted(item.File):
+		action.Action, action.Bytes = ActionRestricted, 0
+	default:
+		action.Path = c.route(item.Path)
+		c.planFile(ctx, &action, previous, downloadPath)
+	}
+	return action
+}
+
+// planFile decides the action of a file with fileAction, as fetchFile would.
+func (c *Client) planFile(ctx context.Context, action *PlanAction, previous *Manifest, downloadPath string) {
+	file := action.File
+	entry := ManifestEntry{ID: file.Id, Path: action.Path, MimeType: file.MimeType, ModifiedTime: file.ModifiedTime, Revision: file.HeadRevisionId}
+	prev, found := previous.Lookup(file.Id)
+	action.Action, prev = c.fileAction(ctx, prev, found, &entry, file, filepath.Join(downloadPath, filepath.FromSlash(action.Path)))
+	switch {
+	case action.Action == ActionSkip:
+		action.Bytes = 0
+	case action.Action == ActionMove:
+		action.From, action.Bytes = prev.Path, 0
+	case action.Action == ActionExport:
+		action.Bytes = -1
+	case isGoogleDoc(file):
+		// Only a link stub of a few hundred bytes is written.
+		action.Bytes = 0
+	}
+}
+
+// ApplyPlan carries out a plan made by PlanFolder, downloading into the
+// plan's directory exactly the files it lists, as DownloadFolder would
+// download them, and carrying out the action it records for each: files
+// added to the folder since are not downloaded, files the plan keeps are not
+// checked again, and files whose content changed since fail their checksum
+// verification. The client should have the settings the plan was made with.
+func (c *Client) ApplyPlan(ctx context.Context, plan *Plan) error {
+	return c.downloadInto(ctx, plan.FolderID, plan.Dest, plan, nil)
+}
+
+// each calls fn for every folder and file of the plan, with the local path
+// it is saved to.
+func (p *Plan) each(fn func(item DriveItem, relPath string) error) error {
+	for _, a := range p.Actions {
+		if a.File == nil {
+			return fmt.Errorf("invalid plan: no file metadata for %s", a.Path)
+		}
+		item := DriveItem{
+			ID:       a.File.Id,
+			Name:     path.Base(a.Path),
+			Path:     a.Path,
+			Size:     a.File.Size,
+			MD5:      a.File.Md5Checksum,
+			MimeType: a.File.MimeType,
+			File:     a.File,
+		}
+		if err := fn(item, a.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package drive
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves size bytes of disk space for f without changing its
+// size, so that the file system can lay it out contiguously. Preallocation
+// is advisory: file systems that do not support it are ignored.
+func preallocate(f *os.File, size int64) {
+	unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size)
+}
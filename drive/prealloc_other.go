@@ -0,0 +1,8 @@
+//go:build !linux
+
+package drive
+
+import "os"
+
+// preallocate does nothing outside Linux.
+func preallocate(f *os.File, size int64) {}
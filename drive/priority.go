@@ -0,0 +1,109 @@
+package drive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Priority orders the downloads of files; see Client.Priorities.
+type Priority int
+
+const (
+	// PriorityLow files are downloaded once the walk is over and no file of
+	// higher priority is waiting, e.g. bulky media.
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of files matching no pattern.
+	PriorityNormal Priority = 0
+	// PriorityHigh files are downloaded before any other waiting file.
+	PriorityHigh Priority = 1
+)
+
+// A PathPriority gives the files whose path matches Pattern a priority.
+type PathPriority struct {
+	// Pattern is matched against the path of files below the downloaded
+	// folder, ignoring case: its elements are path.Match patterns, and "**"
+	// matches any number of elements, e.g. "**/*.docx" or "Contracts/**". A
+	// pattern without a slash is matched against the file name.
+	Pattern  string
+	Priority Priority
+}
+
+// ParsePriorities parses a comma-separated list of priorities written as
+// "PATTERN=LEVEL", the level being "high", "normal" or "low", e.g.
+// "**/*.docx=high,**/*.mp4=low".
+func ParsePriorities(s string) ([]PathPriority, error) {
+	var priorities []PathPriority
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		i := strings.LastIndex(field, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid priority %q (want \"PATTERN=LEVEL\")", field)
+		}
+		p := PathPriority{Pattern: strings.TrimSpace(field[:i])}
+		switch strings.ToLower(strings.TrimSpace(field[i+1:])) {
+		case "high":
+			p.Priority = PriorityHigh
+		case "normal":
+			p.Priority = PriorityNormal
+		case "low":
+			p.Priority = PriorityLow
+		default:
+			return nil, fmt.Errorf("invalid level in priority %q: want \"high\", \"normal\" or \"low\"", field)
+		}
+		for _, elem := range strings.Split(p.Pattern, "/") {
+			if _, err := path.Match(elem, ""); err != nil || p.Pattern == "" {
+				return nil, fmt.Errorf("invalid pattern in priority %q", field)
+			}
+		}
+		priorities = append(priorities, p)
+	}
+	return priorities, nil
+}
+
+// priority returns the priority of the first of the client's Priorities
+// matching relPath, or PriorityNormal.
+func (c *Client) priority(relPath string) Priority {
+	for _, p := range c.Priorities {
+		if matchPath(p.Pattern, relPath) {
+			return p.Priority
+		}
+	}
+	return PriorityNormal
+}
+
+// matchPath reports whether the slash-separated path name matches pattern, as
+// documented on PathPriority.
+func matchPath(pattern, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchElems matches the elements of a path against those of a pattern.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
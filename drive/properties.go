@@ -0,0 +1,96 @@
+package drive
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A LabelFilter selects the files a Drive label is applied to, or, if Field
+// is set, those whose field of the label has the given value, such as the
+// ID of a choice of a selection field. See Client.Labels.
+type LabelFilter struct {
+	ID    string
+	Field string
+	Value string
+}
+
+// ParseProperties parses a comma-separated list of properties written as
+// "KEY=VALUE", e.g. "classification=public,team=legal".
+func ParseProperties(s string) (map[string]string, error) {
+	properties := make(map[string]string)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("invalid property %q (want \"KEY=VALUE\")", field)
+		}
+		properties[key] = strings.TrimSpace(value)
+	}
+	if len(properties) == 0 {
+		return nil, nil
+	}
+	return properties, nil
+}
+
+// ParseLabelFilters parses a comma-separated list of label filters: label
+// IDs, or "ID.FIELD=VALUE" to select the files whose field of the label has
+// a value.
+func ParseLabelFilters(s string) ([]LabelFilter, error) {
+	var filters []LabelFilter
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		var filter LabelFilter
+		label, value, hasValue := strings.Cut(field, "=")
+		filter.ID, filter.Field, _ = strings.Cut(strings.TrimSpace(label), ".")
+		if hasValue {
+			filter.Value = strings.TrimSpace(value)
+		}
+		switch {
+		case !driveIDPattern.MatchString(filter.ID):
+			return nil, fmt.Errorf("invalid label ID in %q", field)
+		case hasValue != (filter.Field != ""):
+			return nil, fmt.Errorf("invalid label filter %q (want \"ID\" or \"ID.FIELD=VALUE\")", field)
+		case filter.Field != "" && !driveIDPattern.MatchString(filter.Field):
+			return nil, fmt.Errorf("invalid field ID in %q", field)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// metadataTerms returns the Drive query terms selecting the files with the
+// client's Properties, AppProperties and Labels.
+func (c *Client) metadataTerms() []string {
+	var terms []string
+	for _, set := range []struct {
+		name       string
+		properties map[string]string
+	}{
+		{"properties", c.Properties},
+		{"appProperties", c.AppProperties},
+	} {
+		keys := make([]string, 0, len(set.properties))
+		for key := range set.properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			terms = append(terms, fmt.Sprintf("%s has { key='%s' and value='%s' }", set.name, queryEscape(key), queryEscape(set.properties[key])))
+		}
+	}
+	for _, label := range c.Labels {
+		if label.Field == "" {
+			terms = append(terms, fmt.Sprintf("'labels/%s' in labels", label.ID))
+		} else {
+			terms = append(terms, fmt.Sprintf("labels/%s.%s = '%s'", label.ID, label.Field, queryEscape(label.Value)))
+		}
+	}
+	return terms
+}
@@ -0,0 +1,239 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// ErrAnonymous is returned by operations that need the Drive API, and hence
+// credentials, when the client was created with WithoutCredentials.
+var ErrAnonymous = errors.New("not available without credentials")
+
+// Public endpoints used by anonymous clients. They serve files shared with
+// "anyone with the link" without authentication.
+const (
+	publicFolderURL   = "https://drive.google.com/embeddedfolderview?id="
+	publicDownloadURL = "https://drive.google.com/uc?export=download&id="
+)
+
+// publicExportURLs maps Google-native MIME types to their public export URL,
+// formatted with the file ID and the export format's extension.
+var publicExportURLs = map[string]string{
+	"application/vnd.google-apps.document":     "https://docs.google.com/document/d/%s/export?format=%s",
+	"application/vnd.google-apps.spreadsheet":  "https://docs.google.com/spreadsheets/d/%s/export?format=%s",
+	"application/vnd.google-apps.presentation": "https://docs.google.com/presentation/d/%s/export/%s",
+	"application/vnd.google-apps.drawing":      "https://docs.google.com/drawings/d/%s/export/%s",
+}
+
+// publicEntryPattern matches an item of the embedded folder view: its ID,
+// link, icon and title.
+var publicEntryPattern = regexp.MustCompile(`(?s)<div class="flip-entry" id="entry-([\w-]+)".*?<a href="([^"]+)".*?<img src="([^"]*)".*?<div class="flip-entry-title">(.*?)</div>`)
+
+// publicTitlePattern matches the title of the embedded folder view, which is
+// the name of the folder.
+var publicTitlePattern = regexp.MustCompile(`(?s)<title>(.*?)</title>`)
+
+// Patterns of the warning page Drive serves instead of the content of public
+// files too large to be scanned for viruses: the form confirming the
+// download and its hidden fields, and the confirmation link of older
+// versions of the page.
+var (
+	publicConfirmFormPattern  = regexp.MustCompile(`(?s)<form[^>]*id="download-form"[^>]*action="([^"]+)"[^>]*>(.*?)</form>`)
+	publicConfirmInputPattern = regexp.MustCompile(`<input[^>]*type="hidden"[^>]*name="([^"]+)"[^>]*value="([^"]*)"`)
+	publicConfirmLinkPattern  = regexp.MustCompile(`href="(/uc\?export=download[^"]*confirm=[^"]*)"`)
+)
+
+// publicLinkTypes maps link prefixes of the embedded folder view to the MIME
+// type of the item they point to.
+var publicLinkTypes = []struct{ prefix, mimeType string }{
+	{"https://drive.google.com/drive/folders/", folderMimeType},
+	{"https://docs.google.com/document/", "application/vnd.google-apps.document"},
+	{"https://docs.google.com/spreadsheets/", "application/vnd.google-apps.spreadsheet"},
+	{"https://docs.google.com/presentation/", "application/vnd.google-apps.presentation"},
+	{"https://docs.google.com/drawings/", "application/vnd.google-apps.drawing"},
+	{"https://docs.google.com/forms/", "application/vnd.google-apps.form"},
+}
+
+// anonymous reports whether the client works without credentials.
+func (c *Client) anonymous() bool {
+	return c.Service == nil
+}
+
+// listPublicFolder lists a public folder by parsing its embedded folder view.
+func (c *Client) listPublicFolder(ctx context.Context, folderID string) ([]*drivev3.File, error) {
+	body, err := c.openPublic(ctx, publicFolderURL+url.QueryEscape(folderID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve files: %w", err)
+	}
+	defer body.Close()
+	page, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve files: %w", err)
+	}
+
+	var files []*drivev3.File
+	for _, match := range publicEntryPattern.FindAllStringSubmatch(string(page), -1) {
+		file := &drivev3.File{Id: match[1], Name: html.UnescapeString(strings.TrimSpace(match[4]))}
+		link, icon := html.UnescapeString(match[2]), html.UnescapeString(match[3])
+		for _, t := range publicLinkTypes {
+			if strings.HasPrefix(link, t.prefix) {
+				file.MimeType = t.mimeType
+				break
+			}
+		}
+		if file.MimeType == "" {
+			// Regular files show an icon named after their MIME type.
+			file.MimeType = "application/octet-stream"
+			if i := strings.Index(icon, "/type/"); i >= 0 {
+				file.MimeType = icon[i+len("/type/"):]
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// publicFolderName returns the name of a public folder from the title of its
+// embedded folder view.
+func (c *Client) publicFolderName(ctx context.Context, folderID string) (string, error) {
+	body, err := c.openPublic(ctx, publicFolderURL+url.QueryEscape(folderID))
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve folder: %w", err)
+	}
+	defer body.Close()
+	page, err := io.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve folder: %w", err)
+	}
+	match := publicTitlePattern.FindStringSubmatch(string(page))
+	if match == nil {
+		return "", errors.New("failed to retrieve folder: no folder name in the folder view")
+	}
+	return html.UnescapeString(strings.TrimSpace(match[1])), nil
+}
+
+// downloadPublicFile opens the content of a public file. Files too large to
+// be scanned for viruses are served as a warning page instead, whose
+// confirmation is followed to get the content.
+func (c *Client) downloadPublicFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	resp, err := c.getPublic(ctx, publicDownloadURL+url.QueryEscape(fileID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if !isHTML(resp) {
+		return resp.Body, nil
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	confirmURL, ok := publicConfirmURL(string(page), resp.Cookies(), fileID)
+	if !ok {
+		return nil, errors.New("failed to download file: received a web page instead of the file content")
+	}
+	c.debugf(DebugDownloader, "Confirming the download of %s despite the virus scan warning", fileID)
+	body, err := c.openPublic(ctx, confirmURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	return body, nil
+}
+
+// publicConfirmURL returns the URL confirming the download of fileID from the
+// virus scan warning page served instead of its content, with the cookies
+// set along with it. Current pages submit a form with a confirmation token
+// and a UUID; older ones link to the download with a confirm parameter or
+// set the token in a download_warning cookie.
+func publicConfirmURL(page string, cookies []*http.Cookie, fileID string) (string, bool) {
+	if match := publicConfirmFormPattern.FindStringSubmatch(page); match != nil {
+		query := url.Values{}
+		for _, input := range publicConfirmInputPattern.FindAllStringSubmatch(match[2], -1) {
+			query.Set(html.UnescapeString(input[1]), html.UnescapeString(input[2]))
+		}
+		if query.Get("id") == "" {
+			query.Set("id", fileID)
+		}
+		return html.UnescapeString(match[1]) + "?" + query.Encode(), true
+	}
+	if match := publicConfirmLinkPattern.FindStringSubmatch(page); match != nil {
+		return "https://drive.google.com" + html.UnescapeString(match[1]), true
+	}
+	for _, cookie := range cookies {
+		if strings.HasPrefix(cookie.Name, "download_warning") {
+			return publicDownloadURL + url.QueryEscape(fileID) + "&confirm=" + url.QueryEscape(cookie.Value), true
+		}
+	}
+	return "", false
+}
+
+// exportPublicFile opens a public Google-native file exported in format.
+func (c *Client) exportPublicFile(ctx context.Context, file *drivev3.File, format exportFormat) (io.ReadCloser, error) {
+	pattern, ok := publicExportURLs[file.MimeType]
+	if !ok {
+		return nil, fmt.Errorf("failed to export file: %s cannot be exported without credentials", file.MimeType)
+	}
+	body, err := c.openPublic(ctx, fmt.Sprintf(pattern, url.PathEscape(file.Id), strings.TrimPrefix(format.Extension, ".")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to export file: %w", err)
+	}
+	return body, nil
+}
+
+// openPublic performs an unauthenticated GET request. Items that are not
+// shared publicly redirect to the Google sign-in page, which is reported as
+// an error rather than saved as content, and so are web pages received
+// instead of file content.
+func (c *Client) openPublic(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	resp, err := c.getPublic(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if isHTML(resp) && !strings.HasPrefix(rawURL, publicFolderURL) {
+		resp.Body.Close()
+		return nil, errors.New("received a web page instead of the file content")
+	}
+	return resp.Body, nil
+}
+
+// getPublic is like openPublic, but returns the response whatever its
+// content type.
+func (c *Client) getPublic(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.http
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if resp.Request.URL.Host == "accounts.google.com" {
+		resp.Body.Close()
+		return nil, errors.New("not shared publicly (anyone with the link)")
+	}
+	return resp, nil
+}
+
+// isHTML reports whether resp is a web page.
+func isHTML(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/html"
+}
@@ -0,0 +1,414 @@
+package drive
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// QueueName is the name of the work queue journal kept in the download
+// directory while a download is in progress.
+const QueueName = ".drive-queue.jsonl"
+
+// queueFlushInterval is how often the queue journal is flushed to disk.
+const queueFlushInterval = time.Second
+
+// queueLimit is the number of files the queue holds before Add waits for
+// workers to take some, so that walking a huge tree does not outpace the
+// downloads by millions of files.
+const queueLimit = 10000
+
+// queueItem is a file waiting to be downloaded.
+type queueItem struct {
+	Path     string        `json:"path"`
+	File     *drivev3.File `json:"file"`
+	Priority Priority      `json:"priority,omitempty"`
+}
+
+// queueRecord is a line of the queue journal.
+type queueRecord struct {
+	Op       string         `json:"op"` // "start", "add" or "done"
+	FolderID string         `json:"folderId,omitempty"`
+	Item     *queueItem     `json:"item,omitempty"`
+	Entry    *ManifestEntry `json:"entry,omitempty"`
+}
+
+// jobQueue is the work queue of a download: the walker adds files to it and
+// download workers take them off. Every change is appended to a journal that
+// is flushed periodically, so a download interrupted at any point resumes
+// from the journal, losing at most the files that were in flight: the folder
+// is always walked again, so that files added or changed since are found, and
+// the journal only spares the files completed by earlier runs. Files that
+// fail are retried by the next run.
+type jobQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []queueItem
+	known   map[string]bool          // IDs added to the queue by this run
+	done    map[string]ManifestEntry // files completed, including by earlier runs
+	walked  bool                     // the walker is done adding files
+	closed  bool
+
+	classify func(file *drivev3.File) int // transfer class of a file, or -1
+	limits   []int                        // concurrency of each transfer class
+	running  []int                        // files of each class taken by Pop and not yet released
+
+	prioritized bool // hand out the files of highest priority first
+
+	grouped      bool   // hand out the files of one folder at a time
+	sorted       bool   // pending is sorted by folder, once walked
+	group        string // folder whose files are being handed out
+	groupRunning int    // files of group taken by Pop and not yet released
+
+	path    string
+	file    *os.File
+	journal *bufio.Writer
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// openQueue opens the queue journal at path for folderID, resuming the state
+// left by an interrupted download of the same folder. An empty path keeps the
+// queue in memory only.
+func openQueue(path, folderID string) (*jobQueue, error) {
+	q := &jobQueue{
+		known: make(map[string]bool),
+		done:  make(map[string]ManifestEntry),
+		path:  path,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	if path == "" {
+		return q, nil
+	}
+
+	if err := q.replay(folderID); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create queue journal: %w", err)
+	}
+	q.file, q.journal = f, bufio.NewWriter(f)
+
+	// Rewrite the journal compactly with the resumed state.
+	q.write(queueRecord{Op: "start", FolderID: folderID})
+	for _, entry := range q.done {
+		q.write(queueRecord{Op: "done", Entry: &entry})
+	}
+	if err := q.journal.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write queue journal: %w", err)
+	}
+
+	q.stop, q.stopped = make(chan struct{}), make(chan struct{})
+	go q.flushPeriodically()
+	return q, nil
+}
+
+// replay restores the files completed according to an existing journal for
+// folderID. The files that were waiting are found again by the walk, which
+// journals of earlier versions recorded with "walked" records, now ignored.
+func (q *jobQueue) replay(folderID string) error {
+	f, err := os.Open(q.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read queue journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var record queueRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			break // a record torn by a crash ends the journal
+		}
+		switch record.Op {
+		case "start":
+			if record.FolderID != folderID {
+				return nil // left by a download of another folder
+			}
+		case "done":
+			q.done[record.Entry.ID] = *record.Entry
+		}
+	}
+	return nil
+}
+
+// Add queues a file unless it was queued before, or completed by an earlier
+// run and not changed or moved since, and reports whether it was queued;
+// resumed is the entry of a file completed by an earlier run, so that only
+// the files the walk still finds are recorded. While the queue holds
+// queueLimit files, Add waits for workers to take some, unless the queue is
+// grouped, since workers then only take files once the walk is over.
+func (q *jobQueue) Add(item queueItem) (queued bool, resumed *ManifestEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) >= queueLimit && !q.grouped && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed || q.known[item.File.Id] {
+		return false, nil
+	}
+	q.known[item.File.Id] = true
+	if entry, ok := q.done[item.File.Id]; ok && entry.ModifiedTime == item.File.ModifiedTime && entry.Path == item.Path {
+		return false, &entry
+	}
+	q.pending = append(q.pending, item)
+	q.write(queueRecord{Op: "add", Item: &item})
+	q.cond.Signal()
+	return true, nil
+}
+
+// Len returns the number of files waiting to be downloaded.
+func (q *jobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// MarkWalked records that the walker is done adding files, possibly having
+// skipped folders it failed to list, so that Pop returns false once the queue
+// is drained.
+func (q *jobQueue) MarkWalked() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.walked = true
+	q.cond.Broadcast()
+}
+
+// Cancel wakes any waiting workers and makes Pop return false from now on,
+// without closing the journal. It is used when the walk fails.
+func (q *jobQueue) Cancel() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// SetClasses limits the number of files of each transfer class that Pop
+// hands out until they are released; classify returns the class of a file,
+// or -1 for files that are not limited.
+func (q *jobQueue) SetClasses(classify func(file *drivev3.File) int, limits []int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.classify, q.limits, q.running = classify, limits, make([]int, len(limits))
+}
+
+// SetPrioritized makes Pop hand out the waiting file of highest Priority
+// first, in the order they were added among files of the same priority.
+// Files of low priority are only handed out once the walk is over, so that
+// every file of higher priority is found first, unless the queue is full.
+func (q *jobQueue) SetPrioritized() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prioritized = true
+}
+
+// SetGrouped makes Pop hand out files grouped by folder, for sinks that
+// write their entries in the order files complete, such as archives: once
+// the walk is over, the files of a single folder at a time are handed out, in
+// path order, and the files of the next folder only once every file of the
+// current one was released. Files of a folder are thus completed
+// contiguously, while still being downloaded in parallel.
+func (q *jobQueue) SetGrouped() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.grouped = true
+}
+
+// Pop takes the next file off the queue, waiting while the walker may still
+// add files. Files whose transfer class is at its limit are skipped, in favor
+// of the next file of another class; files of another folder than the one
+// being handed out wait if the queue is grouped. It returns false once the
+// queue is drained or closed.
+func (q *jobQueue) Pop() (queueItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.next()
+	for i < 0 && !q.closed && (len(q.pending) > 0 || !q.walked) {
+		q.cond.Wait()
+		i = q.next()
+	}
+	if i < 0 || q.closed {
+		return queueItem{}, false
+	}
+	item := q.pending[i]
+	if i == 0 {
+		q.pending[0] = queueItem{}
+		q.pending = q.pending[1:]
+	} else {
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+	}
+	if q.classify != nil {
+		if class := q.classify(item.File); class >= 0 {
+			q.running[class]++
+		}
+	}
+	if q.grouped {
+		q.group = path.Dir(item.Path)
+		q.groupRunning++
+	}
+	if len(q.pending) == queueLimit-1 {
+		// Wake the walker waiting in Add, along with any idle workers.
+		q.cond.Broadcast()
+	}
+	return item, true
+}
+
+// next returns the index of the first pending file whose transfer class is
+// below its limit, or -1. The caller must hold q.mu.
+func (q *jobQueue) next() int {
+	if q.grouped {
+		if !q.walked {
+			return -1
+		}
+		if !q.sorted {
+			sort.SliceStable(q.pending, func(i, j int) bool {
+				return groupLess(q.pending[i].Path, q.pending[j].Path)
+			})
+			q.sorted = true
+		}
+	}
+	if q.prioritized && !q.grouped {
+		return q.nextByPriority()
+	}
+	if q.classify == nil && !q.grouped {
+		if len(q.pending) > 0 {
+			return 0
+		}
+		return -1
+	}
+	for i, item := range q.pending {
+		if q.grouped && q.groupRunning > 0 && path.Dir(item.Path) != q.group {
+			// The files of the current folder come first once sorted.
+			return -1
+		}
+		if q.classify == nil {
+			return i
+		}
+		if class := q.classify(item.File); class < 0 || q.running[class] < q.limits[class] {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextByPriority returns the index of the first pending file of the highest
+// priority whose transfer class is not at its limit, or -1 if there is none.
+func (q *jobQueue) nextByPriority() int {
+	holdLow := !q.walked && len(q.pending) < queueLimit
+	best := -1
+	for i, item := range q.pending {
+		if item.Priority < PriorityNormal && holdLow || best >= 0 && item.Priority <= q.pending[best].Priority {
+			continue
+		}
+		if q.classify != nil {
+			if class := q.classify(item.File); class >= 0 && q.running[class] >= q.limits[class] {
+				continue
+			}
+		}
+		best = i
+		if item.Priority >= PriorityHigh {
+			break
+		}
+	}
+	return best
+}
+
+// groupLess orders file paths by folder, then by name, so that the files of
+// a folder are contiguous.
+func groupLess(a, b string) bool {
+	if dirA, dirB := path.Dir(a), path.Dir(b); dirA != dirB {
+		return dirA < dirB
+	}
+	return a < b
+}
+
+// Release records that a file taken by Pop is no longer being downloaded,
+// making room for another file of its transfer class.
+func (q *jobQueue) Release(item queueItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.grouped {
+		if q.groupRunning--; q.groupRunning == 0 {
+			// The next folder may start.
+			q.cond.Broadcast()
+		}
+	}
+	if q.classify == nil {
+		return
+	}
+	if class := q.classify(item.File); class >= 0 {
+		q.running[class]--
+		q.cond.Broadcast()
+	}
+}
+
+// Done records that a file has been completed.
+func (q *jobQueue) Done(entry ManifestEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.done[entry.ID] = entry
+	q.write(queueRecord{Op: "done", Entry: &entry})
+}
+
+// write appends a record to the journal. The caller must hold q.mu.
+func (q *jobQueue) write(record queueRecord) {
+	if q.journal == nil {
+		return
+	}
+	data, _ := json.Marshal(record)
+	q.journal.Write(append(data, '\n'))
+}
+
+// flushPeriodically flushes the journal until the queue is closed.
+func (q *jobQueue) flushPeriodically() {
+	defer close(q.stopped)
+	ticker := time.NewTicker(queueFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			q.journal.Flush()
+			q.mu.Unlock()
+		}
+	}
+}
+
+// Close stops the queue, waking any waiting workers. The journal is removed
+// if complete is set, i.e. every file was downloaded; otherwise it is flushed
+// and kept so that the next run resumes from it.
+func (q *jobQueue) Close(complete bool) error {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+
+	close(q.stop)
+	<-q.stopped
+	err := q.journal.Flush()
+	if closeErr := q.file.Close(); err == nil {
+		err = closeErr
+	}
+	if complete {
+		return os.Remove(q.path)
+	}
+	return err
+}
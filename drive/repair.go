@@ -0,0 +1,68 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Repair verifies every file recorded in the manifest at manifestPath against
+// its local copy and downloads again those that are missing or no longer
+// match their recorded size and checksum (bitrot, partial copies). Files
+// downloaded with LayoutCAS are stored again as objects. It returns the
+// number of repaired files.
+func (c *Client) Repair(ctx context.Context, manifestPath string) (repaired int, err error) {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return 0, err
+	}
+	m, err := LoadManifest(manifestPath)
+	if err != nil {
+		return 0, err
+	}
+	root := filepath.Dir(manifestPath)
+	d := &download{root: root, sink: c.dirSink(root), manifest: m}
+	var cas *casSink
+	if _, err := os.Stat(filepath.Join(root, TreeName)); err == nil {
+		cas = c.newCASSink(root)
+	}
+	defer func() {
+		if cas != nil {
+			if treeErr := cas.finish(m); err == nil {
+				err = treeErr
+			}
+		}
+		if saveErr := m.Save(manifestPath); err == nil {
+			err = saveErr
+		}
+	}()
+
+	entries := append([]ManifestEntry(nil), m.Files...)
+	for _, entry := range entries {
+		verifyErr := entry.Verify(d.root)
+		if verifyErr == nil {
+			continue
+		}
+		c.logf("Repairing %s: %v", entry.Path, verifyErr)
+
+		file, err := c.getFile(ctx, entry.ID)
+		if err != nil {
+			return repaired, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		// Files are stored again the way they were.
+		if cas != nil {
+			d.sink = cas
+		} else {
+			sink := c.dirSink(root)
+			if sink.compress, err = ParseCompression(entry.Compression); err != nil {
+				return repaired, fmt.Errorf("%s: %w", entry.Path, err)
+			}
+			d.sink = sink
+		}
+		if err := c.fetchFile(ctx, d, file, entry.Path); err != nil {
+			return repaired, err
+		}
+		repaired++
+	}
+	return repaired, nil
+}
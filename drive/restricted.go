@@ -0,0 +1,72 @@
+package drive
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// restrictedFile is a file whose sharing settings keep viewers from
+// downloading, exporting or copying it.
+type restrictedFile struct {
+	path string
+	file *drivev3.File
+}
+
+// downloadRestricted reports whether a file cannot be downloaded because of
+// its sharing settings, such as a Workspace "viewers can't download" policy.
+// Files listed without capabilities, e.g. by anonymous clients, are assumed
+// to be downloadable.
+func downloadRestricted(file *drivev3.File) bool {
+	return file.Capabilities != nil && !file.Capabilities.CanDownload
+}
+
+// owners returns the email addresses of the owners of a file.
+func owners(file *drivev3.File) string {
+	var emails []string
+	for _, owner := range file.Owners {
+		emails = append(emails, owner.EmailAddress)
+	}
+	return strings.Join(emails, " ")
+}
+
+// reportRestricted lists the files that could not be downloaded because of
+// their sharing settings and, if the client has a RestrictedList, writes
+// them to it as CSV so that their owners can be asked to lift the
+// restriction.
+func (c *Client) reportRestricted(restricted []restrictedFile) error {
+	if len(restricted) == 0 {
+		return nil
+	}
+	sort.Slice(restricted, func(i, j int) bool { return restricted[i].path < restricted[j].path })
+	c.logf("Files whose download is disabled by their sharing settings (%d):", len(restricted))
+	for _, r := range restricted {
+		c.logf("  %s (owned by %s)", r.path, owners(r.file))
+	}
+	if c.RestrictedList == "" {
+		return nil
+	}
+
+	f, err := os.Create(c.RestrictedList)
+	if err != nil {
+		return fmt.Errorf("failed to write restricted file list: %w", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"path", "id", "owners", "link"})
+	for _, r := range restricted {
+		w.Write([]string{r.path, r.file.Id, owners(r.file), "https://drive.google.com/open?id=" + r.file.Id})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write restricted file list: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write restricted file list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// DownloadFolders downloads several folders into downloadPath as a single
+// download, sharing its transfers, queue, progress and manifest: each folder
+// into a subdirectory of downloadPath named after it or, with merge, all of
+// them into downloadPath itself, their content merged.
+//
+// The manifest records the download under RootsID(folderIDs), so that
+// downloading the same folders again only transfers what changed. Unlike
+// DownloadFolder, the folders are walked before any file is downloaded, the
+// way ApplyPlan downloads a plan. When merged folders hold files with the
+// same path, the files of the later folders are renamed; a folder whose path
+// is a file of an earlier folder fails the download.
+func (c *Client) DownloadFolders(ctx context.Context, folderIDs []string, downloadPath string, merge bool) error {
+	plan, err := c.PlanFolders(ctx, folderIDs, downloadPath, merge)
+	if err != nil {
+		return err
+	}
+	return c.ApplyPlan(ctx, plan)
+}
+
+// RootsID returns the ID a download of several folders is recorded under.
+func RootsID(folderIDs []string) string {
+	return strings.Join(folderIDs, ",")
+}
+
+// PlanFolders is like PlanFolder for the download of several folders by
+// DownloadFolders.
+func (c *Client) PlanFolders(ctx context.Context, folderIDs []string, downloadPath string, merge bool) (*Plan, error) {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return nil, err
+	}
+	id := RootsID(folderIDs)
+	previous, _, err := c.previousDownload(id, downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := c.loadDirRules(downloadPath)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{FolderID: id, Dest: downloadPath, Created: time.Now().UTC()}
+	roots := c.newFolderNames()
+	merged := c.newMergedPaths()
+	var mu sync.Mutex
+	for _, folderID := range folderIDs {
+		var prefix string
+		if !merge {
+			name, err := c.FolderName(ctx, folderID)
+			if err != nil {
+				return nil, fmt.Errorf("folder %s: %w", folderID, err)
+			}
+			root := &drivev3.File{Id: folderID, Name: name, MimeType: folderMimeType}
+			prefix = roots.claim(root, name, "")
+			plan.Actions = append(plan.Actions, PlanAction{Action: ActionMkdir, Path: prefix, File: root})
+		}
+		err := c.walk(ctx, folderID, func(item DriveItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if merge {
+				var ok bool
+				var err error
+				if item.Path, ok, err = merged.place(item); err != nil || !ok {
+					return err
+				}
+			} else {
+				item.Path = path.Join(prefix, item.Path)
+			}
+			// The rules apply to the paths in the download directory,
+			// known only once placed.
+			if rules.skip(item.Path, item.File.MimeType == folderMimeType) {
+				return nil
+			}
+			plan.Actions = append(plan.Actions, c.planItem(ctx, item, previous, downloadPath))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("folder %s: %w", folderID, err)
+		}
+	}
+	sort.Slice(plan.Actions, func(i, j int) bool { return plan.Actions[i].Path < plan.Actions[j].Path })
+	return plan, nil
+}
+
+// mergedPaths places the items of several folders merged into one
+// directory: subfolders with the same path are merged, and files whose path
+// is taken are renamed the way folderNames renames colliding names.
+type mergedPaths struct {
+	c       *Client
+	folders map[string]bool              // keys of the paths of folders
+	names   map[string]map[string]string // names used in every folder by their key
+}
+
+// newMergedPaths starts merging folders.
+func (c *Client) newMergedPaths() *mergedPaths {
+	return &mergedPaths{c: c, folders: make(map[string]bool), names: make(map[string]map[string]string)}
+}
+
+// place returns the path of item in the merged directory, or false if it is
+// a folder that is already there.
+func (m *mergedPaths) place(item DriveItem) (string, bool, error) {
+	c := m.c
+	dir, name := path.Split(item.Path)
+	used := m.names[c.nameKey(dir)]
+	if used == nil {
+		used = make(map[string]string)
+		m.names[c.nameKey(dir)] = used
+	}
+	key := c.nameKey(item.Path)
+	switch {
+	case item.IsFolder() && m.folders[key]:
+		return "", false, nil
+	case item.IsFolder() && used[c.nameKey(name)] != "":
+		return "", false, fmt.Errorf("cannot merge folder %s with the file of the same path", item.Path)
+	case item.IsFolder():
+		m.folders[key] = true
+	case used[c.nameKey(name)] != "":
+		renamed := c.disambiguate(item.File, name, "", used)
+		c.logf("Renaming %q to %q to avoid a name collision", item.Path, dir+renamed)
+		name = renamed
+	}
+	used[c.nameKey(name)] = name
+	return dir + name, true, nil
+}
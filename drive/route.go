@@ -0,0 +1,48 @@
+package drive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// A Route moves the files whose name matches Pattern into Dir, a directory
+// relative to the download root, keeping their path below the downloaded
+// folder: with the route "*.jpg -> Photos", "2023/Trip/beach.jpg" is saved
+// as "Photos/2023/Trip/beach.jpg".
+type Route struct {
+	// Pattern is a path.Match pattern matched against the local file name,
+	// ignoring case, e.g. "*.jpg".
+	Pattern string
+	// Dir is the slash-separated directory the matching files are moved to.
+	Dir string
+}
+
+// ParseRoute parses a route written as "PATTERN -> DIR", e.g.
+// "*.pdf -> Documents/".
+func ParseRoute(s string) (Route, error) {
+	pattern, dir, ok := strings.Cut(s, "->")
+	route := Route{Pattern: strings.TrimSpace(pattern), Dir: path.Clean(strings.TrimSpace(dir))}
+	if !ok || route.Pattern == "" || route.Dir == "." {
+		return Route{}, fmt.Errorf("invalid route %q (want \"PATTERN -> DIR\")", s)
+	}
+	if _, err := path.Match(route.Pattern, ""); err != nil {
+		return Route{}, fmt.Errorf("invalid pattern in route %q: %w", s, err)
+	}
+	if path.IsAbs(route.Dir) || route.Dir == ".." || strings.HasPrefix(route.Dir, "../") {
+		return Route{}, fmt.Errorf("route %q leaves the download directory", s)
+	}
+	return route, nil
+}
+
+// route returns the path a file found at relPath is saved to: below the Dir
+// of the first of the client's Routes matching its name, or relPath itself.
+func (c *Client) route(relPath string) string {
+	name := strings.ToLower(path.Base(relPath))
+	for _, route := range c.Routes {
+		if ok, _ := path.Match(strings.ToLower(route.Pattern), name); ok {
+			return path.Join(route.Dir, relPath)
+		}
+	}
+	return relPath
+}
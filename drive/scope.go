@@ -0,0 +1,91 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// OAuth scopes that can be requested with WithScopes.
+const (
+	// ReadonlyScope allows reading files and is all downloads need. It is
+	// the default.
+	ReadonlyScope = drivev3.DriveReadonlyScope
+	// FullScope also allows modifying and deleting files, and is needed by
+	// operations that change the Drive folder.
+	FullScope = drivev3.DriveScope
+	// AppDataScope allows access to the application data folder, which the
+	// other scopes do not cover.
+	AppDataScope = drivev3.DriveAppdataScope
+)
+
+// ErrInsufficientScope is returned by operations that need a scope the
+// client's credentials were not granted.
+var ErrInsufficientScope = errors.New("credentials were not granted the required scope")
+
+// tokenInfoURL is the endpoint reporting the scopes granted to a token.
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// scopeCheck caches the scopes granted to a client's credentials.
+type scopeCheck struct {
+	tokens  oauth2.TokenSource // nil for clients without credentials
+	once    sync.Once
+	granted []string
+	err     error
+}
+
+// requireScope fails fast with ErrInsufficientScope if the client's
+// credentials were not granted scope, before any work is done. Clients
+// without credentials only access public files and are not checked.
+func (c *Client) requireScope(ctx context.Context, scope string) error {
+	if c.scopes == nil || c.scopes.tokens == nil {
+		return nil
+	}
+	c.scopes.once.Do(func() {
+		c.scopes.granted, c.scopes.err = c.grantedScopes(ctx)
+	})
+	if c.scopes.err != nil {
+		return c.scopes.err
+	}
+	for _, granted := range c.scopes.granted {
+		if granted == scope || granted == FullScope && strings.HasPrefix(scope, FullScope+".") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s (granted: %s)", ErrInsufficientScope, scope, strings.Join(c.scopes.granted, " "))
+}
+
+// grantedScopes asks Google which scopes the client's access token has.
+func (c *Client) grantedScopes(ctx context.Context) ([]string, error) {
+	token, err := c.scopes.tokens.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain an access token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenInfoURL+"?access_token="+url.QueryEscape(token.AccessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check granted scopes: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to check granted scopes: %s", resp.Status)
+	}
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to check granted scopes: %w", err)
+	}
+	return strings.Fields(info.Scope), nil
+}
@@ -0,0 +1,71 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+const scriptMimeType = "application/vnd.google-apps.script"
+
+// scriptProject is the JSON export of an Apps Script project.
+type scriptProject struct {
+	Files []struct {
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Source string `json:"source"`
+	} `json:"files"`
+}
+
+// scriptExtensions maps the source file types of an Apps Script project to
+// the extensions used by the Apps Script editor and clasp.
+var scriptExtensions = map[string]string{
+	"server_js": ".gs",
+	"html":      ".html",
+	"json":      ".json",
+}
+
+// fetchScript exports an Apps Script project and saves it as a folder at
+// relPath holding one file per source file of the project.
+func (c *Client) fetchScript(ctx context.Context, d *download, file *drivev3.File, entry ManifestEntry) error {
+	c.logf("Exporting file: %s", file.Name)
+	format := c.exportFormatFor(file)
+	entry.ExportMimeType = format.MimeType
+	body, err := c.exportFile(ctx, file, format)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var project scriptProject
+	if err := json.NewDecoder(body).Decode(&project); err != nil {
+		return fmt.Errorf("failed to decode script project: %w", err)
+	}
+	if err := d.sink.Mkdir(entry.Path); err != nil {
+		return err
+	}
+	modTime, _ := time.Parse(time.RFC3339, file.ModifiedTime)
+	for _, source := range project.Files {
+		name := path.Clean("/" + source.Name)[1:]
+		if name == "" {
+			return fmt.Errorf("script project %s has a file without a name", file.Name)
+		}
+		ext, ok := scriptExtensions[source.Type]
+		if !ok {
+			ext = "." + source.Type
+		}
+		n, _, err := d.sink.Save(path.Join(entry.Path, name+ext), modTime, strings.NewReader(source.Source))
+		if err != nil {
+			return err
+		}
+		entry.Size += n
+	}
+	c.Stats.addFile(entry.Size)
+	d.record(entry)
+	return nil
+}
@@ -0,0 +1,485 @@
+package drive
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// Timing of shared jobs. A worker counts a heartbeat in the files it has
+// claimed every claimHeartbeat; claims whose heartbeat a process sees
+// unchanged for claimTimeout, by its own clock, are considered abandoned by a
+// crashed worker and are put back in the queue. They are variables so that
+// tests can shorten them.
+var (
+	claimHeartbeat   = 30 * time.Second
+	claimTimeout     = 5 * time.Minute
+	sharedPollPeriod = 2 * time.Second
+)
+
+// A SharedJob is a download shared by several processes, possibly on
+// different machines, through a job directory on a shared filesystem. The
+// coordinator walks the folder and publishes one work item per file; workers
+// claim items by renaming them atomically and download them into a shared
+// download directory.
+//
+// The job directory holds job.json (the folder being downloaded and the
+// quotaUser its requests are sent with), a walked
+// marker once every file has been published, and the items themselves in
+// pending/, claimed/, done/ and failed/.
+//
+// Claims are kept alive by a heartbeat counted in the claimed item rather
+// than by its modification time, which the clocks of different machines and
+// the attribute caches of network filesystems make unreliable.
+type SharedJob struct {
+	dir    string
+	worker string // token identifying the claims of this process
+
+	mu       sync.Mutex
+	observed map[string]claimObservation // claims last seen, by file ID
+}
+
+// sharedClaim is the content of an item in claimed/: the pending item, the
+// worker that claimed it and the number of heartbeats it counted.
+type sharedClaim struct {
+	queueItem
+	Worker    string `json:"worker,omitempty"`
+	Heartbeat int64  `json:"heartbeat,omitempty"`
+}
+
+// claimObservation is what a process last saw of a claim, and when it first
+// saw it so, by its own clock.
+type claimObservation struct {
+	worker    string
+	heartbeat int64
+	since     time.Time
+}
+
+// sharedJobInfo is the content of job.json.
+type sharedJobInfo struct {
+	FolderID  string `json:"folderId"`
+	QuotaUser string `json:"quotaUser,omitempty"`
+}
+
+// sharedFailure is the content of an item in failed/.
+type sharedFailure struct {
+	Item  queueItem `json:"item"`
+	Error string    `json:"error"`
+}
+
+// OpenSharedJob opens the job directory at dir, creating it if needed.
+func OpenSharedJob(dir string) (*SharedJob, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	job := &SharedJob{dir: dir, worker: hex.EncodeToString(token), observed: make(map[string]claimObservation)}
+	for _, state := range []string{"pending", "claimed", "done", "failed"} {
+		if err := os.MkdirAll(filepath.Join(dir, state), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to create job directory: %w", err)
+		}
+	}
+	return job, nil
+}
+
+// item returns the path of the item for a file ID in the given state.
+func (job *SharedJob) item(state, id string) string {
+	return filepath.Join(job.dir, state, id+".json")
+}
+
+// info reads the job.json of the job.
+func (job *SharedJob) info() (sharedJobInfo, error) {
+	var info sharedJobInfo
+	data, err := os.ReadFile(filepath.Join(job.dir, "job.json"))
+	if err != nil {
+		return info, fmt.Errorf("failed to read job: %w", err)
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("failed to read job: %w", err)
+	}
+	return info, nil
+}
+
+// walked reports whether every file of the job has been published.
+func (job *SharedJob) walked() bool {
+	_, err := os.Stat(filepath.Join(job.dir, "walked"))
+	return err == nil
+}
+
+// write atomically writes v as JSON to path.
+func (job *SharedJob) write(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ids lists the file IDs of the items in a state.
+func (job *SharedJob) ids(state string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(job.dir, state))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// SharedProgress counts the items of a shared job in each state.
+type SharedProgress struct {
+	Pending, Claimed, Done, Failed int
+	// Walked is set once every file has been published.
+	Walked bool
+}
+
+// Finished reports whether every published item is done or failed.
+func (p SharedProgress) Finished() bool {
+	return p.Walked && p.Pending == 0 && p.Claimed == 0
+}
+
+// Progress counts the items of the job in each state.
+func (job *SharedJob) Progress() (SharedProgress, error) {
+	progress := SharedProgress{Walked: job.walked()}
+	for state, n := range map[string]*int{"pending": &progress.Pending, "claimed": &progress.Claimed, "done": &progress.Done, "failed": &progress.Failed} {
+		ids, err := job.ids(state)
+		if err != nil {
+			return progress, err
+		}
+		*n = len(ids)
+	}
+	return progress, nil
+}
+
+// reclaimStale puts claims abandoned by crashed workers back in the queue:
+// those whose worker and heartbeat were the same when this process last saw
+// them, at least claimTimeout ago.
+func (job *SharedJob) reclaimStale() {
+	ids, _ := job.ids("claimed")
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	observed := make(map[string]claimObservation, len(ids))
+	for _, id := range ids {
+		// An unreadable claim is seen as one that never beats.
+		claim, _ := job.readClaim(id)
+		last, ok := job.observed[id]
+		switch {
+		case !ok || last.worker != claim.Worker || last.heartbeat != claim.Heartbeat:
+			observed[id] = claimObservation{worker: claim.Worker, heartbeat: claim.Heartbeat, since: time.Now()}
+		case time.Since(last.since) > claimTimeout:
+			os.Rename(job.item("claimed", id), job.item("pending", id))
+		default:
+			observed[id] = last
+		}
+	}
+	job.observed = observed
+}
+
+// readClaim reads the claimed item of a file ID.
+func (job *SharedJob) readClaim(id string) (sharedClaim, error) {
+	var claim sharedClaim
+	data, err := os.ReadFile(job.item("claimed", id))
+	if err != nil {
+		return claim, err
+	}
+	err = json.Unmarshal(data, &claim)
+	return claim, err
+}
+
+// claim takes the item of a pending file ID, or returns false if another
+// worker claimed it first.
+func (job *SharedJob) claim(id string) (queueItem, bool) {
+	claimed := job.item("claimed", id)
+	if err := os.Rename(job.item("pending", id), claimed); err != nil {
+		return queueItem{}, false
+	}
+	claim, err := job.readClaim(id)
+	if err != nil || claim.File == nil {
+		job.write(job.item("failed", id), sharedFailure{Item: queueItem{File: &drivev3.File{Id: id}}, Error: "unreadable work item"})
+		os.Remove(claimed)
+		return queueItem{}, false
+	}
+	job.write(claimed, sharedClaim{queueItem: claim.queueItem, Worker: job.worker})
+	return claim.queueItem, true
+}
+
+// beat counts a heartbeat in a claim of this process. It returns false if
+// the claim is no longer this process's, because it was put back in the
+// queue after all.
+func (job *SharedJob) beat(id string) bool {
+	claim, err := job.readClaim(id)
+	if err != nil || claim.Worker != job.worker {
+		return false
+	}
+	claim.Heartbeat++
+	job.write(job.item("claimed", id), claim)
+	return true
+}
+
+// release removes a claim of this process once its item is done or failed,
+// leaving it alone if another worker claimed the item since.
+func (job *SharedJob) release(id string) {
+	if claim, err := job.readClaim(id); err == nil && claim.Worker == job.worker {
+		os.Remove(job.item("claimed", id))
+	}
+}
+
+// PublishFolder walks a Google Drive folder as the coordinator of a shared
+// job, creating its subfolders below downloadPath and publishing a work item
+// for each of its files. Files already published, done or failed are not
+// published again, so an interrupted coordinator can simply be restarted.
+//
+// The quotaUser requests are sent with (see WithQuotaUser) is recorded in
+// the job, and workers send it too, so that every shared job has rate limits
+// of its own.
+func (c *Client) PublishFolder(ctx context.Context, job *SharedJob, folderID, downloadPath string) error {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return err
+	}
+	if info, err := job.info(); err == nil && info.FolderID != folderID {
+		return fmt.Errorf("job directory %s belongs to folder %s", job.dir, info.FolderID)
+	}
+	info := sharedJobInfo{FolderID: folderID, QuotaUser: c.contextQuotaUser(ctx)}
+	if err := job.write(filepath.Join(job.dir, "job.json"), info); err != nil {
+		return fmt.Errorf("failed to write job: %w", err)
+	}
+	if job.walked() {
+		return nil
+	}
+
+	root := c.dirSink(downloadPath)
+	err := c.walk(ctx, folderID, func(item DriveItem) error {
+		if item.IsFolder() {
+			return root.Mkdir(item.Path)
+		}
+		if downloadRestricted(item.File) {
+			c.logf("Skipping %s: download disabled by its sharing settings", item.Path)
+			return nil
+		}
+		for _, state := range []string{"pending", "claimed", "done", "failed"} {
+			if _, err := os.Stat(job.item(state, item.ID)); err == nil {
+				return nil
+			}
+		}
+		return job.write(job.item("pending", item.ID), queueItem{Path: c.route(item.Path), File: item.File})
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(job.dir, "walked"), nil, 0o644)
+}
+
+// WaitSharedJob waits until every item of a shared job is done or failed,
+// putting claims abandoned by crashed workers back in the queue, then writes
+// the manifest of the download to downloadPath. Files that failed are
+// reported through a *DownloadError.
+func (c *Client) WaitSharedJob(ctx context.Context, job *SharedJob, downloadPath string) error {
+	for {
+		progress, err := job.Progress()
+		if err != nil {
+			return err
+		}
+		if progress.Finished() {
+			break
+		}
+		job.reclaimStale()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sharedPollPeriod):
+		}
+	}
+
+	info, err := job.info()
+	if err != nil {
+		return err
+	}
+	manifest := &Manifest{FolderID: info.FolderID}
+	ids, err := job.ids("done")
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		var entry ManifestEntry
+		if data, err := os.ReadFile(job.item("done", id)); err == nil && json.Unmarshal(data, &entry) == nil {
+			manifest.Put(entry)
+		}
+	}
+	if err := manifest.Save(filepath.Join(downloadPath, ManifestName)); err != nil {
+		return err
+	}
+
+	var failures []Failure
+	ids, err = job.ids("failed")
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		var failure sharedFailure
+		if data, err := os.ReadFile(job.item("failed", id)); err == nil && json.Unmarshal(data, &failure) == nil {
+			failures = append(failures, Failure{ID: id, Path: failure.Item.Path, Err: errors.New(failure.Error)})
+		}
+	}
+	if len(failures) > 0 {
+		return &DownloadError{Failures: failures}
+	}
+	return nil
+}
+
+// WorkSharedJob works on a shared job, claiming its items and downloading
+// them into downloadPath with Concurrency workers until every item of the
+// job is done or failed. Any number of processes may work on the same job.
+// Files that failed in this process are reported through a *DownloadError.
+// Requests are sent with the quotaUser recorded in the job, if any.
+func (c *Client) WorkSharedJob(ctx context.Context, job *SharedJob, downloadPath string) error {
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return err
+	}
+	info, err := job.info()
+	if err != nil {
+		return err
+	}
+	folderID := info.FolderID
+	if info.QuotaUser != "" {
+		ctx = WithQuotaUser(ctx, info.QuotaUser)
+	}
+	d := &download{root: downloadPath, sink: c.dirSink(downloadPath), shared: job, manifest: &Manifest{FolderID: folderID}}
+	if previous, err := LoadManifest(filepath.Join(downloadPath, ManifestName)); err == nil && previous.FolderID == folderID {
+		d.previous = previous
+	}
+
+	var (
+		mu       sync.Mutex
+		claimed  = make(map[string]bool) // items claimed by this process
+		failures []Failure
+	)
+	beatCtx, stopBeating := context.WithCancel(ctx)
+	heartbeat := time.NewTicker(claimHeartbeat)
+	var beating sync.WaitGroup
+	defer func() {
+		stopBeating()
+		beating.Wait()
+		heartbeat.Stop()
+	}()
+	beating.Add(1)
+	go func() {
+		defer beating.Done()
+		// Keep this process's claims from being considered abandoned.
+		for {
+			select {
+			case <-beatCtx.Done():
+				return
+			case <-heartbeat.C:
+			}
+			mu.Lock()
+			for id := range claimed {
+				if !job.beat(id) {
+					delete(claimed, id)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	ids := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < max(c.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				item, ok := job.claim(id)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				claimed[id] = true
+				mu.Unlock()
+
+				err := c.fetchFile(ctx, d, item.File, item.Path)
+				if ctx.Err() != nil {
+					// Leave the claim to be reclaimed once it goes stale.
+					return
+				}
+				mu.Lock()
+				if err != nil {
+					c.logf("Failed to download %s: %v", item.Path, err)
+					failures = append(failures, Failure{ID: id, Path: item.Path, Err: err})
+					job.write(job.item("failed", id), sharedFailure{Item: item, Error: err.Error()})
+				}
+				job.release(id)
+				delete(claimed, id)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err = c.feedSharedJob(ctx, job, ids)
+	close(ids)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return &DownloadError{Failures: failures}
+	}
+	return nil
+}
+
+// feedSharedJob sends the IDs of pending items to the workers until the job
+// is finished, putting abandoned claims back in the queue while it waits.
+func (c *Client) feedSharedJob(ctx context.Context, job *SharedJob, ids chan<- string) error {
+	for {
+		pending, err := job.ids("pending")
+		if err != nil {
+			return err
+		}
+		for _, id := range pending {
+			select {
+			case ids <- id:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(pending) > 0 {
+			continue
+		}
+
+		progress, err := job.Progress()
+		if err != nil {
+			return err
+		}
+		if progress.Finished() {
+			return nil
+		}
+		job.reclaimStale()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sharedPollPeriod):
+		}
+	}
+}
+
+// complete records a file downloaded for a shared job.
+func (job *SharedJob) complete(entry ManifestEntry) {
+	job.write(job.item("done", entry.ID), entry)
+}
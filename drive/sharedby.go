@@ -0,0 +1,103 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// sharedWithMeQuery lists the items shared with the user.
+const sharedWithMeQuery = "sharedWithMe = true and trashed = false"
+
+// SharedByID returns the ID the manifest of the items shared by the user with
+// the given email address records in place of a folder ID; see
+// DownloadSharedBy.
+func SharedByID(email string) string {
+	return "sharedBy:" + strings.ToLower(email)
+}
+
+// DownloadSharedBy downloads the items shared with the user of the client by
+// the users with the given email addresses, each into a directory of dest
+// named after their address in lower case, which is handy to collect submissions sent to an
+// inbox account. Like the shared section of DownloadBundle, files are
+// downloaded at the top of their directory and folders with all their
+// content, and every directory is a download of its own, with its manifest.
+//
+// Drive does not filter listings by the user who shared an item, so every
+// item shared with the user is listed once and matched against the
+// addresses; items whose sharing user Drive does not report are skipped. A
+// sharer whose download fails does not stop the others; the errors are
+// returned together.
+func (c *Client) DownloadSharedBy(ctx context.Context, emails []string, dest string) error {
+	if len(emails) == 0 {
+		return errors.New("no sharing user given")
+	}
+	if c.anonymous() {
+		return fmt.Errorf("listing shared items is %w", ErrAnonymous)
+	}
+	if err := c.requireScope(ctx, ReadonlyScope); err != nil {
+		return err
+	}
+	names := make(map[string]*folderNames, len(emails))
+	top := make(map[string][]namedFile, len(emails))
+	var sharers []string
+	for _, email := range emails {
+		sharer := strings.ToLower(email)
+		if names[sharer] == nil {
+			names[sharer] = c.newFolderNames()
+			sharers = append(sharers, sharer)
+		}
+	}
+	unknown := 0
+	_, err := c.listPages(ctx, sharedWithMeQuery, fileFields+", sharingUser(emailAddress)", nil, func(page []*drivev3.File) error {
+		for _, file := range page {
+			if file.SharingUser == nil || file.SharingUser.EmailAddress == "" {
+				unknown++
+				continue
+			}
+			sharer := strings.ToLower(file.SharingUser.EmailAddress)
+			if n, ok := names[sharer]; ok {
+				if name, ok := n.add(ctx, file); ok {
+					top[sharer] = append(top[sharer], namedFile{file: file, name: name})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if unknown > 0 {
+		c.logf("Skipping %d shared item(s) whose sharing user Drive does not report", unknown)
+	}
+
+	root := c.dirSink(dest)
+	var errs []error
+	for _, sharer := range sharers {
+		items := append(top[sharer], names[sharer].flush()...)
+		if len(items) == 0 {
+			c.logf("Nothing shared by %s", sharer)
+			continue
+		}
+		c.logf("Downloading the items shared by %s", sharer)
+		if err := root.Mkdir(sharer); err != nil {
+			return err
+		}
+		plan, err := c.planTop(ctx, SharedByID(sharer), items, filepath.Join(dest, sharer))
+		if err == nil {
+			err = c.ApplyPlan(ctx, plan)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			c.logf("Failed to download the items shared by %s: %v", sharer, err)
+			errs = append(errs, fmt.Errorf("%s: %w", sharer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
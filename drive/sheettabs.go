@@ -0,0 +1,125 @@
+package drive
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// csvTabsMimeType is the export MIME type recorded for spreadsheets too large
+// to export, which are saved as a folder of CSV files instead.
+const csvTabsMimeType = "text/csv"
+
+// sheetRowsPerRead is the number of rows of a tab read by every Sheets API
+// request when even its CSV export is too large.
+const sheetRowsPerRead = 5000
+
+// fetchSheetTabs saves a spreadsheet that Drive refused to export because it
+// is too large as a folder at relPath holding a CSV file per tab, so that its
+// data is still recovered. Every tab is exported on its own through the
+// export URL of the spreadsheet, or else read through the Sheets API a few
+// thousand rows at a time. Formatting, formulas and charts are lost.
+func (c *Client) fetchSheetTabs(ctx context.Context, d *download, file *drivev3.File, entry ManifestEntry) error {
+	c.logf("Saving %s as CSV files, one per tab: the spreadsheet is too large to export", file.Name)
+	service, err := sheets.NewService(ctx, option.WithHTTPClient(c.http))
+	if err != nil {
+		return fmt.Errorf("failed to create Sheets service: %w", err)
+	}
+	spreadsheet, err := service.Spreadsheets.Get(file.Id).
+		Fields("sheets.properties(sheetId,title,gridProperties.rowCount)").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to list the tabs of the spreadsheet: %w", err)
+	}
+	if err := d.sink.Mkdir(entry.Path); err != nil {
+		return err
+	}
+	entry.ExportMimeType = csvTabsMimeType
+	modTime, _ := time.Parse(time.RFC3339, file.ModifiedTime)
+	names := c.newFolderNames()
+	for _, sheet := range spreadsheet.Sheets {
+		tab := sheet.Properties
+		if tab == nil {
+			continue
+		}
+		gid := strconv.FormatInt(tab.SheetId, 10)
+		title := strings.NewReplacer("/", "_", `\`, "_").Replace(tab.Title)
+		name := names.claim(&drivev3.File{Id: gid}, c.fileName(&drivev3.File{Id: gid, Name: title})+".csv", "")
+		n, err := c.saveSheetTab(ctx, d, service, file, tab, path.Join(entry.Path, name), modTime)
+		if err != nil {
+			return fmt.Errorf("tab %q: %w", tab.Title, err)
+		}
+		entry.Size += n
+	}
+	c.Stats.addFile(entry.Size)
+	d.record(entry)
+	return nil
+}
+
+// saveSheetTab saves a tab of a spreadsheet as CSV to relPath and returns its
+// size.
+func (c *Client) saveSheetTab(ctx context.Context, d *download, service *sheets.Service, file *drivev3.File, tab *sheets.SheetProperties, relPath string, modTime time.Time) (int64, error) {
+	exportURL := fmt.Sprintf(sheetExportURL, url.PathEscape(file.Id)) + "?format=csv&gid=" + strconv.FormatInt(tab.SheetId, 10)
+	body, err := c.openPublic(ctx, exportURL)
+	if err == nil {
+		defer body.Close()
+		n, _, err := d.sink.Save(relPath, modTime, body)
+		return n, err
+	}
+	c.logf("Reading tab %q of %s through the Sheets API: %v", tab.Title, file.Name, err)
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(readSheetTab(ctx, service, file.Id, tab, w))
+	}()
+	defer r.Close()
+	n, _, err := d.sink.Save(relPath, modTime, r)
+	return n, err
+}
+
+// readSheetTab reads the values of a tab through the Sheets API, a block of
+// rows at a time, and writes them to w as CSV.
+func readSheetTab(ctx context.Context, service *sheets.Service, spreadsheetID string, tab *sheets.SheetProperties, w io.Writer) error {
+	var rows int64
+	if tab.GridProperties != nil {
+		rows = tab.GridProperties.RowCount
+	}
+	title := "'" + strings.ReplaceAll(tab.Title, "'", "''") + "'"
+	out := csv.NewWriter(w)
+	// Empty rows at the end of a block are left out of the response; they
+	// are only written once a later block has values.
+	var blank int64
+	for first := int64(1); first <= rows; first += sheetRowsPerRead {
+		last := min(first+sheetRowsPerRead-1, rows)
+		values, err := service.Spreadsheets.Values.Get(spreadsheetID, fmt.Sprintf("%s!%d:%d", title, first, last)).
+			ValueRenderOption("FORMATTED_VALUE").Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("failed to read rows %d to %d: %w", first, last, err)
+		}
+		if len(values.Values) > 0 {
+			for ; blank > 0; blank-- {
+				out.Write(nil)
+			}
+		}
+		for _, row := range values.Values {
+			record := make([]string, len(row))
+			for i, value := range row {
+				record[i] = fmt.Sprint(value)
+			}
+			if err := out.Write(record); err != nil {
+				return err
+			}
+		}
+		blank += last - first + 1 - int64(len(values.Values))
+	}
+	out.Flush()
+	return out.Error()
+}
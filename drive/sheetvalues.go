@@ -0,0 +1,124 @@
+package drive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// Parts of the formulas of XLSX and ODS spreadsheets: the formula elements
+// of the cells of XLSX worksheets, the calculation chain listing them and
+// its references, and the formula attributes of the cells of ODS tables.
+// The values last computed for the cells are stored next to their formulas.
+var (
+	xlsxFormulaPattern   = regexp.MustCompile(`(?s)<f(?:\s[^>]*)?(?:/>|>.*?</f>)`)
+	xlsxCalcChainPattern = regexp.MustCompile(`<(?:Override|Relationship)\s[^>]*calcChain\.xml[^>]*/>`)
+	odsFormulaPattern    = regexp.MustCompile(`\stable:formula="[^"]*"`)
+)
+
+// valuesOnly reports whether the formulas of a spreadsheet exported in format
+// are replaced by their values, as SheetValuesOnly asks.
+func (c *Client) valuesOnly(file *drivev3.File, format exportFormat) bool {
+	return c.SheetValuesOnly && file.MimeType == sheetMimeType &&
+		(format.MimeType == sheetFormats[SheetXLSX].MimeType || format.MimeType == sheetFormats[SheetODS].MimeType)
+}
+
+// stripFormulas returns the spreadsheet exported as body in format with the
+// formulas of its cells removed, keeping the values they last computed.
+// Archives are read from the end, so the export is spooled to disk, and the
+// rewritten spreadsheet is read from a temporary file deleted once closed.
+func stripFormulas(body io.ReadCloser, format exportFormat) (io.ReadCloser, error) {
+	defer body.Close()
+	src, err := os.CreateTemp("", "drive-downloader-*"+format.Extension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove formulas: %w", err)
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+	size, err := io.Copy(src, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export file: %w", err)
+	}
+	archive, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove formulas: %w", err)
+	}
+
+	dst, err := os.CreateTemp("", "drive-downloader-*"+format.Extension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove formulas: %w", err)
+	}
+	if err := rewriteSpreadsheet(archive, dst); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return nil, fmt.Errorf("failed to remove formulas: %w", err)
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return nil, fmt.Errorf("failed to remove formulas: %w", err)
+	}
+	return &tempFile{File: dst}, nil
+}
+
+// rewriteSpreadsheet copies the entries of an XLSX or ODS archive to w in
+// their order, which ODS requires, without the formulas of its cells.
+func rewriteSpreadsheet(archive *zip.Reader, w io.Writer) error {
+	out := zip.NewWriter(w)
+	for _, entry := range archive.File {
+		var patterns []*regexp.Regexp
+		switch {
+		case entry.Name == "xl/calcChain.xml":
+			// Excel repairs workbooks whose chain lists cells without
+			// formulas.
+			continue
+		case strings.HasPrefix(entry.Name, "xl/worksheets/") && strings.HasSuffix(entry.Name, ".xml"):
+			patterns = []*regexp.Regexp{xlsxFormulaPattern}
+		case entry.Name == "[Content_Types].xml" || entry.Name == "xl/_rels/workbook.xml.rels":
+			patterns = []*regexp.Regexp{xlsxCalcChainPattern}
+		case entry.Name == "content.xml":
+			patterns = []*regexp.Regexp{odsFormulaPattern}
+		default:
+			if err := out.Copy(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		for _, pattern := range patterns {
+			data = pattern.ReplaceAll(data, nil)
+		}
+		f, err := out.CreateHeader(&zip.FileHeader{Name: entry.Name, Method: entry.Method, Modified: entry.Modified})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// tempFile is a temporary file deleted once closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
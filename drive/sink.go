@@ -0,0 +1,162 @@
+package drive
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// sink stores the files and folders of a download.
+type sink interface {
+	// Mkdir creates the folder at relPath.
+	Mkdir(relPath string) error
+	// Save stores the content of r as the file at relPath and returns the
+	// number of bytes written and their hex-encoded MD5 checksum. modTime is
+	// recorded by sinks that keep modification times.
+	Save(relPath string, modTime time.Time, r io.Reader) (int64, string, error)
+}
+
+// dirSink stores files below a local directory, with the client's
+// permissions, compressing and encrypting them as the client's Compression
+// and Encryption select, and flushing them to stable storage if its Fsync
+// is set.
+type dirSink struct {
+	root        string
+	perm        filePermissions
+	compress    Compression
+	encrypt     *Encryption
+	fsync       bool
+	preallocate bool
+}
+
+// dirSink returns the sink storing files below root.
+func (c *Client) dirSink(root string) dirSink {
+	return dirSink{
+		root:        root,
+		perm:        filePermissions{file: c.FileMode, dir: c.DirMode, owner: c.Ownership},
+		compress:    c.Compression,
+		encrypt:     c.Encryption,
+		fsync:       c.Fsync,
+		preallocate: c.Preallocate,
+	}
+}
+
+func (s dirSink) Mkdir(relPath string) error {
+	if err := s.perm.mkdirAll(filepath.Join(s.root, filepath.FromSlash(relPath))); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	return nil
+}
+
+// Save stores the file at relPath, or compressed and then encrypted at its
+// storedPath, in which case the size and checksum returned are those of the
+// original content.
+func (s dirSink) Save(relPath string, modTime time.Time, r io.Reader) (int64, string, error) {
+	filePath := filepath.Join(s.root, filepath.FromSlash(relPath))
+	if err := s.perm.mkdirAll(filepath.Dir(filePath)); err != nil {
+		return 0, "", fmt.Errorf("failed to create folder: %w", err)
+	}
+	filePath += s.compress.Extension()
+	if s.encrypt != nil {
+		filePath += s.encrypt.Extension
+	}
+	f, err := s.perm.create(filePath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	w := io.Writer(f)
+	// Encrypted data does not compress, so compression comes first.
+	var closers []io.Closer
+	if s.encrypt != nil {
+		encrypted, err := s.encrypt.writer(w)
+		if err != nil {
+			return 0, "", err
+		}
+		w = encrypted
+		closers = append(closers, encrypted)
+	}
+	if s.compress != CompressionNone {
+		compressed, err := s.compress.writer(w)
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return 0, "", err
+		}
+		w = compressed
+		closers = append(closers, compressed)
+	}
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), r)
+	for i := len(closers) - 1; i >= 0; i-- {
+		if closeErr := closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil && s.fsync {
+		err = syncFile(f)
+	}
+	if err != nil {
+		return n, "", fmt.Errorf("failed to save file: %w", err)
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// transforms reports whether files are stored compressed or encrypted rather
+// than as they are.
+func (s dirSink) transforms() bool {
+	return s.compress != CompressionNone || s.encrypt != nil
+}
+
+// storedPath returns the path relPath is stored at, with the extensions of
+// the compression and encryption of files.
+func (s dirSink) storedPath(relPath string) string {
+	relPath += s.compress.Extension()
+	if s.encrypt != nil {
+		relPath += s.encrypt.Extension
+	}
+	return relPath
+}
+
+// record notes in entry how its file is stored, if it is transformed.
+func (s dirSink) record(entry *ManifestEntry) {
+	if !s.transforms() {
+		return
+	}
+	entry.StoredPath = s.storedPath(entry.Path)
+	entry.Compression = s.compress.String()
+	entry.Encrypted = s.encrypt != nil
+}
+
+// saveUnhashed is like Save, but leaves computing the checksum of the file to
+// the caller. size is the expected size of the file, if known, for the sink
+// to preallocate.
+func (s dirSink) saveUnhashed(relPath string, size int64, r io.Reader) (int64, error) {
+	filePath := filepath.Join(s.root, filepath.FromSlash(relPath))
+	if err := s.perm.mkdirAll(filepath.Dir(filePath)); err != nil {
+		return 0, fmt.Errorf("failed to create folder: %w", err)
+	}
+	f, err := s.perm.create(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	if s.preallocate && size > 0 {
+		preallocate(f, size)
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && s.fsync {
+		err = syncFile(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to save file: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,193 @@
+package drive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SparseName is the name of the sparse specification that DownloadFolder
+// reads from the root of the download directory when the client has no
+// Sparse of its own.
+const SparseName = ".drive-sparse"
+
+// pathPattern is a pattern of a sparse specification or an ignore file.
+type pathPattern struct {
+	pattern string // as matched by matchPath
+	negated bool   // written with a leading "!"
+}
+
+// parsePathPatterns reads patterns, one per line, in the syntax of
+// gitignore files: blank lines and lines starting with "#" are skipped, a
+// leading "!" negates the pattern, and leading and trailing slashes are
+// dropped.
+func parsePathPatterns(r io.Reader) ([]pathPattern, error) {
+	var patterns []pathPattern
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var p pathPattern
+		if rest, ok := strings.CutPrefix(text, "!"); ok {
+			p.negated, text = true, rest
+		}
+		p.pattern = strings.Trim(text, "/")
+		if p.pattern == "" {
+			return nil, fmt.Errorf("line %d: empty pattern", line)
+		}
+		for _, elem := range strings.Split(p.pattern, "/") {
+			if _, err := path.Match(elem, ""); err != nil {
+				return nil, fmt.Errorf("line %d: invalid pattern %q", line, text)
+			}
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// lastMatch returns the index of the last of patterns matching relPath or one
+// of the folders above it, and -1 if none does.
+func lastMatch(patterns []pathPattern, relPath string) int {
+	elems := strings.Split(relPath, "/")
+	for i := len(patterns) - 1; i >= 0; i-- {
+		for n := 1; n <= len(elems); n++ {
+			if matchPath(patterns[i].pattern, strings.Join(elems[:n], "/")) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Sparse is a sparse specification, which limits a download to some parts of
+// a folder, like a git sparse-checkout: only the files whose path matches one
+// of its patterns are downloaded, so that the parts of a huge shared drive
+// every machine mirrors can be kept under version control.
+//
+// A specification holds a pattern per line. A pattern matches the local path
+// of a file below the downloaded folder, ignoring case, or one of the folders
+// above it, so that "Projects/Alpha" includes everything in that folder. Its
+// elements are path.Match patterns, and "**" matches any number of them, as
+// in "**/*.pdf"; a pattern without a slash, such as "*.pdf", matches names in
+// any folder. Blank lines and lines starting with "#" are skipped. A pattern
+// starting with "!" excludes what it matches again, the last matching pattern
+// deciding, e.g. "!Projects/Alpha/Archive".
+type Sparse struct {
+	patterns []pathPattern
+}
+
+// ParseSparse reads a sparse specification.
+func ParseSparse(r io.Reader) (*Sparse, error) {
+	patterns, err := parsePathPatterns(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sparse specification: %w", err)
+	}
+	return &Sparse{patterns: patterns}, nil
+}
+
+// LoadSparse reads a sparse specification from a file.
+func LoadSparse(path string) (*Sparse, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sparse specification: %w", err)
+	}
+	defer f.Close()
+	return ParseSparse(f)
+}
+
+// Includes reports whether the file at relPath is downloaded.
+func (s *Sparse) Includes(relPath string) bool {
+	i := lastMatch(s.patterns, relPath)
+	return i >= 0 && !s.patterns[i].negated
+}
+
+// enters reports whether the folder at relPath may hold files the
+// specification includes, and is therefore listed: if it is included itself,
+// or if a pattern following the last one matching it may include paths
+// below it.
+func (s *Sparse) enters(relPath string) bool {
+	i := lastMatch(s.patterns, relPath)
+	if i >= 0 && !s.patterns[i].negated {
+		return true
+	}
+	dir := strings.Split(strings.ToLower(relPath), "/")
+	for _, p := range s.patterns[i+1:] {
+		if !p.negated && (!strings.Contains(p.pattern, "/") || matchPrefix(strings.Split(strings.ToLower(p.pattern), "/"), dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix reports whether the elements of a folder match the leading
+// elements of a pattern, so that paths below the folder may match it.
+// Patterns matching the folder or a folder above it are left to Includes.
+func matchPrefix(pattern, dir []string) bool {
+	for ; len(pattern) > 0 && len(dir) > 0; pattern, dir = pattern[1:], dir[1:] {
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], dir[0]); !ok {
+			return false
+		}
+	}
+	return len(dir) == 0
+}
+
+// dirRules are the rules limiting the paths a download walks: the client's
+// Sparse, or else the SparseName file of the download directory, and the
+// IgnoreName file of the download directory.
+type dirRules struct {
+	sparse *Sparse
+	ignore []pathPattern
+}
+
+// loadDirRules returns the rules of a download into downloadPath, nil if
+// there are none.
+func (c *Client) loadDirRules(downloadPath string) (*dirRules, error) {
+	sparse := c.Sparse
+	if sparse == nil && downloadPath != "" {
+		s, err := LoadSparse(filepath.Join(downloadPath, SparseName))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		sparse = s
+	}
+	var ignore []pathPattern
+	if downloadPath != "" {
+		patterns, err := loadIgnore(filepath.Join(downloadPath, IgnoreName))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		ignore = patterns
+	}
+	if sparse == nil && len(ignore) == 0 {
+		return nil, nil
+	}
+	return &dirRules{sparse: sparse, ignore: ignore}, nil
+}
+
+// skip reports whether the rules leave the item at relPath out of the walk.
+func (r *dirRules) skip(relPath string, isFolder bool) bool {
+	if r == nil {
+		return false
+	}
+	if i := lastMatch(r.ignore, relPath); i >= 0 && !r.ignore[i].negated {
+		return true
+	}
+	if r.sparse == nil {
+		return false
+	}
+	if isFolder {
+		return !r.sparse.enters(relPath)
+	}
+	return !r.sparse.Includes(relPath)
+}
@@ -0,0 +1,213 @@
+package drive
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// statusInterval is how often the status file is rewritten.
+const statusInterval = 2 * time.Second
+
+// States of a download reported in its status file.
+const (
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+)
+
+// Status is the progress of a download, written as JSON to the client's
+// StatusFile while the download runs. Totals only cover the files found so
+// far until Walked is set.
+type Status struct {
+	State      string          `json:"state"`
+	FolderID   string          `json:"folderId"`
+	Started    time.Time       `json:"started"`
+	Updated    time.Time       `json:"updated"`
+	Walked     bool            `json:"walked"`
+	FilesTotal int64           `json:"filesTotal"`
+	FilesDone  int64           `json:"filesDone"`
+	BytesTotal int64           `json:"bytesTotal"`
+	BytesDone  int64           `json:"bytesDone"`
+	Current    []string        `json:"current"`
+	ETASeconds int64           `json:"etaSeconds,omitempty"`
+	Failures   []StatusFailure `json:"failures,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// StatusFailure is a file that could not be downloaded.
+type StatusFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// statusWriter tracks the progress of a download and periodically writes it
+// to a status file. A nil *statusWriter tracks nothing, so callers need not
+// check whether a status file was requested.
+type statusWriter struct {
+	path string
+
+	mu      sync.Mutex
+	status  Status
+	current map[string]bool
+	resumed int64 // bytes completed by earlier runs, excluded from the rate
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newStatus starts writing the status of a download of folderID to the
+// client's StatusFile, or returns nil if it has none.
+func (c *Client) newStatus(folderID string) *statusWriter {
+	if c.StatusFile == "" {
+		return nil
+	}
+	s := &statusWriter{
+		path:    c.StatusFile,
+		status:  Status{State: StateRunning, FolderID: folderID, Started: time.Now()},
+		current: make(map[string]bool),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.stopped)
+		ticker := time.NewTicker(statusInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.write(); err != nil {
+				c.logf("Failed to write status: %v", err)
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// found counts a file to download.
+func (s *statusWriter) found(file *drivev3.File) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.FilesTotal++
+	s.status.BytesTotal += file.Size
+}
+
+// resume counts a file completed by an earlier run.
+func (s *statusWriter) resume(entry ManifestEntry) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.FilesTotal++
+	s.status.FilesDone++
+	s.status.BytesTotal += entry.Size
+	s.status.BytesDone += entry.Size
+	s.resumed += entry.Size
+}
+
+// walked records that every file has been found.
+func (s *statusWriter) walked() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Walked = true
+}
+
+// start records that a file is being downloaded.
+func (s *statusWriter) start(relPath string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current[relPath] = true
+}
+
+// finish records that a file is no longer being downloaded, and counts it as
+// done if it did not fail.
+func (s *statusWriter) finish(file *drivev3.File, relPath string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.current, relPath)
+	if err == nil {
+		s.status.FilesDone++
+		s.status.BytesDone += file.Size
+	}
+}
+
+// fail records a file that could not be downloaded.
+func (s *statusWriter) fail(relPath string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Failures = append(s.status.Failures, StatusFailure{Path: relPath, Error: err.Error()})
+}
+
+// close stops the periodic writes and writes the final status of the
+// download, which ended with err.
+func (s *statusWriter) close(err error) error {
+	if s == nil {
+		return nil
+	}
+	close(s.stop)
+	<-s.stopped
+	s.mu.Lock()
+	s.status.State = StateCompleted
+	if err != nil {
+		s.status.State = StateFailed
+		s.status.Error = err.Error()
+	}
+	clear(s.current)
+	s.mu.Unlock()
+	return s.write()
+}
+
+// write atomically replaces the status file with the current status.
+func (s *statusWriter) write() error {
+	s.mu.Lock()
+	status := s.status
+	status.Updated = time.Now()
+	status.Current = make([]string, 0, len(s.current))
+	for relPath := range s.current {
+		status.Current = append(status.Current, relPath)
+	}
+	sort.Strings(status.Current)
+	status.Failures = append([]StatusFailure(nil), s.status.Failures...)
+	transferred := status.BytesDone - s.resumed
+	s.mu.Unlock()
+
+	// The ETA is only meaningful once the total is known.
+	elapsed := status.Updated.Sub(status.Started)
+	if status.State == StateRunning && status.Walked && transferred > 0 {
+		rate := float64(transferred) / elapsed.Seconds()
+		status.ETASeconds = int64(float64(status.BytesTotal-status.BytesDone) / rate)
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
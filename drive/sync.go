@@ -0,0 +1,256 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// unchanged reports whether the file recorded as prev by a previous download
+// is still present at filePath and its remote copy has not been modified
+// since, in which case entry does not need to be downloaded again. Files
+// without a known modification time are never considered unchanged.
+func unchanged(prev, entry ManifestEntry, filePath string) bool {
+	if entry.ModifiedTime == "" || prev.Path != entry.Path || prev.ModifiedTime != entry.ModifiedTime {
+		return false
+	}
+	if prev.StoredPath != "" {
+		// The compressed or encrypted copy has another size than the
+		// original.
+		_, err := os.Stat(filePath + strings.TrimPrefix(prev.StoredPath, prev.Path))
+		return err == nil
+	}
+	if prev.Discarded {
+		// Only the content extracted from the archive was kept.
+		info, err := os.Stat(extractDir(filePath))
+		return err == nil && info.IsDir()
+	}
+	info, err := os.Stat(filePath)
+	if err == nil && info.IsDir() {
+		// Apps Script projects are saved as folders, and so are
+		// spreadsheets too large to export.
+		return prev.MimeType == scriptMimeType || prev.ExportMimeType == csvTabsMimeType
+	}
+	return err == nil && info.Size() == prev.Size
+}
+
+// sameRevision reports whether a file modified since the previous download,
+// recorded as prev, still has the revision then recorded, so that only its
+// metadata changed. The revision of Google documents, which Drive does not
+// list with them, is looked up and set in entry.
+func (c *Client) sameRevision(ctx context.Context, prev ManifestEntry, entry *ManifestEntry, file *drivev3.File) bool {
+	if prev.Revision == "" || entry.ModifiedTime == "" || prev.ModifiedTime == entry.ModifiedTime {
+		return false
+	}
+	if isGoogleDoc(file) {
+		entry.Revision = c.docRevision(ctx, file)
+	}
+	return entry.Revision == prev.Revision
+}
+
+// docRevision returns the revision of a Google document recorded in the
+// manifest: the ID and modification time of its latest revision, as edits
+// made shortly after one another may update the same revision. It returns an
+// empty string if the revisions cannot be listed, for instance because the
+// user may only view the document.
+func (c *Client) docRevision(ctx context.Context, file *drivev3.File) string {
+	if c.anonymous() {
+		return ""
+	}
+	var head *drivev3.Revision
+	err := c.Service.Revisions.List(file.Id).Fields("nextPageToken, revisions(id, modifiedTime)").PageSize(1000).
+		Pages(ctx, func(page *drivev3.RevisionList) error {
+			if n := len(page.Revisions); n > 0 {
+				head = page.Revisions[n-1]
+			}
+			return nil
+		})
+	if err != nil {
+		c.debugf(DebugDownloader, "Failed to list the revisions of %s: %v", file.Name, err)
+	}
+	if err != nil || head == nil {
+		return ""
+	}
+	return head.Id + "@" + head.ModifiedTime
+}
+
+// fileAction decides what a download does with a file, given the entry prev
+// recorded by the previous download, if found, the entry it would record and
+// the path of the local copy: ActionSkip if the local copy is up to date,
+// ActionMove if it only needs to be moved to the new path of the file, or
+// else ActionDownload, or ActionExport for Google documents other than link
+// stubs. Downloads carry the action out and plans record it. If only the
+// metadata of the file changed, prev is returned with the new modification
+// time and revision.
+func (c *Client) fileAction(ctx context.Context, prev ManifestEntry, found bool, entry *ManifestEntry, file *drivev3.File, filePath string) (string, ManifestEntry) {
+	fetch := ActionDownload
+	if isGoogleDoc(file) && c.LinkStubs != LinkStubsOnly {
+		fetch = ActionExport
+	}
+	if !found {
+		return fetch, prev
+	}
+	if c.sameRevision(ctx, prev, entry, file) {
+		// Only its metadata changed: it is kept, or moved if renamed,
+		// rather than downloaded or exported again.
+		c.debugf(DebugDownloader, "Same revision since the last download: %s", entry.Path)
+		prev.ModifiedTime, prev.Revision = entry.ModifiedTime, entry.Revision
+	}
+	switch {
+	case unchanged(prev, *entry, filePath):
+		return ActionSkip, prev
+	case prev.Path != entry.Path && sameContent(prev, *entry, file):
+		return ActionMove, prev
+	}
+	return fetch, prev
+}
+
+// sameContent reports whether a file, recorded as prev by the previous
+// download, still has the content then downloaded: by its checksum and size,
+// or else by its revision, or for files with neither by its modification
+// time. Moving or renaming a file updates its modification time, but neither
+// its content nor its revision.
+func sameContent(prev, entry ManifestEntry, file *drivev3.File) bool {
+	if !isGoogleDoc(file) && file.Md5Checksum != "" {
+		return file.Md5Checksum == prev.MD5 && file.Size == prev.Size
+	}
+	if entry.ModifiedTime != "" && entry.ModifiedTime == prev.ModifiedTime {
+		return true
+	}
+	return entry.Revision != "" && entry.Revision == prev.Revision
+}
+
+// moveLocal handles a file that was moved or renamed within the Drive folder
+// since the previous download: if its content is unchanged and the local copy
+// recorded as prev still has the recorded checksum, the local copy is renamed
+// to the file's new path instead of downloading it again. It reports whether
+// the file was moved.
+func (c *Client) moveLocal(d *download, prev, entry ManifestEntry, file *drivev3.File) bool {
+	if prev.Path == entry.Path || !sameContent(prev, entry, file) {
+		return false
+	}
+
+	if cas, ok := d.sink.(*casSink); ok {
+		// Only the paths of the tree move.
+		if _, err := os.Stat(cas.localPath(prev)); err != nil {
+			return false
+		}
+		cas.move(prev.Path, entry.Path)
+		c.logf("Moving file: %s -> %s", prev.Path, entry.Path)
+		entry.ExportMimeType, entry.Size, entry.MD5, entry.Object = prev.ExportMimeType, prev.Size, prev.MD5, prev.Object
+		entry.SHA256, entry.Checksum = prev.SHA256, prev.Checksum
+		d.record(entry)
+		return true
+	}
+
+	oldPath := filepath.Join(d.root, filepath.FromSlash(prev.Path))
+	newPath := filepath.Join(d.root, filepath.FromSlash(entry.Path))
+	// A compressed or encrypted copy is checked as repair does, and moved
+	// with the extensions it is stored with.
+	stored := strings.TrimPrefix(prev.StoredPath, prev.Path)
+	if prev.StoredPath != "" {
+		if err := prev.Verify(d.root); err != nil {
+			return false
+		}
+	} else if _, sum, err := hashFile(oldPath); err != nil || sum != prev.MD5 {
+		return false
+	}
+	if err := c.dirSink(d.root).perm.mkdirAll(filepath.Dir(newPath)); err != nil {
+		return false
+	}
+	if err := os.Rename(oldPath+stored, newPath+stored); err != nil {
+		return false
+	}
+	if prev.StoredPath != "" {
+		entry.StoredPath, entry.Compression, entry.Encrypted = entry.Path+stored, prev.Compression, prev.Encrypted
+	}
+	// Sidecars, if any, follow their file.
+	os.Rename(oldPath+SidecarExtension, newPath+SidecarExtension)
+	for _, ext := range commentsExtensions {
+		os.Rename(oldPath+ext, newPath+ext)
+	}
+	if c.LinkStubs == LinkStubsAlongside && isGoogleDoc(file) {
+		format := c.exportFormatFor(file)
+		os.Rename(linkStubPath(oldPath, format), linkStubPath(newPath, format))
+	}
+
+	c.logf("Moving file: %s -> %s", prev.Path, entry.Path)
+	entry.ExportMimeType, entry.Size, entry.MD5 = prev.ExportMimeType, prev.Size, prev.MD5
+	entry.SHA256, entry.Checksum = prev.SHA256, prev.Checksum
+	d.record(entry)
+	return true
+}
+
+// probeUnchanged handles a large file without a checksum that was modified
+// since the previous download without changing size: if the first and last
+// ProbeSize bytes of its remote content match the local copy recorded as
+// prev, the file is taken to be unchanged and recorded with its new
+// modification time instead of being downloaded again. Only those bytes are
+// transferred, at the risk of missing a change in the middle of the file.
+// It reports whether the file was found unchanged.
+func (c *Client) probeUnchanged(ctx context.Context, d *download, prev, entry ManifestEntry, file *drivev3.File, filePath string) bool {
+	if c.ProbeSize <= 0 || c.anonymous() || isGoogleDoc(file) || file.Md5Checksum != "" ||
+		prev.Path != entry.Path || file.Size != prev.Size || file.Size <= 2*c.ProbeSize {
+		return false
+	}
+	local, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer local.Close()
+	if info, err := local.Stat(); err != nil || info.Size() != prev.Size {
+		return false
+	}
+
+	for _, offset := range []int64{0, file.Size - c.ProbeSize} {
+		same, err := c.probeRange(ctx, file.Id, local, offset, c.ProbeSize)
+		if err != nil {
+			c.debugf(DebugDownloader, "Failed to probe %s: %v", entry.Path, err)
+			return false
+		}
+		if !same {
+			return false
+		}
+	}
+
+	c.logf("Unchanged content, not downloading again: %s", entry.Path)
+	if modTime, err := time.Parse(time.RFC3339, file.ModifiedTime); err == nil && prev.Object == "" {
+		// Objects may be shared by several files.
+		os.Chtimes(filePath, modTime, modTime)
+	}
+	entry.Size, entry.MD5, entry.Object = prev.Size, prev.MD5, prev.Object
+	d.record(entry)
+	return true
+}
+
+// probeRange reports whether n bytes of a file's remote content starting at
+// offset are the same as those of local.
+func (c *Client) probeRange(ctx context.Context, fileID string, local io.ReaderAt, offset, n int64) (bool, error) {
+	call := c.Service.Files.Get(fileID).Context(ctx)
+	call.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+n-1))
+	resp, err := call.Download()
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	remote, err := io.ReadAll(io.LimitReader(resp.Body, n+1))
+	if err != nil {
+		return false, err
+	}
+	if int64(len(remote)) != n {
+		// The range was ignored or the file changed size.
+		return false, nil
+	}
+	want := make([]byte, n)
+	if _, err := local.ReadAt(want, offset); err != nil {
+		return false, err
+	}
+	return bytes.Equal(remote, want), nil
+}
@@ -0,0 +1,186 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// bandwidthBurst is the number of seconds of transfer at the bandwidth limit
+// that may be received at once after an idle period.
+const bandwidthBurst = 1
+
+// throttle holds the limits of the downloads of a client that SetConcurrency
+// and SetBandwidthLimit change while they run. The bandwidth is shared by
+// every file being downloaded, through a token bucket.
+type throttle struct {
+	mu          sync.Mutex
+	concurrency int                  // overrides Client.Concurrency if positive
+	bandwidth   *int64               // overrides Client.BandwidthLimit if set
+	pools       map[*workerPool]bool // workers of the downloads in progress
+	tokens      float64              // bytes that may be received without waiting
+	last        time.Time            // when tokens was last updated
+}
+
+// SetConcurrency changes the number of files downloaded at the same time,
+// both by the downloads in progress and by later ones, which otherwise use
+// Concurrency. Downloads in progress start more workers at once, and stop
+// workers as they finish their current file. It is safe to call while the
+// client downloads, unlike setting Concurrency.
+func (c *Client) SetConcurrency(n int) {
+	t := c.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.concurrency = max(n, 1)
+	for pool := range t.pools {
+		pool.resize(t.concurrency)
+	}
+}
+
+// SetBandwidthLimit changes the maximum number of bytes per second received
+// for the content of files, 0 for no limit, both by the downloads in progress
+// and by later ones, which otherwise use BandwidthLimit. It is safe to call
+// while the client downloads, unlike setting BandwidthLimit.
+func (c *Client) SetBandwidthLimit(bytesPerSecond int64) {
+	t := c.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limit := max(bytesPerSecond, 0)
+	t.bandwidth = &limit
+}
+
+// concurrency returns the number of files downloaded at the same time.
+func (c *Client) concurrency() int {
+	t := c.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.concurrency > 0 {
+		return t.concurrency
+	}
+	return max(c.Concurrency, 1)
+}
+
+// bandwidthLimit returns the maximum number of bytes per second received, 0
+// if there is none.
+func (t *throttle) bandwidthLimit(c *Client) int64 {
+	if t.bandwidth != nil {
+		return *t.bandwidth
+	}
+	return c.BandwidthLimit
+}
+
+// waitBandwidth waits until n more bytes may be received.
+func (c *Client) waitBandwidth(ctx context.Context, n int) error {
+	t := c.throttle
+	t.mu.Lock()
+	limit := t.bandwidthLimit(c)
+	if limit <= 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if !t.last.IsZero() {
+		t.tokens = min(t.tokens+now.Sub(t.last).Seconds()*float64(limit), float64(limit*bandwidthBurst))
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	delay := time.Duration(-t.tokens / float64(limit) * float64(time.Second))
+	t.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedReader paces the reads of the content of a file to the bandwidth
+// limit of the client.
+type limitedReader struct {
+	ctx context.Context
+	c   *Client
+	r   io.Reader
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	n, err := l.r.Read(b)
+	if n > 0 {
+		if waitErr := l.c.waitBandwidth(l.ctx, n); err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// workerPool runs the workers of a download, whose number follows the
+// concurrency of the client while it runs.
+type workerPool struct {
+	work func(retire func() bool) bool // runs a worker, reporting whether it retired
+
+	mu      sync.Mutex
+	target  int  // number of workers wanted
+	running int  // number of workers running
+	drained bool // set once a worker found no more work
+	wg      sync.WaitGroup
+}
+
+// startWorkers starts the workers of a download, each running work until it
+// returns. work calls retire before taking a file, and returns true if it
+// reports that the pool shrank, or false once there is no more work.
+func (c *Client) startWorkers(work func(retire func() bool) bool) *workerPool {
+	p := &workerPool{work: work}
+	t := c.throttle
+	t.mu.Lock()
+	if t.pools == nil {
+		t.pools = make(map[*workerPool]bool)
+	}
+	t.pools[p] = true
+	t.mu.Unlock()
+	p.resize(c.concurrency())
+	return p
+}
+
+// waitWorkers waits for the workers of p to return and stops resizing it
+// with the concurrency of the client.
+func (c *Client) waitWorkers(p *workerPool) {
+	p.wg.Wait()
+	t := c.throttle
+	t.mu.Lock()
+	delete(t.pools, p)
+	t.mu.Unlock()
+}
+
+// resize starts workers until n are running; workers beyond n stop once they
+// finish their current file.
+func (p *workerPool) resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.target = max(n, 1)
+	for ; p.running < p.target && !p.drained; p.running++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if !p.work(p.retire) {
+				p.mu.Lock()
+				p.drained = true
+				p.mu.Unlock()
+			}
+		}()
+	}
+}
+
+// retire reports whether the calling worker is to stop because the pool
+// shrank, in which case it is no longer counted.
+func (p *workerPool) retire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running <= p.target {
+		return false
+	}
+	p.running--
+	return true
+}
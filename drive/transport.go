@@ -0,0 +1,101 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// quotaUserKey is the context key of the quotaUser set by WithQuotaUser.
+type quotaUserKey struct{}
+
+// WithQuotaUser returns a context whose requests are sent with quotaUser
+// instead of the client's QuotaUser. A server downloading for several
+// tenants with one client gives each tenant's downloads their own quotaUser,
+// so that per-user rate limits apply to each tenant and one tenant's large
+// download cannot exhaust the quota of the project for the others.
+func WithQuotaUser(ctx context.Context, quotaUser string) context.Context {
+	return context.WithValue(ctx, quotaUserKey{}, quotaUser)
+}
+
+// contextQuotaUser returns the quotaUser requests made with ctx are sent
+// with by c.
+func (c *Client) contextQuotaUser(ctx context.Context) string {
+	if user, ok := ctx.Value(quotaUserKey{}).(string); ok {
+		return user
+	}
+	return c.QuotaUser
+}
+
+// clientTransport is the http.RoundTripper through which a client sends its
+// requests. It counts them, their errors and the bytes received in the
+// client's Stats, applies the client's API key, UserAgent, QuotaUser (or that
+// of the request's context) and QuotaProject, and logs them if the client's
+// Debug asks for it.
+type clientTransport struct {
+	base   http.RoundTripper
+	client *Client
+}
+
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.client
+	if c.Stats != nil {
+		c.Stats.add(apiCallKind(req))
+	}
+	quotaUser := c.contextQuotaUser(req.Context())
+	if c.apiKey == "" && c.UserAgent == "" && quotaUser == "" && c.QuotaProject == "" {
+		return t.send(req)
+	}
+
+	// A RoundTripper must not modify the request it was given.
+	req = req.Clone(req.Context())
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if c.apiKey != "" || quotaUser != "" {
+		query := req.URL.Query()
+		if c.apiKey != "" {
+			query.Set("key", c.apiKey)
+		}
+		if quotaUser != "" {
+			query.Set("quotaUser", quotaUser)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	if c.QuotaProject != "" {
+		req.Header.Set("X-Goog-User-Project", c.QuotaProject)
+	}
+	return t.send(req)
+}
+
+// send passes a request on to the base transport.
+func (t *clientTransport) send(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	if t.client.Debug&(DebugAPI|DebugHTTP) != 0 {
+		resp, err = t.client.debugRoundTrip(t.base, req)
+	} else {
+		resp, err = t.base.RoundTrip(req)
+	}
+	if stats := t.client.Stats; stats != nil {
+		if err != nil || resp.StatusCode >= http.StatusBadRequest {
+			stats.addError()
+		}
+		if err == nil {
+			resp.Body = &countingBody{ReadCloser: resp.Body, stats: stats}
+		}
+	}
+	return resp, err
+}
+
+// countingBody counts the bytes read from a response body in APIStats.
+type countingBody struct {
+	io.ReadCloser
+	stats *APIStats
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.stats.addReceived(int64(n))
+	return n, err
+}
@@ -0,0 +1,38 @@
+package drive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatBytes renders a byte count using binary units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ParseByteSize parses a size such as "4G", "700MiB" or "512k" using binary
+// units. A plain number is a number of bytes.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	upper := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	multiplier := int64(1)
+	if i := strings.IndexAny(upper, "KMGTPE"); i >= 0 && i == len(upper)-1 {
+		multiplier = 1 << (10 * (strings.IndexByte("KMGTPE", upper[i]) + 1))
+		upper = upper[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
@@ -0,0 +1,67 @@
+package drive
+
+import (
+	"fmt"
+	"path/filepath"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// verifyJob is a downloaded file waiting for its checksum to be computed and
+// verified.
+type verifyJob struct {
+	entry ManifestEntry
+	file  *drivev3.File
+}
+
+// verifyFile hashes a file saved without a checksum and checks it. The
+// SHA-256 checksum of files Drive reports one for is computed too, from the
+// saved file rather than from the content received.
+func (c *Client) verifyFile(d *download, job verifyJob) error {
+	localPath := filepath.Join(d.root, filepath.FromSlash(job.entry.Path))
+	var size int64
+	var sum string
+	var err error
+	if job.entry.SHA256 != "" {
+		size, sum, job.entry.SHA256, err = hashFileSHA256(localPath)
+	} else {
+		size, sum, err = hashFile(localPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify file: %w", err)
+	}
+	if size != job.entry.Size {
+		return fmt.Errorf("size mismatch for %s: wrote %d bytes, found %d", job.file.Name, job.entry.Size, size)
+	}
+	job.entry.MD5 = sum
+	return c.checkFile(d, job.entry, job.file)
+}
+
+// Names of the checksums reported by Drive that files are verified against,
+// recorded as ManifestEntry.Checksum.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumMD5    = "md5"
+)
+
+// checkFile compares the checksum of a saved file with the one reported by
+// Drive, its SHA-256 checksum if Drive reports one and its MD5 checksum
+// otherwise, and records the file in the manifest if they match.
+func (c *Client) checkFile(d *download, entry ManifestEntry, file *drivev3.File) error {
+	switch {
+	case isGoogleDoc(file):
+	case file.Sha256Checksum != "":
+		if entry.SHA256 != file.Sha256Checksum {
+			return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", file.Name, file.Sha256Checksum, entry.SHA256)
+		}
+		entry.Checksum = ChecksumSHA256
+	case file.Md5Checksum != "":
+		if entry.MD5 != file.Md5Checksum {
+			return fmt.Errorf("checksum mismatch for %s: expected md5 %s, got %s", file.Name, file.Md5Checksum, entry.MD5)
+		}
+		entry.Checksum = ChecksumMD5
+	}
+	c.debugf(DebugDownloader, "Completed %s (%s, md5 %s)", entry.Path, FormatBytes(entry.Size), entry.MD5)
+	d.record(entry)
+	return nil
+}
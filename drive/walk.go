@@ -0,0 +1,524 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// listAttempts is the number of times a folder spanning several pages is
+// listed before an inconsistent listing is accepted.
+const listAttempts = 3
+
+// folderAttempts is the number of times listing a folder is attempted before
+// its subtree is given up, and folderRetryDelay the delay before the first
+// retry, doubled before each further one.
+const (
+	folderAttempts   = 3
+	folderRetryDelay = time.Second
+)
+
+// ErrFolderListing is wrapped by the failures of folders that could not be
+// listed, whose content was therefore not downloaded.
+var ErrFolderListing = errors.New("folder could not be listed")
+
+// WalkError is returned when some subfolders could not be listed despite
+// retries. The rest of the folder was walked.
+type WalkError struct {
+	Folders []Failure
+}
+
+func (e *WalkError) Error() string {
+	return fmt.Sprintf("%d folder(s) could not be listed", len(e.Folders))
+}
+
+// ListChildren lists the immediate children of a Google Drive folder,
+// following pagination until every page has been retrieved. Files outside
+// the client's time and owner filters are left out; subfolders are always
+// listed.
+//
+// Listings of very large folders occasionally repeat or skip items across
+// pages. Pages are therefore requested in a stable order and de-duplicated,
+// and a listing spanning several pages is checked against a recount of the
+// folder's file IDs and the missing files listed again if the two disagree.
+func (c *Client) ListChildren(ctx context.Context, folderID string) ([]*drivev3.File, error) {
+	var files []*drivev3.File
+	err := c.streamChildren(ctx, folderID, nil, func(page []*drivev3.File) error {
+		files = append(files, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// listCursor records how far the listing of a folder got, so that listing it
+// again after a failure resumes from the page that failed rather than from
+// the first one.
+type listCursor struct {
+	listed    map[string]bool // IDs of the files passed on
+	pageToken string          // token of the next page to retrieve, empty for the first
+	pages     int             // number of pages retrieved
+	complete  bool            // set once the last page was retrieved
+}
+
+// streamChildren lists the immediate children of a folder like ListChildren,
+// passing them to fn a page at a time instead of holding the whole listing in
+// memory. Every file is passed once; files found missing by the recount are
+// passed after the others. If cursor is not nil, the listing resumes from it
+// and it records the progress of the listing, for a call listing the folder
+// again after an error to carry on where this one failed.
+func (c *Client) streamChildren(ctx context.Context, folderID string, cursor *listCursor, fn func(page []*drivev3.File) error) error {
+	if cursor == nil {
+		cursor = &listCursor{}
+	}
+	if cursor.listed == nil {
+		cursor.listed = make(map[string]bool)
+	}
+	emit := func(page []*drivev3.File) error {
+		var fresh []*drivev3.File
+		for _, file := range page {
+			if !cursor.listed[file.Id] {
+				cursor.listed[file.Id] = true
+				fresh = append(fresh, file)
+			}
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+		return fn(fresh)
+	}
+
+	filter := c.fileFilter()
+	if c.anonymous() {
+		if filter != "" {
+			return fmt.Errorf("filters are %w", ErrAnonymous)
+		}
+		files, err := c.listPublicFolder(ctx, folderID)
+		if err != nil {
+			return err
+		}
+		return emit(files)
+	}
+	query := fmt.Sprintf("'%s' in parents and trashed = false", folderID)
+	if filter != "" {
+		query += fmt.Sprintf(" and (mimeType = '%s' or (%s))", folderMimeType, filter)
+	}
+
+	if !cursor.complete {
+		if cursor.pageToken != "" {
+			c.debugf(DebugWalker, "Resuming the listing of folder %s at page %d", folderID, cursor.pages+1)
+		}
+		pages, err := c.listPages(ctx, query, fileFields, &cursor.pageToken, emit)
+		cursor.pages += pages
+		if err != nil {
+			return err
+		}
+		cursor.complete = true
+	}
+	if cursor.pages == 1 {
+		return nil
+	}
+	listed := cursor.listed
+	c.debugf(DebugWalker, "Folder %s spans %d pages, recounting its files", folderID, cursor.pages)
+
+	for attempt := 1; ; attempt++ {
+		counted := make(map[string]bool, len(listed))
+		_, err := c.listPages(ctx, query, "id", nil, func(page []*drivev3.File) error {
+			for _, file := range page {
+				counted[file.Id] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		missing := 0
+		for id := range counted {
+			if !listed[id] {
+				missing++
+			}
+		}
+		if missing == 0 && len(counted) == len(listed) {
+			return nil
+		}
+		if attempt == listAttempts {
+			c.logf("Warning: listing of folder %s is inconsistent (%d files listed, %d counted, %d missing)", folderID, len(listed), len(counted), missing)
+			return nil
+		}
+		c.logf("Listing of folder %s is inconsistent (%d files listed, %d counted, %d missing), listing it again", folderID, len(listed), len(counted), missing)
+		if _, err := c.listPages(ctx, query, fileFields, nil, emit); err != nil {
+			return err
+		}
+	}
+}
+
+// listPages retrieves every file matching query with the given fields,
+// following pagination and passing each page to fn as it arrives. It returns
+// the number of pages retrieved. If pageToken is not nil, the listing starts
+// from the page it holds, if any, and it is updated with the token of the next
+// page once fn handled a page.
+func (c *Client) listPages(ctx context.Context, query, fields string, pageToken *string, fn func(page []*drivev3.File) error) (int, error) {
+	call := c.Service.Files.List().Q(query).OrderBy("createdTime,name").PageSize(1000).
+		Fields(googleapi.Field("nextPageToken, files(" + fields + ")")).Context(ctx)
+	if len(c.Spaces) > 0 {
+		call.Spaces(strings.Join(c.Spaces, ","))
+	}
+	if pageToken != nil && *pageToken != "" {
+		call.PageToken(*pageToken)
+	}
+
+	for pages := 0; ; {
+		fileList, err := call.Do()
+		if err != nil {
+			return pages, fmt.Errorf("failed to retrieve files: %w", err)
+		}
+		pages++
+		if err := fn(fileList.Files); err != nil {
+			return pages, err
+		}
+		if fileList.NextPageToken == "" {
+			return pages, nil
+		}
+		call.PageToken(fileList.NextPageToken)
+		if pageToken != nil {
+			*pageToken = fileList.NextPageToken
+		}
+	}
+}
+
+// Spaces that can be listed; see Client.Spaces.
+var spaces = []string{"drive", "photos", AppDataFolder}
+
+// ParseSpaces parses a comma-separated list of Drive spaces ("drive",
+// "photos" or "appDataFolder").
+func ParseSpaces(s string) ([]string, error) {
+	var parsed []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, space := range spaces {
+			if strings.EqualFold(name, space) {
+				parsed = append(parsed, space)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown space %q", name)
+		}
+	}
+	return parsed, nil
+}
+
+// fileFilter returns the Drive query terms selecting the files within the
+// client's time, owner, property and label filters, or "" if none is set.
+func (c *Client) fileFilter() string {
+	var terms []string
+	for _, filter := range []struct {
+		term string
+		t    time.Time
+	}{
+		{"modifiedTime > '%s'", c.ModifiedAfter},
+		{"modifiedTime < '%s'", c.ModifiedBefore},
+		{"createdTime > '%s'", c.CreatedAfter},
+	} {
+		if !filter.t.IsZero() {
+			terms = append(terms, fmt.Sprintf(filter.term, filter.t.UTC().Format(time.RFC3339)))
+		}
+	}
+	if c.Owner != "" {
+		terms = append(terms, fmt.Sprintf("'%s' in owners", queryEscape(c.Owner)))
+	}
+	if c.NotOwner != "" {
+		terms = append(terms, fmt.Sprintf("not '%s' in owners", queryEscape(c.NotOwner)))
+	}
+	terms = append(terms, c.metadataTerms()...)
+	return strings.Join(terms, " and ")
+}
+
+// queryEscape escapes a string for use in a quoted Drive query value.
+func queryEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// walkFunc is called by walk for every file and folder, with its local path
+// relative to the walk root named the way DownloadFolder names it. It may be
+// called from several goroutines at once.
+type walkFunc func(item DriveItem) error
+
+// walk recursively lists a folder, calling fn for every file and folder below
+// it. Up to Concurrency folders are listed at the same time. A folder is
+// reported before its contents; shortcuts, items rejected by the client's
+// Filter and folders more than MaxDepth levels deep are skipped. A folder
+// found again, in a cycle of folders or below a second parent, is skipped
+// with a warning rather than walked again. The first
+// error returned by fn stops the walk.
+//
+// A subfolder whose listing keeps failing after folderAttempts attempts is
+// skipped with its subtree while the walk continues elsewhere; such folders
+// are reported through a *WalkError at the end. Failing to list the root
+// folder stops the walk.
+//
+// Listings are streamed a page at a time, and folders waiting to be listed
+// are kept on a stack rather than each holding a goroutine, so memory stays
+// bounded by the width of the tree rather than its size. If fn blocks, the
+// walk waits for it: this is how the download queue applies backpressure.
+func (c *Client) walk(ctx context.Context, folderID string, fn walkFunc) error {
+	return c.walkShortened(ctx, folderID, nil, nil, fn)
+}
+
+// walkShortened walks a folder like walk, shortening the local names that
+// short, if not nil, says are too long, and skipping the paths that rules,
+// if not nil, leave out.
+func (c *Client) walkShortened(ctx context.Context, folderID string, short *shortNames, rules *dirRules, fn walkFunc) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	w := &walker{
+		c: c, ctx: ctx, cancel: cancel, fn: fn, short: short, rules: rules,
+		pending: []folderJob{{id: folderID, parents: []string{folderID}}},
+		visited: map[string]bool{folderID: true},
+	}
+	w.cond = sync.NewCond(&w.mu)
+	stop := context.AfterFunc(ctx, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.cond.Broadcast()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(c.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := w.next()
+				if !ok {
+					return
+				}
+				if err := w.walkFolder(job); err != nil {
+					w.cancel(err)
+				}
+				w.finished()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+	if len(w.failed) > 0 {
+		return &WalkError{Folders: w.failed}
+	}
+	return nil
+}
+
+// Walk recursively lists a Drive folder like DownloadFolder does, calling fn
+// for every file and folder below it with the local path it is downloaded
+// to. Items are reported as they are found, from several goroutines at once;
+// a folder is reported before its content. Subfolders that could not be
+// listed are reported through a *WalkError.
+func (c *Client) Walk(ctx context.Context, folderID string, fn func(item DriveItem) error) error {
+	return c.walk(ctx, folderID, fn)
+}
+
+// folderJob is a folder waiting to be listed.
+type folderJob struct {
+	id      string
+	relPath string
+	depth   int
+	parents []string // IDs of the folders from the root down to this one
+}
+
+// walker holds the state of a walk.
+type walker struct {
+	c      *Client
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	fn     walkFunc
+	short  *shortNames // shortens names of paths too long, if set
+	rules  *dirRules   // limits the paths walked, if set
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []folderJob     // folders waiting to be listed, listed last in first out
+	active  int             // folders being listed
+	failed  []Failure       // subfolders that could not be listed
+	visited map[string]bool // IDs of the folders found so far
+}
+
+// next takes the next folder to list, waiting while folders being listed may
+// still add subfolders. It returns false once the walk is over.
+func (w *walker) next() (folderJob, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) == 0 && w.active > 0 && w.ctx.Err() == nil {
+		w.cond.Wait()
+	}
+	if len(w.pending) == 0 || w.ctx.Err() != nil {
+		return folderJob{}, false
+	}
+	job := w.pending[len(w.pending)-1]
+	w.pending = w.pending[:len(w.pending)-1]
+	w.active++
+	return job, true
+}
+
+// push adds a folder to list.
+func (w *walker) push(job folderJob) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, job)
+	w.cond.Signal()
+}
+
+// visit records that a folder was found, and reports whether it was the
+// first time.
+func (w *walker) visit(folderID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.visited[folderID] {
+		return false
+	}
+	w.visited[folderID] = true
+	return true
+}
+
+// finished records that a folder taken by next has been listed.
+func (w *walker) finished() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.active--
+	w.cond.Broadcast()
+}
+
+// walkFolder lists a folder, reporting its files and adding its subfolders to
+// the stack of folders to list.
+func (w *walker) walkFolder(job folderJob) error {
+	names := w.c.newFolderNames()
+	visit := func(file *drivev3.File, name string) error {
+		if file.MimeType == shortcutMimeType {
+			return nil
+		}
+		isFolder := file.MimeType == folderMimeType
+		if isFolder && w.c.MaxDepth >= 0 && job.depth >= w.c.MaxDepth {
+			w.c.logf("Skipping folder (maximum depth reached): %s", file.Name)
+			return nil
+		}
+
+		if w.short != nil {
+			if short, ok := w.short.fit(file, name, job.relPath); ok {
+				w.c.debugf(DebugWalker, "Shortened %s to %s", path.Join(job.relPath, name), short)
+				name = short
+			}
+		}
+		item := newDriveItem(file, name, job.relPath, job.parents)
+		item.CaseClash = names.clash(file.Id)
+		if w.c.Filter != nil && !w.c.Filter(item) {
+			w.c.debugf(DebugWalker, "Filtered out: %s", item.Path)
+			return nil
+		}
+		if w.rules.skip(item.Path, isFolder) {
+			w.c.debugf(DebugWalker, "Left out by the rules of the download directory: %s", item.Path)
+			return nil
+		}
+		if isFolder && !w.visit(file.Id) {
+			if slices.Contains(job.parents, file.Id) {
+				w.c.logf("Warning: skipping folder %s, which contains itself", path.Join("/", item.Path))
+			} else {
+				w.c.logf("Warning: skipping folder %s, already found at another path", path.Join("/", item.Path))
+			}
+			return nil
+		}
+		if err := w.fn(item); err != nil {
+			return err
+		}
+		if isFolder {
+			parents := append(slices.Clip(job.parents), file.Id)
+			w.push(folderJob{id: file.Id, relPath: item.Path, depth: job.depth + 1, parents: parents})
+		}
+		return nil
+	}
+
+	// A retried listing resumes from the page that failed, and never passes
+	// the files already visited again.
+	cursor := &listCursor{}
+	listed := 0
+	var visitErr error
+	for attempt, delay := 1, folderRetryDelay; ; attempt, delay = attempt+1, delay*2 {
+		w.c.debugf(DebugWalker, "Listing folder %s (%s, depth %d)", job.id, path.Join("/", job.relPath), job.depth)
+		err := w.c.streamChildren(w.ctx, job.id, cursor, func(page []*drivev3.File) error {
+			listed += len(page)
+			w.c.debugf(DebugWalker, "Folder %s: %d items listed so far", job.id, listed)
+			for _, file := range page {
+				if name, ok := names.add(w.ctx, file); ok {
+					if visitErr = visit(file, name); visitErr != nil {
+						return visitErr
+					}
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			break
+		}
+		if visitErr != nil || w.ctx.Err() != nil {
+			return err
+		}
+		if attempt < folderAttempts && transientError(err) {
+			w.c.logf("Failed to list folder %s, retrying in %s: %v", path.Join("/", job.relPath), delay, err)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-w.ctx.Done():
+				return w.ctx.Err()
+			}
+		}
+		if job.relPath == "" {
+			return err
+		}
+		w.c.logf("Failed to list folder %s, skipping it: %v", path.Join("/", job.relPath), err)
+		w.mu.Lock()
+		w.failed = append(w.failed, Failure{ID: job.id, Path: job.relPath, Err: fmt.Errorf("%w: %v", ErrFolderListing, err)})
+		w.mu.Unlock()
+		return nil
+	}
+	for _, doc := range names.flush() {
+		if err := visit(doc.file, doc.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transientError reports whether a failed request may succeed if retried:
+// rate limiting, server errors and errors that are not HTTP responses, such
+// as dropped connections.
+func transientError(err error) bool {
+	if errors.Is(err, ErrAnonymous) {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+			return true
+		}
+	}
+	return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+}
@@ -0,0 +1,60 @@
+package drive
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	drivev3 "google.golang.org/api/drive/v3"
+)
+
+// SidecarExtension is appended to the name of a photo or video to name the
+// XMP sidecar written next to it when Sidecars is set.
+const SidecarExtension = ".xmp"
+
+// isMedia reports whether a file is a photo or video that gets an XMP
+// sidecar.
+func isMedia(file *drivev3.File) bool {
+	return strings.HasPrefix(file.MimeType, "image/") || strings.HasPrefix(file.MimeType, "video/")
+}
+
+// writeSidecar saves an XMP sidecar recording the Drive metadata of a photo
+// or video saved at relPath: its description, creation and modification
+// times, Drive file ID and original path in the folder. Photo managers read
+// sidecars when importing, so the metadata survives without modifying the
+// downloaded file, which would break its checksum.
+func (c *Client) writeSidecar(d *download, file *drivev3.File, relPath string, modTime time.Time) error {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>` + "\n")
+	buf.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	buf.WriteString(` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	buf.WriteString(`  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/">` + "\n")
+	writeXMPProperty(&buf, "xmp:CreateDate", file.CreatedTime)
+	writeXMPProperty(&buf, "xmp:ModifyDate", file.ModifiedTime)
+	writeXMPProperty(&buf, "dc:identifier", file.Id)
+	writeXMPProperty(&buf, "dc:source", relPath)
+	if file.Description != "" {
+		buf.WriteString("   <dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">")
+		xml.EscapeText(&buf, []byte(file.Description))
+		buf.WriteString("</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	buf.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	buf.WriteString(`<?xpacket end="w"?>` + "\n")
+
+	if _, _, err := d.sink.Save(relPath+SidecarExtension, modTime, &buf); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return nil
+}
+
+// writeXMPProperty writes a simple XMP property, unless value is empty.
+func writeXMPProperty(buf *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(buf, "   <%s>", name)
+	xml.EscapeText(buf, []byte(value))
+	fmt.Fprintf(buf, "</%s>\n", name)
+}
@@ -1,9 +1,11 @@
-module drive-downloader
+module github.com/rgsuhas/drive-downloader
 
 go 1.23.2
 
 require (
 	golang.org/x/oauth2 v0.23.0
+	golang.org/x/sys v0.26.0
+	golang.org/x/text v0.19.0
 	google.golang.org/api v0.205.0
 )
 
@@ -26,8 +28,6 @@ require (
 	go.opentelemetry.io/otel/trace v1.29.0 // indirect
 	golang.org/x/crypto v0.28.0 // indirect
 	golang.org/x/net v0.30.0 // indirect
-	golang.org/x/sys v0.26.0 // indirect
-	golang.org/x/text v0.19.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241021214115-324edc3d5d38 // indirect
 	google.golang.org/grpc v1.67.1 // indirect
 	google.golang.org/protobuf v1.35.1 // indirect
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// runHook runs a -pre-cmd, -post-cmd or -on-failure-cmd command through the
+// system shell, with env added to its environment and its output sent to the
+// logger. An empty command does nothing.
+func runHook(ctx context.Context, command string, env []string, logger *log.Logger) error {
+	if command == "" {
+		return nil
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = logger.Writer()
+	cmd.Stderr = logger.Writer()
+	return cmd.Run()
+}
+
+// jobEnv returns the environment variables describing a download to hooks.
+// Before the download starts, summary is nil and only the folder and the
+// destination are described.
+func jobEnv(folderID string, settings *downloadSettings, summary *jobSummary) []string {
+	dest := settings.dest
+	if settings.archive != "" {
+		dest = settings.archive
+	}
+	env := []string{
+		"DRIVE_FOLDER_ID=" + folderID,
+		"DRIVE_DEST=" + dest,
+	}
+	if summary == nil {
+		return env
+	}
+
+	env = append(env,
+		"DRIVE_STATUS="+summary.Status,
+		"DRIVE_FILES="+strconv.FormatInt(summary.Files, 10),
+		"DRIVE_BYTES="+strconv.FormatInt(summary.Bytes, 10),
+		"DRIVE_FAILED="+strconv.Itoa(len(summary.Failures)),
+		"DRIVE_API_CALLS="+strconv.FormatInt(summary.APICalls, 10),
+		fmt.Sprintf("DRIVE_DURATION=%.0f", summary.Duration),
+	)
+	if summary.Error != "" {
+		env = append(env, "DRIVE_ERROR="+summary.Error)
+	}
+	return env
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// A command defines the flags of a subcommand on a new flag set and returns
+// it together with the function running the subcommand once they are parsed.
+type command func() (*flag.FlagSet, func())
+
+// commands maps subcommand names to their implementations. Running the tool
+// without a subcommand downloads a folder.
+var commands = map[string]command{
+	"apply":       applyCommand,
+	"auth":        authCommand,
+	"bundle":      bundleCommand,
+	"calibrate":   calibrateCommand,
+	"check":       checkCommand,
+	"coordinate":  coordinateCommand,
+	"copy":        copyCommand,
+	"diff":        diffCommand,
+	"info":        infoCommand,
+	"inventory":   inventoryCommand,
+	"job":         jobCommand,
+	"ls":          lsCommand,
+	"plan":        planCommand,
+	"repair":      repairCommand,
+	"self-update": selfUpdateCommand,
+	"work":        workCommand,
+}
+
+// credentialsFlag registers the -credentials flag on fs.
+func credentialsFlag(fs *flag.FlagSet) *string {
+	return fs.String("credentials", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "service account credentials: a key file, env:VAR, keychain:SERVICE/ACCOUNT, sm://PROJECT/SECRET or profile:NAME")
+}
+
+// endpointEnv names the environment variable overriding the base URL of the
+// Drive API, for mock servers and API gateways.
+const endpointEnv = "DRIVE_API_ENDPOINT"
+
+// newClient creates a Drive client authenticating with the credentials
+// given by the -credentials flag, with any further options. It sends its
+// requests to the endpoint named by DRIVE_API_ENDPOINT, if set.
+func newClient(credentials string, opts ...drive.Option) (*drive.Client, error) {
+	ctx := context.Background()
+	option, err := credentialsOption(ctx, credentials, "")
+	if err != nil {
+		return nil, err
+	}
+	return drive.NewClient(ctx, append([]drive.Option{option, drive.WithEndpoint(os.Getenv(endpointEnv))}, opts...)...)
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			fs, run := command()
+			fs.Parse(os.Args[2:])
+			run()
+			return
+		}
+	}
+
+	if err := runDownload(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
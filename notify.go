@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// jobSummary describes a finished download to hooks and notifications.
+type jobSummary struct {
+	Status   string       `json:"status"` // "success" or "failure"
+	FolderID string       `json:"folder_id"`
+	Dest     string       `json:"dest"`
+	Files    int64        `json:"files"`
+	Bytes    int64        `json:"bytes"`
+	APICalls int64        `json:"api_calls"`
+	Duration float64      `json:"duration_seconds"`
+	Error    string       `json:"error,omitempty"`
+	Failures []jobFailure `json:"failures,omitempty"`
+}
+
+// jobFailure is a file that could not be downloaded.
+type jobFailure struct {
+	ID    string `json:"id"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	Cause string `json:"cause"`
+}
+
+// newJobSummary summarizes a download of folderID that took duration and
+// ended with err.
+func newJobSummary(folderID string, settings *downloadSettings, stats *drive.APIStats, duration time.Duration, err error) *jobSummary {
+	summary := &jobSummary{
+		Status:   "success",
+		FolderID: folderID,
+		Dest:     settings.dest,
+		Files:    stats.Files(),
+		Bytes:    stats.Bytes(),
+		APICalls: stats.Total(),
+		Duration: duration.Seconds(),
+	}
+	if settings.archive != "" {
+		summary.Dest = settings.archive
+	}
+	if err != nil {
+		summary.Status, summary.Error = "failure", err.Error()
+		var downloadErr *drive.DownloadError
+		if errors.As(err, &downloadErr) {
+			for _, failure := range downloadErr.Failures {
+				summary.Failures = append(summary.Failures, jobFailure{ID: failure.ID, Path: failure.Path, Error: failure.Err.Error(), Cause: failure.Cause().String()})
+			}
+		}
+	}
+	return summary
+}
+
+// notify sends the summary of a download to the webhook and email address
+// given by settings, if any.
+func notify(ctx context.Context, settings *downloadSettings, summary *jobSummary) error {
+	var errs []error
+	if settings.notifyWebhook != "" {
+		if err := postWebhook(ctx, settings.notifyWebhook, summary); err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify webhook: %w", err))
+		}
+	}
+	if settings.notifyEmail != "" {
+		if err := sendEmail(settings, summary); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send email: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postWebhook posts the summary as JSON to url.
+func postWebhook(ctx context.Context, url string, summary *jobSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return nil
+}
+
+// sendEmail mails the summary through the SMTP server given by settings,
+// authenticating with -smtp-user and the SMTP_PASSWORD environment variable
+// if a user is given.
+func sendEmail(settings *downloadSettings, summary *jobSummary) error {
+	host, _, err := net.SplitHostPort(settings.smtpServer)
+	if err != nil {
+		return fmt.Errorf("invalid -smtp-server: %w", err)
+	}
+	var auth smtp.Auth
+	if settings.smtpUser != "" {
+		auth = smtp.PlainAuth("", settings.smtpUser, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	from := settings.smtpFrom
+	if from == "" {
+		from = settings.smtpUser
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", settings.notifyEmail)
+	fmt.Fprintf(&msg, "Subject: Drive download %s: %s\r\n", summary.Status, summary.Dest)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Folder:    %s\r\n", summary.FolderID)
+	fmt.Fprintf(&msg, "Dest:      %s\r\n", summary.Dest)
+	fmt.Fprintf(&msg, "Status:    %s\r\n", summary.Status)
+	fmt.Fprintf(&msg, "Files:     %d (%s)\r\n", summary.Files, drive.FormatBytes(summary.Bytes))
+	fmt.Fprintf(&msg, "Duration:  %s\r\n", time.Duration(summary.Duration*float64(time.Second)).Round(time.Second))
+	if summary.Error != "" {
+		fmt.Fprintf(&msg, "Error:     %s\r\n", summary.Error)
+	}
+	if len(summary.Failures) > 0 {
+		fmt.Fprintf(&msg, "\r\nFailed files:\r\n")
+		for _, failure := range summary.Failures {
+			fmt.Fprintf(&msg, "  %s: %s\r\n", failure.Path, failure.Error)
+		}
+	}
+	return smtp.SendMail(settings.smtpServer, auth, from, strings.Split(settings.notifyEmail, ","), []byte(msg.String()))
+}
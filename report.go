@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// reportFormat returns the format of the report written to path, chosen by
+// its extension: "junit" for .xml and "markdown" for .md.
+func reportFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		return "junit", nil
+	case ".md", ".markdown":
+		return "markdown", nil
+	}
+	return "", fmt.Errorf("unknown report format of %s: use a .xml (JUnit) or .md (Markdown) file", path)
+}
+
+// writeReports writes the summary of a download to the -report files given
+// by settings. The files that were downloaded are read from the manifest of
+// the destination, as the summary only lists those that failed.
+func writeReports(settings *downloadSettings, summary *jobSummary) error {
+	if len(settings.reports) == 0 {
+		return nil
+	}
+	var files []drive.ManifestEntry
+	if settings.archive == "" {
+		if m, err := drive.LoadManifest(filepath.Join(settings.dest, drive.ManifestName)); err == nil {
+			files = m.Files
+		}
+	}
+	var errs []error
+	for _, path := range settings.reports {
+		format, err := reportFormat(path)
+		if err == nil {
+			var data []byte
+			if format == "junit" {
+				data, err = junitReport(summary, files)
+			} else {
+				data = markdownReport(summary)
+			}
+			if err == nil {
+				err = os.WriteFile(path, data, 0o644)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to write report: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// junitSuite is the JUnit XML test suite a download is reported as, with a
+// test case per file, so that CI systems show failed files as failed tests.
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport renders the summary as a JUnit XML test suite. The files of
+// the manifest that did not fail are passed test cases; a download that
+// failed as a whole, rather than file by file, is a single failed test case.
+func junitReport(summary *jobSummary, files []drive.ManifestEntry) ([]byte, error) {
+	suite := junitSuite{Name: "drive-downloader " + summary.FolderID, Time: summary.Duration}
+	failed := make(map[string]bool, len(summary.Failures))
+	for _, failure := range summary.Failures {
+		failed[failure.Path] = true
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      failure.Path,
+			ClassName: summary.Dest,
+			Failure:   &junitFailure{Message: failure.Error, Type: failure.Cause, Text: failure.ID + ": " + failure.Error},
+		})
+	}
+	for _, entry := range files {
+		if !failed[entry.Path] {
+			suite.Cases = append(suite.Cases, junitCase{Name: entry.Path, ClassName: summary.Dest})
+		}
+	}
+	if summary.Error != "" && len(summary.Failures) == 0 {
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      "download",
+			ClassName: summary.Dest,
+			Failure:   &junitFailure{Message: summary.Error, Type: "error", Text: summary.Error},
+		})
+	}
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// markdownReport renders the summary as Markdown, to be pasted into chat
+// messages or pull requests.
+func markdownReport(summary *jobSummary) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Drive download %s\n\n", summary.Status)
+	fmt.Fprintf(&b, "| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Folder | `%s` |\n", summary.FolderID)
+	fmt.Fprintf(&b, "| Destination | `%s` |\n", summary.Dest)
+	fmt.Fprintf(&b, "| Files | %d (%s) |\n", summary.Files, drive.FormatBytes(summary.Bytes))
+	fmt.Fprintf(&b, "| Failed | %d |\n", len(summary.Failures))
+	fmt.Fprintf(&b, "| API calls | %d |\n", summary.APICalls)
+	fmt.Fprintf(&b, "| Duration | %s |\n", time.Duration(summary.Duration*float64(time.Second)).Round(time.Second))
+	if summary.Error != "" && len(summary.Failures) == 0 {
+		fmt.Fprintf(&b, "\n**Error:** %s\n", markdownEscape(summary.Error))
+	}
+	if len(summary.Failures) > 0 {
+		fmt.Fprintf(&b, "\n### Failed files\n\n| File | Cause | Error |\n|---|---|---|\n")
+		for _, failure := range summary.Failures {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", markdownEscape(failure.Path), failure.Cause, markdownEscape(failure.Error))
+		}
+	}
+	return []byte(b.String())
+}
+
+// markdownEscape escapes the characters of s that would break a Markdown
+// table cell or be read as formatting.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "*", `\*`, "_", `\_`, "`", "\\`").Replace(s)
+}
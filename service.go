@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rgsuhas/drive-downloader/drive"
+)
+
+// serviceName identifies the tool to the system log and the Windows service
+// control manager.
+const serviceName = "drive-downloader"
+
+// serve runs the download command. With -watch it repeats the download at the
+// configured interval until ctx is cancelled, re-reading the command line and
+// configuration file whenever the process receives SIGHUP; a failed download
+// is logged and retried at the next interval instead of stopping the service.
+// A configuration reloaded while a download runs changes its -concurrency and
+// -bwlimit at once, so that operators can throttle it on the fly; its other
+// settings apply from the next download. One reloaded between downloads
+// starts the next download at once (see waitNextRun).
+func serve(ctx context.Context, args []string, logger *log.Logger) error {
+	settings, err := parseDownloadFlags(args)
+	if err != nil {
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	live := &liveClient{}
+	for {
+		done := make(chan error, 1)
+		go func(settings *downloadSettings) {
+			done <- downloadOnce(ctx, settings, logger, live)
+		}(settings)
+		var err error
+		for running := true; running; {
+			select {
+			case err = <-done:
+				running = false
+			case <-hup:
+				reloaded, reloadErr := parseDownloadFlags(args)
+				if reloadErr != nil {
+					logger.Printf("Failed to reload configuration, keeping the previous one: %v", reloadErr)
+					continue
+				}
+				settings = reloaded
+				if live.apply(settings) {
+					logger.Printf("Configuration reloaded: downloading %d files at a time, %s; the other settings apply from the next download.",
+						settings.concurrency, bandwidthText(settings.bandwidthLimit))
+				} else {
+					logger.Println("Configuration reloaded.")
+				}
+			}
+		}
+		if settings.watch <= 0 {
+			return err
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Printf("Download failed: %v", err)
+		}
+
+		var ok bool
+		if settings, ok = waitNextRun(ctx, hup, args, settings, time.Now(), logger); !ok {
+			return nil
+		}
+	}
+}
+
+// waitNextRun waits until the -watch interval of settings has passed since
+// end and returns the settings of the next download, or false once ctx is
+// cancelled. A signal on hup reloads the configuration and, as documented for
+// SIGHUP, starts the next download at once with it; a configuration that
+// fails to reload is reported and the wait goes on.
+func waitNextRun(ctx context.Context, hup <-chan os.Signal, args []string, settings *downloadSettings, end time.Time, logger *log.Logger) (*downloadSettings, bool) {
+	wait := time.NewTimer(time.Until(end.Add(settings.watch)))
+	defer wait.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-wait.C:
+			return settings, true
+		case <-hup:
+			reloaded, err := parseDownloadFlags(args)
+			if err != nil {
+				logger.Printf("Failed to reload configuration, keeping the previous one until the next download in %s: %v",
+					time.Until(end.Add(settings.watch)).Round(time.Second), err)
+				continue
+			}
+			logger.Println("Configuration reloaded: starting the next download now.")
+			return reloaded, true
+		}
+	}
+}
+
+// liveClient holds the client of the download in progress, if any, for the
+// limits of a reloaded configuration to apply to it.
+type liveClient struct {
+	mu     sync.Mutex
+	client *drive.Client
+}
+
+// set records the client of the download in progress, nil once it is over.
+func (l *liveClient) set(client *drive.Client) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.client = client
+}
+
+// apply changes the concurrency and bandwidth limit of the download in
+// progress to those of settings, and reports whether one is in progress.
+func (l *liveClient) apply(settings *downloadSettings) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.client == nil {
+		return false
+	}
+	l.client.SetConcurrency(settings.concurrency)
+	l.client.SetBandwidthLimit(settings.bandwidthLimit)
+	return true
+}
+
+// bandwidthText describes a bandwidth limit in bytes per second.
+func bandwidthText(limit int64) string {
+	if limit <= 0 {
+		return "without bandwidth limit"
+	}
+	return "at most " + drive.FormatBytes(limit) + "/s"
+}
+
+// writePidFile writes the ID of the current process to path.
+func writePidFile(path string) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write pidfile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/syslog"
+)
+
+// runService is only supported on Windows; elsewhere the tool is run as a
+// regular process by the service manager (e.g. a systemd unit).
+func runService(run func(ctx context.Context) error) error {
+	return errors.New("-run-as-service is only supported on Windows; run the command from a systemd unit instead")
+}
+
+// systemLogWriter returns a writer that logs to syslog, which systemd
+// forwards to the journal.
+func systemLogWriter() (io.Writer, error) {
+	return syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, serviceName)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWaitNextRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(`{"flags": {"watch": "300ms"}}`)
+	args := []string{"-config", path, "-folder", "FOLDER"}
+	settings, err := parseDownloadFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	hup := make(chan os.Signal, 1)
+	ctx := context.Background()
+
+	// A failed reload keeps the previous settings and the rest of the wait.
+	writeConfig(`{"flags": {"watch": "not a duration"}}`)
+	hup <- syscall.SIGHUP
+	end := time.Now()
+	next, ok := waitNextRun(ctx, hup, args, settings, end, logger)
+	if elapsed := time.Since(end); !ok || elapsed < 300*time.Millisecond {
+		t.Errorf("after a failed reload, the next run started after %v, want the 300ms interval", elapsed)
+	}
+	if next != settings {
+		t.Error("a failed reload replaced the settings")
+	}
+
+	// A successful reload starts the next run at once with the reloaded
+	// settings.
+	writeConfig(`{"flags": {"watch": "1h"}}`)
+	hup <- syscall.SIGHUP
+	next, ok = waitNextRun(ctx, hup, args, settings, time.Now(), logger)
+	if !ok || next.watch != time.Hour {
+		t.Errorf("after a reload, waitNextRun = %v, %v, want the reloaded settings", next, ok)
+	}
+
+	// Cancelling ends the wait.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, ok := waitNextRun(cancelled, hup, args, settings, time.Now(), logger); ok {
+		t.Error("waitNextRun went on after its context was cancelled")
+	}
+}
@@ -0,0 +1,76 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// runService runs under the Windows service control manager, cancelling the
+// context passed to run when the service is stopped.
+func runService(run func(ctx context.Context) error) error {
+	return svc.Run(serviceName, &serviceHandler{run: run})
+}
+
+// serviceHandler adapts run to the svc.Handler interface.
+type serviceHandler struct {
+	run func(ctx context.Context) error
+}
+
+// Execute implements svc.Handler.
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- h.run(ctx) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// systemLogWriter returns a writer that logs to the Windows event log. The
+// event source has to be registered once, e.g. with
+// "eventcreate /ID 1 /L APPLICATION /T INFORMATION /SO drive-downloader /D setup".
+func systemLogWriter() (io.Writer, error) {
+	l, err := eventlog.Open(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return eventLogWriter{l}, nil
+}
+
+// eventLogWriter writes each log line as an informational event.
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	if err := w.log.Info(1, strings.TrimRight(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}